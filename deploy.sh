@@ -38,8 +38,10 @@ echo ""
 
 # Deploy Claude Agent Proxy
 echo "📦 Deploying Claude Agent Proxy..."
+# Services are built from the repository root, since they use shared/utils
+gcloud builds submit . --config=cloudbuild.yaml --substitutions=_SERVICE=claude-agent-proxy --quiet
 gcloud run deploy claude-agent-proxy \
-  --source ./services/claude-agent-proxy \
+  --image=gcr.io/$PROJECT_ID/claude-agent-proxy \
   --region=$REGION \
   --platform=managed \
   --allow-unauthenticated \
@@ -62,8 +64,9 @@ echo ""
 
 # Deploy Broadcast Bot
 echo "📦 Deploying Broadcast Bot..."
+gcloud builds submit . --config=cloudbuild.yaml --substitutions=_SERVICE=broadcast-bot --quiet
 gcloud run deploy broadcast-bot \
-  --source ./services/broadcast-bot \
+  --image=gcr.io/$PROJECT_ID/broadcast-bot \
   --region=$REGION \
   --platform=managed \
   --allow-unauthenticated \
@@ -82,8 +85,9 @@ echo ""
 
 # Deploy Slack Events Listener
 echo "📦 Deploying Slack Events Listener..."
+gcloud builds submit . --config=cloudbuild.yaml --substitutions=_SERVICE=slack-events-listener --quiet
 gcloud run deploy slack-events-listener \
-  --source ./services/slack-events-listener \
+  --image=gcr.io/$PROJECT_ID/slack-events-listener \
   --region=$REGION \
   --platform=managed \
   --allow-unauthenticated \
@@ -7,12 +7,19 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/api"
 	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/config"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/dedup"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/recorder"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/sink"
 	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackcreds"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -20,7 +27,7 @@ import (
 func main() {
 	slog.Info("Starting broadcast-bot-svc")
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, nil)))
 	slog.SetDefault(logger)
 
 	if err := godotenv.Load(); err != nil {
@@ -36,24 +43,89 @@ func main() {
 	var level slog.Level
 	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err == nil {
 		opts := &slog.HandlerOptions{Level: level}
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, opts))
+		logger = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, opts)))
 		slog.SetDefault(logger)
 	}
 
 	slog.Info("Starting Broadcast Bot Service",
 		"port", cfg.Port,
 		"broadcast_channel_id", cfg.BroadcastChannelID,
+		"broadcast_channel_routes", len(cfg.BroadcastChannelMap),
+		"sinks", cfg.BroadcastSinks,
+		"max_per_minute", cfg.BroadcastMaxPerMinute,
+		"database_enabled", cfg.DatabaseURL != "",
+		"digest_mode", cfg.DigestMode,
 	)
 
-	slackClient := slack.NewClient(cfg.SlackBotToken, logger)
-	handler := api.NewHandler(slackClient, cfg.BroadcastChannelID, logger)
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":     cfg.UpstreamTimeout,
+		"DEDUP_TTL":            cfg.DedupTTL,
+		"SERVER_READ_TIMEOUT":  cfg.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT": cfg.ServerWriteTimeout,
+	} {
+		if timeout <= 0 {
+			slog.Error("Invalid "+name+", must be a positive duration", "timeout", timeout)
+			os.Exit(1)
+		}
+	}
+	if cfg.BroadcastMaxPerMinute > 0 && cfg.BroadcastMaxPending <= 0 {
+		slog.Error("Invalid BROADCAST_MAX_PENDING, must be positive when BROADCAST_MAX_PER_MINUTE is set", "broadcast_max_pending", cfg.BroadcastMaxPending)
+		os.Exit(1)
+	}
+	if cfg.MaxRequestBodyBytes <= 0 {
+		slog.Error("Invalid MAX_REQUEST_BODY_BYTES, must be positive", "max_request_body_bytes", cfg.MaxRequestBodyBytes)
+		os.Exit(1)
+	}
+
+	sinks, err := buildSinks(cfg, logger)
+	if err != nil {
+		slog.Error("Failed to configure broadcast sinks", "error", err)
+		os.Exit(1)
+	}
+
+	rec, err := recorder.New(cfg.DatabaseURL, logger)
+	if err != nil {
+		slog.Error("Failed to set up database recorder", "error", err)
+		os.Exit(1)
+	}
+	defer rec.Close()
+
+	processed, err := dedup.New(dedup.Options{
+		Backend:    cfg.DedupBackend,
+		FilePath:   cfg.DedupFilePath,
+		TTL:        cfg.DedupTTL,
+		MaxEntries: cfg.DedupMaxEntries,
+	}, logger)
+	if err != nil {
+		slog.Error("Failed to create dedup store", "error", err)
+		os.Exit(1)
+	}
+
+	handler := api.NewHandler(sinks, rec, processed, cfg.BroadcastMaxPerMinute, cfg.BroadcastMaxPending, logger)
+
+	if cfg.DigestMode {
+		if cfg.DigestHour < 0 || cfg.DigestHour > 23 {
+			slog.Error("DIGEST_HOUR must be between 0 and 23", "digest_hour", cfg.DigestHour)
+			os.Exit(1)
+		}
+		loc, err := time.LoadLocation(cfg.DigestTimezone)
+		if err != nil {
+			slog.Error("Invalid DIGEST_TIMEZONE", "error", err)
+			os.Exit(1)
+		}
+		handler.EnableDigest(cfg.DigestHour, loc)
+	}
+
+	metrics.SetService("broadcast-bot-svc")
 
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: mux,
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      tracing.Middleware(api.LimitBody(mux, cfg.MaxRequestBodyBytes), logger),
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -75,6 +147,48 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		slog.Error("HTTP server shutdown failed", "error", err)
 	}
+	handler.Close(shutdownCtx)
 
 	slog.Info("Service shutdown complete")
 }
+
+// buildSinks creates the sinks named in BROADCAST_SINKS
+func buildSinks(cfg config.Config, logger *slog.Logger) ([]sink.Sink, error) {
+	sinks := make([]sink.Sink, 0, len(cfg.BroadcastSinks))
+	for _, name := range cfg.BroadcastSinks {
+		switch strings.TrimSpace(name) {
+		case "slack":
+			if err := slackcreds.ValidateBotToken(cfg.SlackBotToken); err != nil {
+				return nil, fmt.Errorf("slack sink requires a valid SLACK_BOT_TOKEN: %w", err)
+			}
+			if err := slackcreds.ValidateChannelID(cfg.BroadcastChannelID); err != nil {
+				return nil, fmt.Errorf("slack sink requires a valid BROADCAST_CHANNEL_ID: %w", err)
+			}
+			for source, destination := range cfg.BroadcastChannelMap {
+				if err := slackcreds.ValidateChannelID(source); err != nil {
+					return nil, fmt.Errorf("invalid BROADCAST_CHANNEL_MAP source: %w", err)
+				}
+				if err := slackcreds.ValidateChannelID(destination); err != nil {
+					return nil, fmt.Errorf("invalid BROADCAST_CHANNEL_MAP destination for %s: %w", source, err)
+				}
+			}
+			slackSink := sink.NewSlackSink(slack.NewClient(cfg.SlackBotToken, cfg.UpstreamTimeout, logger), cfg.BroadcastChannelID)
+			slackSink.SetChannelRoutes(cfg.BroadcastChannelMap)
+			sinks = append(sinks, slackSink)
+		case "webhook":
+			if cfg.BroadcastWebhookURL == "" {
+				return nil, fmt.Errorf("webhook sink requires BROADCAST_WEBHOOK_URL")
+			}
+			sinks = append(sinks, sink.NewWebhookSink(cfg.BroadcastWebhookURL, cfg.UpstreamTimeout))
+		case "stdout":
+			sinks = append(sinks, sink.NewNDJSONSink(os.Stdout))
+		default:
+			return nil, fmt.Errorf("unknown broadcast sink %q", name)
+		}
+	}
+
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no broadcast sinks configured")
+	}
+	return sinks, nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/sink"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+// digestTopChannels is how many of the busiest channels a digest lists
+const digestTopChannels = 5
+
+// digestAggregator tallies broadcasts and feedback between digests. It keeps counts
+// only, in memory, so anything received since the last digest is lost on restart.
+type digestAggregator struct {
+	tally digestTally
+	mutex sync.Mutex
+}
+
+// digestTally holds the counts for one digest period
+type digestTally struct {
+	since        time.Time
+	interactions int
+	users        map[string]bool
+	channels     map[string]int
+	feedback     map[string]int
+}
+
+func newDigestTally(since time.Time) digestTally {
+	return digestTally{
+		since:    since,
+		users:    make(map[string]bool),
+		channels: make(map[string]int),
+		feedback: make(map[string]int),
+	}
+}
+
+func newDigestAggregator(now time.Time) *digestAggregator {
+	return &digestAggregator{tally: newDigestTally(now)}
+}
+
+func (a *digestAggregator) addBroadcast(req slack.BroadcastRequest) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.tally.interactions++
+	a.tally.users[req.UserID] = true
+	a.tally.channels[req.ChannelID]++
+}
+
+func (a *digestAggregator) addFeedback(req slack.FeedbackRequest) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.tally.feedback[req.FeedbackType]++
+}
+
+// flush returns the digest for the period ending now and starts a new one. The period's
+// tally is returned too, so it can be restored if the digest can't be posted.
+func (a *digestAggregator) flush(now time.Time) (slack.Digest, digestTally) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	tally := a.tally
+	a.tally = newDigestTally(now)
+	return tally.digest(now), tally
+}
+
+// restore merges a flushed tally back in, so its counts go into the next digest and the
+// period starts from the flushed one
+func (a *digestAggregator) restore(flushed digestTally) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.tally.since = flushed.since
+	a.tally.interactions += flushed.interactions
+	for userID := range flushed.users {
+		a.tally.users[userID] = true
+	}
+	for channelID, count := range flushed.channels {
+		a.tally.channels[channelID] += count
+	}
+	for feedbackType, count := range flushed.feedback {
+		a.tally.feedback[feedbackType] += count
+	}
+}
+
+// digest summarizes the tally for the period ending now
+func (t digestTally) digest(now time.Time) slack.Digest {
+	channels := make([]slack.ChannelCount, 0, len(t.channels))
+	for channelID, count := range t.channels {
+		channels = append(channels, slack.ChannelCount{ChannelID: channelID, Count: count})
+	}
+	// Busiest first; ties by ID so the order is stable
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Count != channels[j].Count {
+			return channels[i].Count > channels[j].Count
+		}
+		return channels[i].ChannelID < channels[j].ChannelID
+	})
+	if len(channels) > digestTopChannels {
+		channels = channels[:digestTopChannels]
+	}
+
+	return slack.Digest{
+		PeriodStart:      t.since,
+		PeriodEnd:        now,
+		Interactions:     t.interactions,
+		UniqueUsers:      len(t.users),
+		PositiveFeedback: t.feedback["positive"],
+		NegativeFeedback: t.feedback["negative"],
+		TextFeedback:     t.feedback["text"],
+		TopChannels:      channels,
+	}
+}
+
+// nextDigestTime returns the next time after now that the clock reads hour:00 in loc
+func nextDigestTime(now time.Time, hour int, loc *time.Location) time.Time {
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if !next.After(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, hour, 0, 0, 0, loc)
+	}
+	return next
+}
+
+// EnableDigest switches the handler to digest mode: broadcasts and feedback are no
+// longer posted individually but tallied and posted as one summary daily at hour in loc
+func (h *Handler) EnableDigest(hour int, loc *time.Location) {
+	h.digest = newDigestAggregator(time.Now())
+	go h.digestRoutine(hour, loc)
+}
+
+// digestRoutine posts the digest at each scheduled time
+func (h *Handler) digestRoutine(hour int, loc *time.Location) {
+	for {
+		next := nextDigestTime(time.Now(), hour, loc)
+		h.logger.Info("Next digest scheduled", "at", next)
+		time.Sleep(time.Until(next))
+
+		digest, tally := h.digest.flush(time.Now())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := h.dispatch(func(s sink.Sink) error {
+			return s.SendDigest(ctx, digest)
+		})
+		cancel()
+		if err != nil {
+			// Carry the counts over so the next digest still covers this period
+			h.digest.restore(tally)
+			h.logger.Error("Failed to post digest, keeping its counts for the next one", "error", err, "interactions", digest.Interactions)
+			continue
+		}
+
+		h.logger.Info("Posted digest",
+			"interactions", digest.Interactions,
+			"unique_users", digest.UniqueUsers)
+	}
+}
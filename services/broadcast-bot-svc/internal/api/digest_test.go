@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+func TestDigestAggregation(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	a := newDigestAggregator(start)
+
+	// Channel C1 gets 4 interactions, C2 3 and C3 to C7 one each, from 4 users taking turns
+	for i, channel := range []string{"C1", "C1", "C1", "C1", "C2", "C2", "C2", "C7", "C6", "C5", "C4", "C3"} {
+		a.addBroadcast(slack.BroadcastRequest{UserID: fmt.Sprintf("U%d", i%4), ChannelID: channel})
+	}
+	for _, feedbackType := range []string{"positive", "positive", "positive", "negative", "text", "text"} {
+		a.addFeedback(slack.FeedbackRequest{FeedbackType: feedbackType})
+	}
+
+	end := start.Add(24 * time.Hour)
+	digest, _ := a.flush(end)
+
+	if digest.PeriodStart != start || digest.PeriodEnd != end {
+		t.Errorf("period %v to %v, want %v to %v", digest.PeriodStart, digest.PeriodEnd, start, end)
+	}
+	if digest.Interactions != 12 {
+		t.Errorf("interactions = %d, want 12", digest.Interactions)
+	}
+	if digest.UniqueUsers != 4 {
+		t.Errorf("unique users = %d, want 4", digest.UniqueUsers)
+	}
+	if digest.PositiveFeedback != 3 || digest.NegativeFeedback != 1 || digest.TextFeedback != 2 {
+		t.Errorf("feedback = %d/%d/%d, want 3 positive, 1 negative, 2 text",
+			digest.PositiveFeedback, digest.NegativeFeedback, digest.TextFeedback)
+	}
+
+	// Busiest first, ties by channel ID, capped at digestTopChannels
+	want := []slack.ChannelCount{
+		{ChannelID: "C1", Count: 4},
+		{ChannelID: "C2", Count: 3},
+		{ChannelID: "C3", Count: 1},
+		{ChannelID: "C4", Count: 1},
+		{ChannelID: "C5", Count: 1},
+	}
+	if !slices.Equal(digest.TopChannels, want) {
+		t.Errorf("top channels = %v, want %v", digest.TopChannels, want)
+	}
+}
+
+func TestDigestFlushStartsNewPeriod(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	a := newDigestAggregator(start)
+	a.addBroadcast(slack.BroadcastRequest{UserID: "U1", ChannelID: "C1"})
+	a.addFeedback(slack.FeedbackRequest{FeedbackType: "positive"})
+
+	first := start.Add(24 * time.Hour)
+	a.flush(first)
+	digest, _ := a.flush(first.Add(24 * time.Hour))
+
+	if digest.PeriodStart != first {
+		t.Errorf("second period starts %v, want %v", digest.PeriodStart, first)
+	}
+	if digest.Interactions != 0 || digest.UniqueUsers != 0 || digest.PositiveFeedback != 0 || len(digest.TopChannels) != 0 {
+		t.Errorf("second digest = %+v, want it empty", digest)
+	}
+}
+
+func TestDigestRestoreCarriesCountsOver(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	a := newDigestAggregator(start)
+	a.addBroadcast(slack.BroadcastRequest{UserID: "U1", ChannelID: "C1"})
+	a.addFeedback(slack.FeedbackRequest{FeedbackType: "positive"})
+
+	first := start.Add(24 * time.Hour)
+	_, tally := a.flush(first)
+	a.addBroadcast(slack.BroadcastRequest{UserID: "U1", ChannelID: "C1"})
+	a.addBroadcast(slack.BroadcastRequest{UserID: "U2", ChannelID: "C2"})
+	a.restore(tally)
+
+	digest, _ := a.flush(first.Add(24 * time.Hour))
+	if digest.PeriodStart != start {
+		t.Errorf("period starts %v, want the failed digest's start %v", digest.PeriodStart, start)
+	}
+	if digest.Interactions != 3 || digest.UniqueUsers != 2 || digest.PositiveFeedback != 1 {
+		t.Errorf("digest = %+v, want 3 interactions from 2 users and 1 positive", digest)
+	}
+	if len(digest.TopChannels) == 0 || digest.TopChannels[0] != (slack.ChannelCount{ChannelID: "C1", Count: 2}) {
+		t.Errorf("top channels = %v, want C1 first with 2", digest.TopChannels)
+	}
+}
+
+func TestNextDigestTime(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"before the hour", time.Date(2026, 3, 2, 7, 30, 0, 0, loc), time.Date(2026, 3, 2, 9, 0, 0, 0, loc)},
+		{"exactly on the hour", time.Date(2026, 3, 2, 9, 0, 0, 0, loc), time.Date(2026, 3, 3, 9, 0, 0, 0, loc)},
+		{"after the hour", time.Date(2026, 3, 2, 18, 0, 0, 0, loc), time.Date(2026, 3, 3, 9, 0, 0, 0, loc)},
+		{"end of month", time.Date(2026, 3, 31, 10, 0, 0, 0, loc), time.Date(2026, 4, 1, 9, 0, 0, 0, loc)},
+		{"now in another zone", time.Date(2026, 3, 2, 13, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDigestTime(tt.now, 9, loc); !got.Equal(tt.want) {
+				t.Errorf("nextDigestTime(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestModeSuppressesIndividualPosts(t *testing.T) {
+	h, fake := newTestHandler(t, 0, 0)
+	h.digest = newDigestAggregator(time.Now())
+
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("got %d, want 202 for a digested broadcast", rec.Code)
+	}
+	if got := fake.delivered(); len(got) != 0 {
+		t.Errorf("sink got %v, want nothing until the digest", got)
+	}
+	if digest, _ := h.digest.flush(time.Now()); digest.Interactions != 1 {
+		t.Errorf("digest counted %d interactions, want 1", digest.Interactions)
+	}
+}
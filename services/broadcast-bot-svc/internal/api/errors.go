@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in JSON error bodies. Clients branch on these, so existing codes
+// must never change meaning.
+const (
+	errCodeInvalidJSON     = "invalid_json"
+	errCodeMissingField    = "missing_field"
+	errCodePayloadTooLarge = "payload_too_large"
+	errCodeUpstreamError   = "upstream_error"
+	errCodeBufferFull      = "buffer_full"
+)
+
+// APIError is the machine-readable error carried in responses
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError responds with status and a JSON body of the form
+// {"error": {"code": "...", "message": "..."}}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: APIError{Code: code, Message: message}})
+}
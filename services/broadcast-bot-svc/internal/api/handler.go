@@ -1,35 +1,61 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"sync"
+	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/dedup"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/recorder"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/sink"
 	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 )
 
 type Handler struct {
-	slackClient        *slack.Client
-	broadcastChannelID string
-	logger             *slog.Logger
-	processedMessages  map[string]bool
-	messagesMutex      sync.RWMutex
+	sinks     []sink.Sink
+	recorder  recorder.Recorder
+	logger    *slog.Logger
+	processed dedup.Store
+	limiter   *broadcastLimiter
+	digest    *digestAggregator
+	// stopFlush ends flushRoutine, which closes flushDone once it has returned
+	stopFlush chan struct{}
+	flushDone chan struct{}
 }
 
-func NewHandler(slackClient *slack.Client, broadcastChannelID string, logger *slog.Logger) *Handler {
-	return &Handler{
-		slackClient:        slackClient,
-		broadcastChannelID: broadcastChannelID,
-		logger:             logger,
-		processedMessages:  make(map[string]bool),
+// NewHandler creates the broadcast handler, which delivers every request to all sinks
+// and records it with rec. Correlation IDs are kept in processed so redelivered requests
+// are only delivered once. When maxPerMinute is positive, up to maxPending broadcasts
+// beyond that rate are buffered and posted later as combined messages.
+func NewHandler(sinks []sink.Sink, rec recorder.Recorder, processed dedup.Store, maxPerMinute, maxPending int, logger *slog.Logger) *Handler {
+	h := &Handler{
+		sinks:     sinks,
+		recorder:  rec,
+		logger:    logger,
+		processed: processed,
 	}
+
+	if maxPerMinute > 0 {
+		h.limiter = newBroadcastLimiter(maxPerMinute, maxPending)
+		h.stopFlush = make(chan struct{})
+		h.flushDone = make(chan struct{})
+		go h.flushRoutine(time.Minute / time.Duration(maxPerMinute))
+	}
+
+	return h
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /health", h.handleHealthCheck)
-	mux.HandleFunc("POST /api/broadcast", h.handleBroadcast)
-	mux.HandleFunc("POST /api/feedback", h.handleFeedback)
+	mux.Handle("GET /health", metrics.Instrument("/health", http.HandlerFunc(h.handleHealthCheck)))
+	mux.Handle("POST /api/broadcast", metrics.Instrument("/api/broadcast", http.HandlerFunc(h.handleBroadcast)))
+	mux.Handle("POST /api/feedback", metrics.Instrument("/api/feedback", http.HandlerFunc(h.handleFeedback)))
+	mux.Handle("GET /metrics", metrics.Handler())
 }
 
 func (h *Handler) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -39,49 +65,60 @@ func (h *Handler) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *Handler) isMessageProcessed(correlationID string) bool {
-	h.messagesMutex.RLock()
-	defer h.messagesMutex.RUnlock()
-	return h.processedMessages[correlationID]
-}
-
-func (h *Handler) markMessageProcessed(correlationID string) {
-	h.messagesMutex.Lock()
-	defer h.messagesMutex.Unlock()
-	h.processedMessages[correlationID] = true
-}
-
 func (h *Handler) handleFeedback(w http.ResponseWriter, r *http.Request) {
 	var req slack.FeedbackRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode feedback request", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		h.logger.ErrorContext(r.Context(), "Failed to decode feedback request", "error", err)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid request body")
 		return
 	}
 
+	// Fall back to the caller's X-Correlation-ID, but not a generated one: the ID
+	// deduplicates redeliveries, so it must be stable across retries
+	if req.CorrelationID == "" {
+		req.CorrelationID = r.Header.Get(tracing.Header)
+	}
 	if req.CorrelationID == "" {
 		h.logger.Error("Missing correlation ID in feedback request")
-		http.Error(w, "Correlation ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Correlation ID is required")
 		return
 	}
 
-	if h.isMessageProcessed(req.CorrelationID) {
+	if !h.processed.MarkIfNew(req.CorrelationID) {
 		h.logger.Info("Feedback message already processed", "correlation_id", req.CorrelationID)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	h.markMessageProcessed(req.CorrelationID)
-
 	h.logger.Info("Processing feedback request",
 		"correlation_id", req.CorrelationID,
+		"original_correlation_id", req.OriginalCorrelationID,
 		"user_id", req.UserID,
 		"feedback_type", req.FeedbackType)
 
-	err := h.slackClient.PostFeedbackMessage(r.Context(), h.broadcastChannelID, req)
+	// Recording is best effort; the feedback is still delivered if it fails
+	if err := h.recorder.RecordFeedback(r.Context(), req); err != nil {
+		h.logger.Error("Failed to record feedback", "error", err, "correlation_id", req.CorrelationID)
+	}
+
+	if h.digest != nil {
+		h.digest.addFeedback(req)
+		writeDigested(w, req.CorrelationID)
+		return
+	}
+
+	err := h.dispatch(func(s sink.Sink) error {
+		return s.SendFeedback(r.Context(), req)
+	})
 	if err != nil {
+		// Unmark it so the caller's retry is delivered rather than taken as a duplicate
+		h.processed.Unmark(req.CorrelationID)
 		h.logger.Error("Failed to post feedback message", "error", err, "correlation_id", req.CorrelationID)
-		http.Error(w, "Failed to post feedback message", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeUpstreamError, "Failed to post feedback message")
 		return
 	}
 
@@ -100,34 +137,86 @@ func (h *Handler) handleFeedback(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleBroadcast(w http.ResponseWriter, r *http.Request) {
 	var req slack.BroadcastRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode broadcast request", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		h.logger.ErrorContext(r.Context(), "Failed to decode broadcast request", "error", err)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid request body")
 		return
 	}
 
+	// Fall back to the caller's X-Correlation-ID, but not a generated one: the ID
+	// deduplicates redeliveries, so it must be stable across retries
+	if req.CorrelationID == "" {
+		req.CorrelationID = r.Header.Get(tracing.Header)
+	}
 	if req.CorrelationID == "" {
 		h.logger.Error("Missing correlation ID in broadcast request")
-		http.Error(w, "Correlation ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Correlation ID is required")
 		return
 	}
 
-	if h.isMessageProcessed(req.CorrelationID) {
+	if !h.processed.MarkIfNew(req.CorrelationID) {
 		h.logger.Info("Broadcast message already processed", "correlation_id", req.CorrelationID)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	h.markMessageProcessed(req.CorrelationID)
+	queued := 0
+	if h.limiter != nil && h.digest == nil {
+		var err error
+		queued, err = h.limiter.admit(time.Now(), req)
+		if err != nil {
+			// Unmark it so the broadcast is still accepted when the caller retries
+			h.processed.Unmark(req.CorrelationID)
+			h.logger.Warn("Broadcast buffer full, rejecting message", "correlation_id", req.CorrelationID)
+			w.Header().Set("Retry-After", "60")
+			writeError(w, http.StatusServiceUnavailable, errCodeBufferFull, "Too many broadcasts waiting to be posted")
+			return
+		}
+	}
 
 	h.logger.Info("Processing broadcast request",
 		"correlation_id", req.CorrelationID,
 		"user_id", req.UserID,
 		"channel_id", req.ChannelID)
 
-	err := h.slackClient.PostBroadcastMessage(r.Context(), h.broadcastChannelID, req)
+	// Recording is best effort; the broadcast is still delivered if it fails
+	if err := h.recorder.RecordBroadcast(r.Context(), req); err != nil {
+		h.logger.Error("Failed to record broadcast", "error", err, "correlation_id", req.CorrelationID)
+	}
+
+	if h.digest != nil {
+		h.digest.addBroadcast(req)
+		writeDigested(w, req.CorrelationID)
+		return
+	}
+
+	if queued > 0 {
+		h.logger.Info("Broadcast rate limit reached, buffering message",
+			"correlation_id", req.CorrelationID,
+			"queued", queued)
+
+		response := map[string]string{
+			"status":         "queued",
+			"correlation_id": req.CorrelationID,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	err := h.dispatch(func(s sink.Sink) error {
+		return s.SendBroadcast(r.Context(), req)
+	})
 	if err != nil {
+		// Unmark it so the caller's retry is delivered rather than taken as a duplicate
+		h.processed.Unmark(req.CorrelationID)
 		h.logger.Error("Failed to post broadcast message", "error", err, "correlation_id", req.CorrelationID)
-		http.Error(w, "Failed to post broadcast message", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeUpstreamError, "Failed to post broadcast message")
 		return
 	}
 
@@ -142,3 +231,154 @@ func (h *Handler) handleBroadcast(w http.ResponseWriter, r *http.Request) {
 
 	h.logger.Info("Successfully processed broadcast request", "correlation_id", req.CorrelationID)
 }
+
+// writeDigested acknowledges a request held for the next digest instead of posted
+func writeDigested(w http.ResponseWriter, correlationID string) {
+	response := map[string]string{
+		"status":         "digested",
+		"correlation_id": correlationID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// flushRoutine periodically posts buffered broadcasts as combined messages until Close
+func (h *Handler) flushRoutine(interval time.Duration) {
+	defer close(h.flushDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopFlush:
+			return
+		case <-ticker.C:
+		}
+
+		h.flushBuffered(time.Now())
+	}
+}
+
+// flushBuffered posts the next batch of buffered broadcasts if a send slot is free at now.
+// Only the sinks that failed are retried, and only up to maxFlushAttempts, so a sink that
+// stays down neither repeats posts to the others nor holds broadcasts forever.
+func (h *Handler) flushBuffered(now time.Time) {
+	batch := h.limiter.takeBatch(now)
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	undelivered := h.deliverBatch(ctx, batch)
+	cancel()
+
+	if len(undelivered) == 0 {
+		h.logger.Info("Posted buffered broadcasts", "count", len(batch))
+		return
+	}
+
+	retry := make([]*pendingBroadcast, 0, len(undelivered))
+	for _, p := range undelivered {
+		p.attempts++
+		if p.attempts >= maxFlushAttempts {
+			h.logger.Error("Dead-lettering undelivered broadcast", "correlation_id", p.req.CorrelationID, "attempts", p.attempts, "broadcast", p.req)
+			continue
+		}
+		retry = append(retry, p)
+	}
+	if len(retry) > 0 {
+		h.logger.Error("Failed to post buffered broadcasts, will retry", "count", len(retry))
+		h.limiter.requeue(retry)
+	}
+}
+
+// Close stops posting buffered broadcasts on a timer and posts whatever is still
+// buffered, ignoring the rate limit since the service is shutting down. Broadcasts that
+// can't be posted before ctx ends are logged in full so they can be replayed.
+func (h *Handler) Close(ctx context.Context) {
+	if h.limiter == nil {
+		return
+	}
+
+	close(h.stopFlush)
+	<-h.flushDone
+
+	pending := h.limiter.drain()
+	for len(pending) > 0 {
+		n := min(len(pending), maxBatchSize)
+		batch := pending[:n]
+		pending = pending[n:]
+
+		if undelivered := h.deliverBatch(ctx, batch); len(undelivered) > 0 {
+			h.logger.Error("Failed to post buffered broadcasts on shutdown", "count", len(undelivered)+len(pending))
+			for _, p := range append(undelivered, pending...) {
+				h.logger.Error("Dead-lettering undelivered broadcast", "correlation_id", p.req.CorrelationID, "broadcast", p.req)
+			}
+			return
+		}
+
+		h.logger.Info("Posted buffered broadcasts on shutdown", "count", n)
+	}
+}
+
+// deliverBatch posts each broadcast in batch to the sinks that haven't posted it yet,
+// recording which succeed, and returns those still undelivered to some sink
+func (h *Handler) deliverBatch(ctx context.Context, batch []*pendingBroadcast) []*pendingBroadcast {
+	for i, s := range h.sinks {
+		owed := make([]*pendingBroadcast, 0, len(batch))
+		reqs := make([]slack.BroadcastRequest, 0, len(batch))
+		for _, p := range batch {
+			if !p.delivered[i] {
+				owed = append(owed, p)
+				reqs = append(reqs, p.req)
+			}
+		}
+		if len(reqs) == 0 {
+			continue
+		}
+
+		failed := make(map[int]bool)
+		if err := s.SendBroadcastBatch(ctx, reqs); err != nil {
+			h.logger.Error("Sink delivery failed", "sink", s.Name(), "error", err)
+			var batchErr *sink.BatchError
+			if errors.As(err, &batchErr) {
+				for _, j := range batchErr.Failed {
+					failed[j] = true
+				}
+			} else {
+				for j := range owed {
+					failed[j] = true
+				}
+			}
+		}
+		for j, p := range owed {
+			if !failed[j] {
+				p.delivered[i] = true
+			}
+		}
+	}
+
+	undelivered := make([]*pendingBroadcast, 0)
+	for _, p := range batch {
+		if len(p.delivered) < len(h.sinks) {
+			undelivered = append(undelivered, p)
+		}
+	}
+	return undelivered
+}
+
+// dispatch runs send against every sink, logging and collecting failures so one broken
+// destination doesn't stop the others
+func (h *Handler) dispatch(send func(s sink.Sink) error) error {
+	var errs []error
+	for _, s := range h.sinks {
+		if err := send(s); err != nil {
+			h.logger.Error("Sink delivery failed", "sink", s.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
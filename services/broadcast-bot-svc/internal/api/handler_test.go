@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/dedup"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/recorder"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/sink"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+// fakeSink records everything delivered to it, failing while fail is set
+type fakeSink struct {
+	mutex      sync.Mutex
+	fail       bool
+	broadcasts []slack.BroadcastRequest
+	batches    [][]slack.BroadcastRequest
+	feedback   []slack.FeedbackRequest
+	digests    []slack.Digest
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) SendBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.broadcasts = append(s.broadcasts, req)
+	return nil
+}
+
+func (s *fakeSink) SendBroadcastBatch(ctx context.Context, reqs []slack.BroadcastRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]slack.BroadcastRequest(nil), reqs...))
+	return nil
+}
+
+func (s *fakeSink) SendFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.feedback = append(s.feedback, req)
+	return nil
+}
+
+func (s *fakeSink) SendDigest(ctx context.Context, digest slack.Digest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.digests = append(s.digests, digest)
+	return nil
+}
+
+func (s *fakeSink) setFail(fail bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fail = fail
+}
+
+// delivered returns the correlation IDs of every broadcast posted, singly or batched
+func (s *fakeSink) delivered() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	for _, req := range s.broadcasts {
+		ids = append(ids, req.CorrelationID)
+	}
+	for _, batch := range s.batches {
+		for _, req := range batch {
+			ids = append(ids, req.CorrelationID)
+		}
+	}
+	return ids
+}
+
+// newTestHandler returns a handler delivering to a single fake sink
+func newTestHandler(t *testing.T, maxPerMinute, maxPending int) (*Handler, *fakeSink) {
+	t.Helper()
+
+	fake := &fakeSink{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewHandler([]sink.Sink{fake}, recorder.NopRecorder{}, dedup.NewMemoryStore(time.Hour, 1000), maxPerMinute, maxPending, logger)
+	return h, fake
+}
+
+// postBroadcast sends a broadcast with correlationID to h and returns the response
+func postBroadcast(t *testing.T, h *Handler, correlationID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(slack.BroadcastRequest{
+		UserID:        "U123",
+		ChannelID:     "C123",
+		Question:      "How do I connect a wallet?",
+		Response:      "Go to Connections.",
+		CorrelationID: correlationID,
+	})
+	if err != nil {
+		t.Fatalf("marshal broadcast: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleBroadcast(rec, httptest.NewRequest(http.MethodPost, "/api/broadcast", bytes.NewReader(body)))
+	return rec
+}
+
+func TestBroadcastIsDeliveredToEverySink(t *testing.T) {
+	events := make(chan sink.Event, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event sink.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	t.Cleanup(webhook.Close)
+
+	var ndjson bytes.Buffer
+	fake := &fakeSink{}
+	sinks := []sink.Sink{fake, sink.NewWebhookSink(webhook.URL, 5*time.Second), sink.NewNDJSONSink(&ndjson)}
+	h := NewHandler(sinks, recorder.NopRecorder{}, dedup.NewMemoryStore(time.Hour, 1000), 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+
+	if got := fake.delivered(); len(got) != 1 || got[0] != "corr_1" {
+		t.Errorf("fake sink got %v, want corr_1", got)
+	}
+	if event := <-events; event.Type != "broadcast" {
+		t.Errorf("webhook got a %q event, want broadcast", event.Type)
+	}
+	if !bytes.Contains(ndjson.Bytes(), []byte(`"correlation_id":"corr_1"`)) {
+		t.Errorf("stdout sink wrote %q, want the broadcast", ndjson.String())
+	}
+}
+
+func TestFailingSinkDoesNotBlockOthers(t *testing.T) {
+	broken, working := &fakeSink{fail: true}, &fakeSink{}
+	h := NewHandler([]sink.Sink{broken, working}, recorder.NopRecorder{}, dedup.NewMemoryStore(time.Hour, 1000), 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want 500 when a sink fails", rec.Code)
+	}
+	if got := working.delivered(); len(got) != 1 {
+		t.Errorf("working sink got %v, want the broadcast despite the other failing", got)
+	}
+}
+
+func TestFailedBroadcastIsDeliveredOnRetry(t *testing.T) {
+	h, sink := newTestHandler(t, 0, 0)
+	sink.setFail(true)
+
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500 while the sink fails", rec.Code)
+	}
+
+	sink.setFail(false)
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusOK {
+		t.Fatalf("retry got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := postBroadcast(t, h, "corr_1"); rec.Code != http.StatusOK {
+		t.Fatalf("redelivery got %d: %s", rec.Code, rec.Body)
+	}
+	if got := sink.delivered(); len(got) != 1 || got[0] != "corr_1" {
+		t.Errorf("delivered %v, want corr_1 once", got)
+	}
+}
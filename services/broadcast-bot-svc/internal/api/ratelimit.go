@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+// maxBatchSize bounds how many buffered broadcasts are combined into one Slack message,
+// keeping the combined message under Slack's 50 block limit
+const maxBatchSize = 20
+
+// maxFlushAttempts is how many times a buffered broadcast is offered to the sinks that
+// haven't posted it yet before it is dead-lettered
+const maxFlushAttempts = 5
+
+// errBufferFull is returned by admit when maxPending broadcasts are already waiting
+var errBufferFull = errors.New("broadcast buffer is full")
+
+// broadcastLimiter caps outbound broadcasts to maxPerMinute using a sliding window and
+// buffers up to maxPending over the limit so they can be posted later as combined messages
+type broadcastLimiter struct {
+	maxPerMinute int
+	maxPending   int
+	sent         []time.Time
+	pending      []*pendingBroadcast
+	mutex        sync.Mutex
+}
+
+// pendingBroadcast is a buffered broadcast and how far its delivery has got
+type pendingBroadcast struct {
+	req slack.BroadcastRequest
+	// delivered holds the indexes of the sinks that have already posted it
+	delivered map[int]bool
+	// attempts counts the flushes that left it undelivered to some sink
+	attempts int
+}
+
+func newBroadcastLimiter(maxPerMinute, maxPending int) *broadcastLimiter {
+	return &broadcastLimiter{
+		maxPerMinute: maxPerMinute,
+		maxPending:   maxPending,
+		sent:         make([]time.Time, 0, maxPerMinute),
+		pending:      make([]*pendingBroadcast, 0),
+	}
+}
+
+// admit decides what happens to req: it returns 0 if it may be posted now, or its
+// position in the buffer if it was queued for a later batch. Buffered broadcasts take
+// priority, so nothing new is posted directly while older ones are waiting. When the
+// buffer is full req is neither posted nor queued and errBufferFull is returned.
+func (l *broadcastLimiter) admit(now time.Time, req slack.BroadcastRequest) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.pending) == 0 && l.allowLocked(now) {
+		return 0, nil
+	}
+	if len(l.pending) >= l.maxPending {
+		return 0, errBufferFull
+	}
+
+	l.pending = append(l.pending, &pendingBroadcast{req: req, delivered: make(map[int]bool)})
+	return len(l.pending), nil
+}
+
+func (l *broadcastLimiter) allowLocked(now time.Time) bool {
+	cutoff := now.Add(-time.Minute)
+	for len(l.sent) > 0 && !l.sent[0].After(cutoff) {
+		l.sent = l.sent[1:]
+	}
+
+	if len(l.sent) >= l.maxPerMinute {
+		return false
+	}
+
+	l.sent = append(l.sent, now)
+	return true
+}
+
+// takeBatch returns up to maxBatchSize buffered broadcasts if a send slot is free
+func (l *broadcastLimiter) takeBatch(now time.Time) []*pendingBroadcast {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.pending) == 0 || !l.allowLocked(now) {
+		return nil
+	}
+
+	n := len(l.pending)
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+
+	batch := make([]*pendingBroadcast, n)
+	copy(batch, l.pending[:n])
+	l.pending = l.pending[n:]
+	return batch
+}
+
+// requeue puts broadcasts that failed to post back at the head of the buffer. The buffer
+// may briefly exceed maxPending if broadcasts were queued in the meantime; admit rejects
+// new ones until it drains.
+func (l *broadcastLimiter) requeue(batch []*pendingBroadcast) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.pending = append(batch, l.pending...)
+}
+
+// drain empties the buffer regardless of the rate limit, for use on shutdown
+func (l *broadcastLimiter) drain() []*pendingBroadcast {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	pending := l.pending
+	l.pending = nil
+	return pending
+}
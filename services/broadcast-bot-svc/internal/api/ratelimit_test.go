@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/dedup"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/recorder"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/sink"
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+func TestLimiterAdmitsUpToLimitThenBuffers(t *testing.T) {
+	l := newBroadcastLimiter(2, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if queued, err := l.admit(now, slack.BroadcastRequest{}); queued != 0 || err != nil {
+			t.Fatalf("broadcast %d: got (%d, %v), want it posted now", i, queued, err)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		if queued, err := l.admit(now, slack.BroadcastRequest{}); queued != i || err != nil {
+			t.Fatalf("over-limit broadcast: got (%d, %v), want queued at %d", queued, err, i)
+		}
+	}
+	if _, err := l.admit(now, slack.BroadcastRequest{}); err != errBufferFull {
+		t.Fatalf("broadcast past maxPending: got %v, want errBufferFull", err)
+	}
+}
+
+func TestLimiterBufferedBroadcastsGoFirst(t *testing.T) {
+	l := newBroadcastLimiter(1, 10)
+	now := time.Now()
+
+	l.admit(now, slack.BroadcastRequest{CorrelationID: "a"})
+	l.admit(now, slack.BroadcastRequest{CorrelationID: "b"})
+
+	// A slot frees up, but "b" is still waiting so "c" must queue behind it
+	later := now.Add(time.Minute + time.Second)
+	if queued, _ := l.admit(later, slack.BroadcastRequest{CorrelationID: "c"}); queued != 2 {
+		t.Fatalf("got queued = %d, want 2 behind the buffered broadcast", queued)
+	}
+
+	batch := l.takeBatch(later)
+	if len(batch) != 2 || batch[0].req.CorrelationID != "b" || batch[1].req.CorrelationID != "c" {
+		t.Errorf("batch = %+v, want b then c", batch)
+	}
+}
+
+func TestLimiterRejectsWhenNoSlotForBatch(t *testing.T) {
+	l := newBroadcastLimiter(1, 10)
+	now := time.Now()
+
+	l.admit(now, slack.BroadcastRequest{})
+	l.admit(now, slack.BroadcastRequest{})
+
+	if batch := l.takeBatch(now); batch != nil {
+		t.Errorf("took %d broadcasts with no send slot free", len(batch))
+	}
+}
+
+func TestBurstIsThrottledWithoutDroppingBroadcasts(t *testing.T) {
+	h, sink := newTestHandler(t, 2, 50)
+
+	const burst = 30
+	for i := 0; i < burst; i++ {
+		rec := postBroadcast(t, h, fmt.Sprintf("corr_%d", i))
+		want := http.StatusOK
+		if i >= 2 {
+			want = http.StatusAccepted
+		}
+		if rec.Code != want {
+			t.Fatalf("broadcast %d: got %d, want %d", i, rec.Code, want)
+		}
+	}
+
+	if got := len(sink.delivered()); got != 2 {
+		t.Errorf("%d broadcasts posted during the burst, want only the 2 allowed", got)
+	}
+
+	h.Close(context.Background())
+
+	delivered := sink.delivered()
+	if len(delivered) != burst {
+		t.Fatalf("%d broadcasts delivered after shutdown, want all %d", len(delivered), burst)
+	}
+	for i, id := range delivered {
+		if want := fmt.Sprintf("corr_%d", i); id != want {
+			t.Errorf("delivery %d was %s, want %s in order", i, id, want)
+		}
+	}
+	for _, batch := range sink.batches {
+		if len(batch) > maxBatchSize {
+			t.Errorf("batch of %d exceeds maxBatchSize", len(batch))
+		}
+	}
+}
+
+func TestFullBufferRejectsWithoutMarkingProcessed(t *testing.T) {
+	h, sink := newTestHandler(t, 1, 1)
+
+	postBroadcast(t, h, "corr_posted")
+	postBroadcast(t, h, "corr_queued")
+
+	rec := postBroadcast(t, h, "corr_rejected")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503 once the buffer is full", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 response has no Retry-After header")
+	}
+
+	// Once the buffer drains, the caller's retry must be queued, not deduplicated away
+	if batch := h.limiter.takeBatch(time.Now().Add(time.Minute + time.Second)); len(batch) != 1 {
+		t.Fatalf("took %d buffered broadcasts, want 1", len(batch))
+	}
+	if rec := postBroadcast(t, h, "corr_rejected"); rec.Code != http.StatusAccepted {
+		t.Fatalf("retry got %d, want it queued", rec.Code)
+	}
+
+	h.Close(context.Background())
+	if delivered := sink.delivered(); delivered[len(delivered)-1] != "corr_rejected" {
+		t.Errorf("delivered %v, want the retried broadcast last", delivered)
+	}
+}
+
+func TestCloseDeadLettersWhenSinkFails(t *testing.T) {
+	h, sink := newTestHandler(t, 1, 10)
+
+	postBroadcast(t, h, "corr_1")
+	postBroadcast(t, h, "corr_2")
+	sink.setFail(true)
+
+	h.Close(context.Background())
+
+	if len(sink.delivered()) != 1 {
+		t.Errorf("delivered %v, want only the first broadcast", sink.delivered())
+	}
+	if pending := h.limiter.drain(); len(pending) != 0 {
+		t.Errorf("%d broadcasts left buffered after Close", len(pending))
+	}
+}
+
+func TestFlushRetriesOnlyFailedSinksAndGivesUp(t *testing.T) {
+	broken, working := &fakeSink{fail: true}, &fakeSink{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewHandler([]sink.Sink{broken, working}, recorder.NopRecorder{}, dedup.NewMemoryStore(time.Hour, 1000), 1, 10, logger)
+	t.Cleanup(func() { h.Close(context.Background()) })
+
+	postBroadcast(t, h, "corr_posted")
+	if rec := postBroadcast(t, h, "corr_queued"); rec.Code != http.StatusAccepted {
+		t.Fatalf("got %d, want the second broadcast queued", rec.Code)
+	}
+
+	now := time.Now()
+	for i := 1; i <= maxFlushAttempts+1; i++ {
+		h.flushBuffered(now.Add(time.Duration(i) * (time.Minute + time.Second)))
+	}
+
+	if got := len(working.batches); got != 1 {
+		t.Errorf("working sink got %d batches, want the buffered broadcast posted once", got)
+	}
+	if pending := h.limiter.drain(); len(pending) != 0 {
+		t.Errorf("%d broadcasts still buffered after %d failed flushes", len(pending), maxFlushAttempts)
+	}
+}
@@ -0,0 +1,337 @@
+package dedup
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cleanupInterval = 5 * time.Minute
+
+// Store records which correlation IDs have already been broadcast, so redelivered
+// requests aren't posted twice
+type Store interface {
+	// MarkIfNew records the ID as processed, returning false if it already was. The
+	// check and the write are one step, so concurrent deliveries can't both see it as new.
+	MarkIfNew(correlationID string) bool
+	// Unmark forgets the ID, so a retry of a request that was turned away after being
+	// marked is processed
+	Unmark(correlationID string)
+}
+
+// MemoryStore keeps processed correlation IDs in memory; they are lost on restart.
+// Entries expire after ttl, and at most maxEntries are kept: marking beyond that evicts
+// the entry closest to expiring.
+type MemoryStore struct {
+	ids        map[string]*entry
+	byExpiry   expiryHeap
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory store whose entries expire after ttl. maxEntries
+// of 0 or less leaves the size bounded by ttl alone.
+func NewMemoryStore(ttl time.Duration, maxEntries int) *MemoryStore {
+	s := newMemoryStore(ttl, maxEntries)
+
+	// Start cleanup routine
+	go s.cleanupRoutine()
+
+	return s
+}
+
+func newMemoryStore(ttl time.Duration, maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		ids:        make(map[string]*entry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+// MarkIfNew records the ID as processed unless it was already marked within the TTL
+func (s *MemoryStore) MarkIfNew(correlationID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.markIfNew(correlationID, time.Now())
+	return ok
+}
+
+// Unmark forgets the ID
+func (s *MemoryStore) Unmark(correlationID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unmark(correlationID)
+}
+
+// Len returns the number of IDs held, including expired ones not yet cleaned up
+func (s *MemoryStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.ids)
+}
+
+// markIfNew marks the ID until ttl from now and returns its expiry, reporting false if
+// it was already marked. Callers must hold the mutex.
+func (s *MemoryStore) markIfNew(correlationID string, now time.Time) (time.Time, bool) {
+	if e, ok := s.ids[correlationID]; ok && now.Before(e.expiry) {
+		return e.expiry, false
+	}
+	expiry := now.Add(s.ttl)
+	s.mark(correlationID, expiry)
+	return expiry, true
+}
+
+// mark stores the ID until expiry, evicting to stay within maxEntries. Callers must hold
+// the mutex.
+func (s *MemoryStore) mark(correlationID string, expiry time.Time) {
+	if e, ok := s.ids[correlationID]; ok {
+		e.expiry = expiry
+		heap.Fix(&s.byExpiry, e.index)
+	} else {
+		e := &entry{id: correlationID, expiry: expiry}
+		heap.Push(&s.byExpiry, e)
+		s.ids[correlationID] = e
+	}
+	if s.maxEntries <= 0 || len(s.ids) <= s.maxEntries {
+		return
+	}
+
+	s.removeExpired(time.Now())
+	for len(s.ids) > s.maxEntries {
+		e := heap.Pop(&s.byExpiry).(*entry)
+		delete(s.ids, e.id)
+	}
+}
+
+// unmark drops the ID if it is held. Callers must hold the mutex.
+func (s *MemoryStore) unmark(correlationID string) {
+	if e, ok := s.ids[correlationID]; ok {
+		heap.Remove(&s.byExpiry, e.index)
+		delete(s.ids, correlationID)
+	}
+}
+
+// removeExpired drops entries expired at now. Callers must hold the mutex.
+func (s *MemoryStore) removeExpired(now time.Time) {
+	for len(s.byExpiry) > 0 && now.After(s.byExpiry[0].expiry) {
+		e := heap.Pop(&s.byExpiry).(*entry)
+		delete(s.ids, e.id)
+	}
+}
+
+func (s *MemoryStore) cleanupRoutine() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		s.removeExpired(time.Now())
+		s.mutex.Unlock()
+	}
+}
+
+// FileStore keeps processed correlation IDs in memory and appends them to a file so
+// they survive restarts
+type FileStore struct {
+	*MemoryStore
+	path   string
+	file   *os.File
+	logger *slog.Logger
+}
+
+// NewFileStore loads unexpired IDs from path and opens it for appending
+func NewFileStore(path string, ttl time.Duration, maxEntries int, logger *slog.Logger) (*FileStore, error) {
+	memory := newMemoryStore(ttl, maxEntries)
+	if err := memory.load(path); err != nil {
+		return nil, fmt.Errorf("failed to load dedup file: %w", err)
+	}
+
+	s := &FileStore{
+		MemoryStore: memory,
+		path:        path,
+		logger:      logger,
+	}
+
+	// Rewrite the file without expired entries before appending to it
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("failed to compact dedup file: %w", err)
+	}
+
+	logger.Info("Loaded processed broadcasts from file", "path", path, "count", len(memory.ids))
+
+	// Start cleanup routine
+	go s.cleanupRoutine()
+
+	return s, nil
+}
+
+// MarkIfNew records the ID as processed and persists it, unless it was already marked
+func (s *FileStore) MarkIfNew(correlationID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expiry, ok := s.markIfNew(correlationID, time.Now())
+	if !ok {
+		return false
+	}
+
+	if _, err := fmt.Fprintf(s.file, "%s\t%d\n", correlationID, expiry.Unix()); err != nil {
+		s.logger.Error("Failed to persist processed broadcast", "correlation_id", correlationID, "error", err)
+	}
+	return true
+}
+
+// Unmark forgets the ID and persists that by appending it with an expiry in the past,
+// which overrides the earlier line when the file is loaded
+func (s *FileStore) Unmark(correlationID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unmark(correlationID)
+
+	if _, err := fmt.Fprintf(s.file, "%s\t0\n", correlationID); err != nil {
+		s.logger.Error("Failed to persist unmarked broadcast", "correlation_id", correlationID, "error", err)
+	}
+}
+
+func (s *MemoryStore) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		id, expiryStr, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		unix, err := strconv.ParseInt(expiryStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		if expiry := time.Unix(unix, 0); expiry.After(now) {
+			s.mark(id, expiry)
+		} else {
+			s.unmark(id)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the file with only the entries still held and reopens it for
+// appending. Callers must hold the mutex or be the only user of the store.
+func (s *FileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for id, e := range s.ids {
+		fmt.Fprintf(writer, "%s\t%d\n", id, e.expiry.Unix())
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	return err
+}
+
+func (s *FileStore) cleanupRoutine() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		s.removeExpired(time.Now())
+		if err := s.compact(); err != nil {
+			s.logger.Error("Failed to compact dedup file", "path", s.path, "error", err)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Options configures the store created by New
+type Options struct {
+	Backend    string // memory or file
+	FilePath   string
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// New creates the store selected by opts.Backend
+func New(opts Options, logger *slog.Logger) (Store, error) {
+	switch opts.Backend {
+	case "", "memory":
+		return NewMemoryStore(opts.TTL, opts.MaxEntries), nil
+	case "file":
+		return NewFileStore(opts.FilePath, opts.TTL, opts.MaxEntries, logger)
+	default:
+		return nil, fmt.Errorf("unknown dedup backend %q", opts.Backend)
+	}
+}
+
+// entry is a held ID and its position in the expiry heap
+type entry struct {
+	id     string
+	expiry time.Time
+	index  int
+}
+
+// expiryHeap is a container/heap of entries with the soonest expiry first, so eviction
+// and cleanup don't scan every held ID
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiry.Before(h[j].expiry) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,127 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreStaysBounded(t *testing.T) {
+	s := newMemoryStore(time.Hour, 100)
+
+	for i := 0; i < 1000; i++ {
+		s.MarkIfNew(fmt.Sprintf("corr_%d", i))
+		if s.Len() > 100 {
+			t.Fatalf("Len = %d after %d marks, want at most 100", s.Len(), i+1)
+		}
+	}
+	if s.MarkIfNew("corr_999") {
+		t.Error("most recent ID was evicted")
+	}
+	if !s.MarkIfNew("corr_0") {
+		t.Error("oldest ID is still held after 900 newer ones")
+	}
+}
+
+func TestMemoryStoreEvictsExpiredBeforeLive(t *testing.T) {
+	s := newMemoryStore(time.Hour, 3)
+	s.mark("expired", time.Now().Add(-time.Minute))
+	s.MarkIfNew("corr_1")
+	s.MarkIfNew("corr_2")
+	s.MarkIfNew("corr_3")
+
+	for _, id := range []string{"corr_1", "corr_2", "corr_3"} {
+		if s.MarkIfNew(id) {
+			t.Errorf("%s was evicted while an expired entry was held", id)
+		}
+	}
+	if s.Len() != 3 {
+		t.Errorf("Len = %d, want 3", s.Len())
+	}
+}
+
+func TestMemoryStoreMarkIfNew(t *testing.T) {
+	s := newMemoryStore(time.Hour, 0)
+
+	if !s.MarkIfNew("corr_1") {
+		t.Fatal("first MarkIfNew returned false")
+	}
+	if s.MarkIfNew("corr_1") {
+		t.Error("second MarkIfNew returned true")
+	}
+
+	s.Unmark("corr_1")
+	if !s.MarkIfNew("corr_1") {
+		t.Error("MarkIfNew after Unmark returned false")
+	}
+}
+
+func TestMemoryStoreEvictsSoonestExpiry(t *testing.T) {
+	s := newMemoryStore(time.Hour, 2)
+	now := time.Now()
+	s.mark("corr_late", now.Add(3*time.Hour))
+	s.mark("corr_soon", now.Add(time.Hour))
+	s.mark("corr_mid", now.Add(2*time.Hour))
+
+	if _, ok := s.ids["corr_soon"]; ok {
+		t.Error("entry closest to expiring was kept")
+	}
+	for _, id := range []string{"corr_late", "corr_mid"} {
+		if _, ok := s.ids[id]; !ok {
+			t.Errorf("%s was evicted instead of the entry closest to expiring", id)
+		}
+	}
+}
+
+func TestFileStoreReloadKeepsUnmark(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	s, err := NewFileStore(path, time.Hour, 0, logger)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	s.MarkIfNew("corr_kept")
+	s.MarkIfNew("corr_unmarked")
+	s.Unmark("corr_unmarked")
+	s.file.Close()
+
+	reloaded, err := NewFileStore(path, time.Hour, 0, logger)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	defer reloaded.file.Close()
+	if reloaded.MarkIfNew("corr_kept") {
+		t.Error("marked ID was lost on reload")
+	}
+	if !reloaded.MarkIfNew("corr_unmarked") {
+		t.Error("unmarked ID was still marked after reload")
+	}
+}
+
+func TestFileStoreReloadStaysBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	s, err := NewFileStore(path, time.Hour, 0, logger)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i := 0; i < 500; i++ {
+		s.MarkIfNew(fmt.Sprintf("corr_%d", i))
+	}
+	s.file.Close()
+
+	reloaded, err := NewFileStore(path, time.Hour, 100, logger)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	defer reloaded.file.Close()
+	// The file keeps expiries to the second, so which 100 survive is not checked
+	if reloaded.Len() != 100 {
+		t.Errorf("reloaded %d of 500 IDs, want 100", reloaded.Len())
+	}
+}
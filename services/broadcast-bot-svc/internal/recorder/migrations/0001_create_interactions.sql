@@ -0,0 +1,38 @@
+-- Interactions broadcast by the listener, one row per answered question
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id                   BIGSERIAL PRIMARY KEY,
+    correlation_id       TEXT        NOT NULL UNIQUE,
+    user_id              TEXT        NOT NULL,
+    channel_id           TEXT        NOT NULL,
+    thread_id            TEXT,
+    root_question        TEXT,
+    question             TEXT        NOT NULL,
+    response             TEXT        NOT NULL,
+    source_docs          JSONB,
+    conversation_history JSONB,
+    occurred_at          TIMESTAMPTZ NOT NULL,
+    recorded_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS broadcasts_occurred_at_idx ON broadcasts (occurred_at);
+CREATE INDEX IF NOT EXISTS broadcasts_user_id_idx ON broadcasts (user_id);
+
+-- Reaction and text feedback; original_correlation_id joins to broadcasts.correlation_id
+CREATE TABLE IF NOT EXISTS feedback (
+    id                      BIGSERIAL PRIMARY KEY,
+    correlation_id          TEXT        NOT NULL UNIQUE,
+    original_correlation_id TEXT,
+    user_id                 TEXT        NOT NULL,
+    channel_id              TEXT        NOT NULL,
+    message_ts              TEXT        NOT NULL,
+    thread_ts               TEXT,
+    feedback_type           TEXT        NOT NULL,
+    feedback_text           TEXT,
+    question                TEXT,
+    response                TEXT,
+    occurred_at             TIMESTAMPTZ NOT NULL,
+    recorded_at             TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS feedback_original_correlation_id_idx ON feedback (original_correlation_id);
+CREATE INDEX IF NOT EXISTS feedback_occurred_at_idx ON feedback (occurred_at);
@@ -0,0 +1,4 @@
+-- Token usage reported by the model provider, for attributing cost per interaction and user
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS prompt_tokens     INTEGER;
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS completion_tokens INTEGER;
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS total_tokens      INTEGER;
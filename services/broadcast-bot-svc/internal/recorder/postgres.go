@@ -0,0 +1,214 @@
+package recorder
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const insertBroadcastSQL = `INSERT INTO broadcasts
+	(correlation_id, user_id, channel_id, thread_id, root_question, question, response,
+	 source_docs, conversation_history, occurred_at, prompt_tokens, completion_tokens, total_tokens)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9::jsonb, $10, $11, $12, $13)
+ON CONFLICT (correlation_id) DO NOTHING`
+
+const insertFeedbackSQL = `INSERT INTO feedback
+	(correlation_id, original_correlation_id, user_id, channel_id, message_ts, thread_ts,
+	 feedback_type, feedback_text, question, response, occurred_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (correlation_id) DO NOTHING`
+
+// PostgresRecorder writes broadcasts and feedback to the broadcasts and feedback tables.
+// Rows are keyed by correlation ID, so redelivered requests are stored once.
+type PostgresRecorder struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// NewPostgresRecorder connects to databaseURL and applies pending migrations. The pool
+// reconnects on its own if the database restarts.
+func NewPostgresRecorder(databaseURL string, logger *slog.Logger) (*PostgresRecorder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	r := &PostgresRecorder{
+		pool:   pool,
+		logger: logger,
+	}
+
+	if err := r.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return r, nil
+}
+
+// migrate applies the embedded migrations not yet recorded in schema_migrations, in
+// file name order, each in its own transaction
+func (r *PostgresRecorder) migrate(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    TEXT PRIMARY KEY,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`); err != nil {
+		return err
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if applied[version] {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			// Without arguments the script runs as one simple query, so it may hold
+			// several statements
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT DO NOTHING", version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+		r.logger.Info("Applied database migration", "version", version)
+	}
+
+	return nil
+}
+
+// RecordBroadcast stores one answered interaction
+func (r *PostgresRecorder) RecordBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	sourceDocs, err := jsonOrNull(req.SourceDocs, len(req.SourceDocs) > 0)
+	if err != nil {
+		return err
+	}
+	history, err := jsonOrNull(req.ConversationHistory, len(req.ConversationHistory) > 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.pool.Exec(ctx, insertBroadcastSQL,
+		req.CorrelationID,
+		req.UserID,
+		req.ChannelID,
+		optional(req.ThreadID),
+		optional(req.RootQuestion),
+		req.Question,
+		req.Response,
+		sourceDocs,
+		history,
+		timestamp(req.Timestamp),
+		count(req.PromptTokens),
+		count(req.CompletionTokens),
+		count(req.TotalTokens),
+	)
+	return err
+}
+
+// RecordFeedback stores one piece of feedback
+func (r *PostgresRecorder) RecordFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	_, err := r.pool.Exec(ctx, insertFeedbackSQL,
+		req.CorrelationID,
+		optional(req.OriginalCorrelationID),
+		req.UserID,
+		req.ChannelID,
+		req.MessageTS,
+		optional(req.ThreadTS),
+		req.FeedbackType,
+		optional(req.FeedbackText),
+		optional(req.Question),
+		optional(req.Response),
+		timestamp(req.Timestamp),
+	)
+	return err
+}
+
+func (r *PostgresRecorder) Close() error {
+	r.pool.Close()
+	return nil
+}
+
+// optional sends empty strings as NULL
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// count sends zero, which means the provider reported no usage, as NULL
+func count(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// timestamp uses now for requests without a time
+func timestamp(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+func jsonOrNull(v interface{}, present bool) (*string, error) {
+	if !present {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", v, err)
+	}
+	s := string(data)
+	return &s, nil
+}
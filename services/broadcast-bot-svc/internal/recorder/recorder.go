@@ -0,0 +1,38 @@
+package recorder
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+// Recorder persists broadcasts and feedback for reporting, independently of the sinks
+// they are delivered to
+type Recorder interface {
+	RecordBroadcast(ctx context.Context, req slack.BroadcastRequest) error
+	RecordFeedback(ctx context.Context, req slack.FeedbackRequest) error
+	Close() error
+}
+
+// NopRecorder discards everything; it is used when no database is configured
+type NopRecorder struct{}
+
+func (NopRecorder) RecordBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	return nil
+}
+
+func (NopRecorder) RecordFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	return nil
+}
+
+func (NopRecorder) Close() error { return nil }
+
+// New returns a Postgres recorder for databaseURL, applying any pending migrations, or a
+// NopRecorder when databaseURL is empty
+func New(databaseURL string, logger *slog.Logger) (Recorder, error) {
+	if databaseURL == "" {
+		return NopRecorder{}, nil
+	}
+	return NewPostgresRecorder(databaseURL, logger)
+}
@@ -0,0 +1,234 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+// Sink is a destination for broadcast interactions and feedback
+type Sink interface {
+	Name() string
+	SendBroadcast(ctx context.Context, req slack.BroadcastRequest) error
+	SendBroadcastBatch(ctx context.Context, reqs []slack.BroadcastRequest) error
+	SendFeedback(ctx context.Context, req slack.FeedbackRequest) error
+	SendDigest(ctx context.Context, digest slack.Digest) error
+}
+
+// BatchError is returned by SendBroadcastBatch when some of the batch wasn't posted.
+// Failed holds the indexes in the batch of those broadcasts; the rest were posted.
+type BatchError struct {
+	Failed []int
+	Err    error
+}
+
+func (e *BatchError) Error() string { return e.Err.Error() }
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// failedFrom returns a BatchError for the broadcasts of an n-long batch from index i on
+func failedFrom(i, n int, err error) *BatchError {
+	failed := make([]int, 0, n-i)
+	for ; i < n; i++ {
+		failed = append(failed, i)
+	}
+	return &BatchError{Failed: failed, Err: err}
+}
+
+// SlackSink posts to a Slack channel
+type SlackSink struct {
+	client    *slack.Client
+	channelID string
+	// routes maps source channel IDs to the channel their interactions are posted to
+	routes map[string]string
+}
+
+func NewSlackSink(client *slack.Client, channelID string) *SlackSink {
+	return &SlackSink{
+		client:    client,
+		channelID: channelID,
+	}
+}
+
+// SetChannelRoutes posts broadcasts and feedback from each source channel in routes to
+// the mapped channel instead of the default one. Digests always go to the default.
+func (s *SlackSink) SetChannelRoutes(routes map[string]string) {
+	s.routes = routes
+}
+
+// destination returns the channel interactions from sourceChannelID are posted to
+func (s *SlackSink) destination(sourceChannelID string) string {
+	if channelID, ok := s.routes[sourceChannelID]; ok {
+		return channelID
+	}
+	return s.channelID
+}
+
+func (s *SlackSink) Name() string { return "slack" }
+
+func (s *SlackSink) SendBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	return s.client.PostBroadcastMessage(ctx, s.destination(req.ChannelID), req)
+}
+
+// SendBroadcastBatch posts one batch per destination channel, in order of each
+// channel's first broadcast. After trying them all it returns a BatchError holding the
+// broadcasts bound for channels that failed, along with the first error.
+func (s *SlackSink) SendBroadcastBatch(ctx context.Context, reqs []slack.BroadcastRequest) error {
+	destinations := make([]string, 0, 1)
+	indexes := make(map[string][]int)
+	for i, req := range reqs {
+		channelID := s.destination(req.ChannelID)
+		if _, ok := indexes[channelID]; !ok {
+			destinations = append(destinations, channelID)
+		}
+		indexes[channelID] = append(indexes[channelID], i)
+	}
+
+	var batchErr *BatchError
+	for _, channelID := range destinations {
+		batch := make([]slack.BroadcastRequest, 0, len(indexes[channelID]))
+		for _, i := range indexes[channelID] {
+			batch = append(batch, reqs[i])
+		}
+
+		if err := s.client.PostBroadcastBatch(ctx, channelID, batch); err != nil {
+			if batchErr == nil {
+				batchErr = &BatchError{Err: fmt.Errorf("failed to post batch to %s: %w", channelID, err)}
+			}
+			batchErr.Failed = append(batchErr.Failed, indexes[channelID]...)
+		}
+	}
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+func (s *SlackSink) SendFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	return s.client.PostFeedbackMessage(ctx, s.destination(req.ChannelID), req)
+}
+
+func (s *SlackSink) SendDigest(ctx context.Context, digest slack.Digest) error {
+	return s.client.PostDigestMessage(ctx, s.channelID, digest)
+}
+
+// Event is the envelope written by the webhook and stdout sinks
+type Event struct {
+	Type string      `json:"type"` // "broadcast", "feedback" or "digest"
+	Data interface{} `json:"data"`
+}
+
+// WebhookSink POSTs each event as JSON to a URL
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink whose POSTs each give up after timeout
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) SendBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	return s.send(ctx, Event{Type: "broadcast", Data: req})
+}
+
+func (s *WebhookSink) SendBroadcastBatch(ctx context.Context, reqs []slack.BroadcastRequest) error {
+	for i, req := range reqs {
+		if err := s.SendBroadcast(ctx, req); err != nil {
+			return failedFrom(i, len(reqs), err)
+		}
+	}
+	return nil
+}
+
+func (s *WebhookSink) SendFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	return s.send(ctx, Event{Type: "feedback", Data: req})
+}
+
+func (s *WebhookSink) SendDigest(ctx context.Context, digest slack.Digest) error {
+	return s.send(ctx, Event{Type: "digest", Data: digest})
+}
+
+func (s *WebhookSink) send(ctx context.Context, event Event) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// NDJSONSink writes each event as a line of JSON, typically to stdout for log shipping
+type NDJSONSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func NewNDJSONSink(writer io.Writer) *NDJSONSink {
+	return &NDJSONSink{writer: writer}
+}
+
+func (s *NDJSONSink) Name() string { return "stdout" }
+
+func (s *NDJSONSink) SendBroadcast(ctx context.Context, req slack.BroadcastRequest) error {
+	return s.write(Event{Type: "broadcast", Data: req})
+}
+
+func (s *NDJSONSink) SendBroadcastBatch(ctx context.Context, reqs []slack.BroadcastRequest) error {
+	for i, req := range reqs {
+		if err := s.SendBroadcast(ctx, req); err != nil {
+			return failedFrom(i, len(reqs), err)
+		}
+	}
+	return nil
+}
+
+func (s *NDJSONSink) SendFeedback(ctx context.Context, req slack.FeedbackRequest) error {
+	return s.write(Event{Type: "feedback", Data: req})
+}
+
+func (s *NDJSONSink) SendDigest(ctx context.Context, digest slack.Digest) error {
+	return s.write(Event{Type: "digest", Data: digest})
+}
+
+func (s *NDJSONSink) write(event Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Encode appends the newline that delimits records
+	if err := json.NewEncoder(s.writer).Encode(event); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/broadcast-bot-svc/internal/slack"
+)
+
+func TestNDJSONSinkWritesOneLinePerEvent(t *testing.T) {
+	var out bytes.Buffer
+	s := NewNDJSONSink(&out)
+
+	batch := []slack.BroadcastRequest{{CorrelationID: "corr_1"}, {CorrelationID: "corr_2"}}
+	if err := s.SendBroadcastBatch(context.Background(), batch); err != nil {
+		t.Fatalf("SendBroadcastBatch: %v", err)
+	}
+	if err := s.SendFeedback(context.Background(), slack.FeedbackRequest{CorrelationID: "corr_3", FeedbackType: "positive"}); err != nil {
+		t.Fatalf("SendFeedback: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("wrote %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	wantTypes := []string{"broadcast", "broadcast", "feedback"}
+	for i, line := range lines {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		if event.Type != wantTypes[i] {
+			t.Errorf("line %d type = %q, want %q", i, event.Type, wantTypes[i])
+		}
+	}
+}
+
+func TestWebhookSinkReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	s := NewWebhookSink(server.URL, 5*time.Second)
+	if err := s.SendBroadcast(context.Background(), slack.BroadcastRequest{CorrelationID: "corr_1"}); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("SendBroadcast() = %v, want the 502 reported", err)
+	}
+}
+
+func TestSlackSinkReportsOnlyFailedDestinations(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.SlackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		if msg.Channel == "CBROKEN" {
+			fmt.Fprint(w, `{"ok":false,"error":"channel_not_found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	t.Cleanup(api.Close)
+
+	client := slack.NewClient("xoxb-test", 5*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	client.SetAPIURL(api.URL + "/")
+	s := NewSlackSink(client, "CDEFAULT")
+	s.SetChannelRoutes(map[string]string{"C2": "CBROKEN"})
+
+	batch := []slack.BroadcastRequest{
+		{ChannelID: "C1", CorrelationID: "corr_1"},
+		{ChannelID: "C2", CorrelationID: "corr_2"},
+		{ChannelID: "C1", CorrelationID: "corr_3"},
+	}
+	var batchErr *BatchError
+	if err := s.SendBroadcastBatch(context.Background(), batch); !errors.As(err, &batchErr) {
+		t.Fatalf("SendBroadcastBatch() = %v, want a BatchError", err)
+	}
+	if len(batchErr.Failed) != 1 || batchErr.Failed[0] != 1 {
+		t.Errorf("Failed = %v, want only the broadcast routed to the broken channel", batchErr.Failed)
+	}
+}
+
+func TestWebhookSinkReportsUnsentBroadcasts(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls > 1 {
+			http.Error(w, "no", http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s := NewWebhookSink(server.URL, 5*time.Second)
+	batch := []slack.BroadcastRequest{{CorrelationID: "corr_1"}, {CorrelationID: "corr_2"}, {CorrelationID: "corr_3"}}
+	var batchErr *BatchError
+	if err := s.SendBroadcastBatch(context.Background(), batch); !errors.As(err, &batchErr) {
+		t.Fatalf("SendBroadcastBatch() = %v, want a BatchError", err)
+	}
+	if len(batchErr.Failed) != 2 || batchErr.Failed[0] != 1 || batchErr.Failed[1] != 2 {
+		t.Errorf("Failed = %v, want [1 2]", batchErr.Failed)
+	}
+}
@@ -8,25 +8,44 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackretry"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 )
 
+const defaultAPIURL = "https://slack.com/api/"
+
 type Client struct {
 	botToken string
+	apiURL   string
 	logger   *slog.Logger
 	client   *http.Client
+	retry    slackretry.Policy
 }
 
-func NewClient(botToken string, logger *slog.Logger) *Client {
+// NewClient creates a Slack client whose API requests each give up after timeout
+func NewClient(botToken string, timeout time.Duration, logger *slog.Logger) *Client {
 	return &Client{
 		botToken: botToken,
+		apiURL:   defaultAPIURL,
 		logger:   logger,
+		retry:    slackretry.DefaultPolicy,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
 		},
 	}
 }
 
+// SetAPIURL sends Web API calls to url (ending in a slash) instead of Slack, e.g. a
+// Slack-compatible proxy or a fake server in tests
+func (c *Client) SetAPIURL(url string) {
+	c.apiURL = url
+}
+
 // PostFeedbackMessage sends a feedback message to the specified channel
 func (c *Client) PostFeedbackMessage(ctx context.Context, channelID string, req FeedbackRequest) error {
 	// Create different blocks based on feedback type
@@ -71,12 +90,36 @@ func (c *Client) PostFeedbackMessage(ctx context.Context, channelID string, req
 		})
 	}
 
-	// Add context information
+	// Show what was rated, when the listener could tell
+	if req.Question != "" {
+		blocks = append(blocks, MessageBlock{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Question:*\n%s", truncate(req.Question, 500)),
+			},
+		})
+	}
+	if req.Response != "" {
+		blocks = append(blocks, MessageBlock{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Response:*\n%s", truncate(req.Response, 2000)),
+			},
+		})
+	}
+
+	// Add context information, linking back to the rated interaction when known
+	contextText := fmt.Sprintf("Correlation ID: `%s`", req.CorrelationID)
+	if req.OriginalCorrelationID != "" {
+		contextText += fmt.Sprintf("  |  Rates interaction: `%s`", req.OriginalCorrelationID)
+	}
 	blocks = append(blocks, MessageBlock{
 		Type: "context",
 		Text: &TextObject{
 			Type: "mrkdwn",
-			Text: fmt.Sprintf("Correlation ID: `%s`", req.CorrelationID),
+			Text: contextText,
 		},
 	})
 
@@ -85,28 +128,8 @@ func (c *Client) PostFeedbackMessage(ctx context.Context, channelID string, req
 		Blocks:  blocks,
 	}
 
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.botToken)
-
-	resp, err := c.client.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(body))
+	if err := c.postMessage(ctx, message); err != nil {
+		return err
 	}
 
 	c.logger.Info("Feedback message posted to Slack",
@@ -128,60 +151,324 @@ func (c *Client) PostBroadcastMessage(ctx context.Context, channelID string, req
 					req.Timestamp.Format("2006-01-02 15:04:05 UTC")),
 			},
 		},
-		{
+	}
+
+	// Show the question that started the thread for follow-up turns
+	if req.RootQuestion != "" {
+		blocks = append(blocks, MessageBlock{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Thread Started With:*\n%s", req.RootQuestion),
+			},
+		})
+	}
+
+	// Summarize the earlier turns compactly so the question and response stay prominent
+	if len(req.ConversationHistory) > 0 {
+		blocks = append(blocks, MessageBlock{
+			Type: "context",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: formatConversationHistory(req.ConversationHistory),
+			},
+		})
+	}
+
+	blocks = append(blocks,
+		MessageBlock{
 			Type: "section",
 			Text: &TextObject{
 				Type: "mrkdwn",
 				Text: fmt.Sprintf("*Question:*\n%s", req.Question),
 			},
 		},
-		{
+		MessageBlock{
 			Type: "section",
 			Text: &TextObject{
 				Type: "mrkdwn",
 				Text: fmt.Sprintf("*Response:*\n%s", req.Response),
 			},
 		},
-		{
+	)
+
+	// List the docs the answer was grounded on so reviewers can diagnose bad answers
+	if len(req.SourceDocs) > 0 {
+		blocks = append(blocks, MessageBlock{
 			Type: "context",
 			Text: &TextObject{
 				Type: "mrkdwn",
-				Text: fmt.Sprintf("Correlation ID: `%s`", req.CorrelationID),
+				Text: "*Sources:* " + formatSourceDocs(req.SourceDocs),
+			},
+		})
+	}
+
+	footer := fmt.Sprintf("Correlation ID: `%s`", req.CorrelationID)
+	if req.TotalTokens > 0 {
+		footer += "  |  " + formatTokenUsage(req)
+	}
+
+	blocks = append(blocks,
+		MessageBlock{
+			Type: "context",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: footer,
+			},
+		},
+	)
+
+	message := SlackMessage{
+		Channel: channelID,
+		Blocks:  blocks,
+	}
+
+	if err := c.postMessage(ctx, message); err != nil {
+		return err
+	}
+
+	c.logger.Info("Broadcast message posted to Slack",
+		"channel", channelID,
+		"correlation_id", req.CorrelationID)
+	return nil
+}
+
+// PostBroadcastBatch posts several interactions as a single combined message, used
+// when broadcasts are being rate limited
+func (c *Client) PostBroadcastBatch(ctx context.Context, channelID string, reqs []BroadcastRequest) error {
+	blocks := []MessageBlock{
+		{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Wavie Interactions* (%d batched due to rate limiting)", len(reqs)),
 			},
 		},
 	}
 
+	for _, req := range reqs {
+		blocks = append(blocks,
+			MessageBlock{
+				Type: "section",
+				Text: &TextObject{
+					Type: "mrkdwn",
+					Text: fmt.Sprintf("*User:* <@%s>  *Channel:* <#%s>  *Time:* %s\n*Question:* %s\n*Response:* %s",
+						req.UserID,
+						req.ChannelID,
+						req.Timestamp.Format("2006-01-02 15:04:05 UTC"),
+						truncate(req.Question, 300),
+						truncate(req.Response, 1000)),
+				},
+			},
+			MessageBlock{
+				Type: "context",
+				Text: &TextObject{
+					Type: "mrkdwn",
+					Text: fmt.Sprintf("Correlation ID: `%s`", req.CorrelationID),
+				},
+			},
+		)
+	}
+
 	message := SlackMessage{
 		Channel: channelID,
 		Blocks:  blocks,
 	}
 
+	if err := c.postMessage(ctx, message); err != nil {
+		return err
+	}
+
+	c.logger.Info("Broadcast batch posted to Slack",
+		"channel", channelID,
+		"count", len(reqs))
+	return nil
+}
+
+// PostDigestMessage posts a digest of interactions and feedback as a single message
+func (c *Client) PostDigestMessage(ctx context.Context, channelID string, digest Digest) error {
+	stats := fmt.Sprintf("*Interactions:* %d\n*Unique users:* %d\n*Feedback:* :thumbsup: %d   :thumbsdown: %d   :memo: %d",
+		digest.Interactions,
+		digest.UniqueUsers,
+		digest.PositiveFeedback,
+		digest.NegativeFeedback,
+		digest.TextFeedback)
+
+	blocks := []MessageBlock{
+		{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Wavie Daily Digest*\n%s – %s",
+					digest.PeriodStart.UTC().Format("2006-01-02 15:04 UTC"),
+					digest.PeriodEnd.UTC().Format("2006-01-02 15:04 UTC")),
+			},
+		},
+		{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: stats,
+			},
+		},
+	}
+
+	if len(digest.TopChannels) > 0 {
+		lines := make([]string, len(digest.TopChannels))
+		for i, channel := range digest.TopChannels {
+			lines[i] = fmt.Sprintf("%d. <#%s> – %d", i+1, channel.ChannelID, channel.Count)
+		}
+		blocks = append(blocks, MessageBlock{
+			Type: "section",
+			Text: &TextObject{
+				Type: "mrkdwn",
+				Text: "*Top channels:*\n" + strings.Join(lines, "\n"),
+			},
+		})
+	}
+
+	if err := c.postMessage(ctx, SlackMessage{Channel: channelID, Blocks: blocks}); err != nil {
+		return err
+	}
+
+	c.logger.Info("Digest posted to Slack",
+		"channel", channelID,
+		"interactions", digest.Interactions)
+	return nil
+}
+
+// formatSourceDocs renders doc paths as a comma-separated list of code spans
+func formatSourceDocs(docs []string) string {
+	formatted := make([]string, len(docs))
+	for i, doc := range docs {
+		formatted[i] = "`" + doc + "`"
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Limits for the prior-turns context block, which Slack caps at 3000 characters
+const (
+	historyTurnChars  = 150
+	historyBlockChars = 2900
+)
+
+// formatConversationHistory renders prior turns as a "Context (N prior turns)" block with
+// each turn cut to one short line. When the block would be too long, the oldest turns
+// after the first are left out.
+func formatConversationHistory(history []ConversationMessage) string {
+	header := fmt.Sprintf("*Context (%d prior turns)*", len(history))
+	if len(history) == 1 {
+		header = "*Context (1 prior turn)*"
+	}
+
+	lines := make([]string, len(history))
+	for i, msg := range history {
+		speaker := "User"
+		if msg.Role == "assistant" {
+			speaker = "Wavie"
+		}
+		lines[i] = fmt.Sprintf("> *%s:* %s", speaker, truncate(strings.Join(strings.Fields(msg.Content), " "), historyTurnChars))
+	}
+
+	omitted := 0
+	for len(lines) > 2 && len(header)+len(strings.Join(lines, "\n")) > historyBlockChars {
+		lines = append(lines[:1], lines[2:]...)
+		omitted++
+	}
+	if omitted > 0 {
+		lines = append(lines[:1], append([]string{fmt.Sprintf("> _...%d more..._", omitted)}, lines[1:]...)...)
+	}
+
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+// postMessage sends a prepared message to chat.postMessage, retrying when Slack rate
+// limits it (HTTP 429 or ok:false "ratelimited") or fails with a 5xx
+func (c *Client) postMessage(ctx context.Context, message SlackMessage) error {
 	jsonData, err := json.Marshal(message)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonData))
+	for attempt := 0; ; attempt++ {
+		retry, requested, err := c.tryPostMessage(ctx, jsonData)
+		if !retry || attempt >= c.retry.MaxRetries {
+			return err
+		}
+
+		delay := c.retry.Delay(attempt, requested)
+		c.logger.Warn("Slack post failed, retrying",
+			"channel", message.Channel,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err)
+		if err := slackretry.Sleep(ctx, delay); err != nil {
+			return fmt.Errorf("gave up retrying message: %w", err)
+		}
+	}
+}
+
+// tryPostMessage makes a single chat.postMessage attempt. It reports whether a failure is
+// worth retrying and any delay Slack asked for with Retry-After.
+func (c *Client) tryPostMessage(ctx context.Context, jsonData []byte) (bool, time.Duration, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+"chat.postMessage", bytes.NewReader(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return false, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.botToken)
+	tracing.SetHeader(httpReq)
 
 	resp, err := c.client.Do(httpReq)
+	metrics.ObserveUpstream("slack", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		// Not retried: the message may have been posted before the connection failed
+		return false, 0, fmt.Errorf("failed to send message: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(body))
+		return slackretry.RetryableStatus(resp.StatusCode), slackretry.RetryAfter(resp), err
 	}
 
-	c.logger.Info("Broadcast message posted to Slack",
-		"channel", channelID,
-		"correlation_id", req.CorrelationID)
-	return nil
+	// Slack reports most failures as HTTP 200 with ok:false
+	var slackResp APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&slackResp); err != nil {
+		return false, 0, fmt.Errorf("failed to decode chat.postMessage response: %w", err)
+	}
+	if !slackResp.OK {
+		err := &APIError{Method: "chat.postMessage", Code: slackResp.Error}
+		return slackResp.Error == "ratelimited", slackretry.RetryAfter(resp), err
+	}
+
+	return false, 0, nil
+}
+
+// formatTokenUsage renders the answer's token usage, e.g. "Tokens: 1,234 (1,000 prompt + 234 completion)"
+func formatTokenUsage(req BroadcastRequest) string {
+	return fmt.Sprintf("Tokens: %s (%s prompt + %s completion)",
+		formatCount(req.TotalTokens),
+		formatCount(req.PromptTokens),
+		formatCount(req.CompletionTokens))
+}
+
+// formatCount formats n with thousands separators
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// truncate shortens text to at most maxLen runes, marking the cut with an ellipsis
+func truncate(text string, maxLen int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	return string(runes[:maxLen-3]) + "..."
 }
@@ -0,0 +1,188 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client posting to a fake Slack API, and the channel the fake
+// sends each decoded chat.postMessage payload to
+func newTestClient(t *testing.T) (*Client, <-chan SlackMessage) {
+	t.Helper()
+
+	posted := make(chan SlackMessage, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg SlackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		posted <- msg
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	t.Cleanup(api.Close)
+
+	c := NewClient("xoxb-test", 5*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.SetAPIURL(api.URL + "/")
+	return c, posted
+}
+
+// contextBlocks returns the text of each context block in msg
+func contextBlocks(msg SlackMessage) []string {
+	var texts []string
+	for _, block := range msg.Blocks {
+		if block.Type == "context" && block.Text != nil {
+			texts = append(texts, block.Text.Text)
+		}
+	}
+	return texts
+}
+
+func testBroadcast() BroadcastRequest {
+	return BroadcastRequest{
+		UserID:        "UASKER",
+		ChannelID:     "C123",
+		Question:      "How do I connect a wallet?",
+		Response:      "Go to Connections.",
+		Timestamp:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		CorrelationID: "corr_1",
+	}
+}
+
+func TestBroadcastRendersSourceDocs(t *testing.T) {
+	c, posted := newTestClient(t)
+
+	req := testBroadcast()
+	req.SourceDocs = []string{"wallets/connect.md", "wallets/troubleshooting.md"}
+	if err := c.PostBroadcastMessage(context.Background(), "CANALYTICS", req); err != nil {
+		t.Fatalf("PostBroadcastMessage: %v", err)
+	}
+
+	msg := <-posted
+	want := "*Sources:* `wallets/connect.md`, `wallets/troubleshooting.md`"
+	blocks := contextBlocks(msg)
+	found := false
+	for _, text := range blocks {
+		found = found || text == want
+	}
+	if !found {
+		t.Errorf("context blocks = %q, want one reading %q", blocks, want)
+	}
+}
+
+func TestBroadcastWithoutSourceDocsHasNoSourcesBlock(t *testing.T) {
+	c, posted := newTestClient(t)
+
+	if err := c.PostBroadcastMessage(context.Background(), "CANALYTICS", testBroadcast()); err != nil {
+		t.Fatalf("PostBroadcastMessage: %v", err)
+	}
+
+	for _, text := range contextBlocks(<-posted) {
+		if strings.Contains(text, "Sources") {
+			t.Errorf("got context block %q for a broadcast without source docs", text)
+		}
+	}
+}
+
+// slackReply is one scripted response from the fake Slack API
+type slackReply struct {
+	status int
+	body   string
+}
+
+// newScriptedClient returns a client whose fake Slack API answers successive calls with
+// replies, repeating the last one, and the number of calls it received. Retries back
+// off by milliseconds rather than seconds.
+func newScriptedClient(t *testing.T, replies ...slackReply) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		reply := replies[min(n, len(replies))-1]
+		w.WriteHeader(reply.status)
+		fmt.Fprint(w, reply.body)
+	}))
+	t.Cleanup(api.Close)
+
+	c := NewClient("xoxb-test", 5*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.SetAPIURL(api.URL + "/")
+	c.retry.BaseDelay = time.Millisecond
+	return c, &calls
+}
+
+func TestRateLimitedPostIsRetried(t *testing.T) {
+	tests := map[string]slackReply{
+		"HTTP 429": {http.StatusTooManyRequests, ""},
+		"ok:false": {http.StatusOK, `{"ok":false,"error":"ratelimited"}`},
+		"HTTP 503": {http.StatusServiceUnavailable, "upstream unavailable"},
+	}
+
+	for name, limited := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, calls := newScriptedClient(t, limited, slackReply{http.StatusOK, `{"ok":true}`})
+
+			if err := c.PostBroadcastMessage(context.Background(), "C123", testBroadcast()); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if n := calls.Load(); n != 2 {
+				t.Errorf("made %d calls, want 2", n)
+			}
+		})
+	}
+}
+
+func TestPostGivesUpAfterMaxRetries(t *testing.T) {
+	c, calls := newScriptedClient(t, slackReply{http.StatusTooManyRequests, ""})
+
+	if err := c.PostBroadcastMessage(context.Background(), "C123", testBroadcast()); err == nil {
+		t.Fatal("got nil error, want the rate limit reported")
+	}
+	if n, want := calls.Load(), int32(c.retry.MaxRetries+1); n != want {
+		t.Errorf("made %d calls, want %d", n, want)
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	c, calls := newScriptedClient(t, slackReply{http.StatusBadRequest, "invalid_json"})
+
+	if err := c.PostFeedbackMessage(context.Background(), "C123", FeedbackRequest{FeedbackType: "positive"}); err == nil {
+		t.Fatal("got nil error, want the 400 reported")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d calls, want 1", n)
+	}
+}
+
+func TestOKFalseIsReturnedAsError(t *testing.T) {
+	posts := map[string]func(*Client) error{
+		"broadcast": func(c *Client) error {
+			return c.PostBroadcastMessage(context.Background(), "C123", testBroadcast())
+		},
+		"feedback": func(c *Client) error {
+			return c.PostFeedbackMessage(context.Background(), "C123", FeedbackRequest{FeedbackType: "positive"})
+		},
+	}
+
+	for name, post := range posts {
+		t.Run(name, func(t *testing.T) {
+			c, calls := newScriptedClient(t, slackReply{http.StatusOK, `{"ok":false,"error":"channel_not_found"}`})
+
+			err := post(c)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != "channel_not_found" {
+				t.Fatalf("got %v, want a channel_not_found APIError", err)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("made %d calls, want 1 since channel_not_found is not retryable", n)
+			}
+		})
+	}
+}
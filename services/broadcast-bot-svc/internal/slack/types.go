@@ -1,14 +1,33 @@
 package slack
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type BroadcastRequest struct {
-	UserID        string    `json:"user_id"`
-	ChannelID     string    `json:"channel_id"`
-	Question      string    `json:"question"`
-	Response      string    `json:"response"`
-	Timestamp     time.Time `json:"timestamp"`
-	CorrelationID string    `json:"correlation_id"`
+	UserID       string `json:"user_id"`
+	ChannelID    string `json:"channel_id"`
+	ThreadID     string `json:"thread_id,omitempty"`
+	RootQuestion string `json:"root_question,omitempty"`
+	// ConversationHistory holds the thread's turns before this question, oldest first
+	ConversationHistory []ConversationMessage `json:"conversation_history,omitempty"`
+	Question            string                `json:"question"`
+	Response            string                `json:"response"`
+	SourceDocs          []string              `json:"source_docs,omitempty"`
+	Timestamp           time.Time             `json:"timestamp"`
+	CorrelationID       string                `json:"correlation_id"`
+	// Token usage of the answer, when the model provider reported it
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+}
+
+// ConversationMessage is one earlier turn of the thread a broadcast belongs to
+type ConversationMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // FeedbackRequest represents a request to broadcast user feedback
@@ -23,6 +42,42 @@ type FeedbackRequest struct {
 	FeedbackText  string    `json:"feedback_text,omitempty"`
 	Timestamp     time.Time `json:"timestamp"`
 	CorrelationID string    `json:"correlation_id"`
+	// OriginalCorrelationID is the correlation ID of the interaction being rated, if known
+	OriginalCorrelationID string `json:"original_correlation_id,omitempty"`
+}
+
+// Digest summarizes the interactions and feedback received over a period
+type Digest struct {
+	PeriodStart      time.Time      `json:"period_start"`
+	PeriodEnd        time.Time      `json:"period_end"`
+	Interactions     int            `json:"interactions"`
+	UniqueUsers      int            `json:"unique_users"`
+	PositiveFeedback int            `json:"positive_feedback"`
+	NegativeFeedback int            `json:"negative_feedback"`
+	TextFeedback     int            `json:"text_feedback"`
+	TopChannels      []ChannelCount `json:"top_channels"`
+}
+
+// ChannelCount is the number of interactions in one channel
+type ChannelCount struct {
+	ChannelID string `json:"channel_id"`
+	Count     int    `json:"count"`
+}
+
+// APIResponse holds the fields common to every Slack Web API response
+type APIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// APIError is returned when Slack responds with ok:false
+type APIError struct {
+	Method string
+	Code   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack API error: %s returned %s", e.Method, e.Code)
 }
 
 type MessageBlock struct {
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,27 +16,37 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackcreds"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	Port               string `envconfig:"PORT" default:"8080"`
-	SlackBotToken      string `envconfig:"BROADCASTER_SLACK_BOT_TOKEN" required:"true"`
-	BroadcastChannelID string `envconfig:"BROADCAST_CHANNEL_ID" required:"true"`
+	Port               string        `envconfig:"PORT" default:"8080"`
+	SlackBotToken      string        `envconfig:"BROADCASTER_SLACK_BOT_TOKEN" required:"true"`
+	BroadcastChannelID string        `envconfig:"BROADCAST_CHANNEL_ID" required:"true"`
+	UpstreamTimeout    time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"30s"`
+	ServerReadTimeout  time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"60s"`
+	ServerWriteTimeout time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"60s"`
+
+	// Request bodies larger than this get a 413
+	MaxRequestBodyBytes int64 `envconfig:"MAX_REQUEST_BODY_BYTES" default:"1048576"`
 }
 
 type BroadcastRequest struct {
-	User          string `json:"user"`
-	Channel       string `json:"channel"`
-	Question      string `json:"question"`
-	Response      string `json:"response"`
-	Timestamp     string `json:"timestamp"`
-	CorrelationID string `json:"correlation_id"`
+	User          string   `json:"user"`
+	Channel       string   `json:"channel"`
+	Question      string   `json:"question"`
+	Response      string   `json:"response"`
+	SourceDocs    []string `json:"source_docs,omitempty"`
+	Timestamp     string   `json:"timestamp"`
+	CorrelationID string   `json:"correlation_id"`
 }
 
 type SlackBlock struct {
-	Type   string                 `json:"type"`
-	Text   map[string]interface{} `json:"text,omitempty"`
+	Type   string                   `json:"type"`
+	Text   map[string]interface{}   `json:"text,omitempty"`
 	Fields []map[string]interface{} `json:"fields,omitempty"`
 }
 
@@ -54,7 +66,7 @@ func NewBroadcastService(config *Config) *BroadcastService {
 	return &BroadcastService{
 		config: config,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: config.UpstreamTimeout,
 		},
 		processedMessages: make(map[string]bool),
 	}
@@ -70,7 +82,7 @@ func (s *BroadcastService) markMessageProcessed(correlationID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.processedMessages[correlationID] = true
-	
+
 	if len(s.processedMessages) > 1000 {
 		newMap := make(map[string]bool)
 		count := 0
@@ -98,55 +110,75 @@ func (s *BroadcastService) buildSlackMessage(req *BroadcastRequest) SlackMessage
 	question := s.truncateText(req.Question, 300)
 	response := s.truncateText(req.Response, 800)
 
-	return SlackMessage{
-		Channel: s.config.BroadcastChannelID,
-		Blocks: []SlackBlock{
-			{
-				Type: "section",
-				Text: map[string]interface{}{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*🤖 New Wavie Interaction*\n_%s_", timeStr),
-				},
+	blocks := []SlackBlock{
+		{
+			Type: "section",
+			Text: map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*🤖 New Wavie Interaction*\n_%s_", timeStr),
 			},
-			{
-				Type: "section",
-				Fields: []map[string]interface{}{
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*User:*\n<@%s>", req.User),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Channel:*\n<#%s>", req.Channel),
-					},
-				},
-			},
-			{
-				Type: "section",
-				Text: map[string]interface{}{
+		},
+		{
+			Type: "section",
+			Fields: []map[string]interface{}{
+				{
 					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Question:*\n```%s```", question),
+					"text": fmt.Sprintf("*User:*\n<@%s>", req.User),
 				},
-			},
-			{
-				Type: "section",
-				Text: map[string]interface{}{
+				{
 					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Response:*\n%s", response),
+					"text": fmt.Sprintf("*Channel:*\n<#%s>", req.Channel),
 				},
 			},
-			{
-				Type: "section",
-				Text: map[string]interface{}{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Correlation ID:* `%s`", req.CorrelationID),
-				},
+		},
+		{
+			Type: "section",
+			Text: map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*Question:*\n```%s```", question),
 			},
-			{
-				Type: "divider",
+		},
+		{
+			Type: "section",
+			Text: map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*Response:*\n%s", response),
 			},
 		},
 	}
+
+	// List the docs the answer was grounded on so reviewers can diagnose bad answers
+	if len(req.SourceDocs) > 0 {
+		sources := make([]string, len(req.SourceDocs))
+		for i, doc := range req.SourceDocs {
+			sources[i] = "`" + doc + "`"
+		}
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*Sources:* %s", strings.Join(sources, ", ")),
+			},
+		})
+	}
+
+	blocks = append(blocks,
+		SlackBlock{
+			Type: "section",
+			Text: map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*Correlation ID:* `%s`", req.CorrelationID),
+			},
+		},
+		SlackBlock{
+			Type: "divider",
+		},
+	)
+
+	return SlackMessage{
+		Channel: s.config.BroadcastChannelID,
+		Blocks:  blocks,
+	}
 }
 
 func (s *BroadcastService) sendSlackMessage(message SlackMessage) error {
@@ -164,6 +196,7 @@ func (s *BroadcastService) sendSlackMessage(message SlackMessage) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
+	metrics.ObserveUpstream("slack", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %v", err)
 	}
@@ -187,18 +220,28 @@ func (s *BroadcastService) sendSlackMessage(message SlackMessage) error {
 
 func (s *BroadcastService) handleBroadcast(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req BroadcastRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
+	// Fall back to the caller's X-Correlation-ID, but not a generated one: the ID
+	// deduplicates redeliveries, so it must be stable across retries
+	if req.CorrelationID == "" {
+		req.CorrelationID = r.Header.Get(tracing.Header)
+	}
+
 	if req.CorrelationID == "" || req.User == "" || req.Channel == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Missing required fields: correlation_id, user and channel")
 		return
 	}
 
@@ -211,13 +254,13 @@ func (s *BroadcastService) handleBroadcast(w http.ResponseWriter, r *http.Reques
 
 	s.markMessageProcessed(req.CorrelationID)
 
-	log.Printf("Broadcasting interaction (ID: %s): User %s in Channel %s", 
+	log.Printf("Broadcasting interaction (ID: %s): User %s in Channel %s",
 		req.CorrelationID, req.User, req.Channel)
 
 	message := s.buildSlackMessage(&req)
 	if err := s.sendSlackMessage(message); err != nil {
 		log.Printf("Failed to send broadcast message (ID: %s): %v", req.CorrelationID, err)
-		http.Error(w, "Failed to send broadcast", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeUpstreamError, "Failed to send broadcast")
 		return
 	}
 
@@ -242,31 +285,62 @@ func (s *BroadcastService) healthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// limitBody caps request bodies at maxBytes so an oversized POST cannot exhaust memory.
+// Reading past the limit fails with an error that isBodyTooLarge recognizes.
+func limitBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err came from reading past limitBody's limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 func main() {
 	var config Config
 	if err := envconfig.Process("", &config); err != nil {
 		log.Fatalf("Failed to process environment variables: %v", err)
 	}
 
-	if !strings.HasPrefix(config.SlackBotToken, "xoxb-") {
-		log.Fatalf("Invalid Slack bot token format. Expected to start with 'xoxb-'")
+	if err := slackcreds.ValidateBotToken(config.SlackBotToken); err != nil {
+		log.Fatalf("Invalid BROADCASTER_SLACK_BOT_TOKEN: %v", err)
 	}
 
-	if !strings.HasPrefix(config.BroadcastChannelID, "C") && !strings.HasPrefix(config.BroadcastChannelID, "G") {
-		log.Fatalf("Invalid channel ID format. Expected to start with 'C' or 'G'")
+	if err := slackcreds.ValidateChannelID(config.BroadcastChannelID); err != nil {
+		log.Fatalf("Invalid BROADCAST_CHANNEL_ID: %v", err)
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":     config.UpstreamTimeout,
+		"SERVER_READ_TIMEOUT":  config.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT": config.ServerWriteTimeout,
+	} {
+		if timeout <= 0 {
+			log.Fatalf("%s must be a positive duration, got %v", name, timeout)
+		}
+	}
+	if config.MaxRequestBodyBytes <= 0 {
+		log.Fatalf("MAX_REQUEST_BODY_BYTES must be positive, got %d", config.MaxRequestBodyBytes)
 	}
 
 	service := NewBroadcastService(&config)
 
+	metrics.SetService("broadcast-bot")
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", service.healthCheck)
-	mux.HandleFunc("/api/broadcast", service.handleBroadcast)
+	mux.Handle("/health", metrics.Instrument("/health", http.HandlerFunc(service.healthCheck)))
+	mux.Handle("/api/broadcast", metrics.Instrument("/api/broadcast", http.HandlerFunc(service.handleBroadcast)))
+	mux.Handle("/metrics", metrics.Handler())
 
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
-		ReadTimeout:  60 * time.Second,
-		WriteTimeout: 60 * time.Second,
+		Handler:      tracing.Middleware(limitBody(mux, config.MaxRequestBodyBytes), slog.Default()),
+		ReadTimeout:  config.ServerReadTimeout,
+		WriteTimeout: config.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -284,4 +358,4 @@ func main() {
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+)
+
+func TestOversizedBroadcastIsRejected(t *testing.T) {
+	s := NewBroadcastService(&Config{
+		SlackBotToken:      "xoxb-test",
+		BroadcastChannelID: "C123",
+		UpstreamTimeout:    5 * time.Second,
+	})
+	handler := limitBody(http.HandlerFunc(s.handleBroadcast), 64)
+
+	body := `{"correlation_id":"wavie_1","user":"U1","channel":"C1","response":"` + strings.Repeat("wallet ", 100) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/broadcast", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d for a %d byte body over a 64 byte limit, want 413", rec.Code, len(body))
+	}
+	if s.isMessageProcessed("wavie_1") {
+		t.Error("oversized broadcast was marked processed")
+	}
+}
+
+func TestRejectedBroadcastCarriesRequestID(t *testing.T) {
+	s := NewBroadcastService(&Config{
+		SlackBotToken:      "xoxb-test",
+		BroadcastChannelID: "C123",
+		UpstreamTimeout:    5 * time.Second,
+	})
+	handler := tracing.Middleware(limitBody(http.HandlerFunc(s.handleBroadcast), 64), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	body := `{"correlation_id":"wavie_1","response":"` + strings.Repeat("wallet ", 100) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/broadcast", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge || rec.Header().Get(tracing.RequestIDHeader) == "" {
+		t.Errorf("got %d with %s %q, want a 413 still carrying a request ID", rec.Code, tracing.RequestIDHeader, rec.Header().Get(tracing.RequestIDHeader))
+	}
+}
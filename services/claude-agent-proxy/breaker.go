@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen is returned instead of calling Claude while the circuit is open
+var errCircuitOpen = errors.New("Claude API temporarily unavailable: circuit breaker open")
+
+// CircuitBreaker stops calling Claude while it keeps failing, so requests fail fast
+// during an outage instead of each waiting out its timeout. It opens after threshold
+// consecutive failures and rejects requests for cooldown. Then it half-opens: one trial
+// request is let through, and its result closes the circuit or opens it for another
+// cooldown. A nil CircuitBreaker lets everything through.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state    string
+	failures int
+	openedAt time.Time
+	// trialAt is when the half-open trial request was let through; zero when none is in
+	// flight. A trial that never reports back is replaced after a cooldown.
+	trialAt time.Time
+}
+
+// CircuitStatus is a snapshot of a CircuitBreaker for the health check
+type CircuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     circuitClosed,
+	}
+}
+
+// Allow returns errCircuitOpen if a request must not be sent at now. Every allowed
+// request must be followed by Success or Failure.
+func (b *CircuitBreaker) Allow(now time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		b.trialAt = now
+	case circuitHalfOpen:
+		if !b.trialAt.IsZero() && now.Sub(b.trialAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.trialAt = now
+	}
+	return nil
+}
+
+// Success records that Claude answered, closing the circuit
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = circuitClosed
+	b.failures = 0
+	b.trialAt = time.Time{}
+}
+
+// Failure records that Claude failed at now, opening the circuit if the threshold is
+// reached or the half-open trial failed
+func (b *CircuitBreaker) Failure(now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+		b.state = circuitOpen
+		b.openedAt = now
+		b.trialAt = time.Time{}
+	}
+}
+
+// Status returns the current state. A nil CircuitBreaker reports closed.
+func (b *CircuitBreaker) Status() CircuitStatus {
+	if b == nil {
+		return CircuitStatus{State: circuitClosed}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != circuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
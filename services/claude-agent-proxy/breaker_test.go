@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitOpensAfterThresholdFailures(t *testing.T) {
+	b := NewCircuitBreaker(3, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		b.Failure(now)
+	}
+	if err := b.Allow(now); err != nil {
+		t.Fatalf("Allow after 2 of 3 failures: %v", err)
+	}
+
+	b.Failure(now)
+	if got := b.Status().State; got != circuitOpen {
+		t.Fatalf("state = %s after 3 failures, want open", got)
+	}
+	if err := b.Allow(now.Add(59 * time.Second)); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("Allow during cooldown = %v, want errCircuitOpen", err)
+	}
+}
+
+func TestCircuitSuccessResetsFailureCount(t *testing.T) {
+	b := NewCircuitBreaker(3, time.Minute)
+	now := time.Now()
+
+	b.Failure(now)
+	b.Failure(now)
+	b.Success()
+	b.Failure(now)
+	b.Failure(now)
+
+	if status := b.Status(); status.State != circuitClosed || status.ConsecutiveFailures != 2 {
+		t.Errorf("got %s with %d failures, want closed with 2 since the success", status.State, status.ConsecutiveFailures)
+	}
+}
+
+func TestCircuitHalfOpensForOneTrialAfterCooldown(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	opened := time.Now()
+	b.Failure(opened)
+
+	trial := opened.Add(time.Minute)
+	if err := b.Allow(trial); err != nil {
+		t.Fatalf("Allow after cooldown: %v", err)
+	}
+	if got := b.Status().State; got != circuitHalfOpen {
+		t.Fatalf("state = %s after cooldown, want half_open", got)
+	}
+	if err := b.Allow(trial.Add(time.Second)); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("second Allow while the trial is in flight = %v, want errCircuitOpen", err)
+	}
+	if err := b.Allow(trial.Add(time.Minute)); err != nil {
+		t.Errorf("Allow once an unreported trial is a cooldown old: %v", err)
+	}
+}
+
+func TestCircuitTrialResultClosesOrReopens(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	opened := time.Now()
+	b.Failure(opened)
+
+	trial := opened.Add(time.Minute)
+	b.Allow(trial)
+	b.Failure(trial)
+	if status := b.Status(); status.State != circuitOpen || !status.OpenedAt.Equal(trial) {
+		t.Fatalf("got %s opened at %v after a failed trial, want open again at %v", status.State, status.OpenedAt, trial)
+	}
+
+	b.Allow(trial.Add(time.Minute))
+	b.Success()
+	if status := b.Status(); status.State != circuitClosed || status.ConsecutiveFailures != 0 || status.OpenedAt != nil {
+		t.Errorf("got %+v after a successful trial, want closed with no failures", status)
+	}
+}
+
+func TestNilCircuitBreakerAllowsEverything(t *testing.T) {
+	var b *CircuitBreaker
+	b.Failure(time.Now())
+
+	if err := b.Allow(time.Now()); err != nil || b.Status().State != circuitClosed {
+		t.Errorf("nil breaker got %v in state %s, want it always closed", err, b.Status().State)
+	}
+}
+
+func TestRetriedRequestCountsAsOneFailure(t *testing.T) {
+	config := testConfig(t)
+	config.MaxRetries = 2
+	config.CircuitBreakerThreshold = 2
+	newFlakyClaude(t, config, 10, http.StatusServiceUnavailable, "0")
+	s := NewClaudeProxyService(config)
+
+	if _, err := s.callClaudeAPI(context.Background(), config.ClaudeModel, []ClaudeMessage{{Role: "user", Content: "Hi"}}, nil, "corr_1"); err == nil {
+		t.Fatal("callClaudeAPI succeeded against a failing upstream")
+	}
+	if status := s.breaker.Status(); status.State != circuitClosed || status.ConsecutiveFailures != 1 {
+		t.Errorf("got %s with %d failures after one request of three attempts, want closed with 1", status.State, status.ConsecutiveFailures)
+	}
+}
+
+func TestHalfOpenTrialCanRetry(t *testing.T) {
+	config := testConfig(t)
+	config.MaxRetries = 2
+	config.CircuitBreakerThreshold = 1
+	config.CircuitBreakerCooldown = time.Hour
+	calls := newFlakyClaude(t, config, 1, http.StatusServiceUnavailable, "0")
+	s := NewClaudeProxyService(config)
+	s.breaker.Failure(time.Now().Add(-2 * time.Hour))
+
+	if _, err := s.callClaudeAPI(context.Background(), config.ClaudeModel, []ClaudeMessage{{Role: "user", Content: "Hi"}}, nil, "corr_1"); err != nil {
+		t.Fatalf("trial request: %v", err)
+	}
+	if got := s.breaker.Status().State; got != circuitClosed || calls.Load() != 2 {
+		t.Errorf("state = %s after %d calls, want the trial's retry to succeed and close the circuit", got, calls.Load())
+	}
+}
+
+func TestStreamErrorAfterHeadersCountsAsFailure(t *testing.T) {
+	config := testConfig(t)
+	config.CircuitBreakerThreshold = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Go to\"}}\n\n")
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	t.Cleanup(server.Close)
+	config.AnthropicAPIURL = server.URL
+	s := NewClaudeProxyService(config)
+
+	_, err := s.streamClaudeAPI(context.Background(), config.ClaudeModel, []ClaudeMessage{{Role: "user", Content: "Hi"}}, nil, "corr_1", func(string) error { return nil })
+	if err == nil {
+		t.Fatal("streamClaudeAPI succeeded on a stream that errored")
+	}
+	if got := s.breaker.Status().State; got != circuitOpen {
+		t.Errorf("state = %s after a stream failed partway through, want open", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+)
+
+// fitContextWindow trims a request until the system prompt and messages leave room for
+// MaxTokens of output within model's context window, which would otherwise get it
+// rejected outright. The oldest turns go first, since they matter least to the question
+// being asked, then the lowest-scored of relevantChunks. The question itself is always
+// kept.
+func (s *ClaudeProxyService) fitContextWindow(model string, relevantChunks []Chunk, messages []ClaudeMessage, correlationID string) ([]Chunk, []ClaudeMessage) {
+	budget := s.tokenGuard.InputBudget(model, s.config.MaxTokens)
+	messageTokens := 0
+	for _, msg := range messages {
+		messageTokens += tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+	}
+	kept := messages
+	promptTokens := func(chunks []Chunk) int {
+		return tokenlimit.EstimateTokens(s.buildSystemPrompt(chunks, kept))
+	}
+
+	for len(kept) > 1 && promptTokens(relevantChunks)+messageTokens > budget {
+		// The conversation must still start with a user turn after dropping
+		drop := 1
+		for drop < len(kept)-1 && kept[drop].Role != "user" {
+			drop++
+		}
+		for _, msg := range kept[:drop] {
+			messageTokens -= tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+		}
+		kept = kept[drop:]
+	}
+	if dropped := len(messages) - len(kept); dropped > 0 {
+		log.Printf("Dropped the oldest %d of %d messages to stay within %d input tokens for %s (ID: %s)",
+			dropped, len(messages), budget, model, correlationID)
+	}
+
+	chunks := relevantChunks
+	for len(chunks) > 0 && promptTokens(chunks)+messageTokens > budget {
+		lowest := 0
+		for i, chunk := range chunks {
+			if chunk.Score < chunks[lowest].Score {
+				lowest = i
+			}
+		}
+		log.Printf("Dropping chunk %s (score %.2f) to fit the context window (ID: %s)",
+			chunks[lowest].ID, chunks[lowest].Score, correlationID)
+
+		trimmed := make([]Chunk, 0, len(chunks)-1)
+		trimmed = append(trimmed, chunks[:lowest]...)
+		chunks = append(trimmed, chunks[lowest+1:]...)
+	}
+	if dropped := len(relevantChunks) - len(chunks); dropped > 0 {
+		log.Printf("Dropped %d of %d chunks to stay within %d input tokens for %s (ID: %s)",
+			dropped, len(relevantChunks), budget, model, correlationID)
+	}
+
+	return chunks, kept
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+)
+
+// budgetFixture returns a conversation of about 6k tokens ending in a question, and four
+// retrieved chunks of about 1k tokens each
+func budgetFixture() ([]ClaudeMessage, []Chunk) {
+	messages := make([]ClaudeMessage, 0, 13)
+	for i := 0; i < 6; i++ {
+		messages = append(messages,
+			ClaudeMessage{Role: "user", Content: strings.Repeat("question ", 250)},
+			ClaudeMessage{Role: "assistant", Content: strings.Repeat("answer ", 285)})
+	}
+	messages = append(messages, ClaudeMessage{Role: "user", Content: "How do I reconcile a wallet?"})
+
+	chunks := make([]Chunk, 4)
+	for i := range chunks {
+		chunks[i] = Chunk{
+			ID:      fmt.Sprintf("doc.md_chunk_%d", i),
+			Title:   "Reconciliation",
+			Content: strings.Repeat("reconcile ", 400),
+			Score:   float64(10 - i),
+		}
+	}
+	return messages, chunks
+}
+
+func TestFitContextWindowSmallWindowTrimsAggressively(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	s.config.MaxTokens = 1000
+	s.tokenGuard = tokenlimit.NewGuard(map[string]int{"claude-small": 4000})
+	messages, chunks := budgetFixture()
+
+	keptChunks, keptMessages := s.fitContextWindow("claude-small", chunks, messages, "test")
+
+	if len(keptMessages) != 1 || keptMessages[0] != messages[len(messages)-1] {
+		t.Errorf("kept %d messages, want only the question", len(keptMessages))
+	}
+	if len(keptChunks) == 0 || len(keptChunks) == len(chunks) {
+		t.Fatalf("kept %d of %d chunks, want some dropped", len(keptChunks), len(chunks))
+	}
+	for i, chunk := range keptChunks {
+		if chunk.ID != chunks[i].ID {
+			t.Errorf("kept chunk %d is %s, want the highest-scored chunks in order", i, chunk.ID)
+		}
+	}
+
+	used := tokenlimit.EstimateTokens(s.buildSystemPrompt(keptChunks, keptMessages))
+	for _, msg := range keptMessages {
+		used += tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+	}
+	if used > 4000-1000 {
+		t.Errorf("trimmed request uses ~%d tokens, over the %d token budget", used, 4000-1000)
+	}
+}
+
+func TestFitContextWindowKeepsConversationStartingWithUser(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	s.config.MaxTokens = 1000
+	s.tokenGuard = tokenlimit.NewGuard(map[string]int{"claude-medium": 7000})
+	messages, chunks := budgetFixture()
+
+	_, keptMessages := s.fitContextWindow("claude-medium", chunks, messages, "test")
+
+	if len(keptMessages) == 1 || len(keptMessages) == len(messages) {
+		t.Fatalf("kept %d of %d messages, want only the oldest dropped", len(keptMessages), len(messages))
+	}
+	if keptMessages[0].Role != "user" {
+		t.Errorf("trimmed conversation starts with %s, want user", keptMessages[0].Role)
+	}
+}
+
+func TestFitContextWindowLargeWindowKeepsEverything(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	messages, chunks := budgetFixture()
+
+	keptChunks, keptMessages := s.fitContextWindow("claude-3-sonnet-20240229", chunks, messages, "test")
+
+	if len(keptChunks) != len(chunks) || len(keptMessages) != len(messages) {
+		t.Errorf("kept %d chunks and %d messages, want all %d and %d in a 200k window",
+			len(keptChunks), len(keptMessages), len(chunks), len(messages))
+	}
+}
+
+func TestFitContextWindowDropsChunkLargerThanWindow(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	s.config.MaxTokens = 1000
+	s.tokenGuard = tokenlimit.NewGuard(map[string]int{"claude-small": 4000})
+	question := ClaudeMessage{Role: "user", Content: "How do I reconcile a wallet?"}
+	oversized := Chunk{
+		ID:      "ledger.md_chunk_0",
+		Title:   "Ledger",
+		Content: strings.Repeat("reconcile ", 4000),
+		Score:   10,
+	}
+
+	keptChunks, keptMessages := s.fitContextWindow("claude-small", []Chunk{oversized}, []ClaudeMessage{question}, "test")
+
+	if len(keptChunks) != 0 {
+		t.Errorf("kept %d chunks, want the ~10k token chunk dropped from a 3k budget", len(keptChunks))
+	}
+	if len(keptMessages) != 1 || keptMessages[0] != question {
+		t.Errorf("kept messages %v, want the question", keptMessages)
+	}
+	used := tokenlimit.EstimateTokens(s.buildSystemPrompt(keptChunks, keptMessages)) +
+		tokenlimit.EstimateMessageTokens(question.Role, question.Content)
+	if used > 4000-1000 {
+		t.Errorf("trimmed request uses ~%d tokens, over the %d token budget", used, 4000-1000)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache keeps recent completions for identical questions so popular FAQ-style
+// questions don't spend tokens on every ask. It holds at most maxEntries, evicting the
+// least recently used, and each entry expires after ttl. A nil ResponseCache never hits.
+type ResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	entries    map[string]*list.Element
+	// order holds *cacheEntry values, most recently used at the front
+	order *list.List
+}
+
+type cacheEntry struct {
+	key        string
+	completion ClaudeCompletion
+	expiresAt  time.Time
+}
+
+func NewResponseCache(maxEntries int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns a copy of the completion cached under key if it hasn't expired at now
+func (c *ResponseCache) Get(key string, now time.Time) (*ClaudeCompletion, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	completion := entry.completion
+	return &completion, true
+}
+
+// Put caches completion under key until ttl after now, evicting the least recently used
+// entry when the cache is full
+func (c *ResponseCache) Put(key string, completion *ClaudeCompletion, now time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.completion = *completion
+		entry.expiresAt = now.Add(c.ttl)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{
+		key:        key,
+		completion: *completion,
+		expiresAt:  now.Add(c.ttl),
+	})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// Purge drops every entry, e.g. after a docs reload changes what chunks contain
+func (c *ResponseCache) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of cached entries, including expired ones not yet removed
+func (c *ResponseCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// responseCacheKey identifies a question by model, its text ignoring case and spacing,
+// and the chunks retrieved for it, so a docs change that alters retrieval is a miss
+func responseCacheKey(model, question string, chunks []Chunk) string {
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(strings.Fields(strings.ToLower(question)), " ")))
+	for _, chunk := range chunks {
+		hash.Write([]byte{0})
+		hash.Write([]byte(chunk.ID))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
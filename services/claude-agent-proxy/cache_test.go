@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheHitAndMiss(t *testing.T) {
+	c := NewResponseCache(10, time.Minute)
+	now := time.Now()
+	c.Put("wallets", &ClaudeCompletion{Text: "Go to Connections."}, now)
+
+	if completion, ok := c.Get("wallets", now.Add(59*time.Second)); !ok || completion.Text != "Go to Connections." {
+		t.Errorf("Get within ttl = %v, %v, want the cached completion", completion, ok)
+	}
+	if _, ok := c.Get("exports", now); ok {
+		t.Error("Get of an uncached key hit")
+	}
+	if _, ok := c.Get("wallets", now.Add(time.Minute)); ok || c.Len() != 0 {
+		t.Errorf("Get after ttl hit with %d entries left, want an expired miss that removes it", c.Len())
+	}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewResponseCache(2, time.Minute)
+	now := time.Now()
+	c.Put("wallets", &ClaudeCompletion{Text: "wallets"}, now)
+	c.Put("exports", &ClaudeCompletion{Text: "exports"}, now)
+	c.Get("wallets", now)
+	c.Put("invoices", &ClaudeCompletion{Text: "invoices"}, now)
+
+	if _, ok := c.Get("exports", now); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"wallets", "invoices"} {
+		if _, ok := c.Get(key, now); !ok {
+			t.Errorf("%s was evicted, want it kept", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want the cache held at 2", c.Len())
+	}
+}
+
+func TestRepeatedQuestionIsAnsweredFromCache(t *testing.T) {
+	config := testConfig(t)
+	config.ResponseCacheSize = 10
+	fake := newFakeClaude(t, config, "Go to Connections.")
+	s := NewClaudeProxyService(config)
+
+	postChat(t, s, ChatRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+	rec, resp := postChat(t, s, ChatRequest{Message: "how do I  connect a WALLET?", CorrelationID: "corr_2"})
+	if rec.Code != http.StatusOK || !resp.Cached || resp.Response != "Go to Connections." {
+		t.Fatalf("got %d with cached %v: %s, want the cached answer", rec.Code, resp.Cached, rec.Body)
+	}
+	if got := len(fake.requests); got != 1 {
+		t.Errorf("Claude was called %d times for one question asked twice, want 1", got)
+	}
+
+	_, resp = postChat(t, s, ChatRequest{
+		Messages: []ClaudeMessage{
+			{Role: "user", Content: "What about Coinbase?"},
+			{Role: "assistant", Content: "Coinbase is an exchange."},
+			{Role: "user", Content: "How do I connect a wallet?"},
+		},
+		CorrelationID: "corr_3",
+	})
+	if resp.Cached {
+		t.Error("question with history was answered from the cache")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errUpstreamBusy = errors.New("too many concurrent Claude requests")
+
+// busyRetryAfter is the Retry-After, in seconds, sent when no upstream slot frees up
+const busyRetryAfter = "5"
+
+// UpstreamSemaphore bounds the number of Claude calls in flight, so a burst of questions
+// doesn't run into the account's concurrency limits. A nil UpstreamSemaphore never blocks.
+type UpstreamSemaphore struct {
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// UpstreamStatus is a snapshot of an UpstreamSemaphore for the health check
+type UpstreamStatus struct {
+	InFlight int `json:"in_flight"`
+	Limit    int `json:"limit"`
+}
+
+func NewUpstreamSemaphore(size int, maxWait time.Duration) *UpstreamSemaphore {
+	return &UpstreamSemaphore{
+		slots:   make(chan struct{}, size),
+		maxWait: maxWait,
+	}
+}
+
+// Acquire takes a slot, waiting until one frees up, maxWait passes or ctx is done. It
+// returns errUpstreamBusy if no slot freed up in time, or ctx's error if the caller went
+// away. Every successful Acquire must be followed by Release.
+func (s *UpstreamSemaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(s.maxWait)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errUpstreamBusy
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errUpstreamBusy
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (s *UpstreamSemaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// Status returns how many slots are taken. A nil UpstreamSemaphore reports a limit of 0.
+func (s *UpstreamSemaphore) Status() UpstreamStatus {
+	if s == nil {
+		return UpstreamStatus{}
+	}
+	return UpstreamStatus{InFlight: len(s.slots), Limit: cap(s.slots)}
+}
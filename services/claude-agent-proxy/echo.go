@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// echoCompletion stands in for Claude in ECHO_MODE, so the Slack flow can be exercised
+// locally without an API key or spending tokens. It echoes the latest user message and
+// lists the titles of the chunks retrieval found for it.
+func echoCompletion(model string, messages []ClaudeMessage, relevantChunks []Chunk) *ClaudeCompletion {
+	question := ""
+	if len(messages) > 0 {
+		question = messages[len(messages)-1].Content
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "[echo] %s", question)
+	if len(relevantChunks) == 0 {
+		text.WriteString("\n\nNo documentation retrieved.")
+	} else {
+		text.WriteString("\n\nRetrieved documentation:")
+		for _, chunk := range relevantChunks {
+			fmt.Fprintf(&text, "\n- %s (%s)", chunk.Title, chunk.DocPath)
+		}
+	}
+
+	return &ClaudeCompletion{Text: text.String(), Model: model}
+}
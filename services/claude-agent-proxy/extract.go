@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// extractors turn a raw file into plain text ready for cleaning and chunking, keyed by
+// lower-case file extension. Files with other extensions are skipped.
+var extractors = map[string]func([]byte) (string, error){
+	".md":   extractPlainText,
+	".txt":  extractPlainText,
+	".html": extractHTMLText,
+	".htm":  extractHTMLText,
+	".pdf":  extractPDFText,
+}
+
+var (
+	htmlTitlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlDropPattern    = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(?:script|style|head)>`)
+	htmlHeadingPattern = regexp.MustCompile(`(?is)<h([1-6])[^>]*>(.*?)</h[1-6]>`)
+	htmlBreakPattern   = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|tr|section|article|blockquote|pre)>`)
+	htmlTagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRunPattern    = regexp.MustCompile(`[ \t]+`)
+)
+
+func extractPlainText(raw []byte) (string, error) {
+	return string(raw), nil
+}
+
+// extractHTMLText drops script/style contents, turns headings into Markdown headings so
+// section splitting still works, and collapses the remaining tags to text
+func extractHTMLText(raw []byte) (string, error) {
+	content := htmlDropPattern.ReplaceAllString(string(raw), "")
+	content = htmlCommentPattern.ReplaceAllString(content, "")
+	content = htmlHeadingPattern.ReplaceAllStringFunc(content, func(heading string) string {
+		match := htmlHeadingPattern.FindStringSubmatch(heading)
+		level := int(match[1][0] - '0')
+		text := strings.TrimSpace(htmlTagPattern.ReplaceAllString(match[2], ""))
+		return "\n" + strings.Repeat("#", level) + " " + text + "\n"
+	})
+	content = htmlBreakPattern.ReplaceAllString(content, "\n")
+	content = htmlTagPattern.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRunPattern.ReplaceAllString(line, " "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// htmlTitle returns the contents of the <title> tag, if any
+func htmlTitle(raw []byte) string {
+	match := htmlTitlePattern.FindSubmatch(raw)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(string(match[1])))
+}
+
+var pdfStreamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// extractPDFText pulls the text layer out of a PDF's content streams, one page per
+// paragraph (most generators write one content stream per page). It handles uncompressed
+// and FlateDecode streams and the standard text operators; text drawn with custom font
+// encodings may come out garbled.
+func extractPDFText(raw []byte) (string, error) {
+	if !bytes.HasPrefix(raw, []byte("%PDF")) {
+		return "", fmt.Errorf("not a PDF file")
+	}
+
+	pages := make([]string, 0)
+	for _, loc := range pdfStreamPattern.FindAllSubmatchIndex(raw, -1) {
+		dict := raw[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(raw[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := raw[start : start+end]
+
+		// Skip images, fonts and other non-content streams
+		if bytes.Contains(dict, []byte("/Subtype")) || bytes.Contains(dict, []byte("/Length1")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := inflate(data)
+			if err != nil {
+				continue
+			}
+			data = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+
+		if text := strings.TrimSpace(pdfContentText(data)); text != "" {
+			pages = append(pages, text)
+		}
+	}
+
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no extractable text layer")
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// pdfContentText interprets the text operators of a content stream: strings shown with
+// Tj, TJ, ' and " are emitted, and line moves (Td, TD, T*, ', ") and ET start new lines.
+// Every case consumes at least one byte, so malformed streams can't stall the loop.
+func pdfContentText(data []byte) string {
+	var text strings.Builder
+	var pending []string
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(data, i)
+			pending = append(pending, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			// Inline dictionaries such as marked-content properties hold no page text
+			i = skipPDFDict(data, i)
+		case c == '<':
+			s, next := pdfHexString(data, i)
+			pending = append(pending, s)
+			i = next
+		case c == '[' || c == ']':
+			i++
+		case isPDFDelimiter(c):
+			i++
+		default:
+			start := i
+			i++
+			for i < len(data) && !isPDFDelimiter(data[i]) && data[i] != '(' && data[i] != '<' && data[i] != '[' && data[i] != ']' {
+				i++
+			}
+			switch string(data[start:i]) {
+			case "Tj", "TJ":
+				text.WriteString(strings.Join(pending, ""))
+			case "'", "\"":
+				text.WriteString("\n" + strings.Join(pending, ""))
+			case "Td", "TD", "T*", "ET":
+				text.WriteString("\n")
+			}
+			if !isNumeric(data[start:i]) {
+				pending = pending[:0]
+			}
+		}
+	}
+
+	lines := strings.Split(text.String(), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimSpace(spaceRunPattern.ReplaceAllString(line, " ")); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func pdfLiteralString(data []byte, i int) (string, int) {
+	var s strings.Builder
+	depth := 0
+	for i++; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(data) {
+				return s.String(), i
+			}
+			switch data[i] {
+			case 'n':
+				s.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				s.WriteByte(' ')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				// Octal escape of up to three digits
+				v := 0
+				for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+					v = v*8 + int(data[i]-'0')
+					i++
+				}
+				i--
+				s.WriteByte(byte(v))
+			default:
+				s.WriteByte(data[i])
+			}
+		case '(':
+			depth++
+			s.WriteByte(c)
+		case ')':
+			if depth == 0 {
+				return s.String(), i + 1
+			}
+			depth--
+			s.WriteByte(c)
+		default:
+			s.WriteByte(c)
+		}
+	}
+	return s.String(), i
+}
+
+// skipPDFDict returns the index just past the dictionary opening at data[i], allowing
+// for nested dictionaries and strings containing ">>"
+func skipPDFDict(data []byte, i int) int {
+	depth := 0
+	for i < len(data) {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("<<")):
+			depth++
+			i += 2
+		case bytes.HasPrefix(data[i:], []byte(">>")):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		case data[i] == '(':
+			_, i = pdfLiteralString(data, i)
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+func pdfHexString(data []byte, i int) (string, int) {
+	end := bytes.IndexByte(data[i:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	digits := bytes.Map(func(r rune) rune {
+		if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return r
+		}
+		return -1
+	}, data[i+1:i+end])
+	// An odd final digit is treated as if followed by 0
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	decoded, _ := hex.DecodeString(string(digits))
+	return string(decoded), i + end + 1
+}
+
+func isPDFDelimiter(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == '/' || c == '{' || c == '}' || c == '%'
+}
+
+func isNumeric(token []byte) bool {
+	if len(token) == 0 {
+		return false
+	}
+	for _, c := range token {
+		if (c < '0' || c > '9') && c != '.' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// fileTitle derives a title from a file name, e.g. "runbooks/db-failover.pdf" -> "db-failover"
+func fileTitle(name string) string {
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// contentText runs pdfContentText, failing the test rather than hanging if it doesn't return
+func contentText(t *testing.T, data string) string {
+	t.Helper()
+
+	done := make(chan string, 1)
+	go func() { done <- pdfContentText([]byte(data)) }()
+
+	select {
+	case text := <-done:
+		return text
+	case <-time.After(2 * time.Second):
+		t.Fatalf("pdfContentText(%q) did not return", data)
+		return ""
+	}
+}
+
+func TestPDFContentText(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"literal strings", "BT /F1 12 Tf 72 712 Td (Connect a) Tj ( wallet) Tj ET", "Connect a wallet"},
+		{"hex string", "BT <48656C6C6F> Tj ET", "Hello"},
+		{"TJ array", "BT [(Recon) -20 (cile)] TJ ET", "Reconcile"},
+		{"line moves", "BT (First) Tj 0 -14 Td (Second) Tj ET", "First\nSecond"},
+		{"marked content dictionary", "/Span <</ActualText (ignored) /MCID 0>> BDC BT (Shown) Tj ET EMC", "Shown"},
+		{"nested dictionary", "/P <</A <</B 1>> /C (a >> b)>> BDC BT (Shown) Tj ET EMC", "Shown"},
+		{"unterminated dictionary", "BT (Shown) Tj ET <</MCID 0", "Shown"},
+		{"trailing angle bracket", "BT (Shown) Tj ET <", "Shown"},
+		{"trailing double angle bracket", "BT (Shown) Tj ET <<", "Shown"},
+		{"stray closing brackets", "BT (Shown) Tj > >> ) ET", "Shown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentText(t, tt.data); got != tt.want {
+				t.Errorf("pdfContentText(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
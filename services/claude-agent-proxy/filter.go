@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const bannedPhraseInstruction = "\n\nIMPORTANT: Your previous answer used wording that is not permitted. Do not endorse competitors, make legal or regulatory claims, or make guarantees. Answer again using neutral, factual language."
+
+// loadBannedPhrases reads one phrase per line, skipping blank lines and # comments
+func loadBannedPhrases(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open banned phrases file: %v", err)
+	}
+	defer file.Close()
+
+	phrases := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, strings.ToLower(line))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned phrases file: %v", err)
+	}
+
+	return phrases, nil
+}
+
+// containsBannedPhrase reports whether the text contains any banned phrase, ignoring case
+func (s *ClaudeProxyService) containsBannedPhrase(text string) bool {
+	lower := strings.ToLower(text)
+	for _, phrase := range s.bannedPhrases {
+		if strings.Contains(lower, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBannedPhrases checks a response against the banned phrase list. On a match it
+// either regenerates once with a stronger instruction or returns the fallback message.
+// Violations are logged without the phrase content.
+func (s *ClaudeProxyService) filterBannedPhrases(ctx context.Context, model string, messages []ClaudeMessage, relevantChunks []Chunk, completion *ClaudeCompletion, correlationID string) *ClaudeCompletion {
+	if !s.containsBannedPhrase(completion.Text) {
+		return completion
+	}
+
+	log.Printf("Banned phrase detected in response (ID: %s), action: %s", correlationID, s.config.BannedPhraseAction)
+
+	filtered := *completion
+	if s.config.BannedPhraseAction == "regenerate" {
+		regenerated, err := s.sendClaudeRequest(ctx, model, s.buildSystemPrompt(relevantChunks, messages)+bannedPhraseInstruction, messages, correlationID)
+		if err != nil {
+			log.Printf("Error regenerating response (ID: %s): %v", correlationID, err)
+		} else {
+			filtered.InputTokens += regenerated.InputTokens
+			filtered.OutputTokens += regenerated.OutputTokens
+			if !s.containsBannedPhrase(regenerated.Text) {
+				log.Printf("Regenerated response passed banned phrase check (ID: %s)", correlationID)
+				filtered.Text = regenerated.Text
+				return &filtered
+			}
+			log.Printf("Regenerated response still contains a banned phrase (ID: %s)", correlationID)
+		}
+	}
+
+	filtered.Text = s.config.BannedPhraseFallback
+	return &filtered
+}
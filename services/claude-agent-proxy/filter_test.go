@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadBannedPhrases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	os.WriteFile(path, []byte("# Competitors\nBetter than Cryptio\n\n  Guaranteed Returns  \n"), 0o644)
+
+	phrases, err := loadBannedPhrases(path)
+	if err != nil {
+		t.Fatalf("loadBannedPhrases: %v", err)
+	}
+	if want := []string{"better than cryptio", "guaranteed returns"}; !slices.Equal(phrases, want) {
+		t.Errorf("phrases = %q, want %q", phrases, want)
+	}
+}
+
+// newFilterService returns a service banning "guaranteed returns" that handles matches
+// with action
+func newFilterService(t *testing.T, action string, texts ...string) (*ClaudeProxyService, *fakeClaude) {
+	t.Helper()
+
+	config := testConfig(t)
+	config.BannedPhraseAction = action
+	config.BannedPhraseFallback = "Please contact the Bitwave team."
+	claude := newFakeClaude(t, config, texts...)
+
+	s := NewClaudeProxyService(config)
+	s.bannedPhrases = []string{"guaranteed returns"}
+	return s, claude
+}
+
+func TestBannedPhraseRegeneratesOnce(t *testing.T) {
+	s, claude := newFilterService(t, "regenerate", "Staking has Guaranteed Returns.", "Staking rewards vary.")
+	messages := []ClaudeMessage{{Role: "user", Content: "Is staking safe?"}}
+
+	first, err := s.callClaudeAPI(context.Background(), s.config.ClaudeModel, messages, nil, "corr_1")
+	if err != nil {
+		t.Fatalf("callClaudeAPI: %v", err)
+	}
+	filtered := s.filterBannedPhrases(context.Background(), s.config.ClaudeModel, messages, nil, first, "corr_1")
+
+	if filtered.Text != "Staking rewards vary." {
+		t.Errorf("Text = %q, want the regenerated answer", filtered.Text)
+	}
+	if filtered.InputTokens != 240 || filtered.OutputTokens != 60 {
+		t.Errorf("usage = %d in, %d out, want both calls counted", filtered.InputTokens, filtered.OutputTokens)
+	}
+
+	claude.next(t)
+	if retry := claude.next(t); !strings.HasSuffix(retry.System, bannedPhraseInstruction) {
+		t.Error("regeneration was sent without the banned phrase instruction")
+	}
+}
+
+func TestBannedPhraseFallsBackWhenRegenerationFails(t *testing.T) {
+	s, _ := newFilterService(t, "regenerate", "Guaranteed returns!", "Still guaranteed returns.")
+	messages := []ClaudeMessage{{Role: "user", Content: "Is staking safe?"}}
+
+	first, _ := s.callClaudeAPI(context.Background(), s.config.ClaudeModel, messages, nil, "corr_1")
+	filtered := s.filterBannedPhrases(context.Background(), s.config.ClaudeModel, messages, nil, first, "corr_1")
+
+	if filtered.Text != "Please contact the Bitwave team." {
+		t.Errorf("Text = %q, want the fallback", filtered.Text)
+	}
+}
+
+func TestBannedPhraseFallbackActionSkipsRegeneration(t *testing.T) {
+	s, claude := newFilterService(t, "fallback", "Guaranteed returns!")
+	messages := []ClaudeMessage{{Role: "user", Content: "Is staking safe?"}}
+
+	first, _ := s.callClaudeAPI(context.Background(), s.config.ClaudeModel, messages, nil, "corr_1")
+	filtered := s.filterBannedPhrases(context.Background(), s.config.ClaudeModel, messages, nil, first, "corr_1")
+
+	if filtered.Text != "Please contact the Bitwave team." {
+		t.Errorf("Text = %q, want the fallback", filtered.Text)
+	}
+	claude.next(t)
+	if len(claude.requests) != 0 {
+		t.Error("regenerated although BANNED_PHRASE_ACTION is fallback")
+	}
+}
+
+func TestCleanAnswerIsUnchanged(t *testing.T) {
+	s, claude := newFilterService(t, "regenerate", "Staking rewards vary.")
+	messages := []ClaudeMessage{{Role: "user", Content: "Is staking safe?"}}
+
+	first, _ := s.callClaudeAPI(context.Background(), s.config.ClaudeModel, messages, nil, "corr_1")
+	if filtered := s.filterBannedPhrases(context.Background(), s.config.ClaudeModel, messages, nil, first, "corr_1"); filtered != first {
+		t.Errorf("clean answer was replaced with %q", filtered.Text)
+	}
+	claude.next(t)
+	if len(claude.requests) != 0 {
+		t.Error("regenerated a clean answer")
+	}
+}
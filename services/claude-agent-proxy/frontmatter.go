@@ -0,0 +1,106 @@
+package main
+
+import "strings"
+
+// parseFrontmatter splits leading YAML frontmatter ("---" lines around key: value pairs)
+// from a document. It understands the subset our docs use: scalar values, optionally
+// quoted, and lists written inline ([billing, api]) or as "- item" lines. Lists are
+// returned comma-joined. Content without frontmatter is returned unchanged with nil
+// metadata.
+func parseFrontmatter(content string) (map[string]string, string) {
+	body := strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(body, "---") {
+		return nil, content
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	if strings.TrimSpace(lines[0]) != "---" {
+		return nil, content
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, content
+	}
+
+	metadata := make(map[string]string)
+	var listKey string
+	var listItems []string
+	flushList := func() {
+		if listKey != "" {
+			metadata[listKey] = strings.Join(listItems, ",")
+		}
+		listKey, listItems = "", nil
+	}
+
+	for _, line := range lines[1:end] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") && listKey != "" {
+			listItems = append(listItems, unquoteYAML(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+
+		flushList()
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "":
+			// A block list may follow on "- item" lines
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			items := make([]string, 0)
+			for _, item := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), ",") {
+				if item = unquoteYAML(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			metadata[key] = strings.Join(items, ",")
+		default:
+			metadata[key] = unquoteYAML(value)
+		}
+	}
+	flushList()
+
+	return metadata, strings.Join(lines[end+1:], "")
+}
+
+// unquoteYAML trims whitespace and one pair of matching quotes from a scalar
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// documentTags returns the tags listed in a document's frontmatter
+func documentTags(doc Document) []string {
+	if doc.Metadata["tags"] == "" {
+		return nil
+	}
+	return strings.Split(doc.Metadata["tags"], ",")
+}
+
+// tagText joins tags for keyword extraction. The separator keeps configured phrases from
+// matching across two tags.
+func tagText(tags []string) string {
+	return strings.Join(tags, ", ")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// noDocsInstruction is added to the system prompt when REQUIRE_DOCS_FOR_PRODUCT_Q is set
+// and a product question found no documentation, since Claude otherwise answers from
+// general knowledge with confident but wrong Bitwave specifics
+const noDocsInstruction = `
+
+NO RELEVANT BITWAVE DOCUMENTATION WAS FOUND FOR THIS QUESTION.
+Do not guess at Bitwave features, settings or behavior. Say that you couldn't find documentation covering this, and suggest rephrasing the question or contacting Bitwave support. You may still answer general, non-Bitwave parts of the question.`
+
+// isProductQuestion reports whether question mentions any of terms as whole words,
+// ignoring case and punctuation. Terms may be several words, e.g. "cost basis".
+func isProductQuestion(question string, terms []string) bool {
+	normalize := func(text string) string {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		return " " + strings.Join(words, " ") + " "
+	}
+
+	padded := normalize(question)
+	for _, term := range terms {
+		if normalized := normalize(term); normalized != "  " && strings.Contains(padded, normalized) {
+			return true
+		}
+	}
+	return false
+}
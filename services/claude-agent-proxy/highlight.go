@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/retrieval"
+)
+
+// highlightMarker wraps matched keywords in highlighted snippets, rendering as bold in
+// Markdown and Slack
+const highlightMarker = "**"
+
+// matchedKeywords returns the chunk's keywords whose stems are among terms, in order of
+// first appearance in the chunk. These are the words as written in the chunk, so
+// "invoices" is returned for a query about "invoice".
+func matchedKeywords(chunk Chunk, terms map[string]float64) []string {
+	matched := make([]string, 0)
+	for _, keyword := range chunk.Keywords {
+		if _, ok := terms[retrieval.Stem(keyword)]; ok {
+			matched = append(matched, keyword)
+		}
+	}
+	return matched
+}
+
+// highlightKeywords returns text with every whole-word, case-insensitive occurrence of
+// keywords wrapped in highlightMarker. The text is copied, never modified in place.
+func highlightKeywords(text string, keywords []string) string {
+	if len(keywords) == 0 {
+		return text
+	}
+
+	// Longest first, so "multi-entity" is highlighted rather than "multi" inside it
+	alternatives := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		alternatives[i] = regexp.QuoteMeta(keyword)
+	}
+	sort.Slice(alternatives, func(i, j int) bool {
+		return len(alternatives[i]) > len(alternatives[j])
+	})
+
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(alternatives, "|") + `)\b`)
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		return highlightMarker + match + highlightMarker
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultStopWords is the built-in English filler list used unless STOPWORDS_PATH is set
+var defaultStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true,
+	"not": true, "you": true, "all": true, "can": true, "had": true,
+	"her": true, "was": true, "one": true, "our": true, "out": true,
+	"day": true, "get": true, "has": true, "him": true, "his": true,
+	"how": true, "its": true, "may": true, "new": true, "now": true,
+	"old": true, "see": true, "two": true, "way": true, "who": true,
+	"this": true, "that": true, "with": true, "have": true, "from": true,
+	"they": true, "know": true, "want": true, "been": true, "good": true,
+	"much": true, "some": true, "time": true, "very": true, "when": true,
+	"come": true, "here": true, "just": true, "like": true, "long": true,
+	"make": true, "many": true, "over": true, "such": true, "take": true,
+	"than": true, "them": true, "well": true, "were": true,
+	"e.g": true, "i.e": true,
+}
+
+// loadStopWords reads a stop-word file: one entry per line, skipping blank lines and #
+// comments. Single words are stop words; lines with several words are phrases to index
+// as one keyword, e.g. "cost basis".
+func loadStopWords(path string) (map[string]bool, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open stop words file: %v", err)
+	}
+	defer file.Close()
+
+	stopWords := make(map[string]bool)
+	phrases := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words := strings.Fields(strings.ToLower(line))
+		if len(words) == 1 {
+			stopWords[words[0]] = true
+		} else {
+			phrases = append(phrases, strings.Join(words, " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read stop words file: %v", err)
+	}
+
+	return stopWords, phrases, nil
+}
+
+// SetStopWords replaces the built-in stop words and adds keyword phrases. A custom list
+// is taken as complete, so three-letter words like "gas" and "fee" become keywords
+// unless it lists them. Call before loading documents.
+func (ds *DocumentService) SetStopWords(stopWords map[string]bool, phrases []string) {
+	ds.stopWords = stopWords
+	ds.minKeywordLength = 3
+
+	ds.phrases = make([]keywordPhrase, 0, len(phrases))
+	for _, phrase := range phrases {
+		words := strings.Fields(phrase)
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		ds.phrases = append(ds.phrases, keywordPhrase{
+			text:    phrase,
+			pattern: regexp.MustCompile(`\b` + strings.Join(words, `\s+`) + `\b`),
+		})
+	}
+}
+
+// isKeyword reports whether a lower-case token from wordPattern is worth indexing.
+// Tokens without letters (numbers, dates) and stop words are skipped. Plain words need
+// minKeywordLength letters, but tokens with digits or separators are distinctive even
+// when short, such as "v2".
+func (ds *DocumentService) isKeyword(word string) bool {
+	if !strings.ContainsAny(word, "abcdefghijklmnopqrstuvwxyz") || ds.stopWords[word] {
+		return false
+	}
+	if strings.ContainsAny(word, "0123456789-.") {
+		return len(word) >= 2
+	}
+	return len(word) >= ds.minKeywordLength
+}
+
+type keywordPhrase struct {
+	text    string
+	pattern *regexp.Regexp
+}
+
+// keywordOccurrences returns every keyword occurrence in text, in order and with
+// repeats: words that aren't stop words, followed by any configured phrases. Words
+// joined by hyphens or dots stay whole, so "multi-sig", "erc-20" and "api.bitwave.io"
+// are single keywords. Indexing and queries both go through here, so they always agree.
+func (ds *DocumentService) keywordOccurrences(text string) []string {
+	text = strings.ToLower(text)
+
+	occurrences := make([]string, 0)
+	for _, word := range wordPattern.FindAllString(text, -1) {
+		if ds.isKeyword(word) {
+			occurrences = append(occurrences, word)
+		}
+	}
+
+	for _, phrase := range ds.phrases {
+		for range phrase.pattern.FindAllStringIndex(text, -1) {
+			occurrences = append(occurrences, phrase.text)
+		}
+	}
+
+	return occurrences
+}
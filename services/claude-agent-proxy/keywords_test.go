@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKeywordOccurrencesKeepsJoinedTerms(t *testing.T) {
+	ds := NewDocumentService(nil, 0)
+
+	got := ds.keywordOccurrences("Import ERC-20 transfers from a multi-sig wallet with the v2 API, e.g. api.bitwave.io.")
+	want := []string{"import", "erc-20", "transfers", "multi-sig", "wallet", "v2", "api.bitwave.io"}
+	if !slices.Equal(got, want) {
+		t.Errorf("keywordOccurrences = %v, want %v", got, want)
+	}
+}
+
+func TestSearchMatchesJoinedTermsWhole(t *testing.T) {
+	ds := NewDocumentService(nil, 0)
+	ds.addFile("tokens.md", []byte("# Token imports\n\nERC-20 token transfers are imported automatically."), 100)
+	ds.addFile("safes.md", []byte("# Safes\n\nConnect a multi-sig wallet such as Safe to sync its history."), 100)
+	ds.addFile("erc.md", []byte("# ERC standards\n\nThe ERC process defines Ethereum standards, 20 of which we support."), 100)
+	ds.addFile("chains.md", []byte("# Chains\n\nMulti chain accounts need a sig field per chain."), 100)
+	ds.buildKeywordIndex()
+
+	for query, path := range map[string]string{
+		"ERC-20?":   "tokens.md",
+		"multi-sig": "safes.md",
+	} {
+		results := ds.SearchWithHistory(query, nil, 0, 3, nil)
+		if len(results) != 1 || results[0].DocPath != path {
+			t.Errorf("%q returned %v, want only %s", query, chunkPaths(results), path)
+		}
+	}
+}
@@ -5,29 +5,105 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/retrieval"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	Port              string `envconfig:"PORT" default:"8080"`
-	AnthropicAPIKey   string `envconfig:"ANTHROPIC_API_KEY" required:"true"`
-	ClaudeModel       string `envconfig:"CLAUDE_MODEL" default:"claude-3-sonnet-20240229"`
-	DocsZipPath       string `envconfig:"DOCS_ZIP_PATH" default:"./docs.zip"`
-	MaxContextChunks  int    `envconfig:"MAX_CONTEXT_CHUNKS" default:"5"`
-	ChunkSize         int    `envconfig:"CHUNK_SIZE" default:"1000"`
+	Port                  string        `envconfig:"PORT" default:"8080"`
+	AnthropicAPIKey       string        `envconfig:"ANTHROPIC_API_KEY"`
+	AnthropicAPIURL       string        `envconfig:"ANTHROPIC_API_URL" default:"https://api.anthropic.com/v1/messages"`
+	ClaudeModel           string        `envconfig:"CLAUDE_MODEL" default:"claude-3-sonnet-20240229"`
+	AllowedModels         []string      `envconfig:"ALLOWED_MODELS"`
+	MaxTokens             int           `envconfig:"CLAUDE_MAX_TOKENS" default:"4000"`
+	ModelContextWindows   string        `envconfig:"MODEL_CONTEXT_WINDOWS"`
+	Temperature           *float64      `envconfig:"CLAUDE_TEMPERATURE"`
+	DocsZipPath           string        `envconfig:"DOCS_ZIP_PATH" default:"./docs.zip"`
+	DocsWatch             bool          `envconfig:"DOCS_WATCH" default:"false"`
+	DocsWatchPoll         bool          `envconfig:"DOCS_WATCH_POLL" default:"false"`
+	DocsWatchInterval     time.Duration `envconfig:"DOCS_WATCH_INTERVAL" default:"5s"`
+	MaxContextChunks      int           `envconfig:"MAX_CONTEXT_CHUNKS" default:"5"`
+	ChunkSize             int           `envconfig:"CHUNK_SIZE" default:"1000"`
+	ChunkOverlap          int           `envconfig:"CHUNK_OVERLAP" default:"100"`
+	ChunkStrategy         string        `envconfig:"CHUNK_STRATEGY" default:"words"`
+	CleaningSteps         []string      `envconfig:"CLEANING_STEPS" default:"frontmatter,html_comments,markdown_comments,images,entities"`
+	StopWordsPath         string        `envconfig:"STOPWORDS_PATH"`
+	SynonymsPath          string        `envconfig:"SYNONYMS_PATH"`
+	CondenseQueries       bool          `envconfig:"CONDENSE_QUERIES" default:"false"`
+	CondenseMinLength     int           `envconfig:"CONDENSE_MIN_LENGTH" default:"500"`
+	CondenseMaxTerms      int           `envconfig:"CONDENSE_MAX_TERMS" default:"12"`
+	RetrievalHistoryTurns int           `envconfig:"RETRIEVAL_HISTORY_TURNS" default:"0"`
+	ChunkDedupThreshold   float64       `envconfig:"CHUNK_DEDUP_THRESHOLD" default:"0.9"`
+	MaxHistoryMessages    int           `envconfig:"MAX_HISTORY_MESSAGES" default:"10"`
+	BannedPhrasesPath     string        `envconfig:"BANNED_PHRASES_PATH"`
+	BannedPhraseAction    string        `envconfig:"BANNED_PHRASE_ACTION" default:"regenerate"`
+	BannedPhraseFallback  string        `envconfig:"BANNED_PHRASE_FALLBACK" default:"Sorry, I can't help with that. Please contact the Bitwave team for assistance."`
+	IncludeUsage          bool          `envconfig:"INCLUDE_USAGE" default:"false"`
+	InputTokenPricePer1K  float64       `envconfig:"INPUT_TOKEN_PRICE_PER_1K" default:"0.003"`
+	OutputTokenPricePer1K float64       `envconfig:"OUTPUT_TOKEN_PRICE_PER_1K" default:"0.015"`
+	TargetAnswerWords     int           `envconfig:"TARGET_ANSWER_WORDS" default:"0"`
+	MaxRetries            int           `envconfig:"MAX_RETRIES" default:"3"`
+	RateLimitThreshold    float64       `envconfig:"RATE_LIMIT_THRESHOLD" default:"0.1"`
+	RateLimitMaxDelay     time.Duration `envconfig:"RATE_LIMIT_MAX_DELAY" default:"5s"`
+	UpstreamTimeout       time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"90s"`
+	ServerReadTimeout     time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"120s"`
+	ServerWriteTimeout    time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"120s"`
+	MaxRequestBodyBytes   int64         `envconfig:"MAX_REQUEST_BODY_BYTES" default:"1048576"`
+
+	// Consecutive Claude failures that open the circuit breaker, 0 disables it
+	CircuitBreakerThreshold int           `envconfig:"CIRCUIT_BREAKER_THRESHOLD" default:"5"`
+	CircuitBreakerCooldown  time.Duration `envconfig:"CIRCUIT_BREAKER_COOLDOWN" default:"30s"`
+
+	// Tell Claude to admit missing documentation instead of guessing when retrieval finds
+	// nothing for a question mentioning one of ProductTerms
+	RequireDocsForProductQ bool     `envconfig:"REQUIRE_DOCS_FOR_PRODUCT_Q" default:"false"`
+	ProductTerms           []string `envconfig:"PRODUCT_TERMS" default:"bitwave"`
+
+	// Cache up to ResponseCacheSize answers to questions asked without history, 0 disables it
+	ResponseCacheSize int           `envconfig:"RESPONSE_CACHE_SIZE" default:"0"`
+	ResponseCacheTTL  time.Duration `envconfig:"RESPONSE_CACHE_TTL" default:"10m"`
+
+	// Chat requests calling Claude at once, 0 disables the cap; others wait up to
+	// UpstreamQueueTimeout for a slot before getting a 503
+	MaxConcurrentUpstream int           `envconfig:"MAX_CONCURRENT_UPSTREAM" default:"10"`
+	UpstreamQueueTimeout  time.Duration `envconfig:"UPSTREAM_QUEUE_TIMEOUT" default:"10s"`
+
+	// EchoMode answers with the question and retrieved chunk titles instead of calling
+	// Claude, for local development without an API key
+	EchoMode bool `envconfig:"ECHO_MODE" default:"false"`
+
+	// Setting DocsUploadToken enables POST /api/upload-docs, which accepts ZIPs of up to
+	// MaxUploadBytes
+	DocsUploadToken string `envconfig:"DOCS_UPLOAD_TOKEN"`
+	MaxUploadBytes  int64  `envconfig:"MAX_UPLOAD_BYTES" default:"52428800"`
+
+	// Setting UsageResetToken enables POST /metrics/usage/reset, which returns the usage
+	// totals and zeroes them
+	UsageResetToken string `envconfig:"USAGE_RESET_TOKEN"`
 }
 
 type Document struct {
@@ -43,27 +119,149 @@ type Chunk struct {
 	Title    string
 	Content  string
 	Keywords []string
-	Score    float64
+	// Tags are the document's frontmatter tags, indexed as keywords of every chunk
+	Tags  []string
+	Score float64
+	// MatchedKeywords are the chunk's keywords that matched the query, set on search
+	// results only
+	MatchedKeywords []string
 }
 
+// DocumentService holds the loaded documents and their search index. Loading mutates it
+// and is not safe alongside searches, so ClaudeProxyService loads into an emptyCopy and
+// swaps the pointer; once published an index is only ever read.
 type DocumentService struct {
-	documents []Document
-	chunks    []Chunk
-	keywords  map[string][]int
+	documents     []Document
+	chunks        []Chunk
+	keywords      map[string][]int
+	cleaningSteps []string
+	chunkOverlap  int
+	// chunkStrategy is how long sections are split; see SetChunkStrategy
+	chunkStrategy string
+
+	// Keyword extraction; see SetStopWords
+	stopWords        map[string]bool
+	phrases          []keywordPhrase
+	minKeywordLength int
+	// synonyms holds groups of terms, each split into words; see SetSynonyms
+	synonyms [][][]string
+
+	// Per-chunk keyword counts and lengths (in keywords) for BM25 scoring
+	termFreqs      []map[string]int
+	chunkLengths   []int
+	avgChunkLength float64
+
+	// dedupThreshold drops near-duplicate search results; see SetDedupThreshold
+	dedupThreshold float64
+
+	// loadedAt is when loading finished; zero until documents are loaded
+	loadedAt time.Time
 }
 
 type ChatRequest struct {
-	Message       string `json:"message"`
-	User          string `json:"user"`
-	Channel       string `json:"channel"`
-	CorrelationID string `json:"correlation_id"`
+	Message             string          `json:"message"`
+	User                string          `json:"user"`
+	Channel             string          `json:"channel"`
+	CorrelationID       string          `json:"correlation_id"`
+	ConversationHistory []ClaudeMessage `json:"conversation_history,omitempty"`
+	IncludeUsage        bool            `json:"include_usage,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+	Model               string          `json:"model,omitempty"`
+	Filter              *SearchFilter   `json:"filter,omitempty"`
+
+	// Messages is the whole conversation, ending with the user's turn, for callers that
+	// keep no state of their own. When set it replaces Message and ConversationHistory
+	// and is sent to Claude as is.
+	Messages []ClaudeMessage `json:"messages,omitempty"`
+}
+
+// conversation returns the question being asked and the turns before it, whichever way
+// the request supplied them
+func (r ChatRequest) conversation() (string, []ClaudeMessage) {
+	if n := len(r.Messages); n > 0 {
+		return r.Messages[n-1].Content, r.Messages[:n-1]
+	}
+	return r.Message, r.ConversationHistory
+}
+
+// validateMessages checks a full conversation can be sent to Claude unchanged
+func validateMessages(messages []ClaudeMessage) error {
+	for i, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return fmt.Errorf("messages[%d] has role %q, expected user or assistant", i, msg.Role)
+		}
+		if strings.TrimSpace(msg.Content) == "" {
+			return fmt.Errorf("messages[%d] has no content", i)
+		}
+	}
+	if messages[len(messages)-1].Role != "user" {
+		return fmt.Errorf("the last message must have role user")
+	}
+	return nil
+}
+
+// SearchFilter scopes retrieval to part of the docs, e.g. one product. Empty fields match
+// everything; when both are set a chunk must match both.
+type SearchFilter struct {
+	// Tag matches documents with this frontmatter tag, ignoring case
+	Tag string `json:"tag,omitempty"`
+	// PathPrefix matches documents whose path in the docs archive starts with it
+	PathPrefix string `json:"path_prefix,omitempty"`
+}
+
+// matches reports whether chunk is in scope. A nil filter matches every chunk.
+func (f *SearchFilter) matches(chunk Chunk) bool {
+	if f == nil {
+		return true
+	}
+	if f.PathPrefix != "" && !strings.HasPrefix(chunk.DocPath, f.PathPrefix) {
+		return false
+	}
+	if f.Tag != "" {
+		for _, tag := range chunk.Tags {
+			if strings.EqualFold(strings.TrimSpace(tag), strings.TrimSpace(f.Tag)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
 type ChatResponse struct {
-	Response      string   `json:"response"`
-	CorrelationID string   `json:"correlation_id"`
-	Error         string   `json:"error,omitempty"`
-	SourceDocs    []string `json:"source_docs,omitempty"`
+	Response      string      `json:"response"`
+	CorrelationID string      `json:"correlation_id"`
+	Error         *APIError   `json:"error,omitempty"`
+	SourceDocs    []SourceDoc `json:"sources,omitempty"`
+	SourceTitles  []string    `json:"source_docs,omitempty"`
+	UsedDocs      bool        `json:"used_docs"`
+	Cached        bool        `json:"cached,omitempty"`
+	Model         string      `json:"model,omitempty"`
+	InputTokens   int         `json:"input_tokens,omitempty"`
+	OutputTokens  int         `json:"output_tokens,omitempty"`
+	// Messages echoes a request's Messages with the reply appended, ready to send back
+	// with the next turn
+	Messages []ClaudeMessage `json:"messages,omitempty"`
+}
+
+// SourceDoc identifies a chunk used to answer. Titles alone are ambiguous ("Overview",
+// "FAQ"), so the document path and chunk ID are included; the flat source_docs title
+// list is kept for existing clients.
+type SourceDoc struct {
+	Title           string   `json:"title"`
+	Path            string   `json:"path"`
+	ChunkID         string   `json:"chunk_id"`
+	Score           float64  `json:"score"`
+	MatchedKeywords []string `json:"matched_keywords,omitempty"`
+}
+
+type SearchResult struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	DocPath         string   `json:"doc_path"`
+	Score           float64  `json:"score"`
+	Snippet         string   `json:"snippet"`
+	MatchedKeywords []string `json:"matched_keywords,omitempty"`
 }
 
 type ClaudeMessage struct {
@@ -72,13 +270,16 @@ type ClaudeMessage struct {
 }
 
 type ClaudeRequest struct {
-	Model     string          `json:"model"`
-	MaxTokens int             `json:"max_tokens"`
-	Messages  []ClaudeMessage `json:"messages"`
-	System    string          `json:"system,omitempty"`
+	Model       string          `json:"model"`
+	MaxTokens   int             `json:"max_tokens"`
+	Messages    []ClaudeMessage `json:"messages"`
+	System      string          `json:"system,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
 }
 
 type ClaudeResponse struct {
+	Model   string `json:"model"`
 	Content []struct {
 		Text string `json:"text"`
 		Type string `json:"type"`
@@ -93,47 +294,121 @@ type ClaudeResponse struct {
 	} `json:"error,omitempty"`
 }
 
-func NewDocumentService() *DocumentService {
+// ClaudeCompletion is the text and usage returned by a successful Claude API call
+type ClaudeCompletion struct {
+	Text         string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+var (
+	frontmatterPattern     = regexp.MustCompile(`(?s)\A---\r?\n.*?\r?\n---\r?\n`)
+	htmlCommentPattern     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownCommentPattern = regexp.MustCompile(`(?m)^\[(?://|comment)\]: #.*$`)
+	imageLinePattern       = regexp.MustCompile(`(?m)^\s*(?:\[?!\[[^\]]*\]\([^)]*\)(?:\]\([^)]*\))?\s*)+$`)
+	wordPattern            = regexp.MustCompile(`[a-z0-9]+(?:[-.][a-z0-9]+)*`)
+)
+
+// cleaningSteps are the content cleaners that can be enabled via CLEANING_STEPS, applied
+// in the configured order before chunking
+var cleaningSteps = map[string]func(string) string{
+	"frontmatter": func(content string) string {
+		return frontmatterPattern.ReplaceAllString(content, "")
+	},
+	"html_comments": func(content string) string {
+		return htmlCommentPattern.ReplaceAllString(content, "")
+	},
+	"markdown_comments": func(content string) string {
+		return markdownCommentPattern.ReplaceAllString(content, "")
+	},
+	"images": func(content string) string {
+		return imageLinePattern.ReplaceAllString(content, "")
+	},
+	"entities": html.UnescapeString,
+}
+
+func NewDocumentService(steps []string, chunkOverlap int) *DocumentService {
+	enabled := make([]string, 0, len(steps))
+	for _, step := range steps {
+		step = strings.TrimSpace(step)
+		if _, ok := cleaningSteps[step]; !ok {
+			log.Printf("Warning: Unknown cleaning step %q ignored", step)
+			continue
+		}
+		enabled = append(enabled, step)
+	}
+
+	return &DocumentService{
+		documents:     make([]Document, 0),
+		chunks:        make([]Chunk, 0),
+		keywords:      make(map[string][]int),
+		cleaningSteps: enabled,
+		chunkOverlap:  chunkOverlap,
+
+		stopWords:        defaultStopWords,
+		minKeywordLength: 4,
+	}
+}
+
+// emptyCopy returns a DocumentService with the same settings and no documents, so a
+// reload can be built alongside the live one
+func (ds *DocumentService) emptyCopy() *DocumentService {
 	return &DocumentService{
-		documents: make([]Document, 0),
-		chunks:    make([]Chunk, 0),
-		keywords:  make(map[string][]int),
+		documents:        make([]Document, 0),
+		chunks:           make([]Chunk, 0),
+		keywords:         make(map[string][]int),
+		cleaningSteps:    ds.cleaningSteps,
+		chunkOverlap:     ds.chunkOverlap,
+		chunkStrategy:    ds.chunkStrategy,
+		stopWords:        ds.stopWords,
+		phrases:          ds.phrases,
+		minKeywordLength: ds.minKeywordLength,
+		synonyms:         ds.synonyms,
+		dedupThreshold:   ds.dedupThreshold,
 	}
 }
 
+// reset drops loaded documents. Fresh slices are allocated rather than truncated so an
+// index still being read elsewhere never sees its backing arrays overwritten.
+func (ds *DocumentService) reset() {
+	ds.documents = make([]Document, 0)
+	ds.chunks = make([]Chunk, 0)
+	ds.keywords = make(map[string][]int)
+}
+
+// errNoDocuments is returned when a docs ZIP or directory holds no supported documents,
+// e.g. an upload without any Markdown, so it isn't mistaken for a successful load
+var errNoDocuments = errors.New("no supported documents found")
+
 func (ds *DocumentService) LoadFromZip(zipPath string, chunkSize int) error {
 	log.Printf("Loading documents from ZIP: %s", zipPath)
-	
+
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return fmt.Errorf("failed to open ZIP file: %v", err)
 	}
 	defer reader.Close()
 
-	ds.documents = ds.documents[:0]
-	ds.chunks = ds.chunks[:0]
-	ds.keywords = make(map[string][]int)
+	ds.reset()
 
 	for _, file := range reader.File {
-		if !strings.HasSuffix(strings.ToLower(file.Name), ".md") {
+		if _, ok := extractors[strings.ToLower(path.Ext(file.Name))]; !ok {
 			continue
 		}
 
-		content, err := ds.readZipFile(file)
+		raw, err := ds.readZipFile(file)
 		if err != nil {
 			log.Printf("Warning: Failed to read %s: %v", file.Name, err)
 			continue
 		}
 
-		doc := Document{
-			Path:     file.Name,
-			Title:    ds.extractTitle(content),
-			Content:  content,
-			Metadata: map[string]string{"size": fmt.Sprintf("%d", len(content))},
-		}
+		ds.addFile(file.Name, raw, chunkSize)
+	}
 
-		ds.documents = append(ds.documents, doc)
-		ds.chunkDocument(doc, chunkSize)
+	if len(ds.documents) == 0 {
+		log.Printf("Warning: ZIP %s has %d files but no supported documents", zipPath, len(reader.File))
+		return errNoDocuments
 	}
 
 	ds.buildKeywordIndex()
@@ -142,19 +417,147 @@ func (ds *DocumentService) LoadFromZip(zipPath string, chunkSize int) error {
 	return nil
 }
 
-func (ds *DocumentService) readZipFile(file *zip.File) (string, error) {
-	rc, err := file.Open()
+// LoadFromDirectory loads documents from a directory tree, such as a mounted docs volume.
+// Symlinked directories are followed, but each real directory is only visited once.
+func (ds *DocumentService) LoadFromDirectory(root string, chunkSize int) error {
+	log.Printf("Loading documents from directory: %s", root)
+
+	ds.reset()
+
+	if err := ds.walkDirectory(root, root, make(map[string]bool), chunkSize); err != nil {
+		return fmt.Errorf("failed to walk docs directory: %v", err)
+	}
+
+	if len(ds.documents) == 0 {
+		log.Printf("Warning: Docs directory %s has no supported documents", root)
+		return errNoDocuments
+	}
+
+	ds.buildKeywordIndex()
+
+	log.Printf("Loaded %d documents, created %d chunks", len(ds.documents), len(ds.chunks))
+	return nil
+}
+
+func (ds *DocumentService) walkDirectory(root, dir string, visited map[string]bool, chunkSize int) error {
+	realDir, err := filepath.EvalSymlinks(dir)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer rc.Close()
+	if visited[realDir] {
+		log.Printf("Warning: Skipping %s, already visited (symlink loop?)", dir)
+		return nil
+	}
+	visited[realDir] = true
 
-	content, err := io.ReadAll(rc)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return string(content), nil
+	for _, entry := range entries {
+		fullPath := filepath.Join(dir, entry.Name())
+
+		// Stat follows symlinks so linked files and directories are handled like real ones
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			log.Printf("Warning: Failed to stat %s: %v", fullPath, err)
+			continue
+		}
+
+		if info.IsDir() {
+			if err := ds.walkDirectory(root, fullPath, visited, chunkSize); err != nil {
+				log.Printf("Warning: Failed to read directory %s: %v", fullPath, err)
+			}
+			continue
+		}
+
+		if _, ok := extractors[strings.ToLower(filepath.Ext(entry.Name()))]; !ok {
+			continue
+		}
+
+		relPath, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			relPath = fullPath
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if info.Size() == 0 {
+			log.Printf("Warning: Skipping empty file %s", relPath)
+			continue
+		}
+
+		raw, err := os.ReadFile(fullPath)
+		if err != nil {
+			log.Printf("Warning: Failed to read %s: %v", relPath, err)
+			continue
+		}
+
+		ds.addFile(relPath, raw, chunkSize)
+	}
+
+	return nil
+}
+
+// addFile extracts text from a supported file and adds it as a chunked document.
+// Files whose extraction fails are logged and skipped.
+func (ds *DocumentService) addFile(name string, raw []byte, chunkSize int) {
+	ext := strings.ToLower(path.Ext(name))
+	extract, ok := extractors[ext]
+	if !ok {
+		return
+	}
+
+	content, err := extract(raw)
+	if err != nil {
+		log.Printf("Warning: Failed to extract text from %s: %v", name, err)
+		return
+	}
+
+	// Frontmatter supplies the title and metadata and is never part of the body
+	frontmatter, content := parseFrontmatter(content)
+
+	title := frontmatter["title"]
+	if title == "" {
+		title = ds.extractTitle(content)
+	}
+	if title == "Untitled" {
+		switch ext {
+		case ".html", ".htm":
+			if t := htmlTitle(raw); t != "" {
+				title = t
+			}
+		case ".pdf":
+			title = fileTitle(name)
+		}
+	}
+
+	metadata := map[string]string{"size": fmt.Sprintf("%d", len(content))}
+	for key, value := range frontmatter {
+		if key != "title" {
+			metadata[key] = value
+		}
+	}
+
+	doc := Document{
+		Path:     name,
+		Title:    title,
+		Content:  content,
+		Metadata: metadata,
+	}
+
+	ds.documents = append(ds.documents, doc)
+	ds.chunkDocument(doc, chunkSize)
+}
+
+func (ds *DocumentService) readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
 }
 
 func (ds *DocumentService) extractTitle(content string) string {
@@ -170,8 +573,9 @@ func (ds *DocumentService) extractTitle(content string) string {
 
 func (ds *DocumentService) chunkDocument(doc Document, chunkSize int) {
 	content := ds.cleanContent(doc.Content)
-	sections := ds.splitBySections(content)
-	
+	sections := retrieval.SplitSections(content)
+	tags := documentTags(doc)
+
 	for i, section := range sections {
 		if len(section) <= chunkSize {
 			chunk := Chunk{
@@ -179,7 +583,8 @@ func (ds *DocumentService) chunkDocument(doc Document, chunkSize int) {
 				DocPath:  doc.Path,
 				Title:    doc.Title,
 				Content:  section,
-				Keywords: ds.extractKeywords(section),
+				Keywords: ds.extractKeywords(section + "\n" + tagText(tags)),
+				Tags:     tags,
 			}
 			ds.chunks = append(ds.chunks, chunk)
 		} else {
@@ -190,7 +595,8 @@ func (ds *DocumentService) chunkDocument(doc Document, chunkSize int) {
 					DocPath:  doc.Path,
 					Title:    doc.Title,
 					Content:  subChunk,
-					Keywords: ds.extractKeywords(subChunk),
+					Keywords: ds.extractKeywords(subChunk + "\n" + tagText(tags)),
+					Tags:     tags,
 				}
 				ds.chunks = append(ds.chunks, chunk)
 			}
@@ -199,182 +605,297 @@ func (ds *DocumentService) chunkDocument(doc Document, chunkSize int) {
 }
 
 func (ds *DocumentService) cleanContent(content string) string {
+	for _, step := range ds.cleaningSteps {
+		content = cleaningSteps[step](content)
+	}
+
 	content = regexp.MustCompile(`\n\s*\n\s*\n`).ReplaceAllString(content, "\n\n")
 	content = strings.TrimSpace(content)
 	return content
 }
 
-func (ds *DocumentService) splitBySections(content string) []string {
-	lines := strings.Split(content, "\n")
-	sections := make([]string, 0)
-	currentSection := strings.Builder{}
-	
-	for _, line := range lines {
-		if strings.HasPrefix(strings.TrimSpace(line), "#") && currentSection.Len() > 0 {
-			sections = append(sections, currentSection.String())
-			currentSection.Reset()
-		}
-		currentSection.WriteString(line + "\n")
-	}
-	
-	if currentSection.Len() > 0 {
-		sections = append(sections, currentSection.String())
-	}
-	
-	return sections
-}
-
+// splitIntoChunks packs words, or whole sentences with the sentence strategy, into chunks
+// of roughly chunkSize characters, each after the first overlapping the previous one by
+// up to chunkOverlap characters; see retrieval.PackUnits
 func (ds *DocumentService) splitIntoChunks(text string, chunkSize int) []string {
 	if len(text) <= chunkSize {
 		return []string{text}
 	}
-	
-	chunks := make([]string, 0)
-	words := strings.Fields(text)
-	currentChunk := strings.Builder{}
-	
-	for _, word := range words {
-		if currentChunk.Len()+len(word)+1 > chunkSize && currentChunk.Len() > 0 {
-			chunks = append(chunks, currentChunk.String())
-			currentChunk.Reset()
-		}
-		if currentChunk.Len() > 0 {
-			currentChunk.WriteString(" ")
-		}
-		currentChunk.WriteString(word)
-	}
-	
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, currentChunk.String())
-	}
-	
-	return chunks
+	return retrieval.PackUnits(ds.chunkUnits(text, chunkSize), chunkSize, ds.chunkOverlap)
 }
 
+// extractKeywords returns the distinct keywords in text in order of first appearance
 func (ds *DocumentService) extractKeywords(text string) []string {
-	text = strings.ToLower(text)
-	words := regexp.MustCompile(`\b[a-z]{3,}\b`).FindAllString(text, -1)
-	
-	stopWords := map[string]bool{
-		"the": true, "and": true, "for": true, "are": true, "but": true,
-		"not": true, "you": true, "all": true, "can": true, "had": true,
-		"her": true, "was": true, "one": true, "our": true, "out": true,
-		"day": true, "get": true, "has": true, "him": true, "his": true,
-		"how": true, "its": true, "may": true, "new": true, "now": true,
-		"old": true, "see": true, "two": true, "way": true, "who": true,
-		"this": true, "that": true, "with": true, "have": true, "from": true,
-		"they": true, "know": true, "want": true, "been": true, "good": true,
-		"much": true, "some": true, "time": true, "very": true, "when": true,
-		"come": true, "here": true, "just": true, "like": true, "long": true,
-		"make": true, "many": true, "over": true, "such": true, "take": true,
-		"than": true, "them": true, "well": true, "were": true,
-	}
-	
 	keywords := make([]string, 0)
 	seen := make(map[string]bool)
-	
-	for _, word := range words {
-		if !stopWords[word] && !seen[word] && len(word) > 3 {
-			keywords = append(keywords, word)
-			seen[word] = true
+
+	for _, keyword := range ds.keywordOccurrences(text) {
+		if !seen[keyword] {
+			keywords = append(keywords, keyword)
+			seen[keyword] = true
 		}
 	}
-	
+
 	return keywords
 }
 
+// buildKeywordIndex maps each keyword stem to the chunks containing it and records the term
+// frequencies and chunk lengths BM25 needs
 func (ds *DocumentService) buildKeywordIndex() {
 	ds.keywords = make(map[string][]int)
-	
+	ds.termFreqs = make([]map[string]int, len(ds.chunks))
+	ds.chunkLengths = make([]int, len(ds.chunks))
+	totalLength := 0
+
 	for i, chunk := range ds.chunks {
+		// Index on stems so "invoices" finds "invoice"; variants of one stem in the same
+		// chunk are indexed once
 		for _, keyword := range chunk.Keywords {
-			if _, exists := ds.keywords[keyword]; !exists {
-				ds.keywords[keyword] = make([]int, 0)
+			key := retrieval.Stem(keyword)
+			if indices := ds.keywords[key]; len(indices) > 0 && indices[len(indices)-1] == i {
+				continue
 			}
-			ds.keywords[keyword] = append(ds.keywords[keyword], i)
+			ds.keywords[key] = append(ds.keywords[key], i)
+		}
+
+		// Tags count as occurrences so a tag-only match still scores
+		freqs := make(map[string]int, len(chunk.Keywords))
+		for _, keyword := range ds.keywordOccurrences(chunk.Content + "\n" + tagText(chunk.Tags)) {
+			freqs[retrieval.Stem(keyword)]++
+			ds.chunkLengths[i]++
 		}
+		ds.termFreqs[i] = freqs
+		totalLength += ds.chunkLengths[i]
 	}
+
+	ds.avgChunkLength = 0
+	if len(ds.chunks) > 0 {
+		ds.avgChunkLength = float64(totalLength) / float64(len(ds.chunks))
+	}
+}
+
+// SearchRelevantChunks searches for query among the chunks matching filter, which may be nil
+func (ds *DocumentService) SearchRelevantChunks(query string, maxChunks int, filter *SearchFilter) []Chunk {
+	return ds.SearchWithHistory(query, nil, 0, maxChunks, filter)
 }
 
-func (ds *DocumentService) SearchRelevantChunks(query string, maxChunks int) []Chunk {
+// SearchWithHistory searches using the latest message plus up to historyTurns prior
+// conversation turns, so follow-ups like "how do I export it?" can match what "it"
+// referred to. Each earlier turn counts half as much as the one after it. Only chunks
+// matching filter, which may be nil, are scored, and near duplicates of better-scoring
+// chunks are skipped; see SetDedupThreshold.
+func (ds *DocumentService) SearchWithHistory(query string, history []ClaudeMessage, historyTurns int, maxChunks int, filter *SearchFilter) []Chunk {
 	if len(ds.chunks) == 0 {
 		return nil
 	}
-	
-	queryWords := ds.extractKeywords(strings.ToLower(query))
-	if len(queryWords) == 0 {
+
+	termWeights := make(map[string]float64)
+	addTerms := func(text string, weight float64) {
+		words := append(ds.extractKeywords(strings.ToLower(text)), ds.synonymKeywords(text)...)
+		for _, word := range words {
+			key := retrieval.Stem(word)
+			if weight > termWeights[key] {
+				termWeights[key] = weight
+			}
+		}
+	}
+
+	addTerms(query, 1.0)
+	weight := 1.0
+	for i := len(history) - 1; i >= 0 && i >= len(history)-historyTurns; i-- {
+		weight /= 2
+		addTerms(history[i].Content, weight)
+	}
+
+	if len(termWeights) == 0 {
 		return nil
 	}
-	
+
 	chunkScores := make(map[int]float64)
-	
-	for _, queryWord := range queryWords {
+
+	for queryWord, termWeight := range termWeights {
 		if chunkIndices, exists := ds.keywords[queryWord]; exists {
-			weight := math.Log(float64(len(ds.chunks))/float64(len(chunkIndices))) + 1
+			idf := retrieval.IDF(len(ds.chunks), len(chunkIndices))
 			for _, chunkIndex := range chunkIndices {
-				chunkScores[chunkIndex] += weight
+				if !filter.matches(ds.chunks[chunkIndex]) {
+					continue
+				}
+				chunkScores[chunkIndex] += ds.bm25(chunkIndex, queryWord, idf) * termWeight
 			}
 		}
 	}
-	
+
 	type scoredChunk struct {
 		chunk Chunk
 		score float64
+		index int
 	}
-	
+
 	scoredChunks := make([]scoredChunk, 0)
 	for chunkIndex, score := range chunkScores {
 		if chunkIndex < len(ds.chunks) {
 			chunk := ds.chunks[chunkIndex]
 			chunk.Score = score
-			scoredChunks = append(scoredChunks, scoredChunk{chunk, score})
+			chunk.MatchedKeywords = matchedKeywords(chunk, termWeights)
+			scoredChunks = append(scoredChunks, scoredChunk{chunk, score, chunkIndex})
 		}
 	}
-	
+
+	// Equal scores keep index order so results don't vary between identical searches
 	sort.Slice(scoredChunks, func(i, j int) bool {
-		return scoredChunks[i].score > scoredChunks[j].score
+		if scoredChunks[i].score != scoredChunks[j].score {
+			return scoredChunks[i].score > scoredChunks[j].score
+		}
+		return scoredChunks[i].index < scoredChunks[j].index
 	})
-	
-	result := make([]Chunk, 0)
+
+	// Drop near duplicates before the cut so the budget goes to distinct content
+	candidates := make([]Chunk, len(scoredChunks))
 	for i, scored := range scoredChunks {
-		if i >= maxChunks {
-			break
-		}
-		result = append(result, scored.chunk)
+		candidates[i] = scored.chunk
 	}
-	
+	result := selectDistinct(candidates, maxChunks, ds.dedupThreshold)
+
 	return result
 }
 
+// bm25 scores one query term against one chunk
+func (ds *DocumentService) bm25(chunkIndex int, term string, idf float64) float64 {
+	return retrieval.BM25(ds.termFreqs[chunkIndex][term], ds.chunkLengths[chunkIndex], ds.avgChunkLength, idf)
+}
+
+// CondenseQuery reduces a long question to its most discriminating keywords for
+// retrieval. Terms are ranked by how often they appear in the question weighted by how
+// rare they are across the indexed chunks, so pasted boilerplate doesn't dominate.
+func (ds *DocumentService) CondenseQuery(query string, maxTerms int) string {
+	frequency := make(map[string]int)
+	for _, keyword := range ds.keywordOccurrences(query) {
+		frequency[keyword]++
+	}
+
+	keywords := ds.extractKeywords(query)
+	scores := make(map[string]float64, len(keywords))
+	for _, keyword := range keywords {
+		idf := 1.0
+		if chunkIndices, exists := ds.keywords[retrieval.Stem(keyword)]; exists && len(ds.chunks) > 0 {
+			idf = math.Log(float64(len(ds.chunks))/float64(len(chunkIndices))) + 1
+		}
+		scores[keyword] = float64(frequency[keyword]) * idf
+	}
+
+	sort.SliceStable(keywords, func(i, j int) bool {
+		return scores[keywords[i]] > scores[keywords[j]]
+	})
+
+	if len(keywords) > maxTerms {
+		keywords = keywords[:maxTerms]
+	}
+
+	return strings.Join(keywords, " ")
+}
+
 type ClaudeProxyService struct {
-	config     *Config
-	httpClient *http.Client
-	docService *DocumentService
+	config        *Config
+	httpClient    *http.Client
+	docService    *DocumentService
+	docsMu        sync.RWMutex
+	reloadMu      sync.Mutex
+	bannedPhrases []string
+	throttle      *RateLimitThrottle
+	metrics       *UsageMetrics
+	breaker       *CircuitBreaker
+	cache         *ResponseCache
+	upstream      *UpstreamSemaphore
+	tokenGuard    *tokenlimit.Guard
+
+	// lastLoadError is the error from the most recent LoadDocuments, nil once one
+	// succeeds; guarded by docsMu
+	lastLoadError error
 }
 
 func NewClaudeProxyService(config *Config) *ClaudeProxyService {
-	return &ClaudeProxyService{
+	s := &ClaudeProxyService{
 		config:     config,
-		httpClient: &http.Client{Timeout: 90 * time.Second},
-		docService: NewDocumentService(),
+		httpClient: &http.Client{Timeout: config.UpstreamTimeout},
+		docService: NewDocumentService(config.CleaningSteps, config.ChunkOverlap),
+		throttle:   NewRateLimitThrottle(config.RateLimitThreshold, config.RateLimitMaxDelay),
+		metrics:    NewUsageMetrics(),
+		tokenGuard: tokenlimit.NewGuard(nil),
+	}
+	if config.CircuitBreakerThreshold > 0 {
+		s.breaker = NewCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerCooldown)
 	}
+	if config.ResponseCacheSize > 0 {
+		s.cache = NewResponseCache(config.ResponseCacheSize, config.ResponseCacheTTL)
+	}
+	if config.MaxConcurrentUpstream > 0 {
+		s.upstream = NewUpstreamSemaphore(config.MaxConcurrentUpstream, config.UpstreamQueueTimeout)
+	}
+	return s
 }
 
+// LoadDocuments builds a fresh document index and swaps it in, so searches running
+// during a reload keep using the previous index instead of a half-built one
 func (s *ClaudeProxyService) LoadDocuments() error {
 	if s.config.DocsZipPath == "" {
 		log.Println("No docs ZIP path configured, running without knowledge base")
 		return nil
 	}
-	
-	if _, err := os.Stat(s.config.DocsZipPath); os.IsNotExist(err) {
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	info, err := os.Stat(s.config.DocsZipPath)
+	if os.IsNotExist(err) {
 		log.Printf("Docs ZIP file not found at %s, running without knowledge base", s.config.DocsZipPath)
 		return nil
 	}
-	
-	return s.docService.LoadFromZip(s.config.DocsZipPath, s.config.ChunkSize)
+
+	docs := s.docs().emptyCopy()
+
+	// DOCS_ZIP_PATH may also point at a directory, e.g. a mounted docs volume
+	if err == nil && info.IsDir() {
+		err = docs.LoadFromDirectory(s.config.DocsZipPath, s.config.ChunkSize)
+	} else {
+		err = docs.LoadFromZip(s.config.DocsZipPath, s.config.ChunkSize)
+	}
+	if err != nil {
+		s.docsMu.Lock()
+		s.lastLoadError = err
+		s.docsMu.Unlock()
+		return err
+	}
+
+	docs.loadedAt = time.Now()
+
+	s.docsMu.Lock()
+	s.docService = docs
+	s.lastLoadError = nil
+	s.docsMu.Unlock()
+
+	// Chunk IDs survive edits to their documents, so cached answers may be stale
+	s.cache.Purge()
+	return nil
+}
+
+// docsStatus returns the current document index and the error from the last load attempt
+func (s *ClaudeProxyService) docsStatus() (*DocumentService, error) {
+	s.docsMu.RLock()
+	defer s.docsMu.RUnlock()
+	return s.docService, s.lastLoadError
 }
 
-func (s *ClaudeProxyService) buildSystemPrompt(relevantChunks []Chunk) string {
+// docs returns the current document index
+func (s *ClaudeProxyService) docs() *DocumentService {
+	s.docsMu.RLock()
+	defer s.docsMu.RUnlock()
+	return s.docService
+}
+
+// buildSystemPrompt adds relevantChunks to the base prompt. Without any, and with
+// RequireDocsForProductQ set, a final user message that looks like a product question
+// gets noDocsInstruction instead.
+func (s *ClaudeProxyService) buildSystemPrompt(relevantChunks []Chunk, messages []ClaudeMessage) string {
 	basePrompt := `You are Wavie, a helpful AI assistant integrated into Slack for Bitwave. You help users with questions about Bitwave products, documentation, and general assistance.
 
 Key guidelines:
@@ -386,7 +907,15 @@ Key guidelines:
 - If asked about Bitwave-specific features, refer to the provided documentation
 - Remember this is a Slack environment, so keep responses conversational but informative`
 
+	if s.config.TargetAnswerWords > 0 {
+		basePrompt += fmt.Sprintf("\n- Aim for under %d words unless the question needs more detail", s.config.TargetAnswerWords)
+	}
+
 	if len(relevantChunks) == 0 {
+		if s.config.RequireDocsForProductQ && len(messages) > 0 &&
+			isProductQuestion(messages[len(messages)-1].Content, s.config.ProductTerms) {
+			return basePrompt + noDocsInstruction
+		}
 		return basePrompt
 	}
 
@@ -394,58 +923,110 @@ Key guidelines:
 	for i, chunk := range relevantChunks {
 		contextPrompt += fmt.Sprintf("\n--- Document %d: %s ---\n%s\n", i+1, chunk.Title, chunk.Content)
 	}
-	
+
 	contextPrompt += "\nUse the above documentation to inform your responses when relevant. If the documentation doesn't contain the answer, say so clearly."
-	
+
 	return contextPrompt
 }
 
-func (s *ClaudeProxyService) callClaudeAPI(message string, relevantChunks []Chunk) (string, error) {
-	systemPrompt := s.buildSystemPrompt(relevantChunks)
-	
-	claudeReq := ClaudeRequest{
-		Model:     s.config.ClaudeModel,
-		MaxTokens: 4000,
-		System:    systemPrompt,
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: message,
-			},
-		},
+// buildMessages turns the conversation history and the current question into the
+// Messages API list: the last MaxHistoryMessages usable turns in order, then the
+// question. The API wants alternating roles starting with the user, so other roles and
+// empty turns are dropped, leading assistant turns are skipped and consecutive turns
+// from the same role are merged.
+func (s *ClaudeProxyService) buildMessages(history []ClaudeMessage, message string) []ClaudeMessage {
+	usable := make([]ClaudeMessage, 0, len(history))
+	for _, msg := range history {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" || (msg.Role != "user" && msg.Role != "assistant") {
+			continue
+		}
+		usable = append(usable, ClaudeMessage{Role: msg.Role, Content: content})
+	}
+	if limit := s.config.MaxHistoryMessages; limit >= 0 && len(usable) > limit {
+		usable = usable[len(usable)-limit:]
 	}
+	usable = append(usable, ClaudeMessage{Role: "user", Content: message})
 
-	jsonData, err := json.Marshal(claudeReq)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+	messages := make([]ClaudeMessage, 0, len(usable))
+	for _, msg := range usable {
+		if len(messages) == 0 && msg.Role != "user" {
+			continue
+		}
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == msg.Role {
+			messages[last].Content += "\n\n" + msg.Content
+			continue
+		}
+		messages = append(messages, msg)
 	}
+	return messages
+}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+// chatMessages returns the messages to send for a request: a full conversation as given,
+// or the history and question assembled by buildMessages
+func (s *ClaudeProxyService) chatMessages(req ChatRequest) []ClaudeMessage {
+	if len(req.Messages) > 0 {
+		return req.Messages
+	}
+	return s.buildMessages(req.ConversationHistory, req.Message)
+}
+
+// resolveModel returns the model to answer a request with: the requested one if it is
+// in ALLOWED_MODELS, otherwise CLAUDE_MODEL
+func (s *ClaudeProxyService) resolveModel(requested, correlationID string) string {
+	if requested == "" || requested == s.config.ClaudeModel {
+		return s.config.ClaudeModel
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.config.AnthropicAPIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	for _, allowed := range s.config.AllowedModels {
+		if strings.TrimSpace(allowed) == requested {
+			return requested
+		}
+	}
 
-	resp, err := s.httpClient.Do(req)
+	log.Printf("Requested model %q is not allowed, using %s (ID: %s)", requested, s.config.ClaudeModel, correlationID)
+	return s.config.ClaudeModel
+}
+
+func (s *ClaudeProxyService) callClaudeAPI(ctx context.Context, model string, messages []ClaudeMessage, relevantChunks []Chunk, correlationID string) (*ClaudeCompletion, error) {
+	if s.config.EchoMode {
+		return echoCompletion(model, messages, relevantChunks), nil
+	}
+	return s.sendClaudeRequest(ctx, model, s.buildSystemPrompt(relevantChunks, messages), messages, correlationID)
+}
+
+func (s *ClaudeProxyService) sendClaudeRequest(ctx context.Context, model, systemPrompt string, messages []ClaudeMessage, correlationID string) (*ClaudeCompletion, error) {
+	if s.config.EchoMode {
+		return echoCompletion(model, messages, nil), nil
+	}
+
+	claudeReq := ClaudeRequest{
+		Model:       model,
+		MaxTokens:   s.config.MaxTokens,
+		System:      systemPrompt,
+		Messages:    messages,
+		Temperature: s.config.Temperature,
+	}
+
+	resp, err := s.doClaudeRequest(ctx, claudeReq, correlationID)
 	if err != nil {
-		return "", fmt.Errorf("failed to call Claude API: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var claudeResp ClaudeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	err = json.NewDecoder(resp.Body).Decode(&claudeResp)
+	s.recordClaudeResult(ctx, err != nil || isRetryableStatus(resp.StatusCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
 	if claudeResp.Error.Type != "" {
-		return "", fmt.Errorf("claude API error: %s - %s", claudeResp.Error.Type, claudeResp.Error.Message)
+		return nil, fmt.Errorf("claude API error: %s - %s", claudeResp.Error.Type, claudeResp.Error.Message)
 	}
 
 	if len(claudeResp.Content) == 0 {
-		return "", fmt.Errorf("no content in Claude response")
+		return nil, fmt.Errorf("no content in Claude response")
 	}
 
 	var response string
@@ -456,133 +1037,617 @@ func (s *ClaudeProxyService) callClaudeAPI(message string, relevantChunks []Chun
 	}
 
 	if response == "" {
-		return "", fmt.Errorf("no text content found in response")
+		return nil, fmt.Errorf("no text content found in response")
 	}
 
-	log.Printf("Claude API usage - Input tokens: %d, Output tokens: %d", 
+	log.Printf("Claude API usage - Input tokens: %d, Output tokens: %d",
 		claudeResp.Usage.InputTokens, claudeResp.Usage.OutputTokens)
 
-	return response, nil
+	s.metrics.Record(claudeResp.Usage.InputTokens, claudeResp.Usage.OutputTokens)
+
+	return &ClaudeCompletion{
+		Text:         response,
+		Model:        claudeResp.Model,
+		InputTokens:  claudeResp.Usage.InputTokens,
+		OutputTokens: claudeResp.Usage.OutputTokens,
+	}, nil
+}
+
+// doClaudeRequest sends a request to the Messages API, throttling first when rate-limit
+// quota is low and recording the quota reported in the response. Network errors, 429s
+// and 5xx responses are retried up to MaxRetries times, honoring retry-after when sent;
+// once retries are exhausted the last error response is returned for the caller to decode.
+// Waiting stops as soon as ctx is done. While the circuit breaker is open it returns
+// errCircuitOpen without calling Claude. The breaker sees each request once, however many
+// attempts it takes: errors are recorded here, but a returned response is recorded by
+// the caller through recordClaudeResult once its body has been read.
+func (s *ClaudeProxyService) doClaudeRequest(ctx context.Context, claudeReq ClaudeRequest, correlationID string) (*http.Response, error) {
+	jsonData, err := json.Marshal(claudeReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	if err := s.breaker.Allow(time.Now()); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", s.config.AnthropicAPIURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", s.config.AnthropicAPIKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+
+		// Slow down before hitting a hard 429 when quota is running low
+		if delay := s.throttle.Delay(time.Now()); delay > 0 {
+			log.Printf("Rate limit quota low, throttling Claude request for %v", delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("gave up waiting for rate limit quota: %w", err)
+			}
+		}
+
+		resp, err := s.httpClient.Do(req)
+		metrics.ObserveUpstream("claude", err == nil && resp.StatusCode == http.StatusOK)
+		if err == nil {
+			s.throttle.Update(resp.Header, time.Now())
+			if !isRetryableStatus(resp.StatusCode) {
+				return resp, nil
+			}
+		}
+
+		if attempt >= s.config.MaxRetries {
+			if err != nil {
+				s.recordClaudeResult(ctx, true)
+				return nil, fmt.Errorf("failed to call Claude API: %v", err)
+			}
+			return resp, nil
+		}
+
+		delay := retryDelay(resp, attempt)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		log.Printf("Retrying Claude API (ID: %s) in %v, attempt %d of %d: %s",
+			correlationID, delay, attempt+1, s.config.MaxRetries, reason)
+		if err := sleepContext(ctx, delay); err != nil {
+			s.recordClaudeResult(ctx, true)
+			return nil, fmt.Errorf("gave up retrying Claude API: %w", err)
+		}
+	}
+}
+
+// recordClaudeResult reports the outcome of a request to the circuit breaker. failed
+// means Claude itself failed: other 4xx responses are problems with the request, and a
+// caller hanging up says nothing about Claude's health.
+func (s *ClaudeProxyService) recordClaudeResult(ctx context.Context, failed bool) {
+	if !failed {
+		s.breaker.Success()
+		return
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	s.breaker.Failure(time.Now())
 }
 
 func (s *ClaudeProxyService) handleChat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
-	if req.Message == "" {
-		http.Error(w, "Message is required", http.StatusBadRequest)
+	// Callers that only send the header still get a body-level ID for logs and responses
+	if req.CorrelationID == "" {
+		req.CorrelationID = tracing.FromContext(r.Context())
+	}
+
+	if len(req.Messages) > 0 {
+		if err := validateMessages(req.Messages); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+			return
+		}
+	} else if req.Message == "" {
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Message is required")
 		return
 	}
 
-	log.Printf("Processing chat request (ID: %s): %s", req.CorrelationID, req.Message)
+	question, history := req.conversation()
+	log.Printf("Processing chat request (ID: %s, %d prior turns): %s", req.CorrelationID, len(history), question)
+
+	// Use one index snapshot for the whole request even if a reload lands midway
+	docs := s.docs()
 
-	relevantChunks := s.docService.SearchRelevantChunks(req.Message, s.config.MaxContextChunks)
-	
-	sourceDocs := make([]string, 0)
+	// Long pasted questions dilute retrieval, so search with a condensed query while the
+	// full question still goes to Claude
+	retrievalQuery := question
+	if s.config.CondenseQueries && len(question) > s.config.CondenseMinLength {
+		if condensed := docs.CondenseQuery(question, s.config.CondenseMaxTerms); condensed != "" {
+			retrievalQuery = condensed
+			log.Printf("Condensed %d character question for retrieval (ID: %s): %s", len(question), req.CorrelationID, condensed)
+		}
+	}
+
+	if req.Filter != nil {
+		log.Printf("Scoping retrieval (ID: %s) to tag %q, path prefix %q", req.CorrelationID, req.Filter.Tag, req.Filter.PathPrefix)
+	}
+
+	model := s.resolveModel(req.Model, req.CorrelationID)
+
+	relevantChunks := docs.SearchWithHistory(retrievalQuery, history, s.config.RetrievalHistoryTurns, s.config.MaxContextChunks, req.Filter)
+	relevantChunks, messages := s.fitContextWindow(model, relevantChunks, s.chatMessages(req), req.CorrelationID)
+
+	sourceDocs := make([]SourceDoc, 0)
 	if len(relevantChunks) > 0 {
 		log.Printf("Found %d relevant documentation chunks", len(relevantChunks))
 		for _, chunk := range relevantChunks {
-			sourceDocs = append(sourceDocs, chunk.Title)
+			sourceDocs = append(sourceDocs, SourceDoc{
+				Title:           chunk.Title,
+				Path:            chunk.DocPath,
+				ChunkID:         chunk.ID,
+				Score:           chunk.Score,
+				MatchedKeywords: chunk.MatchedKeywords,
+			})
+		}
+	}
+
+	if req.Stream {
+		if !s.acquireUpstream(w, r, req.CorrelationID) {
+			return
 		}
+		defer s.upstream.Release()
+		s.streamChat(r.Context(), w, req, model, messages, relevantChunks, sourceDocs)
+		return
 	}
 
-	response, err := s.callClaudeAPI(req.Message, relevantChunks)
+	// Answers depend on earlier turns too, so only questions without history are cached
+	cacheKey := ""
+	if s.cache != nil && len(history) == 0 {
+		cacheKey = responseCacheKey(model, question, relevantChunks)
+		if completion, ok := s.cache.Get(cacheKey, time.Now()); ok {
+			resp := s.buildChatResponse(req, completion, sourceDocs)
+			resp.Cached = true
+
+			log.Printf("Sending cached response (ID: %s): %d characters, %d source docs",
+				req.CorrelationID, len(resp.Response), len(sourceDocs))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+	}
+
+	if !s.acquireUpstream(w, r, req.CorrelationID) {
+		return
+	}
+	defer s.upstream.Release()
+
+	completion, err := s.callClaudeAPI(r.Context(), model, messages, relevantChunks, req.CorrelationID)
 	if err != nil {
 		log.Printf("Error calling Claude API (ID: %s): %v", req.CorrelationID, err)
-		
-		resp := ChatResponse{
-			CorrelationID: req.CorrelationID,
-			Error:         "Failed to process your request. Please try again.",
-		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(resp)
+		if errors.Is(err, errCircuitOpen) {
+			writeError(w, http.StatusServiceUnavailable, errCodeUpstreamUnavailable, "Claude is temporarily unavailable. Please try again shortly.")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errCodeUpstreamError, "Failed to process your request. Please try again.")
 		return
 	}
 
-	if len(response) > 4000 {
-		response = response[:3900] + "\n\n... (response truncated due to length)"
+	completion = s.filterBannedPhrases(r.Context(), model, messages, relevantChunks, completion, req.CorrelationID)
+	if cacheKey != "" {
+		s.cache.Put(cacheKey, completion, time.Now())
+	}
+
+	resp := s.buildChatResponse(req, completion, sourceDocs)
+
+	log.Printf("Sending response (ID: %s): %d characters, %d source docs",
+		req.CorrelationID, len(resp.Response), len(sourceDocs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// acquireUpstream takes a slot for calling Claude, responding with a 503 and returning
+// false if none frees up in time. The caller must Release the slot once it's done.
+func (s *ClaudeProxyService) acquireUpstream(w http.ResponseWriter, r *http.Request, correlationID string) bool {
+	err := s.upstream.Acquire(r.Context())
+	if err == nil {
+		return true
+	}
+
+	log.Printf("No upstream slot available (ID: %s): %v", correlationID, err)
+	w.Header().Set("Retry-After", busyRetryAfter)
+	writeError(w, http.StatusServiceUnavailable, errCodeUpstreamBusy, "Too many requests in progress. Please try again shortly.")
+	return false
+}
+
+const truncationNotice = "\n\n... (response truncated due to length)"
+
+// truncateForSlack shortens text to at most max characters (runes, so multibyte
+// characters are never split), cutting at the last word boundary and appending a notice
+func truncateForSlack(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
 	}
 
+	budget := max - len([]rune(truncationNotice))
+	if budget <= 0 {
+		return string(runes[:max])
+	}
+
+	// Back up to the last space unless the budget already ends on a whole word
+	cut := runes[:budget]
+	for i := len(cut) - 1; i > 0 && !unicode.IsSpace(runes[budget]); i-- {
+		if unicode.IsSpace(cut[i]) {
+			cut = cut[:i]
+			break
+		}
+	}
+
+	return strings.TrimRightFunc(string(cut), unicode.IsSpace) + truncationNotice
+}
+
+// buildChatResponse truncates the answer to fit Slack and attaches usage when requested
+func (s *ClaudeProxyService) buildChatResponse(req ChatRequest, completion *ClaudeCompletion, sourceDocs []SourceDoc) ChatResponse {
 	resp := ChatResponse{
-		Response:      response,
+		Response:      truncateForSlack(completion.Text, 4000),
 		CorrelationID: req.CorrelationID,
 		SourceDocs:    sourceDocs,
+		UsedDocs:      len(sourceDocs) > 0,
+	}
+	for _, doc := range sourceDocs {
+		resp.SourceTitles = append(resp.SourceTitles, doc.Title)
 	}
 
-	log.Printf("Sending response (ID: %s): %d characters, %d source docs", 
-		req.CorrelationID, len(response), len(sourceDocs))
+	// The conversation keeps the full reply; truncation only keeps Slack posts in bounds
+	if len(req.Messages) > 0 {
+		resp.Messages = append(append(make([]ClaudeMessage, 0, len(req.Messages)+1), req.Messages...),
+			ClaudeMessage{Role: "assistant", Content: completion.Text})
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	if req.IncludeUsage || s.config.IncludeUsage {
+		resp.Model = completion.Model
+		resp.InputTokens = completion.InputTokens
+		resp.OutputTokens = completion.OutputTokens
+	}
+
+	return resp
 }
 
 func (s *ClaudeProxyService) handleRefreshDocs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	log.Println("Refreshing documentation...")
+	s.reloadDocuments(w)
+}
+
+// reloadDocuments reloads the index and responds with the result. A failed reload
+// keeps serving the current index.
+func (s *ClaudeProxyService) reloadDocuments(w http.ResponseWriter) {
 	if err := s.LoadDocuments(); err != nil {
 		log.Printf("Error refreshing docs: %v", err)
-		http.Error(w, "Failed to refresh documents", http.StatusInternalServerError)
+		if errors.Is(err, errNoDocuments) {
+			writeError(w, http.StatusUnprocessableEntity, errCodeNoDocuments, "Docs contain no supported documents, keeping the current index")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to refresh documents")
 		return
 	}
 
+	docs := s.docs()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "success",
-		"documents": len(s.docService.documents),
-		"chunks":    len(s.docService.chunks),
+		"documents": len(docs.documents),
+		"chunks":    len(docs.chunks),
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
 
-func (s *ClaudeProxyService) healthCheck(w http.ResponseWriter, r *http.Request) {
+const (
+	maxSearchLimit     = 25
+	searchSnippetRunes = 200
+)
+
+// handleSearch runs retrieval for a query and returns the ranked chunks without calling
+// Claude, so retrieval quality can be checked without spending tokens
+func (s *ClaudeProxyService) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Missing q parameter")
+		return
+	}
+
+	limit := s.config.MaxContextChunks
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid limit parameter")
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	// Optional tag and path_prefix parameters scope the search like a chat filter
+	var filter *SearchFilter
+	if tag, prefix := r.URL.Query().Get("tag"), r.URL.Query().Get("path_prefix"); tag != "" || prefix != "" {
+		filter = &SearchFilter{Tag: tag, PathPrefix: prefix}
+	}
+
+	// highlight=true wraps matched keywords in the snippets to show why chunks matched
+	highlight := false
+	if value := r.URL.Query().Get("highlight"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid highlight parameter")
+			return
+		}
+		highlight = parsed
+	}
+
+	chunks := s.docs().SearchRelevantChunks(query, limit, filter)
+	results := make([]SearchResult, 0, len(chunks))
+	for _, chunk := range chunks {
+		text := snippet(chunk.Content, searchSnippetRunes)
+		if highlight {
+			text = highlightKeywords(text, chunk.MatchedKeywords)
+		}
+		results = append(results, SearchResult{
+			ID:              chunk.ID,
+			Title:           chunk.Title,
+			DocPath:         chunk.DocPath,
+			Score:           chunk.Score,
+			Snippet:         text,
+			MatchedKeywords: chunk.MatchedKeywords,
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "healthy",
-		"service":   "claude-agent-proxy",
-		"model":     s.config.ClaudeModel,
-		"documents": len(s.docService.documents),
-		"chunks":    len(s.docService.chunks),
-		"timestamp": time.Now().Format(time.RFC3339),
+		"query":   query,
+		"limit":   limit,
+		"filter":  filter,
+		"results": results,
 	})
 }
 
+// snippet collapses whitespace and cuts text to at most max runes
+func snippet(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:max])) + "..."
+}
+
+// healthCheck reports "degraded" when the last docs load failed or the Claude circuit
+// breaker is not closed. The status code stays 200 while an earlier index is still being
+// served, and is 503 when no documents are loaded at all, so a readiness probe only pulls
+// instances with nothing to answer from.
+func (s *ClaudeProxyService) healthCheck(w http.ResponseWriter, r *http.Request) {
+	docs, loadErr := s.docsStatus()
+
+	status := "healthy"
+	code := http.StatusOK
+	response := map[string]interface{}{
+		"service":    "claude-agent-proxy",
+		"model":      s.config.ClaudeModel,
+		"documents":  len(docs.documents),
+		"chunks":     len(docs.chunks),
+		"rate_limit": s.throttle.Quota(),
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+
+	circuit := s.breaker.Status()
+	response["circuit_breaker"] = circuit
+	response["upstream"] = s.upstream.Status()
+	if circuit.State != circuitClosed {
+		status = "degraded"
+	}
+
+	if !docs.loadedAt.IsZero() {
+		response["last_loaded_at"] = docs.loadedAt.Format(time.RFC3339)
+		response["docs_age_seconds"] = int(time.Since(docs.loadedAt).Seconds())
+	}
+	if loadErr != nil {
+		status = "degraded"
+		response["last_load_error"] = loadErr.Error()
+		if errors.Is(loadErr, errNoDocuments) {
+			response["knowledge_base"] = "empty"
+		}
+		if len(docs.chunks) == 0 {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	response["status"] = status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// limitBody caps request bodies at maxBytes so an oversized POST cannot exhaust memory.
+// Reading past the limit fails with an error that isBodyTooLarge recognizes.
+func limitBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err came from reading past limitBody's limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 func main() {
 	var config Config
 	if err := envconfig.Process("", &config); err != nil {
 		log.Fatalf("Failed to process environment variables: %v", err)
 	}
 
+	if config.AnthropicAPIKey == "" && !config.EchoMode {
+		log.Fatalf("ANTHROPIC_API_KEY is required unless ECHO_MODE is set")
+	}
+	if config.EchoMode {
+		log.Printf("ECHO_MODE is set: answers echo the question instead of calling Claude")
+	}
+	if config.MaxTokens <= 0 {
+		log.Fatalf("CLAUDE_MAX_TOKENS must be positive, got %d", config.MaxTokens)
+	}
+	contextWindows, err := tokenlimit.ParseWindows(config.ModelContextWindows)
+	if err != nil {
+		log.Fatalf("Invalid MODEL_CONTEXT_WINDOWS: %v", err)
+	}
+	tokenGuard := tokenlimit.NewGuard(contextWindows)
+	for _, model := range append([]string{config.ClaudeModel}, config.AllowedModels...) {
+		model = strings.TrimSpace(model)
+		if window := tokenGuard.ContextWindow(model); window <= config.MaxTokens {
+			log.Fatalf("The %d token context window of %s must exceed CLAUDE_MAX_TOKENS (%d)", window, model, config.MaxTokens)
+		}
+	}
+	if config.Temperature != nil && (*config.Temperature < 0 || *config.Temperature > 1) {
+		log.Fatalf("CLAUDE_TEMPERATURE must be between 0 and 1, got %g", *config.Temperature)
+	}
+	if config.CircuitBreakerThreshold < 0 {
+		log.Fatalf("CIRCUIT_BREAKER_THRESHOLD must not be negative, got %d", config.CircuitBreakerThreshold)
+	}
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":         config.UpstreamTimeout,
+		"SERVER_READ_TIMEOUT":      config.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT":     config.ServerWriteTimeout,
+		"CIRCUIT_BREAKER_COOLDOWN": config.CircuitBreakerCooldown,
+		"RESPONSE_CACHE_TTL":       config.ResponseCacheTTL,
+		"UPSTREAM_QUEUE_TIMEOUT":   config.UpstreamQueueTimeout,
+	} {
+		if timeout <= 0 {
+			log.Fatalf("%s must be a positive duration, got %v", name, timeout)
+		}
+	}
+	if config.ChunkStrategy != chunkStrategyWords && config.ChunkStrategy != chunkStrategySentence {
+		log.Fatalf("CHUNK_STRATEGY must be words or sentence, got %q", config.ChunkStrategy)
+	}
+	if config.MaxConcurrentUpstream < 0 {
+		log.Fatalf("MAX_CONCURRENT_UPSTREAM must not be negative, got %d", config.MaxConcurrentUpstream)
+	}
+	if config.ResponseCacheSize < 0 {
+		log.Fatalf("RESPONSE_CACHE_SIZE must not be negative, got %d", config.ResponseCacheSize)
+	}
+	if config.MaxRequestBodyBytes <= 0 {
+		log.Fatalf("MAX_REQUEST_BODY_BYTES must be positive, got %d", config.MaxRequestBodyBytes)
+	}
+	if config.DocsUploadToken != "" {
+		if config.DocsZipPath == "" {
+			log.Fatalf("DOCS_UPLOAD_TOKEN requires DOCS_ZIP_PATH")
+		}
+		if info, err := os.Stat(config.DocsZipPath); err == nil && info.IsDir() {
+			log.Fatalf("DOCS_UPLOAD_TOKEN requires DOCS_ZIP_PATH to be a ZIP file, not a directory")
+		}
+		if config.MaxUploadBytes <= 0 {
+			log.Fatalf("MAX_UPLOAD_BYTES must be positive, got %d", config.MaxUploadBytes)
+		}
+	}
+
 	service := NewClaudeProxyService(&config)
+	service.tokenGuard = tokenGuard
+
+	if config.BannedPhrasesPath != "" {
+		phrases, err := loadBannedPhrases(config.BannedPhrasesPath)
+		if err != nil {
+			log.Fatalf("Failed to load banned phrases: %v", err)
+		}
+		service.bannedPhrases = phrases
+		log.Printf("Loaded %d banned phrases", len(phrases))
+	}
+
+	service.docService.SetDedupThreshold(config.ChunkDedupThreshold)
+	service.docService.SetChunkStrategy(config.ChunkStrategy)
+
+	if config.StopWordsPath != "" {
+		stopWords, phrases, err := loadStopWords(config.StopWordsPath)
+		if err != nil {
+			log.Fatalf("Failed to load stop words: %v", err)
+		}
+		service.docService.SetStopWords(stopWords, phrases)
+		log.Printf("Loaded %d stop words and %d keyword phrases", len(stopWords), len(phrases))
+	}
+
+	if config.SynonymsPath != "" {
+		groups, err := loadSynonyms(config.SynonymsPath)
+		if err != nil {
+			log.Fatalf("Failed to load synonyms: %v", err)
+		}
+		service.docService.SetSynonyms(groups)
+		log.Printf("Loaded %d synonym groups", len(groups))
+	}
 
 	if err := service.LoadDocuments(); err != nil {
 		log.Printf("Warning: Failed to load documents: %v", err)
 	}
 
+	if config.DocsWatch {
+		go service.watchDocs(config.DocsWatchInterval, config.DocsWatchPoll)
+	}
+
+	metrics.SetService("claude-agent-proxy")
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", service.healthCheck)
-	mux.HandleFunc("/api/chat", service.handleChat)
-	mux.HandleFunc("/api/refresh-docs", service.handleRefreshDocs)
+	mux.Handle("/health", metrics.Instrument("/health", http.HandlerFunc(service.healthCheck)))
+	mux.Handle("/api/chat", metrics.Instrument("/api/chat", http.HandlerFunc(service.handleChat)))
+	mux.Handle("/api/refresh-docs", metrics.Instrument("/api/refresh-docs", http.HandlerFunc(service.handleRefreshDocs)))
+	mux.Handle("/api/search", metrics.Instrument("/api/search", http.HandlerFunc(service.handleSearch)))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/metrics/usage", service.handleUsage)
+
+	// Uploads get their own body limit, so they're routed around the default one
+	root := http.NewServeMux()
+	root.Handle("/", limitBody(mux, config.MaxRequestBodyBytes))
+	if config.DocsUploadToken != "" {
+		root.Handle("/api/upload-docs", limitBody(metrics.Instrument("/api/upload-docs", http.HandlerFunc(service.handleUploadDocs)), config.MaxUploadBytes))
+		log.Printf("Docs upload enabled at /api/upload-docs")
+	}
+	if config.UsageResetToken != "" {
+		mux.HandleFunc("/metrics/usage/reset", service.handleUsageReset)
+		log.Printf("Usage reset enabled at /metrics/usage/reset")
+	}
 
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
-		ReadTimeout:  120 * time.Second,
-		WriteTimeout: 120 * time.Second,
+		Handler:      tracing.Middleware(root, slog.Default()),
+		ReadTimeout:  config.ServerReadTimeout,
+		WriteTimeout: config.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -596,9 +1661,9 @@ func main() {
 		server.Shutdown(ctx)
 	}()
 
-	log.Printf("Claude Agent Proxy Service starting on port %s (Model: %s, Docs: %d)", 
-		config.Port, config.ClaudeModel, len(service.docService.documents))
+	log.Printf("Claude Agent Proxy Service starting on port %s (Model: %s, Docs: %d)",
+		config.Port, config.ClaudeModel, len(service.docs().documents))
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// testConfig returns the default configuration, as if no environment variables were set
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+
+	var config Config
+	if err := envconfig.Process("claude_proxy_test", &config); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+	config.AnthropicAPIKey = "sk-ant-test"
+	return &config
+}
+
+func TestCleanContent(t *testing.T) {
+	raw := "---\ntitle: Wallets\n---\n" +
+		"[![Build](https://ci.example.com/badge.svg)](https://ci.example.com) ![Docs](https://img.example.com/docs.svg)\n" +
+		"# Wallets\n\n" +
+		"<!-- TODO: screenshots\nfor every exchange -->\n" +
+		"[//]: # (internal note)\n" +
+		"Connect Coinbase &amp; Ledger wallets.\n\n\n\n" +
+		"See the ![inline](https://img.example.com/x.png) guide."
+
+	ds := NewDocumentService([]string{"frontmatter", "html_comments", "markdown_comments", "images", "entities"}, 0)
+	got := ds.cleanContent(raw)
+
+	want := "# Wallets\n\nConnect Coinbase & Ledger wallets.\n\nSee the ![inline](https://img.example.com/x.png) guide."
+	if got != want {
+		t.Errorf("cleanContent() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCleanContentOnlyRunsEnabledSteps(t *testing.T) {
+	raw := "<!-- draft -->\nFees &amp; limits"
+
+	ds := NewDocumentService([]string{"entities", "no_such_step"}, 0)
+	if got := ds.cleanContent(raw); got != "<!-- draft -->\nFees & limits" {
+		t.Errorf("cleanContent() = %q, want only entities decoded", got)
+	}
+}
+
+// fakeClaude is a stand-in for the Messages API that records each request and answers
+// with the next of its texts, repeating the last
+type fakeClaude struct {
+	*httptest.Server
+	requests chan ClaudeRequest
+}
+
+// newFakeClaude starts a fake Messages API and points config at it
+func newFakeClaude(t *testing.T, config *Config, texts ...string) *fakeClaude {
+	t.Helper()
+
+	fake := &fakeClaude{requests: make(chan ClaudeRequest, 10)}
+	var calls atomic.Int32
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		fake.requests <- req
+
+		text := texts[min(int(calls.Add(1))-1, len(texts)-1)]
+		fmt.Fprintf(w, `{"model":%q,"content":[{"type":"text","text":%q}],"usage":{"input_tokens":120,"output_tokens":30}}`, req.Model, text)
+	}))
+	t.Cleanup(fake.Close)
+
+	config.AnthropicAPIURL = fake.URL
+	return fake
+}
+
+// next returns the next request the fake received
+func (f *fakeClaude) next(t *testing.T) ClaudeRequest {
+	t.Helper()
+
+	select {
+	case req := <-f.requests:
+		return req
+	default:
+		t.Fatal("Claude was not called")
+	}
+	return ClaudeRequest{}
+}
+
+// indexDocs replaces the service's document index with files, keyed by path
+func indexDocs(s *ClaudeProxyService, files map[string]string) {
+	docs := s.docs().emptyCopy()
+	for name, content := range files {
+		docs.addFile(name, []byte(content), s.config.ChunkSize)
+	}
+	docs.buildKeywordIndex()
+	s.docService = docs
+}
+
+// postChat sends req to the chat endpoint and decodes the response
+func postChat(t *testing.T, s *ClaudeProxyService, req ChatRequest) (*httptest.ResponseRecorder, ChatResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleChat(rec, httptest.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body)))
+
+	var resp ChatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestLongQuestionRetrievesWithCondensedQuery(t *testing.T) {
+	config := testConfig(t)
+	config.CondenseQueries = true
+	config.CondenseMinLength = 200
+	config.CondenseMaxTerms = 2
+	claude := newFakeClaude(t, config, "Use the reconciliation report.")
+	s := NewClaudeProxyService(config)
+	indexDocs(s, map[string]string{
+		"reconciliation.md": "# Reconciliation\n\nThe reconciliation report compares wallet balances with the ledger.",
+		"errors.md":         "# Sync errors\n\nA timeout while syncing an exchange is retried automatically.",
+	})
+
+	// A pasted log mentions words from other docs once each; the question repeats its subject
+	question := "My reconciliation report looks wrong. Pasting the log: " +
+		"worker-7 started, batch 42 queued, exchange adapter timeout after 30s while syncing, " +
+		"retry scheduled, cursor persisted, ledger snapshot refreshed, job finished with warnings. " +
+		"Can you explain the reconciliation report?"
+	rec, _ := postChat(t, s, ChatRequest{Message: question, CorrelationID: "corr_1"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+
+	req := claude.next(t)
+	if got := req.Messages[len(req.Messages)-1].Content; got != question {
+		t.Errorf("Claude got %q, want the full question", got)
+	}
+	if !strings.Contains(req.System, "reconciliation report compares") {
+		t.Error("system prompt lacks the reconciliation chunk the condensed query should find")
+	}
+	if strings.Contains(req.System, "retried automatically") {
+		t.Error("system prompt includes the sync errors chunk matched by the pasted log")
+	}
+}
+
+func TestCondenseQueryKeepsRareTerms(t *testing.T) {
+	ds := NewDocumentService(nil, 0)
+	ds.addFile("a.md", []byte("# A\n\nwallet wallet wallet sync"), 100)
+	ds.addFile("b.md", []byte("# B\n\nwallet balances"), 100)
+	ds.addFile("c.md", []byte("# C\n\nwallet reconciliation"), 100)
+	ds.buildKeywordIndex()
+
+	got := ds.CondenseQuery("wallet wallet reconciliation please", 1)
+	if got != "reconciliation" {
+		t.Errorf("CondenseQuery() = %q, want the rarest term", got)
+	}
+}
+
+func TestSearchWithHistoryResolvesFollowUpToRecentTurn(t *testing.T) {
+	ds := NewDocumentService(nil, 0)
+	ds.addFile("coinbase.md", []byte("# Coinbase export\n\nExport Coinbase transactions as a CSV file."), 100)
+	ds.addFile("ledger.md", []byte("# Ledger export\n\nExport Ledger transactions as a CSV file."), 100)
+	ds.buildKeywordIndex()
+
+	history := []ClaudeMessage{
+		{Role: "user", Content: "Tell me about Ledger"},
+		{Role: "assistant", Content: "Ledger is a hardware wallet."},
+		{Role: "user", Content: "What about Coinbase?"},
+		{Role: "assistant", Content: "Coinbase is an exchange."},
+	}
+
+	results := ds.SearchWithHistory("How do I export it?", history, 4, 2, nil)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want both export docs", len(results))
+	}
+	if results[0].DocPath != "coinbase.md" {
+		t.Errorf("top result is %s, want coinbase.md from the most recent turn", results[0].DocPath)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("scores %.3f and %.3f, want the recent turn weighted higher", results[0].Score, results[1].Score)
+	}
+}
+
+func TestSearchWithHistoryIgnoresTurnsBeyondLimit(t *testing.T) {
+	ds := NewDocumentService(nil, 0)
+	ds.addFile("coinbase.md", []byte("# Coinbase export\n\nExport Coinbase transactions as a CSV file."), 100)
+	ds.addFile("ledger.md", []byte("# Ledger export\n\nExport Ledger transactions as a CSV file."), 100)
+	ds.buildKeywordIndex()
+
+	history := []ClaudeMessage{
+		{Role: "user", Content: "What about Coinbase?"},
+		{Role: "assistant", Content: "Coinbase is an exchange."},
+	}
+
+	results := ds.SearchWithHistory("How do I export it?", history, 0, 2, nil)
+	for _, chunk := range results {
+		if slices.Contains(chunk.MatchedKeywords, "coinbase") {
+			t.Errorf("%s matched %v with history turns disabled", chunk.DocPath, chunk.MatchedKeywords)
+		}
+	}
+}
+
+func TestChatResponseIncludesModelAndUsage(t *testing.T) {
+	config := testConfig(t)
+	newFakeClaude(t, config, "Go to Connections.")
+	s := NewClaudeProxyService(config)
+
+	rec, resp := postChat(t, s, ChatRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1", IncludeUsage: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Model != config.ClaudeModel || resp.InputTokens != 120 || resp.OutputTokens != 30 {
+		t.Errorf("got model %q with %d in, %d out, want %s with 120 and 30", resp.Model, resp.InputTokens, resp.OutputTokens, config.ClaudeModel)
+	}
+}
+
+func TestChatResponseOmitsUsageByDefault(t *testing.T) {
+	config := testConfig(t)
+	newFakeClaude(t, config, "Go to Connections.")
+	s := NewClaudeProxyService(config)
+
+	rec, resp := postChat(t, s, ChatRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+	if resp.Model != "" || resp.InputTokens != 0 || strings.Contains(rec.Body.String(), `"input_tokens"`) {
+		t.Errorf("body %s carries usage, want it omitted unless requested", rec.Body)
+	}
+}
+
+func TestChatResponseCarriesCallerCorrelationID(t *testing.T) {
+	config := testConfig(t)
+	newFakeClaude(t, config, "Go to Connections.")
+	s := NewClaudeProxyService(config)
+	handler := tracing.Middleware(http.HandlerFunc(s.handleChat), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"How do I connect a wallet?"}`))
+	req.Header.Set(tracing.Header, "wavie_1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp ChatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.CorrelationID != "wavie_1" || rec.Header().Get(tracing.Header) != "wavie_1" {
+		t.Errorf("got correlation_id %q and %s %q, want the caller's wavie_1 in both", resp.CorrelationID, tracing.Header, rec.Header().Get(tracing.Header))
+	}
+	if got := rec.Header().Get(tracing.RequestIDHeader); got != "wavie_1" {
+		t.Errorf("%s = %q, want the correlation ID wavie_1", tracing.RequestIDHeader, got)
+	}
+}
+
+func TestSystemPromptIncludesAnswerLengthGuidance(t *testing.T) {
+	config := testConfig(t)
+	config.TargetAnswerWords = 150
+	s := NewClaudeProxyService(config)
+
+	prompt := s.buildSystemPrompt(nil, nil)
+	if !strings.Contains(prompt, "Aim for under 150 words unless the question needs more detail") {
+		t.Errorf("system prompt has no answer length guidance:\n%s", prompt)
+	}
+}
+
+func TestSystemPromptZeroTargetAddsNoGuidance(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+
+	if prompt := s.buildSystemPrompt(nil, nil); strings.Contains(prompt, "Aim for under") {
+		t.Errorf("system prompt has answer length guidance with TARGET_ANSWER_WORDS=0:\n%s", prompt)
+	}
+}
+
+// newFlakyClaude starts a Messages API stand-in that answers the first failures requests
+// with status and the rest with "Go to Connections.", returning a count of calls made
+func newFlakyClaude(t *testing.T, config *Config, failures int, status int, retryAfter string) *atomic.Int32 {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			w.Header().Set("retry-after", retryAfter)
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"model":"claude-test","content":[{"type":"text","text":"Go to Connections."}],"usage":{"input_tokens":120,"output_tokens":30}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	config.AnthropicAPIURL = server.URL
+	return calls
+}
+
+func TestClaudeRequestRetriesUntilSuccess(t *testing.T) {
+	config := testConfig(t)
+	config.MaxRetries = 3
+	calls := newFlakyClaude(t, config, 2, http.StatusServiceUnavailable, "0")
+	s := NewClaudeProxyService(config)
+
+	completion, err := s.callClaudeAPI(context.Background(), config.ClaudeModel, []ClaudeMessage{{Role: "user", Content: "Hi"}}, nil, "corr_1")
+	if err != nil {
+		t.Fatalf("callClaudeAPI: %v", err)
+	}
+	if completion.Text != "Go to Connections." {
+		t.Errorf("Text = %q, want the answer from the third attempt", completion.Text)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Claude was called %d times, want 3", got)
+	}
+}
+
+func TestClaudeRequestStopsRetryingWhenContextEnds(t *testing.T) {
+	config := testConfig(t)
+	config.MaxRetries = 3
+	calls := newFlakyClaude(t, config, 10, http.StatusTooManyRequests, "3600")
+	s := NewClaudeProxyService(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.callClaudeAPI(ctx, config.ClaudeModel, []ClaudeMessage{{Role: "user", Content: "Hi"}}, nil, "corr_1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("callClaudeAPI() = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v to give up, want it to stop waiting when the context ends", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Claude was called %d times, want 1", got)
+	}
+}
+
+func TestTruncateForSlack(t *testing.T) {
+	notice := len([]rune(truncationNotice))
+
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{"short text unchanged", "Go to Connections 🎉", 100, "Go to Connections 🎉"},
+		{"exactly max runes unchanged", "日本語のテキスト", 8, "日本語のテキスト"},
+		// The emoji is the last rune that fits, so the cut falls on the space before it
+		{"emoji at the boundary", "Done ✅ " + strings.Repeat("x", 100), notice + 6, "Done ✅" + truncationNotice},
+		{"emoji straddling the boundary", "Done 🎉🎉 " + strings.Repeat("x", 100), notice + 6, "Done" + truncationNotice},
+		// No spaces to break on, so CJK is cut at the rune budget
+		{"CJK at the boundary", strings.Repeat("漢字", 100), notice + 5, "漢字漢字漢" + truncationNotice},
+		{"accented words", "café résumé naïve façade " + strings.Repeat("x", 100), notice + 14, "café résumé" + truncationNotice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateForSlack(tt.text, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateForSlack() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateForSlack() = %q is not valid UTF-8", got)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.max {
+				t.Errorf("truncateForSlack() has %d runes, want at most %d", n, tt.max)
+			}
+		})
+	}
+}
+
+// chunkContents returns the content of every chunk in s's index
+func chunkContents(s *ClaudeProxyService) []string {
+	contents := make([]string, len(s.docs().chunks))
+	for i, chunk := range s.docs().chunks {
+		contents[i] = chunk.Content
+	}
+	return contents
+}
+
+func TestLongCodeBlockStaysInOneChunk(t *testing.T) {
+	config := testConfig(t)
+	config.ChunkSize = 500
+	s := NewClaudeProxyService(config)
+
+	var code strings.Builder
+	code.WriteString("```json\n{\n")
+	for i := 0; code.Len() < 2048; i++ {
+		fmt.Fprintf(&code, "  \"field_%02d\": \"value number %02d for the export\",\n", i, i)
+	}
+	code.WriteString("  \"last\": true\n}\n```")
+	block := code.String()
+
+	prose := strings.Repeat("The export API returns every ledger entry for the period. ", 15)
+	indexDocs(s, map[string]string{"api/export.md": "# Export API\n\n" + prose + "\n\n" + block + "\n\n" + prose})
+
+	containing := 0
+	for _, content := range chunkContents(s) {
+		if strings.Contains(content, "```json") || strings.Contains(content, "\"last\": true") {
+			containing++
+			if !strings.Contains(content, block) {
+				t.Errorf("chunk holds part of the code block but not all of it:\n%s", content)
+			}
+		}
+		if n := strings.Count(content, "```"); n%2 != 0 {
+			t.Errorf("chunk has %d code fences, want them balanced:\n%s", n, content)
+		}
+	}
+	if containing != 1 {
+		t.Errorf("code block appears in %d chunks, want exactly 1", containing)
+	}
+}
+
+// numberedWords returns n distinct words such as "close001", "close002"
+func numberedWords(prefix string, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("%s%03d", prefix, i+1)
+	}
+	return strings.Join(words, " ")
+}
+
+func TestAdjacentChunksShareOverlap(t *testing.T) {
+	config := testConfig(t)
+	config.ChunkSize = 200
+	config.ChunkOverlap = 50
+	s := NewClaudeProxyService(config)
+
+	// Each word and its separator take 9 characters, so 5 words fit in the 50 character overlap
+	indexDocs(s, map[string]string{
+		"procedures.md": "# Close the books\n" + numberedWords("close", 60) + "\n# Audit\n" + numberedWords("audit", 60),
+	})
+
+	chunks := s.docs().chunks
+	for i := 1; i < len(chunks); i++ {
+		prev, next := strings.Fields(chunks[i-1].Content), strings.Fields(chunks[i].Content)
+		// Sub-chunk IDs end in _<section>_<chunk>; overlap never crosses a heading
+		prevSection := chunks[i-1].ID[:strings.LastIndex(chunks[i-1].ID, "_")]
+		if prevSection != chunks[i].ID[:strings.LastIndex(chunks[i].ID, "_")] {
+			if slices.Contains(prev, next[0]) {
+				t.Errorf("chunk %d starts with %q from the previous section", i, next[0])
+			}
+			continue
+		}
+
+		if strings.HasPrefix(next[0], "#") || !slices.Equal(prev[len(prev)-5:], next[:5]) || slices.Contains(prev, next[5]) {
+			t.Errorf("chunk %d starts %q after chunk %d ends %q, want exactly the last 5 words repeated", i, next[:6], i-1, prev[len(prev)-5:])
+		}
+	}
+
+	// Words in an overlap are indexed in both chunks that hold them
+	shared := strings.Fields(chunks[1].Content)[0]
+	results := s.docs().SearchRelevantChunks(shared, 10, nil)
+	if len(results) != 2 {
+		t.Errorf("searching %q found %d chunks, want the 2 that share it", shared, len(results))
+	}
+}
+
+func TestSearchRanksRelevantLongChunkAboveIncidentalMention(t *testing.T) {
+	config := testConfig(t)
+	s := NewClaudeProxyService(config)
+	indexDocs(s, map[string]string{
+		"reconciliation.md": "# Bank reconciliation\n" +
+			"Reconciliation matches every ledger entry against the bank statement. " +
+			"Start reconciliation from the Banking page, choose the account and the statement date. " +
+			"Wavie suggests matches for imported transactions; confirm each suggested match or pick another entry. " +
+			"Unmatched deposits usually mean a missing invoice payment, so record the payment before continuing. " +
+			"When the difference reaches zero, finish the reconciliation and Wavie locks the matched entries. " +
+			"An unlocked reconciliation can be reopened from the history tab.",
+		"glossary.md": "# Glossary\nLedger: the record of entries. See reconciliation.",
+		"invoices.md": "# Invoices\n" +
+			"Create invoices from the Sales page. Choose a customer, add line items with quantities and prices, " +
+			"and pick the payment terms. Taxes are calculated from the customer's region. Send the invoice by email " +
+			"or download a PDF copy. Overdue invoices appear on the dashboard with reminders you can schedule. " +
+			"Partial payments reduce the balance due, and credit notes cancel an invoice without deleting it.",
+		"payroll.md": "# Payroll\n" +
+			"Run payroll once per pay period from the People page. Review employee hours, overtime and leave " +
+			"before approving. Wavie calculates withholding and benefit deductions for each employee, then " +
+			"produces payslips. Approved payroll posts wages and liabilities to the ledger automatically. " +
+			"Corrections after approval are made with an adjustment run rather than by editing payslips.",
+	})
+
+	// The reconciliation section is a typical length and mentions the term throughout, while
+	// the glossary line is short but only mentions it in passing
+	results := s.docs().SearchRelevantChunks("reconciliation", 2, nil)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].DocPath != "reconciliation.md" || results[1].DocPath != "glossary.md" {
+		t.Errorf("ranked %s (%.2f) above %s (%.2f), want the reconciliation section first",
+			results[0].DocPath, results[0].Score, results[1].DocPath, results[1].Score)
+	}
+}
+
+func TestSearchPrefersShortChunkForSingleMentions(t *testing.T) {
+	config := testConfig(t)
+	s := NewClaudeProxyService(config)
+	indexDocs(s, map[string]string{
+		"overview.md": "# Overview\n" + numberedWords("topic", 40) + " Exports are covered elsewhere.",
+		"export.md":   "# Export\nExports download as CSV.",
+		"payroll.md":  "# Payroll\nRun payroll each period and approve the payslips.",
+	})
+
+	// With one mention each, the mention carries more weight in the shorter chunk
+	results := s.docs().SearchRelevantChunks("exports", 2, nil)
+	if len(results) != 2 || results[0].DocPath != "export.md" {
+		t.Fatalf("got %v, want export.md ranked first", chunkPaths(results))
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("scores %.3f and %.3f, want the short chunk strictly higher", results[0].Score, results[1].Score)
+	}
+}
+
+// chunkPaths returns the document path of each chunk
+func chunkPaths(chunks []Chunk) []string {
+	paths := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		paths[i] = chunk.DocPath
+	}
+	return paths
+}
+
+// TestSearchDuringReload is meant for go test -race: searches must only ever see a
+// complete index while refreshes swap in new ones
+func TestSearchDuringReload(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"reconcile.md": "# Reconcile accounts\nReconcile each bank account monthly.",
+		"invoices.md":  "# Invoices\nCreate invoices from the Sales page.",
+		"payroll.md":   "# Payroll\nApprove payslips before submission.",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	config := testConfig(t)
+	config.DocsZipPath = dir
+	s := NewClaudeProxyService(config)
+	if err := s.LoadDocuments(); err != nil {
+		t.Fatalf("load documents: %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				results := s.docs().SearchRelevantChunks("reconciling invoices", 5, nil)
+				if len(results) != 2 {
+					t.Errorf("search during reload found %v, want both matching chunks", chunkPaths(results))
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/refresh-docs", nil)
+		rec := httptest.NewRecorder()
+		s.handleRefreshDocs(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// captureClaudeBody starts a fake Messages API and points config at it. The returned
+// function gives the top-level fields of the next request it received.
+func captureClaudeBody(t *testing.T, config *Config) func() map[string]json.RawMessage {
+	t.Helper()
+
+	bodies := make(chan map[string]json.RawMessage, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"Go to Connections."}]}`)
+	}))
+	t.Cleanup(api.Close)
+
+	config.AnthropicAPIURL = api.URL
+	return func() map[string]json.RawMessage {
+		t.Helper()
+
+		select {
+		case body := <-bodies:
+			return body
+		default:
+			t.Fatal("Claude was not called")
+		}
+		return nil
+	}
+}
+
+func TestClaudeRequestCarriesConfiguredSampling(t *testing.T) {
+	t.Setenv("CLAUDE_MAX_TOKENS", "1500")
+	t.Setenv("CLAUDE_TEMPERATURE", "0.2")
+	config := testConfig(t)
+	nextBody := captureClaudeBody(t, config)
+	s := NewClaudeProxyService(config)
+
+	if rec, _ := postChat(t, s, ChatRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"}); rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+
+	body := nextBody()
+	if got := string(body["max_tokens"]); got != "1500" {
+		t.Errorf("max_tokens = %s, want 1500", got)
+	}
+	if got := string(body["temperature"]); got != "0.2" {
+		t.Errorf("temperature = %s, want 0.2", got)
+	}
+}
+
+func TestClaudeRequestOmitsUnsetTemperature(t *testing.T) {
+	config := testConfig(t)
+	nextBody := captureClaudeBody(t, config)
+	s := NewClaudeProxyService(config)
+
+	postChat(t, s, ChatRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+
+	body := nextBody()
+	if got := string(body["max_tokens"]); got != "4000" {
+		t.Errorf("max_tokens = %s, want the 4000 default", got)
+	}
+	if temperature, ok := body["temperature"]; ok {
+		t.Errorf("temperature = %s, want it omitted so Claude's default applies", temperature)
+	}
+}
+
+func TestOversizedChatRequestIsRejected(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	handler := limitBody(http.HandlerFunc(s.handleChat), 64)
+
+	body := `{"message":"` + strings.Repeat("wallet ", 100) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d for a %d byte body over a 64 byte limit, want 413", rec.Code, len(body))
+	}
+}
+
+func TestSearchMatchesMorphologicalVariants(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	indexDocs(s, map[string]string{
+		"reconcile.md": "# Reconcile accounts\nReconcile each bank account monthly.",
+		"payroll.md":   "# Payroll\nApprove payslips before submission.",
+	})
+
+	for _, query := range []string{"reconciling", "reconciliation", "reconciled accounts"} {
+		results := s.docs().SearchRelevantChunks(query, 1, nil)
+		if len(results) != 1 || results[0].DocPath != "reconcile.md" {
+			t.Errorf("search %q found %v, want reconcile.md", query, chunkPaths(results))
+			continue
+		}
+		// Keywords keep the words as written; only the index uses stems
+		if results[0].Keywords[0] != "reconcile" {
+			t.Errorf("search %q: first keyword %q, want the original word", query, results[0].Keywords[0])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UsageMetrics accumulates Claude token usage for the life of the process, or until
+// reset via POST /metrics/usage/reset
+type UsageMetrics struct {
+	requests     int64
+	inputTokens  int64
+	outputTokens int64
+	since        time.Time
+	mu           sync.Mutex
+}
+
+// UsageSnapshot is the JSON shape served by /metrics/usage
+type UsageSnapshot struct {
+	Requests         int64     `json:"requests"`
+	InputTokens      int64     `json:"input_tokens"`
+	OutputTokens     int64     `json:"output_tokens"`
+	EstimatedCostUSD float64   `json:"estimated_cost_usd"`
+	Since            time.Time `json:"since"`
+}
+
+func NewUsageMetrics() *UsageMetrics {
+	return &UsageMetrics{since: time.Now()}
+}
+
+// Record adds one successful Claude call
+func (m *UsageMetrics) Record(inputTokens, outputTokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.inputTokens += int64(inputTokens)
+	m.outputTokens += int64(outputTokens)
+}
+
+// Snapshot returns the totals, pricing tokens at the given per-1K rates, and resets the
+// counters afterwards if reset is set
+func (m *UsageMetrics) Snapshot(inputPricePer1K, outputPricePer1K float64, reset bool) UsageSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := UsageSnapshot{
+		Requests:     m.requests,
+		InputTokens:  m.inputTokens,
+		OutputTokens: m.outputTokens,
+		EstimatedCostUSD: float64(m.inputTokens)/1000*inputPricePer1K +
+			float64(m.outputTokens)/1000*outputPricePer1K,
+		Since: m.since,
+	}
+
+	if reset {
+		m.requests, m.inputTokens, m.outputTokens = 0, 0, 0
+		m.since = time.Now()
+	}
+
+	return snapshot
+}
+
+func (s *ClaudeProxyService) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	snapshot := s.metrics.Snapshot(s.config.InputTokenPricePer1K, s.config.OutputTokenPricePer1K, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// usageResetTokenHeader carries USAGE_RESET_TOKEN on usage resets
+const usageResetTokenHeader = "X-Usage-Reset-Token"
+
+// handleUsageReset returns the usage totals and zeroes them, so budgeting data can only
+// be wiped deliberately by a caller holding USAGE_RESET_TOKEN
+func (s *ClaudeProxyService) handleUsageReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.Header.Get(usageResetTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.UsageResetToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid "+usageResetTokenHeader)
+		return
+	}
+
+	snapshot := s.metrics.Snapshot(s.config.InputTokenPricePer1K, s.config.OutputTokenPricePer1K, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUsageGetNeverResets(t *testing.T) {
+	s := NewClaudeProxyService(testConfig(t))
+	s.metrics.Record(100, 20)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		s.handleUsage(rec, httptest.NewRequest(http.MethodGet, "/metrics/usage?reset=true", nil))
+
+		var snapshot UsageSnapshot
+		json.Unmarshal(rec.Body.Bytes(), &snapshot)
+		if snapshot.Requests != 1 || snapshot.InputTokens != 100 {
+			t.Fatalf("GET %d got %+v, want the recorded call still counted", i+1, snapshot)
+		}
+	}
+}
+
+func TestUsageResetRequiresToken(t *testing.T) {
+	config := testConfig(t)
+	config.UsageResetToken = "secret"
+	s := NewClaudeProxyService(config)
+	s.metrics.Record(100, 20)
+
+	for _, tc := range []struct {
+		method, token string
+		want          int
+	}{
+		{http.MethodGet, "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "wrong", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, "/metrics/usage/reset", nil)
+		req.Header.Set(usageResetTokenHeader, tc.token)
+		rec := httptest.NewRecorder()
+		s.handleUsageReset(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s with token %q got %d, want %d", tc.method, tc.token, rec.Code, tc.want)
+		}
+	}
+	if snapshot := s.metrics.Snapshot(0, 0, false); snapshot.Requests != 1 {
+		t.Fatalf("rejected resets changed the totals to %+v", snapshot)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/metrics/usage/reset", nil)
+	req.Header.Set(usageResetTokenHeader, "secret")
+	rec := httptest.NewRecorder()
+	s.handleUsageReset(rec, req)
+
+	var before UsageSnapshot
+	json.Unmarshal(rec.Body.Bytes(), &before)
+	if rec.Code != http.StatusOK || before.Requests != 1 {
+		t.Errorf("got %d with %+v, want 200 and the totals before the reset", rec.Code, before)
+	}
+	if after := s.metrics.Snapshot(0, 0, false); after.Requests != 0 || after.InputTokens != 0 {
+		t.Errorf("totals after reset = %+v, want zero", after)
+	}
+}
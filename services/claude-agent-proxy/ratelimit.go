@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitQuota is the most recent state reported by the anthropic-ratelimit-* headers
+type RateLimitQuota struct {
+	LimitRequests     int       `json:"limit_requests"`
+	RemainingRequests int       `json:"remaining_requests"`
+	ResetRequestsAt   time.Time `json:"reset_requests_at"`
+	LimitTokens       int       `json:"limit_tokens"`
+	RemainingTokens   int       `json:"remaining_tokens"`
+	ResetTokensAt     time.Time `json:"reset_tokens_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// RateLimitThrottle slows requests down when the remaining quota drops below a fraction
+// of the limit, spreading what is left over the time until the limit resets
+type RateLimitThrottle struct {
+	threshold float64
+	maxDelay  time.Duration
+	quota     RateLimitQuota
+	mu        sync.RWMutex
+}
+
+func NewRateLimitThrottle(threshold float64, maxDelay time.Duration) *RateLimitThrottle {
+	return &RateLimitThrottle{
+		threshold: threshold,
+		maxDelay:  maxDelay,
+	}
+}
+
+// Update records the quota from a response's headers. Missing or unparseable headers
+// leave the previous value in place.
+func (t *RateLimitThrottle) Update(header http.Header, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	updated := false
+	updated = parseHeaderInt(header, "anthropic-ratelimit-requests-limit", &t.quota.LimitRequests) || updated
+	updated = parseHeaderInt(header, "anthropic-ratelimit-requests-remaining", &t.quota.RemainingRequests) || updated
+	updated = parseHeaderTime(header, "anthropic-ratelimit-requests-reset", &t.quota.ResetRequestsAt) || updated
+	updated = parseHeaderInt(header, "anthropic-ratelimit-tokens-limit", &t.quota.LimitTokens) || updated
+	updated = parseHeaderInt(header, "anthropic-ratelimit-tokens-remaining", &t.quota.RemainingTokens) || updated
+	updated = parseHeaderTime(header, "anthropic-ratelimit-tokens-reset", &t.quota.ResetTokensAt) || updated
+
+	if updated {
+		t.quota.UpdatedAt = now
+	}
+}
+
+func (t *RateLimitThrottle) Quota() RateLimitQuota {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.quota
+}
+
+// Delay returns how long the next request should wait, or zero when quota is healthy
+func (t *RateLimitThrottle) Delay(now time.Time) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	delay := t.spread(t.quota.LimitRequests, t.quota.RemainingRequests, t.quota.ResetRequestsAt, now)
+	if tokenDelay := t.spread(t.quota.LimitTokens, t.quota.RemainingTokens, t.quota.ResetTokensAt, now); tokenDelay > delay {
+		delay = tokenDelay
+	}
+
+	if delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+	return delay
+}
+
+func (t *RateLimitThrottle) spread(limit, remaining int, resetAt, now time.Time) time.Duration {
+	if limit <= 0 || float64(remaining)/float64(limit) >= t.threshold {
+		return 0
+	}
+
+	untilReset := resetAt.Sub(now)
+	if untilReset <= 0 {
+		return 0
+	}
+
+	return untilReset / time.Duration(remaining+1)
+}
+
+func parseHeaderInt(header http.Header, key string, dst *int) bool {
+	value, err := strconv.Atoi(header.Get(key))
+	if err != nil {
+		return false
+	}
+	*dst = value
+	return true
+}
+
+// parseHeaderTime reads Anthropic's RFC 3339 reset timestamps
+func parseHeaderTime(header http.Header, key string, dst *time.Time) bool {
+	value, err := time.Parse(time.RFC3339, header.Get(key))
+	if err != nil {
+		return false
+	}
+	*dst = value
+	return true
+}
+
+// isRetryableStatus reports whether a response is worth retrying: rate limits and
+// transient server errors, but never other client errors
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// maxRetryDelay caps the wait between retries, including waits asked for with retry-after,
+// so a retried request still finishes within the caller's timeout
+const maxRetryDelay = 20 * time.Second
+
+// retryDelay honors the retry-after header (seconds or an HTTP date) when present,
+// otherwise backs off exponentially from one second, never waiting over maxRetryDelay
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	return min(requestedRetryDelay(resp, attempt), maxRetryDelay)
+}
+
+func requestedRetryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if value := resp.Header.Get("retry-after"); value != "" {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+			if at, err := http.ParseTime(value); err == nil {
+				if d := time.Until(at); d > 0 {
+					return d
+				}
+			}
+		}
+	}
+	return time.Second << attempt
+}
+
+// sleepContext waits for d, returning early with the context's error if it is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
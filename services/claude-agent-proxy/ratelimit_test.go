@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitThrottleParsesAnthropicHeaders(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	reset := now.Add(20 * time.Second)
+
+	h := http.Header{}
+	h.Set("anthropic-ratelimit-requests-limit", "50")
+	h.Set("anthropic-ratelimit-requests-remaining", "3")
+	h.Set("anthropic-ratelimit-requests-reset", reset.Format(time.RFC3339))
+	h.Set("anthropic-ratelimit-tokens-limit", "40000")
+	h.Set("anthropic-ratelimit-tokens-remaining", "39000")
+	h.Set("anthropic-ratelimit-tokens-reset", reset.Format(time.RFC3339))
+
+	throttle := NewRateLimitThrottle(0.1, time.Minute)
+	throttle.Update(h, now)
+
+	quota := throttle.Quota()
+	if quota.LimitRequests != 50 || quota.RemainingRequests != 3 || !quota.ResetRequestsAt.Equal(reset) {
+		t.Errorf("requests quota = %+v, want 3 of 50 resetting at %v", quota, reset)
+	}
+	if quota.LimitTokens != 40000 || quota.RemainingTokens != 39000 || !quota.UpdatedAt.Equal(now) {
+		t.Errorf("tokens quota = %+v, want 39000 of 40000 updated at %v", quota, now)
+	}
+
+	// 3/50 is below the 10% threshold: 20s is spread over the 3 remaining requests and this one
+	if got := throttle.Delay(now); got != 5*time.Second {
+		t.Errorf("Delay() = %v, want 5s", got)
+	}
+}
+
+func TestRateLimitThrottleHealthyQuotaHasNoDelay(t *testing.T) {
+	now := time.Now()
+
+	h := http.Header{}
+	h.Set("anthropic-ratelimit-requests-limit", "50")
+	h.Set("anthropic-ratelimit-requests-remaining", "40")
+	h.Set("anthropic-ratelimit-requests-reset", now.Add(time.Minute).Format(time.RFC3339))
+
+	throttle := NewRateLimitThrottle(0.1, time.Minute)
+	throttle.Update(h, now)
+
+	if got := throttle.Delay(now); got != 0 {
+		t.Errorf("Delay() = %v, want 0", got)
+	}
+}
+
+func TestRateLimitThrottleDelayIsCapped(t *testing.T) {
+	now := time.Now()
+
+	h := http.Header{}
+	h.Set("anthropic-ratelimit-requests-limit", "50")
+	h.Set("anthropic-ratelimit-requests-remaining", "0")
+	h.Set("anthropic-ratelimit-requests-reset", now.Add(time.Hour).Format(time.RFC3339))
+
+	throttle := NewRateLimitThrottle(0.1, 2*time.Second)
+	throttle.Update(h, now)
+
+	if got := throttle.Delay(now); got != 2*time.Second {
+		t.Errorf("Delay() = %v, want the 2s cap", got)
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"first backoff", "", 0, time.Second},
+		{"third backoff", "", 2, 4 * time.Second},
+		{"backoff past the cap", "", 10, maxRetryDelay},
+		{"retry-after", "5", 0, 5 * time.Second},
+		{"retry-after past the cap", "3600", 0, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("retry-after", tt.retryAfter)
+			}
+			if got := retryDelay(resp, tt.attempt); got != tt.want {
+				t.Errorf("retryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
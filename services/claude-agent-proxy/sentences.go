@@ -0,0 +1,137 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/retrieval"
+)
+
+// Chunking strategies selectable via CHUNK_STRATEGY
+const (
+	chunkStrategyWords    = "words"
+	chunkStrategySentence = "sentence"
+)
+
+// abbreviations end in a period without ending a sentence. Dotted initialisms such as
+// "e.g." and "U.S." are recognized by initialismPattern instead.
+var abbreviations = map[string]bool{
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "st.": true, "jr.": true, "sr.": true,
+	"vs.": true, "etc.": true, "approx.": true, "inc.": true, "ltd.": true, "co.": true,
+	"corp.": true, "no.": true, "fig.": true, "jan.": true, "feb.": true, "aug.": true,
+	"sept.": true, "oct.": true, "nov.": true, "dec.": true,
+}
+
+var (
+	initialismPattern = regexp.MustCompile(`^(?:[a-z]\.)+$`)
+	listItemPattern   = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s`)
+)
+
+// SetChunkStrategy chooses how sections longer than the chunk size are split: "words"
+// packs words up to the limit, "sentence" packs whole sentences so chunks don't end
+// mid-sentence
+func (ds *DocumentService) SetChunkStrategy(strategy string) {
+	ds.chunkStrategy = strategy
+}
+
+// chunkUnits breaks text into the units splitIntoChunks packs: words, or with the
+// sentence strategy whole sentences, falling back to words for a sentence longer than
+// chunkSize. Fenced code blocks are always a single unit.
+func (ds *DocumentService) chunkUnits(text string, chunkSize int) []string {
+	if ds.chunkStrategy != chunkStrategySentence {
+		return retrieval.SplitCodeFences(text)
+	}
+
+	units := make([]string, 0)
+	var prose []string
+	flush := func() {
+		for _, sentence := range splitSentences(strings.Join(prose, " ")) {
+			if len(sentence) > chunkSize {
+				units = append(units, strings.Fields(sentence)...)
+			} else {
+				units = append(units, sentence)
+			}
+		}
+		prose = nil
+	}
+
+	var fence []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		isFence := strings.HasPrefix(trimmed, "```")
+		if fence != nil {
+			fence = append(fence, line)
+			if isFence {
+				units = append(units, strings.Join(fence, "\n"))
+				fence = nil
+			}
+			continue
+		}
+
+		switch {
+		case isFence:
+			flush()
+			fence = []string{line}
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			// Headings and list items rarely end in punctuation, so they end whatever
+			// came before rather than running into the next sentence
+			flush()
+			prose = append(prose, trimmed)
+			flush()
+		case listItemPattern.MatchString(trimmed):
+			flush()
+			prose = append(prose, trimmed)
+		default:
+			prose = append(prose, trimmed)
+		}
+	}
+	flush()
+	if fence != nil {
+		units = append(units, strings.Join(fence, "\n"))
+	}
+
+	return units
+}
+
+// splitSentences splits text into sentences at words ending in ".", "!" or "?" (allowing
+// closing quotes and brackets after them), unless the word is a known abbreviation or
+// the next word starts in lowercase
+func splitSentences(text string) []string {
+	words := strings.Fields(text)
+	sentences := make([]string, 0)
+	start := 0
+
+	for i, word := range words {
+		if i+1 < len(words) && !endsSentence(word, words[i+1]) {
+			continue
+		}
+		sentences = append(sentences, strings.Join(words[start:i+1], " "))
+		start = i + 1
+	}
+
+	return sentences
+}
+
+func endsSentence(word, next string) bool {
+	word = strings.TrimRight(word, `"')]”’`)
+	if word == "" {
+		return false
+	}
+
+	switch word[len(word)-1] {
+	case '!', '?':
+	case '.':
+		lower := strings.ToLower(strings.TrimLeft(word, `"'([“‘`))
+		if abbreviations[lower] || initialismPattern.MatchString(lower) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	first := []rune(strings.TrimLeft(next, `"'([“‘`))
+	return len(first) == 0 || !unicode.IsLower(first[0])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words in each shingle compared for similarity
+const shingleSize = 3
+
+// SetDedupThreshold sets how similar (0 to 1, Jaccard similarity of word shingles) a
+// chunk may be to a better-scoring one before searches drop it as a near duplicate, so
+// boilerplate repeated across docs doesn't fill the context. 0 disables deduplication.
+func (ds *DocumentService) SetDedupThreshold(threshold float64) {
+	ds.dedupThreshold = threshold
+}
+
+// selectDistinct returns up to max chunks from candidates, which are sorted best first,
+// skipping any at least threshold similar to one already selected. A threshold of 0 or
+// less keeps every candidate.
+func selectDistinct(candidates []Chunk, max int, threshold float64) []Chunk {
+	selected := make([]Chunk, 0, max)
+	if threshold <= 0 {
+		for _, chunk := range candidates {
+			if len(selected) >= max {
+				break
+			}
+			selected = append(selected, chunk)
+		}
+		return selected
+	}
+
+	selectedShingles := make([]map[string]bool, 0, max)
+	for _, chunk := range candidates {
+		if len(selected) >= max {
+			break
+		}
+
+		candidate := shingles(chunk.Content)
+		duplicate := false
+		for _, kept := range selectedShingles {
+			if jaccard(candidate, kept) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+
+		selected = append(selected, chunk)
+		selectedShingles = append(selectedShingles, candidate)
+	}
+	return selected
+}
+
+// shingles returns the set of shingleSize-word sequences in text after lowercasing and
+// dropping punctuation, so formatting differences don't hide a duplicate. Text shorter
+// than one shingle is a single shingle.
+func shingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	set := make(map[string]bool)
+	if len(words) < shingleSize {
+		if len(words) > 0 {
+			set[strings.Join(words, " ")] = true
+		}
+		return set
+	}
+
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = true
+	}
+	return set
+}
+
+// jaccard returns the size of the intersection of a and b over the size of their union
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for shingle := range a {
+		if b[shingle] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// claudeStreamEvent covers the fields used from Anthropic's streaming events
+type claudeStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamClaudeAPI calls Claude in streaming mode, passing each text delta to onDelta as
+// it arrives, and returns the full completion once the stream ends
+func (s *ClaudeProxyService) streamClaudeAPI(ctx context.Context, model string, messages []ClaudeMessage, relevantChunks []Chunk, correlationID string, onDelta func(text string) error) (*ClaudeCompletion, error) {
+	if s.config.EchoMode {
+		completion := echoCompletion(model, messages, relevantChunks)
+		if err := onDelta(completion.Text); err != nil {
+			return nil, err
+		}
+		return completion, nil
+	}
+
+	claudeReq := ClaudeRequest{
+		Model:       model,
+		MaxTokens:   s.config.MaxTokens,
+		System:      s.buildSystemPrompt(relevantChunks, messages),
+		Messages:    messages,
+		Stream:      true,
+		Temperature: s.config.Temperature,
+	}
+
+	resp, err := s.doClaudeRequest(ctx, claudeReq, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A 200 only means the stream started: Claude can still fail partway through, so the
+	// circuit breaker hears the outcome once the stream has ended
+	failed := isRetryableStatus(resp.StatusCode)
+	defer func() { s.recordClaudeResult(ctx, failed) }()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp claudeStreamEvent
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error.Type == "" {
+			return nil, fmt.Errorf("claude API error: status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("claude API error: %s - %s", errResp.Error.Type, errResp.Error.Message)
+	}
+
+	completion := &ClaudeCompletion{}
+	var text strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event claudeStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			log.Printf("Warning: Failed to parse stream event: %v", err)
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			completion.Model = event.Message.Model
+			completion.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			text.WriteString(event.Delta.Text)
+			if err := onDelta(event.Delta.Text); err != nil {
+				return nil, fmt.Errorf("failed to forward stream delta: %v", err)
+			}
+		case "message_delta":
+			completion.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			failed = true
+			return nil, fmt.Errorf("claude API error: %s - %s", event.Error.Type, event.Error.Message)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		failed = true
+		return nil, fmt.Errorf("failed to read stream: %v", err)
+	}
+
+	completion.Text = text.String()
+	if completion.Text == "" {
+		return nil, fmt.Errorf("no text content found in response")
+	}
+
+	log.Printf("Claude API usage - Input tokens: %d, Output tokens: %d",
+		completion.InputTokens, completion.OutputTokens)
+	s.metrics.Record(completion.InputTokens, completion.OutputTokens)
+
+	return completion, nil
+}
+
+// streamChat answers a chat request as server-sent events: a "delta" event per text
+// fragment, then a "done" event carrying the final ChatResponse. The final response is
+// authoritative, since the banned-phrase filter may replace text already streamed.
+func (s *ClaudeProxyService) streamChat(ctx context.Context, w http.ResponseWriter, req ChatRequest, model string, messages []ClaudeMessage, relevantChunks []Chunk, sourceDocs []SourceDoc) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	completion, err := s.streamClaudeAPI(ctx, model, messages, relevantChunks, req.CorrelationID, func(text string) error {
+		if err := writeSSE(w, "delta", map[string]string{"text": text}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error streaming Claude API (ID: %s): %v", req.CorrelationID, err)
+		apiErr := &APIError{
+			Code:    errCodeUpstreamError,
+			Message: "Failed to process your request. Please try again.",
+		}
+		if errors.Is(err, errCircuitOpen) {
+			apiErr = &APIError{
+				Code:    errCodeUpstreamUnavailable,
+				Message: "Claude is temporarily unavailable. Please try again shortly.",
+			}
+		}
+		writeSSE(w, "error", ChatResponse{
+			CorrelationID: req.CorrelationID,
+			Error:         apiErr,
+		})
+		flusher.Flush()
+		return
+	}
+
+	completion = s.filterBannedPhrases(ctx, model, messages, relevantChunks, completion, req.CorrelationID)
+	resp := s.buildChatResponse(req, completion, sourceDocs)
+
+	log.Printf("Streamed response (ID: %s): %d characters, %d source docs",
+		req.CorrelationID, len(resp.Response), len(sourceDocs))
+
+	writeSSE(w, "done", resp)
+	flusher.Flush()
+}
+
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadSynonyms reads a synonym file: one group of interchangeable terms per line,
+// separated by commas, e.g. "2fa, two-factor authentication". Blank lines and #
+// comments are skipped, as are groups with fewer than two terms.
+func loadSynonyms(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open synonyms file: %v", err)
+	}
+	defer file.Close()
+
+	groups := make([][]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		terms := make([]string, 0)
+		for _, term := range strings.Split(line, ",") {
+			if term = strings.TrimSpace(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) >= 2 {
+			groups = append(groups, terms)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read synonyms file: %v", err)
+	}
+
+	return groups, nil
+}
+
+// SetSynonyms sets the groups of interchangeable terms searches expand queries with. A
+// query mentioning any term of a group also searches for every other term, so "2fa"
+// finds docs that only say "two-factor authentication" and vice versa. Only queries
+// are expanded; the index is unchanged. Call before loading documents.
+func (ds *DocumentService) SetSynonyms(groups [][]string) {
+	ds.synonyms = make([][][]string, 0, len(groups))
+	for _, group := range groups {
+		terms := make([][]string, 0, len(group))
+		for _, term := range group {
+			if words := wordPattern.FindAllString(strings.ToLower(term), -1); len(words) > 0 {
+				terms = append(terms, words)
+			}
+		}
+		ds.synonyms = append(ds.synonyms, terms)
+	}
+}
+
+// synonymKeywords returns the words of every synonym of a term mentioned in text. A term
+// is mentioned when all its words appear in text after stop-word removal. Short words
+// like "txn" count even though they are too short to be keywords themselves.
+func (ds *DocumentService) synonymKeywords(text string) []string {
+	if len(ds.synonyms) == 0 {
+		return nil
+	}
+
+	words := make(map[string]bool)
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		if !ds.stopWords[word] {
+			words[word] = true
+		}
+	}
+
+	expanded := make([]string, 0)
+	for _, group := range ds.synonyms {
+		if !mentionsAnyTerm(words, group) {
+			continue
+		}
+		for _, term := range group {
+			for _, word := range term {
+				if !ds.stopWords[word] {
+					expanded = append(expanded, word)
+				}
+			}
+		}
+	}
+	return expanded
+}
+
+// mentionsAnyTerm reports whether all the words of some term are in words
+func mentionsAnyTerm(words map[string]bool, terms [][]string) bool {
+	for _, term := range terms {
+		mentioned := true
+		for _, word := range term {
+			if !words[word] {
+				mentioned = false
+				break
+			}
+		}
+		if mentioned {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadSynonymsSkipsCommentsAndSingleTerms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "synonyms.txt")
+	content := "# Security\n2FA, two-factor authentication , mfa\n\nwallet\ntxn,transaction\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := loadSynonyms(path)
+	if err != nil {
+		t.Fatalf("loadSynonyms: %v", err)
+	}
+	want := [][]string{{"2FA", "two-factor authentication", "mfa"}, {"txn", "transaction"}}
+	if !slices.EqualFunc(groups, want, slices.Equal[[]string]) {
+		t.Errorf("groups = %q, want %q", groups, want)
+	}
+}
+
+// newSecurityDocs indexes a doc that only says "two-factor authentication" and one about
+// an unrelated setting
+func newSecurityDocs(groups [][]string) *DocumentService {
+	ds := NewDocumentService(nil, 0)
+	ds.SetSynonyms(groups)
+	ds.addFile("security.md", []byte("# Account security\n\nTurn on two-factor authentication under Profile, then scan the code."), 100)
+	ds.addFile("exports.md", []byte("# Exports\n\nEnable scheduled exports under Reports."), 100)
+	ds.buildKeywordIndex()
+	return ds
+}
+
+func TestSynonymFindsDocUsingOtherTerm(t *testing.T) {
+	ds := newSecurityDocs([][]string{{"2fa", "two-factor authentication"}})
+
+	results := ds.SearchWithHistory("How do I enable 2FA?", nil, 0, 3, nil)
+	if len(results) == 0 || results[0].DocPath != "security.md" {
+		t.Errorf("2FA returned %v, want security.md first", chunkPaths(results))
+	}
+}
+
+func TestSearchWithoutSynonymsMissesOtherTerm(t *testing.T) {
+	ds := newSecurityDocs(nil)
+
+	for _, chunk := range ds.SearchWithHistory("2FA", nil, 0, 3, nil) {
+		if chunk.DocPath == "security.md" {
+			t.Errorf("2FA found security.md without a synonym group")
+		}
+	}
+}
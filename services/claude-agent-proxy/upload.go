@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// uploadTokenHeader carries DOCS_UPLOAD_TOKEN on docs uploads
+const uploadTokenHeader = "X-Docs-Upload-Token"
+
+// handleUploadDocs replaces the docs ZIP with the request body, either raw or as the
+// "file" part of a multipart form, and reloads the index. The upload is written next to
+// DocsZipPath and renamed over it only once it is a readable ZIP with at least one .md
+// file, so a bad upload leaves both the file and the live index untouched.
+func (s *ClaudeProxyService) handleUploadDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.Header.Get(uploadTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.DocsUploadToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid "+uploadTokenHeader)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.DocsZipPath), ".docs-upload-*.zip")
+	if err != nil {
+		log.Printf("Error creating docs upload file: %v", err)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to store upload")
+		return
+	}
+	// Removing fails harmlessly once the upload has been renamed into place
+	defer os.Remove(tmp.Name())
+
+	err = copyUpload(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error receiving docs upload: %v", err)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Upload too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidUpload, "Failed to read upload")
+		return
+	}
+
+	if err := validateDocsZip(tmp.Name()); err != nil {
+		log.Printf("Rejected docs upload: %v", err)
+		writeError(w, http.StatusUnprocessableEntity, errCodeInvalidUpload, err.Error())
+		return
+	}
+
+	// CreateTemp makes the file private; match what a deployed docs.zip usually has
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		log.Printf("Warning: Failed to set docs upload permissions: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.config.DocsZipPath); err != nil {
+		log.Printf("Error replacing docs ZIP: %v", err)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to store upload")
+		return
+	}
+
+	log.Printf("Docs ZIP replaced by upload, reloading...")
+	s.reloadDocuments(w)
+}
+
+// copyUpload writes the uploaded file to dst: the "file" part of a multipart form, or
+// the whole body otherwise
+func copyUpload(dst io.Writer, r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		_, err := io.Copy(dst, r.Body)
+		return err
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("multipart upload has no \"file\" part")
+		}
+		if err != nil {
+			return err
+		}
+		if part.FormName() == "file" {
+			_, err := io.Copy(dst, part)
+			return err
+		}
+	}
+}
+
+// validateDocsZip checks that zipPath is a readable ZIP containing at least one .md file
+func validateDocsZip(zipPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("upload is not a readable ZIP: %v", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() && strings.EqualFold(path.Ext(file.Name), ".md") {
+			return nil
+		}
+	}
+	return fmt.Errorf("upload contains no .md files")
+}
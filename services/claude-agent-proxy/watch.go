@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// docsWatchDebounce is how long the docs must stay unchanged before reloading, so a
+// ZIP that is still being copied into place isn't loaded half-written
+const docsWatchDebounce = 2 * time.Second
+
+// watchDocs reloads the documents once a change to DOCS_ZIP_PATH has settled. It uses
+// fsnotify, or polls every interval when poll is set or fsnotify can't watch the path,
+// as on some network and overlay mounts.
+func (s *ClaudeProxyService) watchDocs(interval time.Duration, poll bool) {
+	root := s.config.DocsZipPath
+	reload := func() {
+		log.Printf("Docs at %s changed, reloading", root)
+		if err := s.LoadDocuments(); err != nil {
+			log.Printf("Error reloading docs: %v", err)
+		}
+	}
+
+	if !poll {
+		watcher, err := newDocsWatcher(root)
+		if err == nil {
+			log.Printf("Watching %s for changes", root)
+			watcher.run(docsWatchDebounce, reload)
+			return
+		}
+		log.Printf("Can't watch %s for changes, polling instead: %v", root, err)
+	}
+
+	log.Printf("Polling %s for changes every %s", root, interval)
+	pollDocs(root, interval, reload)
+}
+
+// docsWatcher reports changes to a docs ZIP file or anywhere beneath a docs directory
+type docsWatcher struct {
+	watcher *fsnotify.Watcher
+	root    string
+	isDir   bool
+}
+
+// newDocsWatcher starts watching root. A ZIP file is watched through its parent
+// directory so replacing it by rename is still seen; a directory is watched along with
+// every directory beneath it, since fsnotify isn't recursive.
+func newDocsWatcher(root string) (*docsWatcher, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &docsWatcher{watcher: watcher, root: filepath.Clean(root), isDir: info.IsDir()}
+
+	if w.isDir {
+		err = w.addTree(w.root)
+	} else {
+		err = watcher.Add(filepath.Dir(w.root))
+	}
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addTree watches dir and every directory beneath it
+func (w *docsWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+// run calls reload once no change has been seen for debounce after the last one, until
+// the watcher is closed
+func (w *docsWatcher) run(debounce time.Duration, reload func()) {
+	defer w.watcher.Close()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.relevant(event) {
+				continue
+			}
+			settled = time.After(debounce)
+
+		case <-settled:
+			settled = nil
+			reload()
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching docs: %v", err)
+		}
+	}
+}
+
+// relevant reports whether event changes the docs, starting to watch directories
+// created beneath a docs directory
+func (w *docsWatcher) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if !w.isDir {
+		return filepath.Clean(event.Name) == w.root
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.addTree(event.Name); err != nil {
+				log.Printf("Error watching %s: %v", event.Name, err)
+			}
+		}
+	}
+	return true
+}
+
+// docsStamp summarizes the docs path well enough to notice changes
+type docsStamp struct {
+	modTime time.Time
+	size    int64
+	files   int
+}
+
+// pollDocs stats root every interval and calls reload once a change has settled
+func pollDocs(root string, interval time.Duration, reload func()) {
+	last, _ := statDocs(root)
+	var pending *docsStamp
+	var changedAt time.Time
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		current, err := statDocs(root)
+		if err != nil {
+			// Missing while being replaced; check again next tick
+			continue
+		}
+
+		if current != last && (pending == nil || current != *pending) {
+			pending = &current
+			changedAt = now
+			continue
+		}
+
+		if pending == nil || now.Sub(changedAt) < docsWatchDebounce {
+			continue
+		}
+
+		reload()
+		last = *pending
+		pending = nil
+	}
+}
+
+// statDocs stamps a ZIP file by its mtime and size, or a directory by the newest mtime,
+// total size and number of files beneath it
+func statDocs(root string) (docsStamp, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return docsStamp{}, err
+	}
+	if !info.IsDir() {
+		return docsStamp{modTime: info.ModTime(), size: info.Size(), files: 1}, nil
+	}
+
+	var stamp docsStamp
+	err = filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(stamp.modTime) {
+			stamp.modTime = info.ModTime()
+		}
+		stamp.size += info.Size()
+		stamp.files++
+		return nil
+	})
+	return stamp, err
+}
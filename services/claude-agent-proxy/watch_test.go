@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runWatcher starts watching root and returns a count of reloads
+func runWatcher(t *testing.T, root string) *atomic.Int32 {
+	t.Helper()
+	w, err := newDocsWatcher(root)
+	if err != nil {
+		t.Fatalf("newDocsWatcher: %v", err)
+	}
+	t.Cleanup(func() { w.watcher.Close() })
+
+	reloads := &atomic.Int32{}
+	go w.run(50*time.Millisecond, func() { reloads.Add(1) })
+	return reloads
+}
+
+func waitForReloads(t *testing.T, reloads *atomic.Int32, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for reloads.Load() < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give a stray extra reload the chance to show up
+	time.Sleep(150 * time.Millisecond)
+	if got := reloads.Load(); got != want {
+		t.Errorf("reloaded %d times, want %d", got, want)
+	}
+}
+
+func TestDocsWatcherReloadsOnceForABurstOfWrites(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "docs.zip")
+	if err := os.WriteFile(zipPath, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloads := runWatcher(t, zipPath)
+
+	for _, content := range []string{"v2", "v3", "v4"} {
+		if err := os.WriteFile(zipPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForReloads(t, reloads, 1)
+}
+
+func TestDocsWatcherIgnoresSiblingsOfTheZip(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "docs.zip")
+	if err := os.WriteFile(zipPath, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloads := runWatcher(t, zipPath)
+
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForReloads(t, reloads, 0)
+}
+
+func TestDocsWatcherSeesTheZipReplacedByRename(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "docs.zip")
+	if err := os.WriteFile(zipPath, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloads := runWatcher(t, zipPath)
+
+	tmp := filepath.Join(dir, "docs.zip.tmp")
+	if err := os.WriteFile(tmp, []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, zipPath); err != nil {
+		t.Fatal(err)
+	}
+	waitForReloads(t, reloads, 1)
+}
+
+func TestDocsWatcherWatchesNewSubdirectories(t *testing.T) {
+	root := t.TempDir()
+	reloads := runWatcher(t, root)
+
+	sub := filepath.Join(root, "guides")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitForReloads(t, reloads, 1)
+
+	if err := os.WriteFile(filepath.Join(sub, "setup.md"), []byte("# Setup"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForReloads(t, reloads, 2)
+}
@@ -10,9 +10,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/anthropic"
 	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/api"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/breaker"
 	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/config"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/docs"
 	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/tools"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -20,7 +28,7 @@ import (
 func main() {
 	slog.Info("Starting gpt-agent-proxy-svc")
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, nil)))
 	slog.SetDefault(logger)
 
 	if err := godotenv.Load(); err != nil {
@@ -36,7 +44,7 @@ func main() {
 	var level slog.Level
 	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err == nil {
 		opts := &slog.HandlerOptions{Level: level}
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, opts))
+		logger = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, opts)))
 		slog.SetDefault(logger)
 	}
 
@@ -45,15 +53,99 @@ func main() {
 		"openai_model", cfg.OpenAIModel,
 	)
 
-	openaiClient := openai.NewClient(cfg.OpenAIAPIKey, cfg.OpenAIModel, logger)
-	handler := api.NewHandler(openaiClient, logger)
+	if cfg.OpenAIAPIKey == "" && !cfg.EchoMode {
+		slog.Error("OPENAI_API_KEY is required unless ECHO_MODE is set")
+		os.Exit(1)
+	}
+	if cfg.Temperature < 0 || cfg.Temperature > 2 {
+		slog.Error("Invalid OPENAI_TEMPERATURE, must be between 0 and 2", "temperature", cfg.Temperature)
+		os.Exit(1)
+	}
+	if cfg.MaxTokens <= 0 {
+		slog.Error("Invalid OPENAI_MAX_TOKENS, must be positive", "max_tokens", cfg.MaxTokens)
+		os.Exit(1)
+	}
+	if cfg.MaxConcurrentUpstream < 0 {
+		slog.Error("Invalid MAX_CONCURRENT_UPSTREAM, must not be negative", "max_concurrent_upstream", cfg.MaxConcurrentUpstream)
+		os.Exit(1)
+	}
+	if cfg.CircuitBreakerThreshold < 0 {
+		slog.Error("Invalid CIRCUIT_BREAKER_THRESHOLD, must not be negative", "threshold", cfg.CircuitBreakerThreshold)
+		os.Exit(1)
+	}
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":         cfg.UpstreamTimeout,
+		"SERVER_READ_TIMEOUT":      cfg.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT":     cfg.ServerWriteTimeout,
+		"CIRCUIT_BREAKER_COOLDOWN": cfg.CircuitBreakerCooldown,
+		"TOOL_TIMEOUT":             cfg.ToolTimeout,
+		"UPSTREAM_QUEUE_TIMEOUT":   cfg.UpstreamQueueTimeout,
+	} {
+		if timeout <= 0 {
+			slog.Error("Invalid "+name+", must be a positive duration", "timeout", timeout)
+			os.Exit(1)
+		}
+	}
+	if cfg.MaxRequestBodyBytes <= 0 {
+		slog.Error("Invalid MAX_REQUEST_BODY_BYTES, must be positive", "max_request_body_bytes", cfg.MaxRequestBodyBytes)
+		os.Exit(1)
+	}
+
+	contextWindows, err := tokenlimit.ParseWindows(cfg.ModelContextWindows)
+	if err != nil {
+		slog.Error("Invalid MODEL_CONTEXT_WINDOWS", "error", err)
+		os.Exit(1)
+	}
+	tokenGuard := tokenlimit.NewGuard(contextWindows)
+
+	throttle := ratelimit.NewThrottle(cfg.RateLimitThreshold, cfg.RateLimitMaxDelay)
+
+	openaiClient := openai.NewClient(cfg.OpenAIAPIKey, cfg.OpenAIModel, cfg.SystemPrompt, tokenGuard, throttle, cfg.TargetAnswerWords, cfg.Temperature, cfg.MaxTokens, logger)
+	openaiClient.SetMaxRetries(cfg.OpenAIMaxRetries)
+	openaiClient.SetTimeout(cfg.UpstreamTimeout)
+	if cfg.CircuitBreakerThreshold > 0 {
+		openaiClient.SetBreaker(breaker.NewBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown))
+	}
+	if cfg.ToolsPath != "" {
+		toolDefs, executor, err := tools.LoadHTTPTools(cfg.ToolsPath, cfg.ToolTimeout, logger)
+		if err != nil {
+			slog.Error("Failed to load TOOLS_PATH", "path", cfg.ToolsPath, "error", err)
+			os.Exit(1)
+		}
+		openaiClient.SetTools(toolDefs, executor)
+		slog.Info("Tool calling enabled", "tools", len(toolDefs))
+	}
+	if cfg.FallbackEnabled {
+		if cfg.AnthropicAPIKey == "" {
+			slog.Warn("FALLBACK_ENABLED is set but ANTHROPIC_API_KEY is empty, fallback disabled")
+		} else {
+			anthropicClient := anthropic.NewClient(cfg.AnthropicAPIKey, cfg.AnthropicModel, cfg.Temperature, cfg.MaxTokens, logger)
+			anthropicClient.SetTimeout(cfg.UpstreamTimeout)
+			openaiClient.SetFallback(anthropicClient)
+			slog.Info("Anthropic fallback enabled", "anthropic_model", cfg.AnthropicModel)
+		}
+	}
+	docIndex := loadDocs(cfg, logger)
+	handler := api.NewHandler(openaiClient, docIndex, cfg.MaxContextChunks, cfg.IncludeUsage, cfg.HistoryTimestamps, logger)
+	handler.SetUpstreamTimeout(cfg.UpstreamTimeout)
+	if cfg.MaxConcurrentUpstream > 0 {
+		handler.SetUpstreamLimit(ratelimit.NewSemaphore(cfg.MaxConcurrentUpstream, cfg.UpstreamQueueTimeout))
+	}
+	if cfg.EchoMode {
+		handler.SetEchoMode(true)
+		slog.Warn("ECHO_MODE is set, answers echo the question instead of calling OpenAI")
+	}
+
+	metrics.SetService("gpt-agent-proxy-svc")
 
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: mux,
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      tracing.Middleware(api.LimitBody(mux, cfg.MaxRequestBodyBytes), logger),
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -78,3 +170,19 @@ func main() {
 
 	slog.Info("Service shutdown complete")
 }
+
+// loadDocs loads the documentation index, returning nil to run without a knowledge base
+// when none is configured or it cannot be loaded
+func loadDocs(cfg config.Config, logger *slog.Logger) *docs.Index {
+	if cfg.DocsZipPath == "" {
+		slog.Info("No DOCS_ZIP_PATH configured, running without knowledge base")
+		return nil
+	}
+
+	docIndex, err := docs.LoadZip(cfg.DocsZipPath, cfg.ChunkSize, logger)
+	if err != nil {
+		slog.Warn("Failed to load docs, running without knowledge base", "path", cfg.DocsZipPath, "error", err)
+		return nil
+	}
+	return docIndex
+}
@@ -0,0 +1,211 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+)
+
+const (
+	apiURL     = "https://api.anthropic.com/v1/messages"
+	apiVersion = "2023-06-01"
+)
+
+type messagesRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type messagesResponse struct {
+	Model   string         `json:"model"`
+	Content []contentBlock `json:"content"`
+	Usage   usage          `json:"usage"`
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Client answers OpenAI-shaped chat requests with the Anthropic Messages API. It is
+// used as the fallback provider when OpenAI fails.
+type Client struct {
+	apiKey      string
+	model       string
+	temperature float64
+	maxTokens   int
+	logger      *slog.Logger
+	client      *http.Client
+}
+
+// NewClient creates an Anthropic client using the same sampling settings as OpenAI.
+// Anthropic accepts temperatures up to 1, so higher values are capped.
+func NewClient(apiKey, model string, temperature float64, maxTokens int, logger *slog.Logger) *Client {
+	return &Client{
+		apiKey:      apiKey,
+		model:       model,
+		temperature: min(temperature, 1),
+		maxTokens:   maxTokens,
+		logger:      logger,
+		client: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+	}
+}
+
+// SetTimeout sets how long each request to Anthropic may take, including reading the answer
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// Name identifies the provider in logs and metrics
+func (c *Client) Name() string {
+	return "anthropic"
+}
+
+// Complete sends messages, as built for OpenAI, to Anthropic and returns the answer
+// as an OpenAI completion
+func (c *Client) Complete(ctx context.Context, messages []openai.Message, correlationID string) (*openai.Completion, error) {
+	system, converted := convertMessages(messages)
+	if len(converted) == 0 {
+		return nil, fmt.Errorf("no user message to send")
+	}
+
+	request := messagesRequest{
+		Model:       c.model,
+		System:      system,
+		Messages:    converted,
+		MaxTokens:   c.maxTokens,
+		Temperature: c.temperature,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	c.logger.Info("Sending request to Anthropic", "correlation_id", correlationID, "model", c.model)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", apiVersion)
+	tracing.SetHeader(req)
+
+	resp, err := c.client.Do(req)
+	metrics.ObserveUpstream("anthropic", err == nil && resp.StatusCode == http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResp errorResponse
+		if err := json.Unmarshal(body, &errorResp); err != nil || errorResp.Error.Message == "" {
+			return nil, fmt.Errorf("Anthropic API error: %d - %s", resp.StatusCode, string(body))
+		}
+		return nil, fmt.Errorf("Anthropic API error: %s", errorResp.Error.Message)
+	}
+
+	var msgResp messagesResponse
+	if err := json.Unmarshal(body, &msgResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range msgResp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("no text content in response")
+	}
+
+	c.logger.Info("Received response from Anthropic",
+		"correlation_id", correlationID,
+		"tokens_used", msgResp.Usage.InputTokens+msgResp.Usage.OutputTokens,
+		"response_length", text.Len())
+
+	return &openai.Completion{
+		Content: text.String(),
+		Model:   msgResp.Model,
+		Usage: openai.Usage{
+			PromptTokens:     msgResp.Usage.InputTokens,
+			CompletionTokens: msgResp.Usage.OutputTokens,
+			TotalTokens:      msgResp.Usage.InputTokens + msgResp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// convertMessages maps OpenAI chat messages onto the Messages API: system messages move
+// to the top-level system prompt, consecutive turns from the same role are merged since
+// roles must alternate, and leading assistant turns are dropped since the conversation
+// must open with the user
+func convertMessages(messages []openai.Message) (string, []message) {
+	var system []string
+	var converted []message
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			system = append(system, msg.Content)
+			continue
+		case "user", "assistant":
+		default:
+			continue
+		}
+
+		if len(converted) == 0 && msg.Role != "user" {
+			continue
+		}
+
+		if last := len(converted) - 1; last >= 0 && converted[last].Role == msg.Role {
+			converted[last].Content += "\n\n" + msg.Content
+			continue
+		}
+
+		converted = append(converted, message{Role: msg.Role, Content: msg.Content})
+	}
+
+	return strings.Join(system, "\n\n"), converted
+}
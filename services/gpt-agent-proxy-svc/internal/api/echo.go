@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/docs"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+)
+
+// echoModel is reported as the model of echoed answers
+const echoModel = "echo"
+
+// SetEchoMode answers every request with the question and the titles of the retrieved
+// documentation instead of calling OpenAI, so the Slack flow can be exercised locally
+// without an API key or spending tokens
+func (h *Handler) SetEchoMode(enabled bool) {
+	h.echoMode = enabled
+}
+
+// echoCompletion builds the canned answer returned in echo mode
+func echoCompletion(message string, chunks []docs.Chunk) *openai.Completion {
+	var text strings.Builder
+	fmt.Fprintf(&text, "[echo] %s", message)
+	if titles := docs.SourceTitles(chunks); len(titles) == 0 {
+		text.WriteString("\n\nNo documentation retrieved.")
+	} else {
+		text.WriteString("\n\nRetrieved documentation:")
+		for _, title := range titles {
+			fmt.Fprintf(&text, "\n- %s", title)
+		}
+	}
+
+	return &openai.Completion{
+		Content:  text.String(),
+		Model:    echoModel,
+		Provider: echoModel,
+	}
+}
@@ -3,11 +3,17 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/breaker"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/docs"
 	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 )
 
 type ConversationMessage struct {
@@ -17,40 +23,111 @@ type ConversationMessage struct {
 }
 
 type GPTRequest struct {
-	Message            string               `json:"message"`
-	UserID             string               `json:"user_id"`
-	ChannelID          string               `json:"channel_id"`
-	MessageTS          string               `json:"message_ts"`
-	ThreadTS           string               `json:"thread_ts,omitempty"`
+	Message             string                `json:"message"`
+	UserID              string                `json:"user_id"`
+	ChannelID           string                `json:"channel_id"`
+	MessageTS           string                `json:"message_ts"`
+	ThreadTS            string                `json:"thread_ts,omitempty"`
 	ConversationHistory []ConversationMessage `json:"conversation_history,omitempty"`
-	CorrelationID      string               `json:"correlation_id"`
+	CorrelationID       string                `json:"correlation_id"`
+	IncludeUsage        bool                  `json:"include_usage,omitempty"`
 }
 
 type GPTResponse struct {
 	Response      string `json:"response"`
 	CorrelationID string `json:"correlation_id"`
-	Error         string `json:"error,omitempty"`
+	// SourceDocs lists the titles of the documentation the answer was grounded on
+	SourceDocs []string `json:"source_docs,omitempty"`
+	// Token usage is always reported so callers can attribute cost per interaction
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+	// Model is only reported when usage is requested, along with InputTokens and
+	// OutputTokens, which repeat PromptTokens and CompletionTokens under the names the
+	// Claude proxy uses
+	Model        string `json:"model,omitempty"`
+	InputTokens  int    `json:"input_tokens,omitempty"`
+	OutputTokens int    `json:"output_tokens,omitempty"`
 }
 
 type Handler struct {
-	openaiClient *openai.Client
-	logger       *slog.Logger
+	openaiClient      *openai.Client
+	docs              *docs.Index
+	maxContextChunks  int
+	includeUsage      bool
+	historyTimestamps string
+	echoMode          bool
+	upstream          *ratelimit.Semaphore
+	upstreamTimeout   time.Duration
+	logger            *slog.Logger
 }
 
-func NewHandler(openaiClient *openai.Client, logger *slog.Logger) *Handler {
+// NewHandler creates the chat handler. Up to maxContextChunks chunks of docIndex relevant
+// to each question are added to the system prompt; a nil docIndex disables retrieval.
+// When includeUsage is set, every response carries the model name and token usage;
+// otherwise only requests with include_usage do. historyTimestamps (off, relative or
+// absolute) controls whether history messages are prefixed with when they were said.
+func NewHandler(openaiClient *openai.Client, docIndex *docs.Index, maxContextChunks int, includeUsage bool, historyTimestamps string, logger *slog.Logger) *Handler {
 	return &Handler{
-		openaiClient: openaiClient,
-		logger:       logger,
+		openaiClient:      openaiClient,
+		docs:              docIndex,
+		maxContextChunks:  maxContextChunks,
+		includeUsage:      includeUsage,
+		historyTimestamps: historyTimestamps,
+		upstreamTimeout:   defaultUpstreamTimeout,
+		logger:            logger,
 	}
 }
 
+// setUsage fills in the token counts from completion, and the model and input/output
+// aliases too when detailed usage is requested
+func (r *GPTResponse) setUsage(completion *openai.Completion, detailed bool) {
+	r.PromptTokens = completion.Usage.PromptTokens
+	r.CompletionTokens = completion.Usage.CompletionTokens
+	r.TotalTokens = completion.Usage.TotalTokens
+	if detailed {
+		r.Model = completion.Model
+		r.InputTokens = r.PromptTokens
+		r.OutputTokens = r.CompletionTokens
+	}
+}
+
+// defaultUpstreamTimeout matches the UPSTREAM_TIMEOUT default
+const defaultUpstreamTimeout = 120 * time.Second
+
+// busyRetryAfter is the Retry-After, in seconds, sent when no upstream slot frees up
+const busyRetryAfter = "5"
+
+// SetUpstreamLimit bounds concurrent calls to the model provider with s
+func (h *Handler) SetUpstreamLimit(s *ratelimit.Semaphore) {
+	h.upstream = s
+}
+
+// SetUpstreamTimeout bounds how long each chat request may spend waiting for an upstream
+// slot and the model provider, including retries and the Anthropic fallback
+func (h *Handler) SetUpstreamTimeout(timeout time.Duration) {
+	h.upstreamTimeout = timeout
+}
+
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /health", h.handleHealthCheck)
-	mux.HandleFunc("POST /api/chat", h.handleChatCompletion)
+	mux.Handle("GET /health", metrics.Instrument("/health", http.HandlerFunc(h.handleHealthCheck)))
+	mux.Handle("POST /api/chat", metrics.Instrument("/api/chat", http.HandlerFunc(h.handleChatCompletion)))
+	mux.Handle("GET /metrics", metrics.Handler())
 }
 
 func (h *Handler) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{"status": "ok"}
+	circuit := h.openaiClient.CircuitStatus()
+	status := "ok"
+	if circuit.State != breaker.Closed {
+		status = "degraded"
+	}
+
+	response := map[string]interface{}{
+		"status":          status,
+		"rate_limit":      h.openaiClient.RateLimitQuota(),
+		"circuit_breaker": circuit,
+		"upstream":        h.upstream.Status(),
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
@@ -59,14 +136,23 @@ func (h *Handler) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 	var req GPTRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		h.logger.ErrorContext(r.Context(), "Failed to decode request", "error", err)
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errCodePayloadTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid request body")
 		return
 	}
 
+	// Callers that only send the header still get a body-level ID for logs and responses
+	if req.CorrelationID == "" {
+		req.CorrelationID = tracing.FromContext(r.Context())
+	}
+
 	if req.Message == "" {
 		h.logger.Error("Empty message in request", "correlation_id", req.CorrelationID)
-		http.Error(w, "Message is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeMissingField, "Message is required")
 		return
 	}
 
@@ -77,33 +163,69 @@ func (h *Handler) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 		"thread_ts", req.ThreadTS,
 		"has_history", len(req.ConversationHistory) > 0)
 
-	ctx, cancel := context.WithTimeout(r.Context(), 90*time.Second)
+	// Outbound provider calls carry the body-level ID, which is what callers log
+	ctx, cancel := context.WithTimeout(tracing.NewContext(r.Context(), req.CorrelationID), h.upstreamTimeout)
 	defer cancel()
 
 	// Use conversation history if available
-	response, err := h.openaiClient.ChatCompletionWithHistory(ctx, req.Message, req.ConversationHistory, req.CorrelationID)
+	// Malformed history would otherwise surface as an opaque provider 400
+	conversationHistory, dropped := sanitizeHistory(req.ConversationHistory)
+	if dropped > 0 {
+		h.logger.Warn("Dropped invalid conversation history messages",
+			"correlation_id", req.CorrelationID,
+			"dropped", dropped,
+			"kept", len(conversationHistory))
+	}
+
+	relevantChunks := h.docs.SearchRelevantChunks(req.Message, h.maxContextChunks)
+	if len(relevantChunks) > 0 {
+		h.logger.Info("Found relevant documentation chunks",
+			"correlation_id", req.CorrelationID,
+			"chunks", len(relevantChunks))
+	}
+
+	if err := h.upstream.Acquire(ctx); err != nil {
+		h.logger.Warn("No upstream slot available", "error", err, "correlation_id", req.CorrelationID)
+		w.Header().Set("Retry-After", busyRetryAfter)
+		writeError(w, http.StatusServiceUnavailable, errCodeUpstreamBusy, "Too many requests in progress, please try again shortly")
+		return
+	}
+	defer h.upstream.Release()
+
+	history := toOpenAIMessages(conversationHistory, h.historyTimestamps, time.Now())
+	var completion *openai.Completion
+	var err error
+	if h.echoMode {
+		completion = echoCompletion(req.Message, relevantChunks)
+	} else {
+		completion, err = h.openaiClient.ChatCompletionWithHistory(ctx, req.Message, history, docs.FormatContext(relevantChunks), req.CorrelationID)
+	}
 	if err != nil {
 		h.logger.Error("Failed to get chat completion", "error", err, "correlation_id", req.CorrelationID)
 
-		gptResp := GPTResponse{
-			CorrelationID: req.CorrelationID,
-			Error:         err.Error(),
+		// Distinguish model timeouts so callers can tell the user to simplify the question
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, errCodeUpstreamTimeout, "The model took too long to respond. Please try again.")
+			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(gptResp)
+		if errors.Is(err, breaker.ErrOpen) {
+			writeError(w, http.StatusServiceUnavailable, errCodeUpstreamUnavailable, "OpenAI is temporarily unavailable, please try again shortly")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errCodeUpstreamError, "Failed to process your request. Please try again.")
 		return
 	}
 
 	gptResp := GPTResponse{
-		Response:      response,
+		Response:      completion.Content,
 		CorrelationID: req.CorrelationID,
+		SourceDocs:    docs.SourceTitles(relevantChunks),
 	}
+	gptResp.setUsage(completion, req.IncludeUsage || h.includeUsage)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(gptResp)
 
-	h.logger.Info("Successfully processed chat completion", "correlation_id", req.CorrelationID)
+	h.logger.Info("Successfully processed chat completion", "correlation_id", req.CorrelationID, "provider", completion.Provider)
 }
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+)
+
+// newFakeOpenAI starts a Chat Completions stand-in that records each request and
+// answers "Go to Connections." as gpt-4o-2024-08-06
+func newFakeOpenAI(t *testing.T) (*httptest.Server, chan openai.ChatRequest) {
+	t.Helper()
+
+	requests := make(chan openai.ChatRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+
+		fmt.Fprint(w, `{"model":"gpt-4o-2024-08-06","choices":[{"index":0,"message":{"role":"assistant","content":"Go to Connections."},"finish_reason":"stop"}],"usage":{"prompt_tokens":120,"completion_tokens":30,"total_tokens":150}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// newTestHandler returns a handler whose OpenAI client talks to apiURL, with no docs
+func newTestHandler(apiURL string, includeUsage bool) *Handler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := openai.NewClient("sk-test", "gpt-4o", "You are Wavie.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 0, 0.7, 1000, logger)
+	client.SetAPIURL(apiURL)
+	client.SetMaxRetries(0)
+	return NewHandler(client, nil, 5, includeUsage, "", logger)
+}
+
+// postChat sends req to the chat endpoint and decodes the response
+func postChat(t *testing.T, h *Handler, req GPTRequest) (*httptest.ResponseRecorder, GPTResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleChatCompletion(rec, httptest.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body)))
+
+	var resp GPTResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestChatResponseIncludesUsageWhenRequested(t *testing.T) {
+	server, _ := newFakeOpenAI(t)
+	h := newTestHandler(server.URL, false)
+
+	rec, resp := postChat(t, h, GPTRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1", IncludeUsage: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+
+	if resp.Model != "gpt-4o-2024-08-06" {
+		t.Errorf("Model = %q, want the model OpenAI reported", resp.Model)
+	}
+	if resp.InputTokens != 120 || resp.OutputTokens != 30 {
+		t.Errorf("usage = %d in, %d out, want 120 and 30", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestChatResponseIncludesUsageWhenConfigured(t *testing.T) {
+	server, _ := newFakeOpenAI(t)
+	h := newTestHandler(server.URL, true)
+
+	_, resp := postChat(t, h, GPTRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+	if resp.Model == "" || resp.InputTokens == 0 {
+		t.Errorf("got model %q and %d input tokens, want usage with INCLUDE_USAGE set", resp.Model, resp.InputTokens)
+	}
+}
+
+func TestChatResponseOmitsUsageByDefault(t *testing.T) {
+	server, _ := newFakeOpenAI(t)
+	h := newTestHandler(server.URL, false)
+
+	rec, resp := postChat(t, h, GPTRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+	if resp.Model != "" || resp.InputTokens != 0 || resp.OutputTokens != 0 {
+		t.Errorf("got model %q and usage %d/%d, want them omitted", resp.Model, resp.InputTokens, resp.OutputTokens)
+	}
+	if resp.TotalTokens != 150 {
+		t.Errorf("TotalTokens = %d, want cost attribution always reported", resp.TotalTokens)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte(`"model"`)) {
+		t.Errorf("body %s has a model field", rec.Body)
+	}
+}
+
+func TestChatRequestIsBoundByTheUpstreamTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	h := newTestHandler(server.URL, false)
+	h.SetUpstreamTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	rec, _ := postChat(t, h, GPTRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+
+	var body errorResponse
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusGatewayTimeout || body.Error.Code != errCodeUpstreamTimeout {
+		t.Errorf("got %d with code %q, want 504 %s", rec.Code, body.Error.Code, errCodeUpstreamTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %v, want it cut off by the 50ms upstream timeout", elapsed)
+	}
+}
+
+func TestUpstreamErrorsDoNotLeakProviderDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"Incorrect API key provided: sk-test. See https://platform.openai.com/account/api-keys"}}`, http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+	h := newTestHandler(server.URL, false)
+
+	rec, _ := postChat(t, h, GPTRequest{Message: "How do I connect a wallet?", CorrelationID: "corr_1"})
+
+	var body errorResponse
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusInternalServerError || body.Error.Code != errCodeUpstreamError {
+		t.Errorf("got %d with code %q, want 500 %s", rec.Code, body.Error.Code, errCodeUpstreamError)
+	}
+	for _, leak := range []string{"sk-test", "openai.com", "401"} {
+		if strings.Contains(body.Error.Message, leak) {
+			t.Errorf("error message %q leaks %q from the provider", body.Error.Message, leak)
+		}
+	}
+}
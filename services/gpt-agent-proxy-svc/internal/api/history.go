@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+)
+
+// History timestamp modes for HISTORY_TIMESTAMPS
+const (
+	timestampsOff      = "off"
+	timestampsRelative = "relative"
+	timestampsAbsolute = "absolute"
+)
+
+// Limits applied to incoming conversation history
+const (
+	maxHistoryMessages     = 50
+	maxHistoryMessageChars = 8000
+)
+
+// sanitizeHistory drops empty messages, coerces roles other than user and assistant to
+// user, truncates oversized messages and keeps only the most recent maxHistoryMessages.
+// It returns the cleaned history and how many messages were dropped.
+func sanitizeHistory(history []ConversationMessage) ([]ConversationMessage, int) {
+	sanitized := make([]ConversationMessage, 0, len(history))
+	for _, msg := range history {
+		msg.Content = strings.TrimSpace(msg.Content)
+		if msg.Content == "" {
+			continue
+		}
+
+		// System prompts come from this service only, so callers can't smuggle one in
+		if msg.Role != "user" && msg.Role != "assistant" {
+			msg.Role = "user"
+		}
+
+		if runes := []rune(msg.Content); len(runes) > maxHistoryMessageChars {
+			msg.Content = string(runes[:maxHistoryMessageChars])
+		}
+
+		sanitized = append(sanitized, msg)
+	}
+
+	if len(sanitized) > maxHistoryMessages {
+		sanitized = sanitized[len(sanitized)-maxHistoryMessages:]
+	}
+
+	return sanitized, len(history) - len(sanitized)
+}
+
+// toOpenAIMessages converts request history into model messages, prefixing each with
+// when it was said if timestamps are enabled
+func toOpenAIMessages(history []ConversationMessage, timestamps string, now time.Time) []openai.Message {
+	messages := make([]openai.Message, 0, len(history))
+	for _, msg := range history {
+		content := msg.Content
+		if prefix := timestampPrefix(msg.Timestamp, timestamps, now); prefix != "" {
+			content = prefix + " " + content
+		}
+		messages = append(messages, openai.Message{
+			Role:    msg.Role,
+			Content: content,
+		})
+	}
+	return messages
+}
+
+// timestampPrefix renders a message time as "[5 minutes ago]" or "[2006-01-02 15:04 UTC]"
+func timestampPrefix(ts time.Time, mode string, now time.Time) string {
+	if ts.IsZero() {
+		return ""
+	}
+
+	switch mode {
+	case timestampsRelative:
+		return "[" + relativeTime(now.Sub(ts)) + "]"
+	case timestampsAbsolute:
+		return "[" + ts.UTC().Format("2006-01-02 15:04 UTC") + "]"
+	default:
+		return ""
+	}
+}
+
+func relativeTime(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	default:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
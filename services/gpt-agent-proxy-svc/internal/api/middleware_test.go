@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBodyRejectsOversizedRequests(t *testing.T) {
+	h := newTestHandler("http://127.0.0.1:0", false)
+	handler := LimitBody(http.HandlerFunc(h.handleChatCompletion), 64)
+
+	body := `{"text":"` + strings.Repeat("wallet ", 100) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d for a %d byte body over a 64 byte limit, want 413", rec.Code, len(body))
+	}
+}
@@ -0,0 +1,142 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is the position of the circuit
+type State string
+
+const (
+	// Closed lets every request through
+	Closed State = "closed"
+	// Open rejects requests until the cooldown has passed
+	Open State = "open"
+	// HalfOpen lets a single trial request through to test whether the upstream recovered
+	HalfOpen State = "half_open"
+)
+
+// ErrOpen is returned instead of calling the upstream while the circuit is open
+var ErrOpen = errors.New("upstream temporarily unavailable")
+
+// Breaker stops calling an upstream that keeps failing, so requests fail fast during an
+// outage instead of each waiting out its timeout. It opens after threshold consecutive
+// failures and rejects requests for cooldown. Then it half-opens: one trial request is
+// let through, and its result closes the circuit or opens it for another cooldown. A nil
+// Breaker lets everything through.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state    State
+	failures int
+	openedAt time.Time
+	// trialAt is when the half-open trial request was let through; zero when none is in
+	// flight. A trial that never reports back is replaced after a cooldown.
+	trialAt time.Time
+}
+
+// Status is a snapshot of a Breaker for health checks
+type Status struct {
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     Closed,
+	}
+}
+
+// Allow returns ErrOpen if a request must not be sent at now. Every allowed request
+// must be followed by Success or Failure.
+func (b *Breaker) Allow(now time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.state = HalfOpen
+		b.trialAt = now
+		return nil
+	case HalfOpen:
+		if !b.trialAt.IsZero() && now.Sub(b.trialAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.trialAt = now
+		return nil
+	}
+	return nil
+}
+
+// Success records that the upstream answered, closing the circuit
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+	b.trialAt = time.Time{}
+}
+
+// Failure records that the upstream failed at now, opening the circuit if the threshold
+// is reached or the half-open trial failed
+func (b *Breaker) Failure(now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	switch b.state {
+	case HalfOpen:
+		b.open(now)
+	case Closed:
+		if b.failures >= b.threshold {
+			b.open(now)
+		}
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.trialAt = time.Time{}
+}
+
+// Status returns the current state. A nil Breaker reports closed.
+func (b *Breaker) Status() Status {
+	if b == nil {
+		return Status{State: Closed}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
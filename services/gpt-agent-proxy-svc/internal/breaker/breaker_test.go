@@ -0,0 +1,90 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOpensAfterThresholdFailures(t *testing.T) {
+	b := NewBreaker(3, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		b.Failure(now)
+	}
+	if err := b.Allow(now); err != nil {
+		t.Fatalf("Allow after 2 of 3 failures: %v", err)
+	}
+
+	b.Failure(now)
+	if got := b.Status().State; got != Open {
+		t.Fatalf("state = %s after 3 failures, want open", got)
+	}
+	if err := b.Allow(now.Add(59 * time.Second)); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow during cooldown = %v, want ErrOpen", err)
+	}
+}
+
+func TestSuccessResetsFailureCount(t *testing.T) {
+	b := NewBreaker(3, time.Minute)
+	now := time.Now()
+
+	b.Failure(now)
+	b.Failure(now)
+	b.Success()
+	b.Failure(now)
+	b.Failure(now)
+
+	if status := b.Status(); status.State != Closed || status.ConsecutiveFailures != 2 {
+		t.Errorf("got %s with %d failures, want closed with 2 since the success", status.State, status.ConsecutiveFailures)
+	}
+}
+
+func TestHalfOpensForOneTrialAfterCooldown(t *testing.T) {
+	b := NewBreaker(1, time.Minute)
+	opened := time.Now()
+	b.Failure(opened)
+
+	trial := opened.Add(time.Minute)
+	if err := b.Allow(trial); err != nil {
+		t.Fatalf("Allow after cooldown: %v", err)
+	}
+	if got := b.Status().State; got != HalfOpen {
+		t.Fatalf("state = %s after cooldown, want half_open", got)
+	}
+	if err := b.Allow(trial.Add(time.Second)); !errors.Is(err, ErrOpen) {
+		t.Errorf("second Allow while the trial is in flight = %v, want ErrOpen", err)
+	}
+	if err := b.Allow(trial.Add(time.Minute)); err != nil {
+		t.Errorf("Allow once an unreported trial is a cooldown old: %v", err)
+	}
+}
+
+func TestTrialResultClosesOrReopens(t *testing.T) {
+	b := NewBreaker(1, time.Minute)
+	opened := time.Now()
+	b.Failure(opened)
+
+	trial := opened.Add(time.Minute)
+	b.Allow(trial)
+	b.Failure(trial)
+	if status := b.Status(); status.State != Open || !status.OpenedAt.Equal(trial) {
+		t.Fatalf("got %s opened at %v after a failed trial, want open again at %v", status.State, status.OpenedAt, trial)
+	}
+
+	b.Allow(trial.Add(time.Minute))
+	b.Success()
+	if status := b.Status(); status.State != Closed || status.ConsecutiveFailures != 0 || status.OpenedAt != nil {
+		t.Errorf("got %+v after a successful trial, want closed with no failures", status)
+	}
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	var b *Breaker
+	b.Failure(time.Now())
+
+	if err := b.Allow(time.Now()); err != nil || b.Status().State != Closed {
+		t.Errorf("nil breaker got %v in state %s, want it always closed", err, b.Status().State)
+	}
+}
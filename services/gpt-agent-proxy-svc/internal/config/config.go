@@ -1,9 +1,81 @@
 package config
 
+import "time"
+
 type Config struct {
 	LogLevel string `envconfig:"LOG_LEVEL" default:"info"`
 	Port     int    `envconfig:"PORT" default:"8081"`
 
-	OpenAIAPIKey string `envconfig:"OPENAI_API_KEY" required:"true"`
+	OpenAIAPIKey string `envconfig:"OPENAI_API_KEY"`
 	OpenAIModel  string `envconfig:"OPENAI_MODEL" default:"gpt-4"`
+
+	// EchoMode answers with the question and retrieved doc titles instead of calling
+	// OpenAI, for local development; OPENAI_API_KEY is only required without it
+	EchoMode bool `envconfig:"ECHO_MODE" default:"false"`
+
+	// Temperature controls answer randomness, from 0 to 2
+	Temperature float64 `envconfig:"OPENAI_TEMPERATURE" default:"0.7"`
+	// MaxTokens is the completion budget requested for every answer
+	MaxTokens int `envconfig:"OPENAI_MAX_TOKENS" default:"1000"`
+
+	// SystemPrompt sets the assistant's persona and tone
+	SystemPrompt string `envconfig:"OPENAI_SYSTEM_PROMPT" default:"You are Wavie, a helpful AI assistant for Bitwave. You provide clear, concise, and helpful responses to user questions. Keep your responses professional but friendly."`
+
+	// DocsZipPath points at a ZIP of Markdown docs used to ground answers; empty disables retrieval
+	DocsZipPath string `envconfig:"DOCS_ZIP_PATH"`
+	// MaxContextChunks is how many documentation chunks are added to each request
+	MaxContextChunks int `envconfig:"MAX_CONTEXT_CHUNKS" default:"5"`
+	// ChunkSize is the approximate size of a documentation chunk in characters
+	ChunkSize int `envconfig:"CHUNK_SIZE" default:"1000"`
+
+	// ModelContextWindows overrides the built-in context windows, e.g. "gpt-4:8192,my-model:32000"
+	ModelContextWindows string `envconfig:"MODEL_CONTEXT_WINDOWS"`
+
+	// IncludeUsage adds the model name and token usage to every chat response
+	IncludeUsage bool `envconfig:"INCLUDE_USAGE" default:"false"`
+
+	// TargetAnswerWords asks the model to keep answers under this many words; 0 disables the guidance
+	TargetAnswerWords int `envconfig:"TARGET_ANSWER_WORDS" default:"0"`
+
+	// HistoryTimestamps prefixes history messages with when they were said: off, relative or absolute
+	HistoryTimestamps string `envconfig:"HISTORY_TIMESTAMPS" default:"off"`
+
+	// RateLimitThreshold is the remaining-quota fraction below which requests are slowed down
+	RateLimitThreshold float64 `envconfig:"RATE_LIMIT_THRESHOLD" default:"0.1"`
+	// RateLimitMaxDelay caps how long a single request is held back when throttling
+	RateLimitMaxDelay time.Duration `envconfig:"RATE_LIMIT_MAX_DELAY" default:"5s"`
+
+	// MaxConcurrentUpstream caps chat requests calling the model provider at once; others
+	// wait up to UpstreamQueueTimeout for a slot, then get a 503. 0 disables the cap.
+	MaxConcurrentUpstream int           `envconfig:"MAX_CONCURRENT_UPSTREAM" default:"10"`
+	UpstreamQueueTimeout  time.Duration `envconfig:"UPSTREAM_QUEUE_TIMEOUT" default:"10s"`
+
+	// OpenAIMaxRetries is how many times a rate-limited, 5xx or network-failed request is retried
+	OpenAIMaxRetries int `envconfig:"OPENAI_MAX_RETRIES" default:"3"`
+
+	// UpstreamTimeout bounds each request to OpenAI or the Anthropic fallback, and each chat
+	// request as a whole
+	UpstreamTimeout time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"120s"`
+
+	// ServerReadTimeout and ServerWriteTimeout bound reading a request and writing its response
+	ServerReadTimeout  time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"120s"`
+	ServerWriteTimeout time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"120s"`
+
+	// MaxRequestBodyBytes is the largest request body accepted; larger ones get a 413
+	MaxRequestBodyBytes int64 `envconfig:"MAX_REQUEST_BODY_BYTES" default:"1048576"`
+
+	// CircuitBreakerThreshold consecutive OpenAI failures stop requests from being sent for
+	// CircuitBreakerCooldown, after which one trial request tests recovery. 0 disables it.
+	CircuitBreakerThreshold int           `envconfig:"CIRCUIT_BREAKER_THRESHOLD" default:"5"`
+	CircuitBreakerCooldown  time.Duration `envconfig:"CIRCUIT_BREAKER_COOLDOWN" default:"30s"`
+
+	// ToolsPath points at a JSON array of HTTP-backed tools the model may call, e.g. to look
+	// up invoice status; empty disables tool calling. ToolTimeout bounds each tool call.
+	ToolsPath   string        `envconfig:"TOOLS_PATH"`
+	ToolTimeout time.Duration `envconfig:"TOOL_TIMEOUT" default:"10s"`
+
+	// FallbackEnabled retries failed OpenAI requests against Anthropic when ANTHROPIC_API_KEY is set
+	FallbackEnabled bool   `envconfig:"FALLBACK_ENABLED" default:"false"`
+	AnthropicAPIKey string `envconfig:"ANTHROPIC_API_KEY"`
+	AnthropicModel  string `envconfig:"ANTHROPIC_MODEL" default:"claude-3-5-sonnet-20241022"`
 }
@@ -0,0 +1,333 @@
+package docs
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/retrieval"
+)
+
+// chunkOverlap is how many characters of whole words each chunk repeats from the end of
+// the previous one, so sentences at a boundary keep their context
+const chunkOverlap = 100
+
+// minKeywordLength is the shortest word indexed as a keyword
+const minKeywordLength = 4
+
+var (
+	frontmatterPattern     = regexp.MustCompile(`(?s)\A---\r?\n.*?\r?\n---\r?\n`)
+	htmlCommentPattern     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownCommentPattern = regexp.MustCompile(`(?m)^\[(?://|comment)\]: #.*$`)
+	imageLinePattern       = regexp.MustCompile(`(?m)^\s*(?:\[?!\[[^\]]*\]\([^)]*\)(?:\]\([^)]*\))?\s*)+$`)
+	blankRunPattern        = regexp.MustCompile(`\n\s*\n\s*\n`)
+	wordPattern            = regexp.MustCompile(`\b[a-z]{3,}\b`)
+)
+
+// stopWords are common English words that never count as keywords
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true,
+	"not": true, "you": true, "all": true, "can": true, "had": true,
+	"her": true, "was": true, "one": true, "our": true, "out": true,
+	"day": true, "get": true, "has": true, "him": true, "his": true,
+	"how": true, "its": true, "may": true, "new": true, "now": true,
+	"old": true, "see": true, "two": true, "way": true, "who": true,
+	"this": true, "that": true, "with": true, "have": true, "from": true,
+	"they": true, "know": true, "want": true, "been": true, "good": true,
+	"much": true, "some": true, "time": true, "very": true, "when": true,
+	"come": true, "here": true, "just": true, "like": true, "long": true,
+	"make": true, "many": true, "over": true, "such": true, "take": true,
+	"than": true, "them": true, "well": true, "were": true,
+}
+
+// Chunk is a searchable piece of a document
+type Chunk struct {
+	ID       string
+	DocPath  string
+	Title    string
+	Content  string
+	Keywords []string
+	Score    float64
+}
+
+// Index holds document chunks and a keyword index for BM25 search. An Index is built
+// once by LoadZip and only read afterwards, so it is safe for concurrent searches. The
+// zero value is an empty index that matches nothing.
+type Index struct {
+	chunks   []Chunk
+	keywords map[string][]int
+
+	// Per-chunk keyword counts and lengths (in keywords) for BM25 scoring
+	termFreqs      []map[string]int
+	chunkLengths   []int
+	avgChunkLength float64
+}
+
+// LoadZip builds an index from the Markdown and text files in a ZIP archive, splitting
+// each document into chunks of roughly chunkSize characters
+func LoadZip(zipPath string, chunkSize int, logger *slog.Logger) (*Index, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP file: %w", err)
+	}
+	defer reader.Close()
+
+	idx := &Index{}
+	documents := 0
+	for _, file := range reader.File {
+		switch strings.ToLower(path.Ext(file.Name)) {
+		case ".md", ".txt":
+		default:
+			continue
+		}
+
+		raw, err := readZipFile(file)
+		if err != nil {
+			logger.Warn("Failed to read document", "file", file.Name, "error", err)
+			continue
+		}
+
+		idx.addDocument(file.Name, string(raw), chunkSize)
+		documents++
+	}
+
+	idx.buildKeywordIndex()
+
+	logger.Info("Loaded documents", "path", zipPath, "documents", documents, "chunks", len(idx.chunks))
+	return idx, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// Len returns the number of indexed chunks
+func (idx *Index) Len() int {
+	return len(idx.chunks)
+}
+
+// addDocument cleans a document and appends its chunks, one or more per Markdown section
+func (idx *Index) addDocument(name, content string, chunkSize int) {
+	title := extractTitle(content)
+	if title == "" {
+		title = fileTitle(name)
+	}
+
+	for i, section := range retrieval.SplitSections(cleanContent(content)) {
+		if len(section) <= chunkSize {
+			idx.chunks = append(idx.chunks, Chunk{
+				ID:       fmt.Sprintf("%s_chunk_%d", name, i),
+				DocPath:  name,
+				Title:    title,
+				Content:  section,
+				Keywords: extractKeywords(section),
+			})
+			continue
+		}
+
+		for j, subChunk := range splitIntoChunks(section, chunkSize) {
+			idx.chunks = append(idx.chunks, Chunk{
+				ID:       fmt.Sprintf("%s_chunk_%d_%d", name, i, j),
+				DocPath:  name,
+				Title:    title,
+				Content:  subChunk,
+				Keywords: extractKeywords(subChunk),
+			})
+		}
+	}
+}
+
+// extractTitle returns the first top-level Markdown heading, or "" if there is none
+func extractTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimPrefix(line, "# ")
+		}
+	}
+	return ""
+}
+
+// fileTitle derives a title from a file name, e.g. "guides/cost-basis.md" -> "cost-basis"
+func fileTitle(name string) string {
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// cleanContent strips frontmatter, comments and image-only lines, which only add noise
+// to the model's context
+func cleanContent(content string) string {
+	content = frontmatterPattern.ReplaceAllString(content, "")
+	content = htmlCommentPattern.ReplaceAllString(content, "")
+	content = markdownCommentPattern.ReplaceAllString(content, "")
+	content = imageLinePattern.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+
+	content = blankRunPattern.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content)
+}
+
+// splitIntoChunks packs words into chunks of roughly chunkSize characters, keeping each
+// fenced code block whole; see retrieval.PackUnits
+func splitIntoChunks(text string, chunkSize int) []string {
+	if len(text) <= chunkSize {
+		return []string{text}
+	}
+	return retrieval.PackUnits(retrieval.SplitCodeFences(text), chunkSize, chunkOverlap)
+}
+
+// keywordOccurrences returns every keyword occurrence in text, in order and with repeats
+func keywordOccurrences(text string) []string {
+	occurrences := make([]string, 0)
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		if !stopWords[word] && len(word) >= minKeywordLength {
+			occurrences = append(occurrences, word)
+		}
+	}
+	return occurrences
+}
+
+// extractKeywords returns the distinct keywords in text in order of first appearance
+func extractKeywords(text string) []string {
+	keywords := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, keyword := range keywordOccurrences(text) {
+		if !seen[keyword] {
+			keywords = append(keywords, keyword)
+			seen[keyword] = true
+		}
+	}
+
+	return keywords
+}
+
+// buildKeywordIndex maps each keyword stem to the chunks containing it and records the
+// term frequencies and chunk lengths BM25 needs
+func (idx *Index) buildKeywordIndex() {
+	idx.keywords = make(map[string][]int)
+	idx.termFreqs = make([]map[string]int, len(idx.chunks))
+	idx.chunkLengths = make([]int, len(idx.chunks))
+	totalLength := 0
+
+	for i, chunk := range idx.chunks {
+		// Index on stems so "invoices" finds "invoice"; variants of one stem in the same
+		// chunk are indexed once
+		for _, keyword := range chunk.Keywords {
+			key := retrieval.Stem(keyword)
+			if indices := idx.keywords[key]; len(indices) > 0 && indices[len(indices)-1] == i {
+				continue
+			}
+			idx.keywords[key] = append(idx.keywords[key], i)
+		}
+
+		freqs := make(map[string]int, len(chunk.Keywords))
+		for _, keyword := range keywordOccurrences(chunk.Content) {
+			freqs[retrieval.Stem(keyword)]++
+			idx.chunkLengths[i]++
+		}
+		idx.termFreqs[i] = freqs
+		totalLength += idx.chunkLengths[i]
+	}
+
+	idx.avgChunkLength = 0
+	if len(idx.chunks) > 0 {
+		idx.avgChunkLength = float64(totalLength) / float64(len(idx.chunks))
+	}
+}
+
+// SearchRelevantChunks returns up to maxChunks chunks ranked by BM25 score against the
+// query's keywords. A nil or empty index returns nothing.
+func (idx *Index) SearchRelevantChunks(query string, maxChunks int) []Chunk {
+	if idx == nil || len(idx.chunks) == 0 || maxChunks <= 0 {
+		return nil
+	}
+
+	chunkScores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, word := range extractKeywords(query) {
+		key := retrieval.Stem(word)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		chunkIndices, exists := idx.keywords[key]
+		if !exists {
+			continue
+		}
+		idf := retrieval.IDF(len(idx.chunks), len(chunkIndices))
+		for _, chunkIndex := range chunkIndices {
+			chunkScores[chunkIndex] += idx.bm25(chunkIndex, key, idf)
+		}
+	}
+
+	// Equal scores keep index order so results don't vary between identical searches
+	ranked := make([]int, 0, len(chunkScores))
+	for chunkIndex := range chunkScores {
+		ranked = append(ranked, chunkIndex)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if chunkScores[a] != chunkScores[b] {
+			return chunkScores[a] > chunkScores[b]
+		}
+		return a < b
+	})
+
+	if len(ranked) > maxChunks {
+		ranked = ranked[:maxChunks]
+	}
+	results := make([]Chunk, len(ranked))
+	for i, chunkIndex := range ranked {
+		results[i] = idx.chunks[chunkIndex]
+		results[i].Score = chunkScores[chunkIndex]
+	}
+	return results
+}
+
+// bm25 scores one query term against one chunk
+func (idx *Index) bm25(chunkIndex int, term string, idf float64) float64 {
+	return retrieval.BM25(idx.termFreqs[chunkIndex][term], idx.chunkLengths[chunkIndex], idx.avgChunkLength, idf)
+}
+
+// FormatContext renders chunks as a documentation section for the system prompt, or
+// returns "" when there are none
+func FormatContext(chunks []Chunk) string {
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	var context strings.Builder
+	context.WriteString("RELEVANT BITWAVE DOCUMENTATION:\n")
+	for i, chunk := range chunks {
+		fmt.Fprintf(&context, "\n--- Document %d: %s ---\n%s\n", i+1, chunk.Title, chunk.Content)
+	}
+	context.WriteString("\nUse the above documentation to inform your responses when relevant. If the documentation doesn't contain the answer, say so clearly.")
+	return context.String()
+}
+
+// SourceTitles returns the distinct titles of the documents chunks came from, in rank order
+func SourceTitles(chunks []Chunk) []string {
+	titles := make([]string, 0, len(chunks))
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		if !seen[chunk.Title] {
+			titles = append(titles, chunk.Title)
+			seen[chunk.Title] = true
+		}
+	}
+	return titles
+}
@@ -0,0 +1,144 @@
+package docs
+
+import (
+	"archive/zip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes files to a ZIP archive in a temporary directory and returns its path
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	zipPath := filepath.Join(t.TempDir(), "docs.zip")
+	out, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("create zip: %v", err)
+	}
+	writer := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	out.Close()
+	return zipPath
+}
+
+func loadTestIndex(t *testing.T, chunkSize int, files map[string]string) *Index {
+	t.Helper()
+
+	idx, err := LoadZip(writeZip(t, files), chunkSize, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("LoadZip: %v", err)
+	}
+	return idx
+}
+
+func TestLoadZipIndexesOnlyTextDocuments(t *testing.T) {
+	idx := loadTestIndex(t, 1000, map[string]string{
+		"guides/wallets.md": "---\ntags: [setup]\n---\n# Wallets\nConnect a wallet from Connections.",
+		"notes.txt":         "Plain text notes about invoices.",
+		"logo.png":          "not a document",
+	})
+
+	if idx.Len() != 2 {
+		t.Fatalf("indexed %d chunks, want one per text document", idx.Len())
+	}
+	for _, chunk := range idx.chunks {
+		if strings.Contains(chunk.Content, "tags:") {
+			t.Errorf("chunk %s kept the frontmatter: %q", chunk.ID, chunk.Content)
+		}
+	}
+	if titles := SourceTitles(idx.SearchRelevantChunks("invoices", 5)); len(titles) != 1 || titles[0] != "notes" {
+		t.Errorf("untitled document got titles %v, want its file name", titles)
+	}
+}
+
+func TestSplitIntoChunksKeepsCodeBlocksWhole(t *testing.T) {
+	block := "```sh\n# install\nmake install\n```"
+	text := strings.Repeat("word ", 30) + "\n" + block + "\n" + strings.Repeat("word ", 30)
+
+	chunks := splitIntoChunks(text, 80)
+	found := false
+	for _, chunk := range chunks {
+		if strings.Contains(chunk, "```") {
+			if !strings.Contains(chunk, block) {
+				t.Errorf("chunk %q splits the code block", chunk)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no chunk holds the code block: %q", chunks)
+	}
+}
+
+func TestSearchRanksByBM25AndMatchesStems(t *testing.T) {
+	idx := loadTestIndex(t, 1000, map[string]string{
+		"reconcile.md": "# Reconcile\nReconcile accounts monthly. Reconciliation keeps reconciled balances right.",
+		"payroll.md":   "# Payroll\nApprove payslips and reconcile once.",
+		"wallets.md":   "# Wallets\nConnect a wallet.",
+	})
+
+	results := idx.SearchRelevantChunks("reconciling", 5)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want the two documents mentioning reconcile", len(results))
+	}
+	if results[0].DocPath != "reconcile.md" || results[0].Score <= results[1].Score {
+		t.Errorf("got %s (%.2f) first, want reconcile.md ranked above payroll.md", results[0].DocPath, results[0].Score)
+	}
+	if got := idx.SearchRelevantChunks("reconciling", 1); len(got) != 1 {
+		t.Errorf("maxChunks 1 returned %d results", len(got))
+	}
+}
+
+func TestSearchOrdersEqualScoresByIndex(t *testing.T) {
+	files := make(map[string]string)
+	for _, name := range []string{"a.md", "b.md", "c.md", "d.md", "e.md"} {
+		files[name] = "# Ledger\nExport the ledger."
+	}
+	idx := loadTestIndex(t, 1000, files)
+
+	want := idx.SearchRelevantChunks("ledger", 5)
+	for i := 0; i < 20; i++ {
+		got := idx.SearchRelevantChunks("ledger", 5)
+		for j := range got {
+			if got[j].ID != want[j].ID {
+				t.Fatalf("search %d returned %s at %d, want %s: equal scores must keep a stable order", i, got[j].ID, j, want[j].ID)
+			}
+		}
+	}
+
+	position := make(map[string]int, idx.Len())
+	for i, chunk := range idx.chunks {
+		position[chunk.ID] = i
+	}
+	for j := 1; j < len(want); j++ {
+		if position[want[j-1].ID] > position[want[j].ID] {
+			t.Errorf("%s ranked before %s, want equal scores in index order", want[j-1].ID, want[j].ID)
+		}
+	}
+}
+
+func TestEmptyIndexMatchesNothing(t *testing.T) {
+	var idx *Index
+	if got := idx.SearchRelevantChunks("anything", 5); got != nil {
+		t.Errorf("nil index returned %v", got)
+	}
+	if got := (&Index{}).SearchRelevantChunks("anything", 5); got != nil {
+		t.Errorf("zero index returned %v", got)
+	}
+	if FormatContext(nil) != "" {
+		t.Error("FormatContext of no chunks is not empty")
+	}
+}
@@ -4,37 +4,114 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/breaker"
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 )
 
+// defaultAPIURL is the Chat Completions endpoint requests go to unless SetAPIURL is called
+const defaultAPIURL = "https://api.openai.com/v1/chat/completions"
+
 type Client struct {
-	apiKey string
-	model  string
-	logger *slog.Logger
-	client *http.Client
+	apiKey       string
+	apiURL       string
+	model        string
+	tokenGuard   *tokenlimit.Guard
+	throttle     *ratelimit.Throttle
+	systemPrompt string
+	logger       *slog.Logger
+	client       *http.Client
+	fallback     Fallback
+	breaker      *breaker.Breaker
+	maxRetries   int
+	temperature  float64
+	maxTokens    int
+	tools        []Tool
+	toolExecutor ToolExecutor
+}
+
+// Fallback is a secondary provider that answers the same messages when OpenAI fails
+type Fallback interface {
+	Name() string
+	Complete(ctx context.Context, messages []Message, correlationID string) (*Completion, error)
 }
 
-func NewClient(apiKey, model string, logger *slog.Logger) *Client {
+// NewClient creates an OpenAI client that sends systemPrompt as the first message of
+// every request. A positive targetAnswerWords asks the model up front to keep answers
+// around that length. maxTokens is the completion budget requested for every answer.
+func NewClient(apiKey, model, systemPrompt string, tokenGuard *tokenlimit.Guard, throttle *ratelimit.Throttle, targetAnswerWords int, temperature float64, maxTokens int, logger *slog.Logger) *Client {
+	if targetAnswerWords > 0 {
+		systemPrompt += fmt.Sprintf(" Aim for under %d words unless the question needs more detail.", targetAnswerWords)
+	}
+
 	return &Client{
-		apiKey: apiKey,
-		model:  model,
-		logger: logger,
+		apiKey:       apiKey,
+		apiURL:       defaultAPIURL,
+		model:        model,
+		tokenGuard:   tokenGuard,
+		throttle:     throttle,
+		systemPrompt: systemPrompt,
+		logger:       logger,
 		client: &http.Client{
 			Timeout: 120 * time.Second,
 		},
+		maxRetries:  defaultMaxRetries,
+		temperature: temperature,
+		maxTokens:   maxTokens,
 	}
 }
 
+// SetAPIURL sends requests to url instead of OpenAI, e.g. a gateway or a test server
+func (c *Client) SetAPIURL(url string) {
+	c.apiURL = url
+}
+
+// SetFallback sends requests to fallback when OpenAI returns an error
+func (c *Client) SetFallback(fallback Fallback) {
+	c.fallback = fallback
+}
+
+// SetBreaker stops requests from reaching OpenAI while b is open; they fail with
+// breaker.ErrOpen, or go straight to the fallback if one is set
+func (c *Client) SetBreaker(b *breaker.Breaker) {
+	c.breaker = b
+}
+
+// CircuitStatus returns the state of the OpenAI circuit breaker, closed if there is none
+func (c *Client) CircuitStatus() breaker.Status {
+	return c.breaker.Status()
+}
+
+// SetMaxRetries sets how many times a rate-limited or failed request is retried
+func (c *Client) SetMaxRetries(maxRetries int) {
+	c.maxRetries = maxRetries
+}
+
+// SetTimeout sets how long each request to OpenAI may take, including reading the answer
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// RateLimitQuota returns the remaining quota last reported by OpenAI
+func (c *Client) RateLimitQuota() ratelimit.Quota {
+	return c.throttle.Quota()
+}
+
 // ChatCompletion sends a single message to OpenAI without conversation history
-func (c *Client) ChatCompletion(ctx context.Context, userMessage, correlationID string) (string, error) {
+func (c *Client) ChatCompletion(ctx context.Context, userMessage, correlationID string) (*Completion, error) {
 	messages := []Message{
 		{
 			Role:    "system",
-			Content: "You are Wavie, a helpful AI assistant for Bitwave. You provide clear, concise, and helpful responses to user questions. Keep your responses professional but friendly.",
+			Content: c.systemPrompt,
 		},
 		{
 			Role:    "user",
@@ -42,21 +119,28 @@ func (c *Client) ChatCompletion(ctx context.Context, userMessage, correlationID
 		},
 	}
 
-	return c.sendChatRequest(ctx, messages, correlationID)
+	return c.complete(ctx, messages, correlationID)
 }
 
-// ChatCompletionWithHistory sends a message to OpenAI with conversation history
-func (c *Client) ChatCompletionWithHistory(ctx context.Context, userMessage string, history []Message, correlationID string) (string, error) {
+// ChatCompletionWithHistory sends a message to OpenAI with conversation history. A
+// non-empty knowledge, such as retrieved documentation, is appended to the system prompt.
+func (c *Client) ChatCompletionWithHistory(ctx context.Context, userMessage string, history []Message, knowledge, correlationID string) (*Completion, error) {
+	systemPrompt := c.systemPrompt
+	if knowledge != "" {
+		systemPrompt += "\n\n" + knowledge
+	}
+
 	// Start with system message
 	messages := []Message{
 		{
 			Role:    "system",
-			Content: "You are Wavie, a helpful AI assistant for Bitwave. You provide clear, concise, and helpful responses to user questions. Keep your responses professional but friendly.",
+			Content: systemPrompt,
 		},
 	}
 
 	// Add conversation history if available
 	if len(history) > 0 {
+		history = c.fitHistory(messages[0], history, userMessage, correlationID)
 		c.logger.Info("Adding conversation history", "history_length", len(history))
 		messages = append(messages, history...)
 	}
@@ -67,67 +151,219 @@ func (c *Client) ChatCompletionWithHistory(ctx context.Context, userMessage stri
 		Content: userMessage,
 	})
 
-	return c.sendChatRequest(ctx, messages, correlationID)
+	return c.complete(ctx, messages, correlationID)
 }
 
-// sendChatRequest handles the actual API call to OpenAI
-func (c *Client) sendChatRequest(ctx context.Context, messages []Message, correlationID string) (string, error) {
+// complete sends messages to OpenAI, retrying them against the fallback provider if
+// one is configured and OpenAI fails for any reason other than the caller giving up.
+// The fallback gets the original messages without any tool calls or results.
+func (c *Client) complete(ctx context.Context, messages []Message, correlationID string) (*Completion, error) {
+	completion, err := c.converse(ctx, messages, correlationID)
+	if err == nil {
+		completion.Provider = "openai"
+		c.logger.Info("Chat completion served", "correlation_id", correlationID, "provider", completion.Provider)
+		return completion, nil
+	}
+	if c.fallback == nil || ctx.Err() != nil {
+		return nil, err
+	}
+
+	c.logger.Warn("OpenAI request failed, falling back",
+		"correlation_id", correlationID,
+		"fallback", c.fallback.Name(),
+		"error", err)
+
+	completion, fallbackErr := c.fallback.Complete(ctx, messages, correlationID)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%w (fallback %s: %v)", err, c.fallback.Name(), fallbackErr)
+	}
+
+	completion.Provider = c.fallback.Name()
+	c.logger.Info("Chat completion served", "correlation_id", correlationID, "provider", completion.Provider)
+	return completion, nil
+}
+
+// fitHistory drops the oldest history messages until the system prompt, history, user
+// message and requested output fit within the model's context window
+func (c *Client) fitHistory(system Message, history []Message, userMessage, correlationID string) []Message {
+	budget := c.tokenGuard.InputBudget(c.model, c.maxTokens)
+	used := tokenlimit.EstimateMessageTokens(system.Role, system.Content) +
+		tokenlimit.EstimateMessageTokens("user", userMessage)
+
+	historyTokens := 0
+	for _, msg := range history {
+		historyTokens += tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+	}
+
+	dropped := 0
+	for len(history) > 0 && used+historyTokens > budget {
+		historyTokens -= tokenlimit.EstimateMessageTokens(history[0].Role, history[0].Content)
+		history = history[1:]
+		dropped++
+	}
+
+	if dropped > 0 {
+		c.logger.Warn("Trimmed conversation history to fit context window",
+			"correlation_id", correlationID,
+			"model", c.model,
+			"dropped_messages", dropped,
+			"input_budget", budget)
+	}
+
+	return history
+}
+
+// sendChatRequest handles the actual API call to OpenAI. A non-empty toolChoice offers
+// the client's tools to the model.
+func (c *Client) sendChatRequest(ctx context.Context, messages []Message, toolChoice, correlationID string) (*Completion, error) {
+
+	inputTokens := 0
+	for _, msg := range messages {
+		inputTokens += tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+	}
+	if budget := c.tokenGuard.InputBudget(c.model, c.maxTokens); inputTokens > budget {
+		return nil, fmt.Errorf("request of ~%d tokens exceeds the %d token input budget for model %s", inputTokens, budget, c.model)
+	}
 
 	request := ChatRequest{
 		Model:       c.model,
 		Messages:    messages,
-		Temperature: 0.7,
-		MaxTokens:   1000,
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+	}
+	if toolChoice != "" {
+		request.Tools = c.tools
+		request.ToolChoice = toolChoice
 	}
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	c.logger.Info("Sending request to OpenAI", "correlation_id", correlationID, "model", c.model)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	var body []byte
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		var requested time.Duration
+		retry, requested, body, err = c.tryChatRequest(ctx, jsonData, correlationID)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= c.maxRetries {
+			return nil, err
+		}
+
+		delay := retryDelay(attempt, requested)
+		// A retry that cannot finish before the caller's deadline only delays the error
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return nil, err
+		}
+
+		c.logger.Warn("OpenAI request failed, retrying",
+			"correlation_id", correlationID,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("gave up retrying request: %w", err)
+		}
+	}
+
+	var chatResp ChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	reply := chatResp.Choices[0].Message
+	c.logger.Info("Received response from OpenAI",
+		"correlation_id", correlationID,
+		"tokens_used", chatResp.Usage.TotalTokens,
+		"response_length", len(reply.Content),
+		"tool_calls", len(reply.ToolCalls))
+
+	return &Completion{
+		Content:   reply.Content,
+		Model:     chatResp.Model,
+		Usage:     chatResp.Usage,
+		ToolCalls: reply.ToolCalls,
+	}, nil
+}
+
+// tryChatRequest makes a single chat completion attempt and returns the response body.
+// It reports whether a failure is worth retrying and any delay OpenAI asked for.
+func (c *Client) tryChatRequest(ctx context.Context, jsonData []byte, correlationID string) (bool, time.Duration, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL, bytes.NewReader(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return false, 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	tracing.SetHeader(req)
+
+	// Slow down before hitting a hard 429 when quota is running low
+	if delay := c.throttle.Delay(time.Now()); delay > 0 {
+		c.logger.Warn("Rate limit quota low, throttling request", "correlation_id", correlationID, "delay", delay)
+		if err := c.throttle.Wait(ctx); err != nil {
+			return false, 0, nil, fmt.Errorf("throttled request cancelled: %w", err)
+		}
+	}
+
+	if err := c.breaker.Allow(time.Now()); err != nil {
+		return false, 0, nil, fmt.Errorf("OpenAI circuit open: %w", err)
+	}
 
 	resp, err := c.client.Do(req)
+	metrics.ObserveUpstream("openai", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		c.recordFailure(ctx)
+		// Network failures are retried unless the caller's context is what ended them
+		return ctx.Err() == nil, 0, nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	c.throttle.Update(resp.Header, time.Now())
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		c.recordFailure(ctx)
+		return ctx.Err() == nil, 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Other 4xx responses are problems with the request, not with OpenAI
+	if isRetryableStatus(resp.StatusCode) {
+		c.breaker.Failure(time.Now())
+	} else {
+		c.breaker.Success()
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		retry := isRetryableStatus(resp.StatusCode)
 		var errorResp ErrorResponse
 		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return "", fmt.Errorf("OpenAI API error: %d - %s", resp.StatusCode, string(body))
+			return retry, retryAfter(resp), nil, fmt.Errorf("OpenAI API error: %d - %s", resp.StatusCode, string(body))
+		}
+		// Quota exhaustion comes back as a 429 too, but will not clear by waiting
+		if errorResp.Error.Code == "insufficient_quota" {
+			retry = false
 		}
-		return "", fmt.Errorf("OpenAI API error: %s", errorResp.Error.Message)
+		return retry, retryAfter(resp), nil, fmt.Errorf("OpenAI API error: %s", errorResp.Error.Message)
 	}
 
-	var chatResp ChatResponse
-	if err := json.Unmarshal(body, &chatResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+	return false, 0, body, nil
+}
 
-	if len(chatResp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+// recordFailure counts a failed attempt against the circuit breaker unless the caller
+// cancelled it
+func (c *Client) recordFailure(ctx context.Context) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
 	}
-
-	response := chatResp.Choices[0].Message.Content
-	c.logger.Info("Received response from OpenAI",
-		"correlation_id", correlationID,
-		"tokens_used", chatResp.Usage.TotalTokens,
-		"response_length", len(response))
-
-	return response, nil
+	c.breaker.Failure(time.Now())
 }
@@ -0,0 +1,163 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+)
+
+// newTestClient returns a client for model with the default context windows and
+// settings, which tests adjust through its fields
+func newTestClient(model string) *Client {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewClient("sk-test", model, "You are Wavie.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 0, 0.7, 1000, logger)
+}
+
+// longHistory returns n alternating turns of roughly 500 tokens each
+func longHistory(n int) []Message {
+	history := make([]Message, n)
+	for i := range history {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history[i] = Message{Role: role, Content: strings.Repeat("word ", 400)}
+	}
+	return history
+}
+
+func TestFitHistorySmallWindowTrimsOldestTurns(t *testing.T) {
+	client := newTestClient("gpt-4")
+	history := longHistory(30)
+
+	fitted := client.fitHistory(Message{Role: "system", Content: client.systemPrompt}, history, "How do I reconcile?", "test")
+
+	if len(fitted) == 0 || len(fitted) >= len(history) {
+		t.Fatalf("kept %d of %d messages, want some but not all", len(fitted), len(history))
+	}
+	if &fitted[len(fitted)-1] != &history[len(history)-1] {
+		t.Error("the most recent turn was dropped")
+	}
+
+	used := tokenlimit.EstimateMessageTokens("system", client.systemPrompt) + tokenlimit.EstimateMessageTokens("user", "How do I reconcile?")
+	for _, msg := range fitted {
+		used += tokenlimit.EstimateMessageTokens(msg.Role, msg.Content)
+	}
+	if budget := client.tokenGuard.InputBudget("gpt-4", client.maxTokens); used > budget {
+		t.Errorf("fitted request uses ~%d tokens, over the %d token budget", used, budget)
+	}
+}
+
+func TestFitHistoryLargeWindowKeepsEverything(t *testing.T) {
+	client := newTestClient("gpt-4-turbo")
+	history := longHistory(30)
+
+	fitted := client.fitHistory(Message{Role: "system", Content: client.systemPrompt}, history, "How do I reconcile?", "test")
+
+	if len(fitted) != len(history) {
+		t.Errorf("kept %d of %d messages, want all of them in a 128k window", len(fitted), len(history))
+	}
+}
+
+func TestNewClientInjectsAnswerLengthGuidance(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	c := NewClient("sk-test", "gpt-4o", "You are Wavie.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 200, 0.7, 1000, logger)
+	want := "You are Wavie. Aim for under 200 words unless the question needs more detail."
+	if c.systemPrompt != want {
+		t.Errorf("system prompt = %q, want %q", c.systemPrompt, want)
+	}
+}
+
+func TestNewClientZeroTargetAddsNoGuidance(t *testing.T) {
+	if c := newTestClient("gpt-4o"); c.systemPrompt != "You are Wavie." {
+		t.Errorf("system prompt = %q, want it unchanged with TARGET_ANSWER_WORDS=0", c.systemPrompt)
+	}
+}
+
+// newFakeOpenAI starts a Chat Completions stand-in that records each request
+func newFakeOpenAI(t *testing.T) (*httptest.Server, chan ChatRequest) {
+	t.Helper()
+
+	requests := make(chan ChatRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+
+		fmt.Fprint(w, `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Go to Connections."},"finish_reason":"stop"}],"usage":{"prompt_tokens":120,"completion_tokens":30,"total_tokens":150}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestCustomSystemPromptIsSentFirst(t *testing.T) {
+	server, requests := newFakeOpenAI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := NewClient("sk-test", "gpt-4o", "You are Ledger, a terse accounting assistant.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 0, 0.7, 1000, logger)
+	c.SetAPIURL(server.URL)
+	c.SetMaxRetries(0)
+
+	if _, err := c.ChatCompletion(context.Background(), "How do I connect a wallet?", "corr_1"); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	history := []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello!"}}
+	if _, err := c.ChatCompletionWithHistory(context.Background(), "How do I connect a wallet?", history, "", "corr_2"); err != nil {
+		t.Fatalf("ChatCompletionWithHistory: %v", err)
+	}
+
+	for _, call := range []string{"ChatCompletion", "ChatCompletionWithHistory"} {
+		req := <-requests
+		if len(req.Messages) == 0 || req.Messages[0].Role != "system" || req.Messages[0].Content != "You are Ledger, a terse accounting assistant." {
+			t.Errorf("%s sent %+v, want the custom system prompt first", call, req.Messages)
+		}
+	}
+}
+
+func TestRequestCarriesConfiguredSampling(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		maxTokens   int
+		wantTemp    string
+	}{
+		{0.2, 2500, "0.2"},
+		{0, 300, "0"}, // zero is a valid temperature and must still be sent
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("temperature %g", tt.temperature), func(t *testing.T) {
+			bodies := make(chan map[string]json.RawMessage, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]json.RawMessage
+				json.NewDecoder(r.Body).Decode(&body)
+				bodies <- body
+				fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Go to Connections."}}]}`)
+			}))
+			t.Cleanup(server.Close)
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			c := NewClient("sk-test", "gpt-4o", "You are Wavie.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 0, tt.temperature, tt.maxTokens, logger)
+			c.SetAPIURL(server.URL)
+			if _, err := c.ChatCompletion(context.Background(), "How do I connect a wallet?", "corr_1"); err != nil {
+				t.Fatalf("ChatCompletion: %v", err)
+			}
+
+			body := <-bodies
+			if got := string(body["temperature"]); got != tt.wantTemp {
+				t.Errorf("temperature = %s, want %s", got, tt.wantTemp)
+			}
+			if got, want := string(body["max_tokens"]), fmt.Sprint(tt.maxTokens); got != want {
+				t.Errorf("max_tokens = %s, want %s", got, want)
+			}
+		})
+	}
+}
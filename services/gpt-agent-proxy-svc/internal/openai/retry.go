@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Requests that are rate limited, fail with a 5xx or fail in transit are retried up to
+// maxRetries times, waiting as long as OpenAI's retry headers ask or else backing off
+// exponentially from baseRetryDelay
+const (
+	defaultMaxRetries = 3
+	baseRetryDelay    = 1 * time.Second
+	maxRetryDelay     = 20 * time.Second
+)
+
+// isRetryableStatus reports whether an HTTP status is worth retrying
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter reads the delay OpenAI asked for, preferring the millisecond-precision
+// retry-after-ms header over Retry-After in seconds, returning 0 if neither is present
+func retryAfter(resp *http.Response) time.Duration {
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// retryDelay returns how long to wait before retry number attempt (from 0)
+func retryDelay(attempt int, requested time.Duration) time.Duration {
+	if requested > 0 {
+		return requested
+	}
+	delay := baseRetryDelay << attempt
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// sleepContext waits for d, returning early with the context's error if it is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
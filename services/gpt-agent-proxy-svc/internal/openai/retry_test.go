@@ -0,0 +1,105 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyOpenAI starts a Chat Completions stand-in that rate limits the first failures
+// requests, asking for retryAfterMs milliseconds, then answers. It returns a client
+// pointed at it and the number of requests received.
+func newFlakyOpenAI(t *testing.T, failures int, retryAfterMs string) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			w.Header().Set("Retry-After-Ms", retryAfterMs)
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached","type":"requests"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Go to Connections."},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	c := newTestClient("gpt-4o")
+	c.SetAPIURL(server.URL)
+	return c, &calls
+}
+
+func TestRateLimitedRequestIsRetried(t *testing.T) {
+	c, calls := newFlakyOpenAI(t, 1, "1")
+
+	completion, err := c.ChatCompletion(context.Background(), "How do I connect a wallet?", "corr_1")
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if completion.Content != "Go to Connections." {
+		t.Errorf("content = %q, want the answer from the retry", completion.Content)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("made %d requests, want 2", n)
+	}
+}
+
+func TestRetriesStopAtMaxRetries(t *testing.T) {
+	c, calls := newFlakyOpenAI(t, 10, "1")
+	c.SetMaxRetries(2)
+
+	if _, err := c.ChatCompletion(context.Background(), "How do I connect a wallet?", "corr_1"); err == nil {
+		t.Fatal("got nil error, want the rate limit reported")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("made %d requests, want 1 plus 2 retries", n)
+	}
+}
+
+func TestRetryPastDeadlineIsSkipped(t *testing.T) {
+	c, calls := newFlakyOpenAI(t, 1, "60000")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.ChatCompletion(ctx, "How do I connect a wallet?", "corr_1"); err == nil {
+		t.Fatal("got nil error, want the rate limit reported")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v, want an immediate error when the wait outlasts the deadline", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"none", nil, 0},
+		{"seconds", map[string]string{"Retry-After": "2"}, 2 * time.Second},
+		{"fractional seconds", map[string]string{"Retry-After": "0.5"}, 500 * time.Millisecond},
+		{"milliseconds preferred", map[string]string{"Retry-After": "2", "Retry-After-Ms": "150"}, 150 * time.Millisecond},
+		{"unparseable", map[string]string{"Retry-After": "soon"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+			if got := retryAfter(resp); got != tt.want {
+				t.Errorf("retryAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxToolRounds is how many times the model may ask for tools before it has to answer
+const maxToolRounds = 5
+
+// ToolExecutor runs the tools offered to the model
+type ToolExecutor interface {
+	// Execute runs the named tool with its JSON-encoded arguments and returns the result
+	// to send back to the model
+	Execute(ctx context.Context, name, arguments string) (string, error)
+}
+
+// SetTools offers tools to the model and runs the ones it asks for with executor. Without
+// tools, requests are sent as plain chat completions.
+func (c *Client) SetTools(tools []Tool, executor ToolExecutor) {
+	c.tools = tools
+	c.toolExecutor = executor
+}
+
+// converse sends messages to OpenAI and, while the model asks for tools, runs them and
+// sends back their results. The last allowed round forbids tool calls so the model has to
+// answer with what it has, and asking for tools anyway is an error. The returned usage
+// covers every round.
+func (c *Client) converse(ctx context.Context, messages []Message, correlationID string) (*Completion, error) {
+	if len(c.tools) == 0 {
+		return c.sendChatRequest(ctx, messages, "", correlationID)
+	}
+
+	var usage Usage
+	for round := 0; ; round++ {
+		toolChoice := "auto"
+		if round >= maxToolRounds {
+			toolChoice = "none"
+		}
+
+		completion, err := c.sendChatRequest(ctx, messages, toolChoice, correlationID)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += completion.Usage.PromptTokens
+		usage.CompletionTokens += completion.Usage.CompletionTokens
+		usage.TotalTokens += completion.Usage.TotalTokens
+
+		if len(completion.ToolCalls) == 0 {
+			completion.Usage = usage
+			return completion, nil
+		}
+		if round >= maxToolRounds {
+			return nil, fmt.Errorf("model still asked for tools after %d rounds", maxToolRounds)
+		}
+
+		messages = append(messages, Message{
+			Role:      "assistant",
+			Content:   completion.Content,
+			ToolCalls: completion.ToolCalls,
+		})
+		for _, call := range completion.ToolCalls {
+			messages = append(messages, Message{
+				Role:       "tool",
+				Content:    c.runTool(ctx, call, correlationID),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// runTool executes one tool call. Failures are reported to the model as the result so it
+// can tell the user rather than the whole request failing.
+func (c *Client) runTool(ctx context.Context, call ToolCall, correlationID string) string {
+	c.logger.Info("Running tool requested by model",
+		"correlation_id", correlationID,
+		"tool", call.Function.Name,
+		"tool_call_id", call.ID)
+
+	result, err := c.toolExecutor.Execute(ctx, call.Function.Name, call.Function.Arguments)
+	if err != nil {
+		c.logger.Warn("Tool call failed",
+			"correlation_id", correlationID,
+			"tool", call.Function.Name,
+			"error", err)
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return result
+}
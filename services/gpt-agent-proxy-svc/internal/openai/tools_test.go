@@ -0,0 +1,51 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/ratelimit"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tokenlimit"
+)
+
+// echoTool is a ToolExecutor that returns its arguments
+type echoTool struct{}
+
+func (echoTool) Execute(ctx context.Context, name, arguments string) (string, error) {
+	return arguments, nil
+}
+
+func TestModelThatKeepsAskingForToolsIsStopped(t *testing.T) {
+	var toolChoices []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		toolChoices = append(toolChoices, req.ToolChoice)
+
+		// Ask for a tool every time, even when told not to
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]}}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := NewClient("sk-test", "gpt-4o", "You are Wavie.", tokenlimit.NewGuard(nil), ratelimit.NewThrottle(0, 0), 0, 0.7, 1000, logger)
+	c.SetAPIURL(server.URL)
+	c.SetMaxRetries(0)
+	c.SetTools([]Tool{{Type: "function", Function: FunctionDefinition{Name: "lookup"}}}, echoTool{})
+
+	if _, err := c.ChatCompletion(context.Background(), "How do I connect a wallet?", "corr_1"); err == nil {
+		t.Fatal("ChatCompletion succeeded, want an error once the tool rounds run out")
+	}
+	if len(toolChoices) != maxToolRounds+1 {
+		t.Fatalf("sent %d requests, want %d", len(toolChoices), maxToolRounds+1)
+	}
+	if last := toolChoices[len(toolChoices)-1]; last != "none" {
+		t.Errorf("last request had tool_choice %q, want none", last)
+	}
+}
@@ -1,15 +1,50 @@
 package openai
 
+import "encoding/json"
+
 type ChatRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Temperature float64   `json:"temperature"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Tools       []Tool    `json:"tools,omitempty"`
+	// ToolChoice is "auto" to let the model call tools or "none" to make it answer
+	ToolChoice string `json:"tool_choice,omitempty"`
 }
 
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are set on assistant messages asking for tools to be run
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a tool message to the call it answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function the model may ask to have called instead of answering
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the function's arguments
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a model's request to call a tool
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name string `json:"name"`
+	// Arguments is a JSON object encoded as a string, as generated by the model
+	Arguments string `json:"arguments"`
 }
 
 type ChatResponse struct {
@@ -33,6 +68,18 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// Completion is the answer and usage returned by a successful chat completion
+type Completion struct {
+	Content string
+	Model   string
+	Usage   Usage
+	// Provider is the API that produced the answer: openai, or the fallback's name
+	Provider string
+	// ToolCalls are the tools the model asked for instead of answering; empty on the
+	// completions Client returns
+	ToolCalls []ToolCall
+}
+
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
 }
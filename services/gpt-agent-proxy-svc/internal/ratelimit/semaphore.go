@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBusy is returned when no upstream slot frees up in time
+var ErrBusy = errors.New("too many concurrent upstream requests")
+
+// Semaphore bounds the number of upstream calls in flight, so a burst of questions
+// doesn't open more simultaneous connections than the provider allows. A nil Semaphore
+// never blocks.
+type Semaphore struct {
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// SemaphoreStatus is a snapshot of a Semaphore for the health check
+type SemaphoreStatus struct {
+	InFlight int `json:"in_flight"`
+	Limit    int `json:"limit"`
+}
+
+// NewSemaphore allows size calls in flight at once; callers beyond that wait up to
+// maxWait for a slot
+func NewSemaphore(size int, maxWait time.Duration) *Semaphore {
+	return &Semaphore{
+		slots:   make(chan struct{}, size),
+		maxWait: maxWait,
+	}
+}
+
+// Acquire takes a slot, waiting until one frees up, maxWait passes or ctx is done. It
+// returns ErrBusy if no slot freed up in time, or ctx's error if the caller gave up.
+// Every successful Acquire must be followed by Release.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(s.maxWait)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBusy
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrBusy
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// Status returns how many slots are taken. A nil Semaphore reports a limit of 0.
+func (s *Semaphore) Status() SemaphoreStatus {
+	if s == nil {
+		return SemaphoreStatus{}
+	}
+	return SemaphoreStatus{InFlight: len(s.slots), Limit: cap(s.slots)}
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota is the most recent rate-limit state reported by OpenAI's x-ratelimit-* headers
+type Quota struct {
+	LimitRequests     int       `json:"limit_requests"`
+	RemainingRequests int       `json:"remaining_requests"`
+	ResetRequestsAt   time.Time `json:"reset_requests_at"`
+	LimitTokens       int       `json:"limit_tokens"`
+	RemainingTokens   int       `json:"remaining_tokens"`
+	ResetTokensAt     time.Time `json:"reset_tokens_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Throttle slows requests down when the remaining quota drops below a fraction of the
+// limit, spreading what is left over the time until the limit resets
+type Throttle struct {
+	threshold float64
+	maxDelay  time.Duration
+	quota     Quota
+	mutex     sync.RWMutex
+}
+
+// NewThrottle creates a throttle that starts delaying once remaining/limit falls below
+// threshold, never sleeping longer than maxDelay per request
+func NewThrottle(threshold float64, maxDelay time.Duration) *Throttle {
+	return &Throttle{
+		threshold: threshold,
+		maxDelay:  maxDelay,
+	}
+}
+
+// Update records the quota from a response's headers. Headers that are missing or
+// unparseable leave the previous value in place.
+func (t *Throttle) Update(header http.Header, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	updated := false
+	updated = parseInt(header, "x-ratelimit-limit-requests", &t.quota.LimitRequests) || updated
+	updated = parseInt(header, "x-ratelimit-remaining-requests", &t.quota.RemainingRequests) || updated
+	updated = parseReset(header, "x-ratelimit-reset-requests", now, &t.quota.ResetRequestsAt) || updated
+	updated = parseInt(header, "x-ratelimit-limit-tokens", &t.quota.LimitTokens) || updated
+	updated = parseInt(header, "x-ratelimit-remaining-tokens", &t.quota.RemainingTokens) || updated
+	updated = parseReset(header, "x-ratelimit-reset-tokens", now, &t.quota.ResetTokensAt) || updated
+
+	if updated {
+		t.quota.UpdatedAt = now
+	}
+}
+
+// Quota returns the last reported quota
+func (t *Throttle) Quota() Quota {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.quota
+}
+
+// Delay returns how long the next request should wait, or zero when quota is healthy
+func (t *Throttle) Delay(now time.Time) time.Duration {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	delay := t.spread(t.quota.LimitRequests, t.quota.RemainingRequests, t.quota.ResetRequestsAt, now)
+	if tokenDelay := t.spread(t.quota.LimitTokens, t.quota.RemainingTokens, t.quota.ResetTokensAt, now); tokenDelay > delay {
+		delay = tokenDelay
+	}
+
+	if delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+	return delay
+}
+
+// Wait sleeps for the current delay, returning early if ctx is cancelled
+func (t *Throttle) Wait(ctx context.Context) error {
+	delay := t.Delay(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// spread divides the time until reset among the remaining requests once the remaining
+// fraction is below the threshold
+func (t *Throttle) spread(limit, remaining int, resetAt, now time.Time) time.Duration {
+	if limit <= 0 || float64(remaining)/float64(limit) >= t.threshold {
+		return 0
+	}
+
+	untilReset := resetAt.Sub(now)
+	if untilReset <= 0 {
+		return 0
+	}
+
+	return untilReset / time.Duration(remaining+1)
+}
+
+func parseInt(header http.Header, key string, dst *int) bool {
+	value, err := strconv.Atoi(header.Get(key))
+	if err != nil {
+		return false
+	}
+	*dst = value
+	return true
+}
+
+// parseReset reads OpenAI's reset durations such as "1s", "6m0s" or "20ms"
+func parseReset(header http.Header, key string, now time.Time, dst *time.Time) bool {
+	value := header.Get(key)
+	if value == "" {
+		return false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return false
+	}
+	*dst = now.Add(d)
+	return true
+}
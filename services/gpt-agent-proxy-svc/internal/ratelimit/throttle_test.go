@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func quotaHeader(remainingRequests, remainingTokens string) http.Header {
+	h := http.Header{}
+	h.Set("x-ratelimit-limit-requests", "100")
+	h.Set("x-ratelimit-remaining-requests", remainingRequests)
+	h.Set("x-ratelimit-reset-requests", "10s")
+	h.Set("x-ratelimit-limit-tokens", "10000")
+	h.Set("x-ratelimit-remaining-tokens", remainingTokens)
+	h.Set("x-ratelimit-reset-tokens", "6m0s")
+	return h
+}
+
+func TestUpdateParsesHeaders(t *testing.T) {
+	throttle := NewThrottle(0.1, time.Minute)
+	throttle.Update(quotaHeader("42", "9000"), testNow)
+
+	want := Quota{
+		LimitRequests:     100,
+		RemainingRequests: 42,
+		ResetRequestsAt:   testNow.Add(10 * time.Second),
+		LimitTokens:       10000,
+		RemainingTokens:   9000,
+		ResetTokensAt:     testNow.Add(6 * time.Minute),
+		UpdatedAt:         testNow,
+	}
+	if got := throttle.Quota(); got != want {
+		t.Errorf("Quota() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUpdateKeepsQuotaWhenHeadersMissing(t *testing.T) {
+	throttle := NewThrottle(0.1, time.Minute)
+	throttle.Update(quotaHeader("42", "9000"), testNow)
+
+	bad := http.Header{}
+	bad.Set("x-ratelimit-remaining-requests", "lots")
+	throttle.Update(bad, testNow.Add(time.Second))
+
+	if got := throttle.Quota(); got.RemainingRequests != 42 || !got.UpdatedAt.Equal(testNow) {
+		t.Errorf("Quota() = %+v, want the earlier quota unchanged", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name              string
+		remainingRequests string
+		remainingTokens   string
+		want              time.Duration
+	}{
+		{"healthy quota", "50", "9000", 0},
+		{"at the threshold", "10", "9000", 0},
+		// 10s until reset spread over the 4 remaining requests and this one
+		{"requests low", "4", "9000", 2 * time.Second},
+		// 6m spread over 100 remaining tokens would be 3.5s, capped by maxDelay
+		{"tokens low", "50", "99", 3 * time.Second},
+		{"exhausted", "0", "9000", 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewThrottle(0.1, 3*time.Second)
+			throttle.Update(quotaHeader(tt.remainingRequests, tt.remainingTokens), testNow)
+
+			if got := throttle.Delay(testNow); got != tt.want {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelayEndsAtReset(t *testing.T) {
+	throttle := NewThrottle(0.1, time.Minute)
+	throttle.Update(quotaHeader("1", "9000"), testNow)
+
+	if got := throttle.Delay(testNow.Add(11 * time.Second)); got != 0 {
+		t.Errorf("Delay() after the reset = %v, want 0", got)
+	}
+}
+
+func TestWaitReturnsWhenContextCancelled(t *testing.T) {
+	throttle := NewThrottle(0.1, time.Hour)
+	h := quotaHeader("0", "9000")
+	h.Set("x-ratelimit-reset-requests", "1h")
+	throttle.Update(h, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := throttle.Wait(ctx); err != context.Canceled {
+		t.Errorf("Wait() = %v, want context.Canceled", err)
+	}
+}
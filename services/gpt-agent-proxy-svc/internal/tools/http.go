@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/services/gpt-agent-proxy-svc/internal/openai"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+)
+
+// maxResultBytes caps how much of a tool's response is sent back to the model
+const maxResultBytes = 16 * 1024
+
+// Definition describes a tool backed by an HTTP endpoint, as read from the tools file
+type Definition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+	// URL receives the model's arguments as a JSON POST body and returns the result
+	URL string `json:"url"`
+}
+
+// HTTPExecutor runs tools by POSTing their arguments to each tool's URL
+type HTTPExecutor struct {
+	urls   map[string]string
+	client *http.Client
+	logger *slog.Logger
+}
+
+// LoadHTTPTools reads a JSON array of Definitions from path and returns them as OpenAI
+// tools along with the executor that calls them
+func LoadHTTPTools(path string, timeout time.Duration, logger *slog.Logger) ([]openai.Tool, *HTTPExecutor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read tools file: %w", err)
+	}
+
+	var definitions []Definition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse tools file: %w", err)
+	}
+
+	executor := &HTTPExecutor{
+		urls:   make(map[string]string, len(definitions)),
+		client: &http.Client{Timeout: timeout},
+		logger: logger,
+	}
+	tools := make([]openai.Tool, 0, len(definitions))
+	for _, def := range definitions {
+		if def.Name == "" || def.URL == "" {
+			return nil, nil, fmt.Errorf("tool %q needs both a name and a url", def.Name)
+		}
+		if _, ok := executor.urls[def.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate tool %q", def.Name)
+		}
+		executor.urls[def.Name] = def.URL
+
+		tools = append(tools, openai.Tool{
+			Type: "function",
+			Function: openai.FunctionDefinition{
+				Name:        def.Name,
+				Description: def.Description,
+				Parameters:  def.Parameters,
+			},
+		})
+	}
+
+	return tools, executor, nil
+}
+
+// Execute POSTs arguments to the tool's URL and returns the response body
+func (e *HTTPExecutor) Execute(ctx context.Context, name, arguments string) (string, error) {
+	url, ok := e.urls[name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+	if !json.Valid([]byte(arguments)) {
+		return "", fmt.Errorf("arguments for tool %q are not valid JSON", name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader([]byte(arguments)))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.SetHeader(req)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call tool %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResultBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read tool %q response: %w", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tool %q returned %d: %s", name, resp.StatusCode, string(body))
+	}
+
+	e.logger.InfoContext(ctx, "Tool call succeeded", "tool", name, "result_length", len(body))
+	return string(body), nil
+}
@@ -12,7 +12,12 @@ import (
 
 	"github.com/BitwaveCorp/shared-svcs/services/slack-events-listener-svc/internal/api"
 	"github.com/BitwaveCorp/shared-svcs/services/slack-events-listener-svc/internal/config"
+	"github.com/BitwaveCorp/shared-svcs/services/slack-events-listener-svc/internal/conversation"
+	"github.com/BitwaveCorp/shared-svcs/services/slack-events-listener-svc/internal/dedup"
 	"github.com/BitwaveCorp/shared-svcs/services/slack-events-listener-svc/internal/slack"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackcreds"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -20,7 +25,7 @@ import (
 func main() {
 	slog.Info("Starting slack-events-listener-svc")
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, nil)))
 	slog.SetDefault(logger)
 
 	if err := godotenv.Load(); err != nil {
@@ -36,7 +41,7 @@ func main() {
 	var level slog.Level
 	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err == nil {
 		opts := &slog.HandlerOptions{Level: level}
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, opts))
+		logger = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, opts)))
 		slog.SetDefault(logger)
 	}
 
@@ -46,15 +51,104 @@ func main() {
 		"broadcast_url", cfg.BroadcastServiceURL,
 	)
 
+	if err := slackcreds.ValidateBotToken(cfg.SlackBotToken); err != nil {
+		slog.Error("Invalid SLACK_BOT_TOKEN", "error", err)
+		os.Exit(1)
+	}
+	if err := slackcreds.ValidateSigningSecret(cfg.SlackSigningSecret); err != nil {
+		slog.Error("Invalid SLACK_SIGNING_SECRET", "error", err)
+		os.Exit(1)
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":     cfg.UpstreamTimeout,
+		"BROADCAST_TIMEOUT":    cfg.BroadcastTimeout,
+		"REQUEST_TIMEOUT":      cfg.RequestTimeout,
+		"SERVER_READ_TIMEOUT":  cfg.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT": cfg.ServerWriteTimeout,
+	} {
+		if timeout <= 0 {
+			slog.Error("Invalid "+name+", must be a positive duration", "timeout", timeout)
+			os.Exit(1)
+		}
+	}
+	if cfg.MaxRequestBodyBytes <= 0 {
+		slog.Error("Invalid MAX_REQUEST_BODY_BYTES, must be positive", "max_request_body_bytes", cfg.MaxRequestBodyBytes)
+		os.Exit(1)
+	}
+	// A question and its answer are the least worth keeping; far more only costs tokens
+	if cfg.ConversationMaxMessages < 2 || cfg.ConversationMaxMessages > 1000 {
+		slog.Error("Invalid CONVERSATION_MAX_MESSAGES, must be between 2 and 1000", "max_messages", cfg.ConversationMaxMessages)
+		os.Exit(1)
+	}
+	if cfg.ConversationMaxAge < time.Minute || cfg.ConversationMaxAge > 30*24*time.Hour {
+		slog.Error("Invalid CONVERSATION_MAX_AGE, must be between 1m and 720h", "max_age", cfg.ConversationMaxAge)
+		os.Exit(1)
+	}
+
 	slackClient := slack.NewClient(cfg.SlackBotToken, logger)
-	handler := api.NewHandler(slackClient, cfg.SlackSigningSecret, cfg.GPTProxyServiceURL, cfg.BroadcastServiceURL, logger)
+	slackClient.SetBlockKit(cfg.BlockKitAnswers)
+
+	dedupStore, err := dedup.New(dedup.Options{
+		Backend:       cfg.DedupBackend,
+		FilePath:      cfg.DedupFilePath,
+		RedisAddr:     cfg.RedisAddr,
+		RedisPassword: cfg.RedisPassword,
+		TTL:           cfg.DedupTTL,
+	}, logger)
+	if err != nil {
+		slog.Error("Failed to create dedup store", "error", err)
+		os.Exit(1)
+	}
+
+	conversationOpts := conversation.Options{
+		Backend:       cfg.ConversationBackend,
+		RedisAddr:     cfg.RedisAddr,
+		RedisPassword: cfg.RedisPassword,
+		MaxMessages:   cfg.ConversationMaxMessages,
+		MaxTokens:     cfg.ConversationTokenBudget,
+		MaxAge:        cfg.ConversationMaxAge,
+	}
+	if cfg.ConversationSummarize {
+		conversationOpts.Summarizer = conversation.ExtractiveSummarizer{}
+	}
+	conversationStore, err := conversation.New(conversationOpts, logger)
+	if err != nil {
+		slog.Error("Failed to create conversation store", "error", err)
+		os.Exit(1)
+	}
+
+	// The bot's own user ID lets the handler ignore its own messages; events also carry
+	// it in their authorizations, so a failure here is not fatal
+	authCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	botUserID, err := slackClient.AuthTest(authCtx)
+	cancel()
+	if err != nil {
+		slog.Warn("Failed to resolve bot user ID", "error", err)
+	} else {
+		slog.Info("Resolved bot user ID", "bot_user_id", botUserID)
+	}
+
+	handler := api.NewHandler(slackClient, dedupStore, conversationStore, botUserID, cfg, logger)
+	if cfg.HomeViewPath != "" {
+		markdown, err := os.ReadFile(cfg.HomeViewPath)
+		if err != nil {
+			slog.Error("Failed to read HOME_VIEW_PATH", "path", cfg.HomeViewPath, "error", err)
+			os.Exit(1)
+		}
+		handler.SetHomeView(string(markdown))
+	}
+
+	metrics.SetService("slack-events-listener-svc")
 
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: mux,
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      tracing.Middleware(api.LimitBody(mux, cfg.MaxRequestBodyBytes), logger),
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
 	}
 
 	go func() {
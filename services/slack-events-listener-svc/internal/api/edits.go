@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/idgen"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
+)
+
+// handleMessageEdit corrects the thread history when a user edits a question Wavie
+// answered, so follow-ups see the fixed text, and re-answers it if enabled. Edits of the
+// bot's own messages, such as placeholders replaced by answers, are never new input.
+func (h *Handler) handleMessageEdit(eventReq slack.EventRequest) {
+	edited, previous := eventReq.Event.Message, eventReq.Event.PreviousMessage
+	if edited == nil || previous == nil {
+		return
+	}
+
+	ownID := h.ownUserID(eventReq)
+	if edited.BotID != "" || (ownID != "" && edited.User == ownID) {
+		h.logger.Debug("Ignoring edit of a bot message", "event_id", eventReq.EventID, "message_ts", edited.TS)
+		return
+	}
+
+	// Link unfurls and other attachments also arrive as message_changed, with the text unchanged
+	if edited.Text == previous.Text {
+		return
+	}
+
+	threadID := edited.ThreadTS
+	if threadID == "" {
+		threadID = edited.TS
+	}
+	if !h.conversationStore.HasAnswered(threadID) {
+		return
+	}
+
+	// Questions are stored the way answerMessage received them, without the bot mention
+	oldQuestion := stripBotMention(previous.Text, ownID)
+	newQuestion := stripBotMention(edited.Text, ownID)
+	if newQuestion == "" || !h.conversationStore.ReplaceMessage(threadID, "user", oldQuestion, newQuestion) {
+		h.logger.Debug("Edited message is not a question in the conversation", "thread_id", threadID, "message_ts", edited.TS)
+		return
+	}
+
+	h.logger.Info("Updated edited question in conversation",
+		"user", edited.User,
+		"channel", eventReq.Event.Channel,
+		"thread_id", threadID,
+		"message_ts", edited.TS)
+
+	if !h.reanswerEdits {
+		return
+	}
+
+	// Only the latest question is re-answered; editing an older one just fixes the history
+	history := h.conversationStore.GetMessages(threadID)
+	idx := lastMessageIndex(history, "user")
+	if idx < 0 || history[idx].Content != newQuestion {
+		return
+	}
+
+	if !h.userLimiter.Allow(edited.User) {
+		h.logger.Warn("User rate limited, not re-answering edit", "user", edited.User, "thread_id", threadID)
+		h.slackClient.PostMessage(context.Background(), eventReq.Event.Channel, rateLimitedMessage, threadID)
+		return
+	}
+
+	correlationID, err := idgen.GenerateId("wv", 16)
+	if err != nil {
+		h.logger.Error("Failed to generate correlation ID", "error", err)
+		return
+	}
+
+	h.logger.Info("Re-answering edited question", "correlation_id", correlationID, "thread_id", threadID)
+	h.answerInThread(edited.User, eventReq.Event.Channel, threadID, newQuestion, history[:idx], false, correlationID)
+}
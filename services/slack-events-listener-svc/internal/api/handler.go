@@ -7,19 +7,27 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/idgen"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+	"github.com/google/uuid"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/config"
 	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/conversation"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/deadletter"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/dedup"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/ratelimit"
 	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
-	"github.com/google/uuid"
-	"github.com/BitwaveCorp/shared-svcs/shared/utils/idgen"
 )
 
 type Handler struct {
@@ -27,40 +35,83 @@ type Handler struct {
 	signingSecret       string
 	gptProxyServiceURL  string
 	broadcastServiceURL string
+	gptClient           *http.Client
+	broadcastClient     *http.Client
 	logger              *slog.Logger
-	processedEvents     map[string]bool
-	eventsMutex         sync.RWMutex
-	conversationStore   *conversation.Store
+	dedupStore          dedup.Store
+	conversationStore   conversation.Store
+	deadLetterQueue     *deadletter.Queue
+	reactionActions     map[string]string
+	timeoutMessage      string
+	enabledEvents       map[string]bool
+	autoJoinChannels    bool
+	botUserID           string
+	thinkingMessage     string
+	userLimiter         *ratelimit.Limiter
+	reanswerEdits       bool
+	replyBroadcast      bool
+	regenerateNegative  bool
+	requestTimeout      time.Duration
+	homeView            slack.View
 }
 
-func NewHandler(slackClient *slack.Client, signingSecret, gptProxyServiceURL, broadcastServiceURL string, logger *slog.Logger) *Handler {
-	// Create conversation store with 20 message limit and 1 hour max age
-	conversationStore := conversation.NewStore(20, 1*time.Hour)
+func NewHandler(slackClient *slack.Client, dedupStore dedup.Store, conversationStore conversation.Store, botUserID string, cfg config.Config, logger *slog.Logger) *Handler {
+	// Answers that fail to post are redelivered in the background
+	deadLetterQueue := deadletter.NewQueue(func(ctx context.Context, channel, text, threadTS string) error {
+		_, err := slackClient.PostMessage(ctx, channel, text, threadTS)
+		return err
+	}, cfg.DLQRetryDuration, logger)
+
+	enabledEvents := make(map[string]bool, len(cfg.EnabledEventTypes))
+	for _, eventType := range cfg.EnabledEventTypes {
+		enabledEvents[strings.TrimSpace(eventType)] = true
+	}
 
 	return &Handler{
 		slackClient:         slackClient,
-		signingSecret:       signingSecret,
-		gptProxyServiceURL:  gptProxyServiceURL,
-		broadcastServiceURL: broadcastServiceURL,
+		signingSecret:       cfg.SlackSigningSecret,
+		gptProxyServiceURL:  cfg.GPTProxyServiceURL,
+		broadcastServiceURL: cfg.BroadcastServiceURL,
+		gptClient:           &http.Client{Timeout: cfg.UpstreamTimeout},
+		broadcastClient:     &http.Client{Timeout: cfg.BroadcastTimeout},
 		logger:              logger,
-		processedEvents:     make(map[string]bool),
+		dedupStore:          dedupStore,
 		conversationStore:   conversationStore,
+		deadLetterQueue:     deadLetterQueue,
+		reactionActions:     cfg.ReactionActions,
+		timeoutMessage:      cfg.TimeoutMessage,
+		enabledEvents:       enabledEvents,
+		autoJoinChannels:    cfg.AutoJoinChannels,
+		botUserID:           botUserID,
+		thinkingMessage:     cfg.ThinkingMessage,
+		userLimiter:         ratelimit.NewLimiter(cfg.UserRateLimit),
+		reanswerEdits:       cfg.ReanswerEdits,
+		replyBroadcast:      cfg.ReplyBroadcast,
+		regenerateNegative:  cfg.RegenerateOnNegative,
+		requestTimeout:      cfg.RequestTimeout,
+		homeView:            slack.NewHomeView(defaultHomeMarkdown),
 	}
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /health", h.handleHealthCheck)
-	mux.HandleFunc("POST /slack/events", h.ProcessEvent)
+	mux.Handle("GET /health", metrics.Instrument("/health", http.HandlerFunc(h.handleHealthCheck)))
+	mux.Handle("POST /slack/events", metrics.Instrument("/slack/events", http.HandlerFunc(h.ProcessEvent)))
+	mux.Handle("GET /metrics", metrics.Handler())
 }
 
 func (h *Handler) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{"status": "ok"}
+	response := map[string]interface{}{
+		"status":        "ok",
+		"dlq_depth":     h.deadLetterQueue.Depth(),
+		"conversations": h.conversationStore.Stats(),
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *Handler) verifySlackSignature(r *http.Request) error {
+// verifySlackSignature checks the request signature against the already-read body
+func (h *Handler) verifySlackSignature(r *http.Request, body []byte) error {
 	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
 	signature := r.Header.Get("X-Slack-Signature")
 
@@ -77,11 +128,6 @@ func (h *Handler) verifySlackSignature(r *http.Request) error {
 		return fmt.Errorf("timestamp is too old")
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read request body: %w", err)
-	}
-
 	baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
 	mac := hmac.New(sha256.New, []byte(h.signingSecret))
 	mac.Write([]byte(baseString))
@@ -94,34 +140,26 @@ func (h *Handler) verifySlackSignature(r *http.Request) error {
 	return nil
 }
 
-func (h *Handler) isEventProcessed(eventID string) bool {
-	h.eventsMutex.RLock()
-	defer h.eventsMutex.RUnlock()
-	return h.processedEvents[eventID]
-}
-
-func (h *Handler) markEventProcessed(eventID string) {
-	h.eventsMutex.Lock()
-	defer h.eventsMutex.Unlock()
-	h.processedEvents[eventID] = true
-}
-
 func (h *Handler) ProcessEvent(w http.ResponseWriter, r *http.Request) {
-	// Verify Slack signature
-	if err := h.verifySlackSignature(r); err != nil {
-		h.logger.Error("Failed to verify Slack signature", "error", err)
-		http.Error(w, "Invalid signature", http.StatusUnauthorized)
-		return
-	}
-
-	// Read request body
+	// Read request body once; it is needed for both the signature and the event
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.logger.Error("Failed to read request body", "error", err)
+		if isBodyTooLarge(err) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 
+	// Verify Slack signature
+	if err := h.verifySlackSignature(r, body); err != nil {
+		h.logger.Error("Failed to verify Slack signature", "error", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
 	// Parse event
 	var eventReq slack.EventRequest
 	if err := json.Unmarshal(body, &eventReq); err != nil {
@@ -137,13 +175,42 @@ func (h *Handler) ProcessEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Deduplicate events
-	if h.isEventProcessed(eventReq.EventID) {
-		h.logger.Info("Duplicate event received, ignoring", "event_id", eventReq.EventID)
+	// Ignore event types that operators have not enabled
+	if !h.enabledEvents[eventReq.Event.Type] {
+		h.logger.Debug("Event type not enabled, ignoring", "event_type", eventReq.Event.Type, "event_id", eventReq.EventID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Never respond to bots, including ourselves, to avoid reply loops
+	if h.isFromBot(eventReq) {
+		h.logger.Debug("Ignoring event from a bot", "event_type", eventReq.Event.Type, "event_id", eventReq.EventID, "bot_id", eventReq.Event.BotID)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	// Slack re-delivers with X-Slack-Retry-Num when we're slow to ack; those are
+	// acknowledged without reprocessing once the first delivery has been recorded
+	retryNum, _ := strconv.Atoi(r.Header.Get("X-Slack-Retry-Num"))
+
+	// Deduplicate events, marking before dispatching so a retry arriving while the first
+	// attempt is still waiting on GPT is recognised as a duplicate
+	if !h.dedupStore.MarkIfNew(eventReq.EventID) {
+		h.logger.Info("Duplicate event received, ignoring",
+			"event_id", eventReq.EventID,
+			"retry_num", retryNum,
+			"retry_reason", r.Header.Get("X-Slack-Retry-Reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if retryNum > 0 {
+		h.logger.Info("Processing retried event not seen before",
+			"event_id", eventReq.EventID,
+			"retry_num", retryNum,
+			"retry_reason", r.Header.Get("X-Slack-Retry-Reason"))
+	}
+
 	// Process event asynchronously
 	go func() {
 		switch eventReq.Event.Type {
@@ -151,21 +218,38 @@ func (h *Handler) ProcessEvent(w http.ResponseWriter, r *http.Request) {
 			h.handleAppMention(eventReq)
 		case "reaction_added":
 			h.handleReactionAdded(eventReq)
+		case "app_home_opened":
+			h.handleAppHomeOpened(eventReq)
 		case "message":
-			// Only process messages in threads that might contain feedback
-			if eventReq.Event.ThreadTS != "" && strings.HasPrefix(eventReq.Event.Text, "***") {
+			if eventReq.Event.Subtype == "message_changed" {
+				h.handleMessageEdit(eventReq)
+				return
+			}
+			// Only thread replies matter: *** feedback, or follow-ups in a thread the bot
+			// is already answering in
+			if eventReq.Event.ThreadTS == "" || eventReq.Event.Subtype != "" {
+				return
+			}
+			if strings.HasPrefix(eventReq.Event.Text, "***") {
 				h.handleTextFeedback(eventReq)
+			} else if h.isThreadFollowUp(eventReq) {
+				h.handleThreadFollowUp(eventReq)
 			}
 		}
-		h.markEventProcessed(eventReq.EventID)
 	}()
 
 	// Respond immediately to Slack
 	w.WriteHeader(http.StatusOK)
 }
 
-// handleReactionAdded processes reaction events for feedback
+// handleReactionAdded processes reaction events for feedback and quick actions
 func (h *Handler) handleReactionAdded(eventReq slack.EventRequest) {
+	// Reactions mapped to a quick action re-run the pipeline for the reacted answer
+	if action, ok := h.reactionActions[eventReq.Event.Reaction]; ok {
+		h.handleQuickAction(eventReq, action)
+		return
+	}
+
 	// Only process thumbs up/down reactions
 	if eventReq.Event.Reaction != "+1" && eventReq.Event.Reaction != "-1" {
 		return
@@ -194,6 +278,14 @@ func (h *Handler) handleReactionAdded(eventReq slack.EventRequest) {
 		CorrelationID: correlationID,
 	}
 
+	// Link the feedback to the interaction it rates
+	if originalID, ok := h.conversationStore.GetAnswerCorrelationID(messageTS); ok {
+		feedbackReq.OriginalCorrelationID = originalID
+	}
+
+	// Show reviewers what was rated
+	h.addFeedbackContext(&feedbackReq, h.ownUserID(eventReq))
+
 	// Send feedback to broadcast service
 	h.sendFeedbackToBroadcast(feedbackReq)
 
@@ -202,6 +294,50 @@ func (h *Handler) handleReactionAdded(eventReq slack.EventRequest) {
 		"user", eventReq.Event.User,
 		"channel", channel,
 		"correlation_id", correlationID)
+
+	if feedbackType == "negative" && h.regenerateNegative {
+		h.regenerateOnNegative(eventReq)
+	}
+}
+
+// addFeedbackContext looks up the reacted message and, if it is one of the bot's answers,
+// fills in the answer and the question it replied to. Reactions to other messages, and
+// lookup failures, leave the feedback without context rather than dropping it.
+func (h *Handler) addFeedbackContext(feedbackReq *slack.FeedbackRequest, ownID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	answer, err := h.slackClient.GetMessage(ctx, feedbackReq.ChannelID, feedbackReq.MessageTS)
+	if err != nil {
+		h.logger.Warn("Failed to look up reacted message", "error", err, "correlation_id", feedbackReq.CorrelationID)
+		return
+	}
+	if ownID == "" || answer.User != ownID {
+		h.logger.Debug("Reacted message is not a bot answer", "message_ts", feedbackReq.MessageTS, "correlation_id", feedbackReq.CorrelationID)
+		return
+	}
+
+	feedbackReq.Response = answer.Text
+	if answer.ThreadTS == "" {
+		return
+	}
+	feedbackReq.ThreadTS = answer.ThreadTS
+
+	thread, err := h.slackClient.GetThreadReplies(ctx, feedbackReq.ChannelID, answer.ThreadTS)
+	if err != nil {
+		h.logger.Warn("Failed to look up thread of reacted message", "error", err, "correlation_id", feedbackReq.CorrelationID)
+		return
+	}
+
+	// The question is the last message from someone else before the answer
+	for i := len(thread) - 1; i >= 0; i-- {
+		msg := thread[i]
+		if msg.TS >= answer.TS || msg.User == ownID || msg.BotID != "" {
+			continue
+		}
+		feedbackReq.Question = stripBotMention(msg.Text, ownID)
+		return
+	}
 }
 
 // handleTextFeedback processes text feedback from thread replies
@@ -230,6 +366,11 @@ func (h *Handler) handleTextFeedback(eventReq slack.EventRequest) {
 		CorrelationID: correlationID,
 	}
 
+	// Text feedback is about the latest answer in the thread
+	if originalID, ok := h.conversationStore.GetLastCorrelationID(eventReq.Event.ThreadTS); ok {
+		feedbackReq.OriginalCorrelationID = originalID
+	}
+
 	// Send feedback to broadcast service
 	h.sendFeedbackToBroadcast(feedbackReq)
 
@@ -249,7 +390,15 @@ func (h *Handler) sendFeedbackToBroadcast(feedback slack.FeedbackRequest) {
 	}
 
 	// Send to broadcast service
-	resp, err := http.Post(h.broadcastServiceURL+"/api/feedback", "application/json", bytes.NewReader(feedbackJSON))
+	httpReq, err := http.NewRequest("POST", h.broadcastServiceURL+"/api/feedback", bytes.NewReader(feedbackJSON))
+	if err != nil {
+		h.logger.Error("Failed to create feedback request", "error", err, "correlation_id", feedback.CorrelationID)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(tracing.Header, feedback.CorrelationID)
+
+	resp, err := h.broadcastClient.Do(httpReq)
 	if err != nil {
 		h.logger.Error("Failed to send feedback to broadcast service", "error", err)
 		return
@@ -265,6 +414,39 @@ func (h *Handler) sendFeedbackToBroadcast(feedback slack.FeedbackRequest) {
 }
 
 func (h *Handler) handleAppMention(eventReq slack.EventRequest) {
+	h.answerMessage(eventReq, stripBotMention(eventReq.Event.Text, botUserID(eventReq)))
+}
+
+// handleThreadFollowUp answers a plain reply in a thread the bot is participating in,
+// so users don't need to @mention Wavie on every follow-up
+func (h *Handler) handleThreadFollowUp(eventReq slack.EventRequest) {
+	h.answerMessage(eventReq, strings.TrimSpace(eventReq.Event.Text))
+}
+
+// isThreadFollowUp reports whether a thread message should be answered without a
+// mention: the bot must have answered in the thread recently, and messages that mention
+// the bot are left to the app_mention event so they aren't answered twice
+func (h *Handler) isThreadFollowUp(eventReq slack.EventRequest) bool {
+	if strings.TrimSpace(eventReq.Event.Text) == "" {
+		return false
+	}
+
+	ownID := h.ownUserID(eventReq)
+	if ownID == "" || strings.Contains(eventReq.Event.Text, "<@"+ownID) {
+		return false
+	}
+
+	return h.conversationStore.HasAnswered(eventReq.Event.ThreadTS)
+}
+
+// answerMessage sends a question to the GPT service with the thread's history and posts
+// the answer in the thread
+func (h *Handler) answerMessage(eventReq slack.EventRequest, message string) {
+	// One deadline covers getting the answer, time spent posting the placeholder included;
+	// an answer that arrives in time is still delivered if posting it runs past it
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+
 	correlationID, err := idgen.GenerateId("wv", 16)
 	if err != nil {
 		h.logger.Error("Failed to generate correlation ID", "error", err)
@@ -278,45 +460,52 @@ func (h *Handler) handleAppMention(eventReq slack.EventRequest) {
 		threadID = eventReq.Event.TS // Use message timestamp as thread ID for new messages
 	}
 
-	h.logger.Info("Processing wavie message", 
-		"correlation_id", correlationID, 
-		"user", eventReq.Event.User, 
+	h.logger.Info("Processing wavie message",
+		"correlation_id", correlationID,
+		"user", eventReq.Event.User,
 		"channel", eventReq.Event.Channel,
 		"is_thread", isThreadReply,
 		"thread_id", threadID)
 
-	// Clean the message text
-	message := strings.ReplaceAll(eventReq.Event.Text, "<@", "")
-	message = strings.ReplaceAll(message, ">", "")
-	message = strings.ReplaceAll(message, "@wavie", "")
-	message = strings.TrimSpace(message)
+	message, broadcast := parseBroadcastFlag(message)
+	broadcast = broadcast || h.replyBroadcast
+
+	// Stop one user from running up the bill or starving everyone else
+	if !h.userLimiter.Allow(eventReq.Event.User) {
+		h.logger.Warn("User rate limited, skipping GPT call", "user", eventReq.Event.User, "correlation_id", correlationID)
+		h.slackClient.PostMessage(context.Background(), eventReq.Event.Channel, rateLimitedMessage, threadID)
+		return
+	}
 
 	// Add user message to conversation context
 	h.conversationStore.AddMessage(threadID, "user", message)
 
 	// Get conversation history for this thread
-	conversationHistory := h.conversationStore.GetMessages(threadID)
+	conversationHistory := toConversationHistory(h.conversationStore.GetMessages(threadID))
 
 	gptReq := slack.GPTRequest{
-		Message:            message,
-		UserID:             eventReq.Event.User,
-		ChannelID:          eventReq.Event.Channel,
-		MessageTS:          eventReq.Event.TS,
-		ThreadTS:           threadID,
+		Message:             message,
+		UserID:              eventReq.Event.User,
+		ChannelID:           eventReq.Event.Channel,
+		MessageTS:           eventReq.Event.TS,
+		ThreadTS:            threadID,
 		ConversationHistory: conversationHistory,
-		CorrelationID:      correlationID,
+		CorrelationID:       correlationID,
 	}
 
-	gptResp, err := h.callGPTService(gptReq)
+	// Let the user know we're on it while GPT works
+	placeholderTS := h.postPlaceholder(eventReq.Event.Channel, threadID, correlationID)
+
+	gptResp, err := h.callGPTService(ctx, gptReq)
 	if err != nil {
-		h.logger.Error("Failed to call GPT service", "error", err, "correlation_id", correlationID)
-		h.slackClient.PostMessage(context.Background(), eventReq.Event.Channel, "Sorry, I'm having trouble processing your request right now.", threadID)
+		h.logger.Error("Failed to call GPT service", "error", err, "correlation_id", correlationID, "timeout", isTimeoutError(err))
+		h.replyOrUpdate(eventReq.Event.Channel, placeholderTS, h.errorMessageFor(err), threadID, correlationID)
 		return
 	}
 
-	if gptResp.Error != "" {
-		h.logger.Error("GPT service returned error", "error", gptResp.Error, "correlation_id", correlationID)
-		h.slackClient.PostMessage(context.Background(), eventReq.Event.Channel, "Sorry, I encountered an error processing your request.", threadID)
+	if gptResp.Error != nil {
+		h.logger.Error("GPT service returned error", "code", gptResp.Error.Code, "error", gptResp.Error.Message, "correlation_id", correlationID)
+		h.replyOrUpdate(eventReq.Event.Channel, placeholderTS, "Sorry, I encountered an error processing your request.", threadID, correlationID)
 		return
 	}
 
@@ -329,47 +518,254 @@ func (h *Handler) handleAppMention(eventReq slack.EventRequest) {
 	}
 
 	// Always reply in the thread if there is one
-	err = h.slackClient.PostMessage(context.Background(), eventReq.Event.Channel, gptResp.Response, threadID)
+	answerTS, err := h.deliverAnswer(context.Background(), eventReq.Event.User, eventReq.Event.Channel, placeholderTS, gptResp.Response, threadID, broadcast, correlationID)
 	if err != nil {
 		h.logger.Error("Failed to post response to Slack", "error", err, "correlation_id", correlationID)
+		h.deadLetterQueue.Add(eventReq.Event.Channel, gptResp.Response, threadID, correlationID)
 		return
 	}
+	if answerTS != "" {
+		h.conversationStore.RecordAnswer(threadID, answerTS, correlationID)
+	}
 
 	broadcastReq := slack.BroadcastRequest{
-		UserID:        eventReq.Event.User,
-		ChannelID:     eventReq.Event.Channel,
-		ThreadID:      threadID,
-		Question:      message,
-		Response:      gptResp.Response,
-		Timestamp:     time.Now(),
-		CorrelationID: correlationID,
+		UserID:           eventReq.Event.User,
+		ChannelID:        eventReq.Event.Channel,
+		ThreadID:         threadID,
+		Question:         message,
+		Response:         gptResp.Response,
+		SourceDocs:       gptResp.SourceDocs,
+		Timestamp:        time.Now(),
+		CorrelationID:    correlationID,
+		PromptTokens:     gptResp.PromptTokens,
+		CompletionTokens: gptResp.CompletionTokens,
+		TotalTokens:      gptResp.TotalTokens,
+	}
+
+	// Include the question that started the thread so reviewers have context for follow-ups
+	if isThreadReply {
+		if root, ok := h.conversationStore.GetRootMessage(threadID, "user"); ok && root.Content != message {
+			broadcastReq.RootQuestion = root.Content
+		}
+	}
+
+	// Include the turns before this question so reviewers can see what led to the answer
+	history := h.conversationStore.GetMessages(threadID)
+	if i := lastMessageIndex(history, "user"); i > 0 {
+		broadcastReq.ConversationHistory = toConversationHistory(history[:i])
 	}
 
 	go h.callBroadcastService(broadcastReq)
 }
 
-func (h *Handler) callGPTService(req slack.GPTRequest) (*slack.GPTResponse, error) {
+const rateLimitedMessage = "You're sending messages too fast. Please wait a minute and try again."
+
+// leadingMentionPattern matches a user mention at the start of a message, used when the
+// bot's own user ID is not known
+var leadingMentionPattern = regexp.MustCompile(`^\s*<@[UW][A-Z0-9]+(?:\|[^>]*)?>[ \t]*`)
+
+// isFromBot reports whether the event was sent by a bot or by our own bot user
+func (h *Handler) isFromBot(eventReq slack.EventRequest) bool {
+	if eventReq.Event.BotID != "" {
+		return true
+	}
+
+	ownID := h.ownUserID(eventReq)
+	return ownID != "" && eventReq.Event.User == ownID
+}
+
+// ownUserID returns the bot's user ID, resolved at startup or taken from the event
+func (h *Handler) ownUserID(eventReq slack.EventRequest) string {
+	if h.botUserID != "" {
+		return h.botUserID
+	}
+	return botUserID(eventReq)
+}
+
+// botUserID returns the bot's user ID from the event's authorizations, if present
+func botUserID(eventReq slack.EventRequest) string {
+	for _, auth := range eventReq.Auths {
+		if auth.IsBot && auth.UserID != "" {
+			return auth.UserID
+		}
+	}
+	return ""
+}
+
+// stripBotMention removes complete <@BOTID> (or <@BOTID|name>) mention tokens from the
+// text, leaving other users' mentions and any other angle-bracketed text intact
+func stripBotMention(text, botID string) string {
+	if botID == "" {
+		return strings.TrimSpace(leadingMentionPattern.ReplaceAllString(text, ""))
+	}
+
+	pattern := regexp.MustCompile(`<@` + regexp.QuoteMeta(botID) + `(?:\|[^>]*)?>[ \t]*`)
+	return strings.TrimSpace(pattern.ReplaceAllString(text, ""))
+}
+
+// broadcastFlagPattern matches --broadcast in a question, which asks for the answer to
+// be sent to the channel too
+var broadcastFlagPattern = regexp.MustCompile(`(?i)(?:^|\s)--broadcast(?:\s|$)`)
+
+// parseBroadcastFlag removes --broadcast from a question and reports whether it was there
+func parseBroadcastFlag(text string) (string, bool) {
+	if !broadcastFlagPattern.MatchString(text) {
+		return text, false
+	}
+	return strings.TrimSpace(broadcastFlagPattern.ReplaceAllString(text, " ")), true
+}
+
+// postPlaceholder posts the thinking message in the thread and returns its ts, or "" if
+// placeholders are disabled or the post failed
+func (h *Handler) postPlaceholder(channel, threadID, correlationID string) string {
+	if h.thinkingMessage == "" {
+		return ""
+	}
+
+	ts, err := h.slackClient.IndicateThinking(context.Background(), channel, threadID, h.thinkingMessage)
+	if err != nil {
+		// The answer is still posted normally, including the not_in_channel handling
+		h.logger.Warn("Failed to post thinking placeholder", "error", err, "correlation_id", correlationID)
+		return ""
+	}
+	return ts
+}
+
+// removePlaceholder deletes a thinking placeholder that was not replaced by the answer.
+// A leftover placeholder is only cosmetic, so failures are logged and otherwise ignored.
+func (h *Handler) removePlaceholder(channel, placeholderTS, correlationID string) {
+	if placeholderTS == "" {
+		return
+	}
+	if err := h.slackClient.DeleteMessage(context.Background(), channel, placeholderTS); err != nil {
+		h.logger.Warn("Failed to delete thinking placeholder", "error", err, "correlation_id", correlationID)
+	}
+}
+
+// replyOrUpdate replaces the placeholder with text, or posts text in the thread when
+// there is no placeholder or it can't be updated
+func (h *Handler) replyOrUpdate(channel, placeholderTS, text, threadID, correlationID string) {
+	ctx := context.Background()
+	if placeholderTS != "" {
+		if err := h.slackClient.UpdateMessage(ctx, channel, placeholderTS, text, threadID); err == nil {
+			return
+		}
+	}
+	if _, err := h.slackClient.PostMessage(ctx, channel, text, threadID); err == nil {
+		h.removePlaceholder(channel, placeholderTS, correlationID)
+	}
+}
+
+// deliverAnswer replaces the placeholder with the answer, falling back to posting it
+// as a new message if there is no placeholder or the update fails. Broadcast answers
+// are always posted fresh so they show up in the channel as a new message.
+func (h *Handler) deliverAnswer(ctx context.Context, userID, channel, placeholderTS, text, threadID string, broadcast bool, correlationID string) (string, error) {
+	if placeholderTS != "" && !broadcast {
+		err := h.slackClient.UpdateMessage(ctx, channel, placeholderTS, text, threadID)
+		if err == nil {
+			return placeholderTS, nil
+		}
+		h.logger.Warn("Failed to replace placeholder with answer, posting instead", "error", err, "correlation_id", correlationID)
+	}
+
+	ts, err := h.postAnswer(ctx, userID, channel, text, threadID, broadcast)
+	if err == nil {
+		h.removePlaceholder(channel, placeholderTS, correlationID)
+	}
+	return ts, err
+}
+
+// postAnswer posts an answer in the thread, also sending it to the channel if broadcast
+// is set. If the bot is not a member of the channel it joins and retries when auto-join
+// is enabled, otherwise it sends the user the answer by DM with an explanation. The
+// returned ts is empty when the answer was delivered by DM.
+func (h *Handler) postAnswer(ctx context.Context, userID, channel, text, threadTS string, broadcast bool) (string, error) {
+	post := func() (string, error) {
+		if broadcast {
+			return h.slackClient.PostBroadcastReply(ctx, channel, text, threadTS)
+		}
+		return h.slackClient.PostMessage(ctx, channel, text, threadTS)
+	}
+
+	ts, err := post()
+	if !slack.IsAPIError(err, "not_in_channel") {
+		return ts, err
+	}
+
+	h.logger.Warn("Bot is not in channel", "channel", channel, "auto_join", h.autoJoinChannels)
+
+	if h.autoJoinChannels {
+		joinErr := h.slackClient.JoinChannel(ctx, channel)
+		if joinErr == nil {
+			return post()
+		}
+		// Private channels can't be joined, so fall through to the DM
+		h.logger.Warn("Failed to join channel", "channel", channel, "error", joinErr)
+	}
+
+	dm := fmt.Sprintf("I couldn't reply in <#%s> because I'm not a member of that channel. Invite me with `/invite @Wavie` to get answers there. Here's my answer:\n\n%s", channel, text)
+	if _, dmErr := h.slackClient.PostMessage(ctx, userID, dm); dmErr != nil {
+		return "", fmt.Errorf("failed to post in channel (%w) and to DM user: %v", err, dmErr)
+	}
+
+	return "", nil
+}
+
+// genericErrorMessage is posted when the GPT call fails for reasons other than a timeout
+const genericErrorMessage = "Sorry, I'm having trouble processing your request right now."
+
+// errGPTTimeout is returned when the GPT service reports that the model timed out
+var errGPTTimeout = errors.New("GPT service timed out")
+
+// isTimeoutError reports whether err came from a deadline or timeout rather than a failure
+func isTimeoutError(err error) bool {
+	if errors.Is(err, errGPTTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// errorMessageFor returns the user-facing message for a failed GPT call
+func (h *Handler) errorMessageFor(err error) string {
+	if isTimeoutError(err) {
+		return h.timeoutMessage
+	}
+	return genericErrorMessage
+}
+
+// callGPTService asks the GPT service for an answer, giving up when ctx is done
+func (h *Handler) callGPTService(ctx context.Context, req slack.GPTRequest) (*slack.GPTResponse, error) {
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal GPT request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", h.gptProxyServiceURL+"/api/chat", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", h.gptProxyServiceURL+"/api/chat", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GPT request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(tracing.Header, req.CorrelationID)
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(httpReq)
+	resp, err := h.gptClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call GPT service: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusGatewayTimeout {
+		return nil, errGPTTimeout
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		var errResp slack.GPTResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
+			return nil, fmt.Errorf("GPT service error: %d %s - %s", resp.StatusCode, errResp.Error.Code, errResp.Error.Message)
+		}
 		return nil, fmt.Errorf("GPT service error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -395,16 +791,17 @@ func (h *Handler) callBroadcastService(req slack.BroadcastRequest) {
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(tracing.Header, req.CorrelationID)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	resp, err := h.broadcastClient.Do(httpReq)
 	if err != nil {
 		h.logger.Error("Failed to call broadcast service", "error", err, "correlation_id", req.CorrelationID)
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// 202 means the broadcast was accepted but queued, or held for the daily digest
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
 		body, _ := io.ReadAll(resp.Body)
 		h.logger.Error("Broadcast service error", "status", resp.StatusCode, "body", string(body), "correlation_id", req.CorrelationID)
 		return
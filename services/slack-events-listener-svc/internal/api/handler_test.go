@@ -0,0 +1,596 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/config"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/conversation"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/dedup"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
+)
+
+const (
+	testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+	testBotUserID     = "UWAVIE"
+	testThreadTS      = "1700000000.000100"
+)
+
+// slackCall is one request received by the fake Slack API
+type slackCall struct {
+	Method string
+	Body   string
+}
+
+// fakeUpstreams stands in for Slack and the GPT and broadcast services, recording what
+// the handler sends them
+type fakeUpstreams struct {
+	gptRequests chan slack.GPTRequest
+	broadcasts  chan slack.BroadcastRequest
+	slackCalls  chan slackCall
+
+	mutex sync.Mutex
+	// gptStatus, if set, is returned by the GPT service instead of an answer
+	gptStatus int
+	// outside holds channels the bot isn't a member of, so posts there fail with
+	// not_in_channel; joining fails with joinError if it is set
+	outside   map[string]bool
+	joinError string
+}
+
+// leaveChannel makes posts to channel fail with not_in_channel until the bot joins it
+func (f *fakeUpstreams) leaveChannel(channel, joinError string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.outside[channel] = true
+	f.joinError = joinError
+}
+
+// slackResponse answers a Slack API call as Slack would given the channels the bot is in
+func (f *fakeUpstreams) slackResponse(method, body string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var payload struct {
+		Channel string `json:"channel"`
+	}
+	json.Unmarshal([]byte(body), &payload)
+
+	switch {
+	case method == "conversations.join" && f.joinError != "":
+		return fmt.Sprintf(`{"ok":false,"error":%q}`, f.joinError)
+	case method == "conversations.join":
+		delete(f.outside, payload.Channel)
+	case method == "chat.postMessage" && f.outside[payload.Channel]:
+		return `{"ok":false,"error":"not_in_channel"}`
+	}
+	return `{"ok":true,"channel":"C123","ts":"1700000000.000900"}`
+}
+
+// failGPT makes the fake GPT service respond with status from now on
+func (f *fakeUpstreams) failGPT(status int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.gptStatus = status
+}
+
+// slackTextsUntil collects the text of Slack posts and updates until one contains want
+func (f *fakeUpstreams) slackTextsUntil(t *testing.T, want string) []string {
+	t.Helper()
+
+	var texts []string
+	for {
+		call := receive(t, f.slackCalls, "Slack post containing "+want)
+		var msg struct {
+			Text string `json:"text"`
+		}
+		json.Unmarshal([]byte(call.Body), &msg)
+		texts = append(texts, msg.Text)
+		if strings.Contains(msg.Text, want) {
+			return texts
+		}
+	}
+}
+
+// newTestHandler returns a handler wired to fake upstreams. configure may adjust the
+// config before the handler is built.
+func newTestHandler(t *testing.T, configure func(*config.Config)) (*Handler, *fakeUpstreams, conversation.Store) {
+	t.Helper()
+
+	fakes := &fakeUpstreams{
+		gptRequests: make(chan slack.GPTRequest, 10),
+		broadcasts:  make(chan slack.BroadcastRequest, 10),
+		slackCalls:  make(chan slackCall, 50),
+		outside:     make(map[string]bool),
+	}
+
+	gpt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req slack.GPTRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		fakes.gptRequests <- req
+
+		fakes.mutex.Lock()
+		status := fakes.gptStatus
+		fakes.mutex.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(slack.GPTResponse{
+				CorrelationID: req.CorrelationID,
+				Error:         &slack.ServiceError{Code: "upstream_error", Message: http.StatusText(status)},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(slack.GPTResponse{Response: "Here's how.", CorrelationID: req.CorrelationID})
+	}))
+	t.Cleanup(gpt.Close)
+
+	broadcast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/broadcast" {
+			var req slack.BroadcastRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			fakes.broadcasts <- req
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(broadcast.Close)
+
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		method := strings.TrimPrefix(r.URL.Path, "/")
+		fakes.slackCalls <- slackCall{Method: method, Body: string(body)}
+		fmt.Fprint(w, fakes.slackResponse(method, string(body)))
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	cfg := config.Config{
+		SlackSigningSecret:  testSigningSecret,
+		GPTProxyServiceURL:  gpt.URL,
+		BroadcastServiceURL: broadcast.URL,
+		UpstreamTimeout:     5 * time.Second,
+		BroadcastTimeout:    5 * time.Second,
+		RequestTimeout:      5 * time.Second,
+		DLQRetryDuration:    time.Minute,
+		EnabledEventTypes:   []string{"app_mention", "reaction_added", "message"},
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	slackClient := slack.NewClient("xoxb-test", logger)
+	slackClient.SetAPIURL(slackAPI.URL + "/")
+	store := conversation.NewStore(20, 0, time.Hour)
+
+	return NewHandler(slackClient, dedup.NewMemoryStore(time.Hour), store, testBotUserID, cfg, logger), fakes, store
+}
+
+// signedEvent builds a /slack/events request for event, signed as Slack would
+func signedEvent(t *testing.T, event slack.EventRequest, secret string) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+
+	req := httptest.NewRequest(http.MethodPost, "/slack/events", bytes.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+// mentionEvent is an app_mention of the bot asking text, as a reply in threadTS if set
+func mentionEvent(eventID, text, threadTS string) slack.EventRequest {
+	return slack.EventRequest{
+		Type:    "event_callback",
+		EventID: eventID,
+		Event: slack.Event{
+			Type:     "app_mention",
+			User:     "UASKER",
+			Text:     "<@" + testBotUserID + "> " + text,
+			Channel:  "C123",
+			TS:       "1700000000.000500",
+			ThreadTS: threadTS,
+		},
+	}
+}
+
+// receive waits for a value on ch, failing the test if none arrives in time
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+// expectNone fails the test if a value arrives on ch within a short wait
+func expectNone[T any](t *testing.T, ch <-chan T, what string) {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected %s: %+v", what, v)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestThreadReplyBroadcastIncludesRootQuestion(t *testing.T) {
+	h, fakes, store := newTestHandler(t, nil)
+
+	store.AddMessage(testThreadTS, "user", "How do I connect my Coinbase wallet?")
+	store.AddMessage(testThreadTS, "assistant", "Go to Connections and choose Coinbase.")
+
+	h.handleAppMention(mentionEvent("Ev1", "What about Ledger?", testThreadTS))
+
+	broadcast := receive(t, fakes.broadcasts, "broadcast")
+	if broadcast.Question != "What about Ledger?" {
+		t.Errorf("Question = %q, want the follow-up", broadcast.Question)
+	}
+	if broadcast.RootQuestion != "How do I connect my Coinbase wallet?" {
+		t.Errorf("RootQuestion = %q, want the question that started the thread", broadcast.RootQuestion)
+	}
+}
+
+func TestTopLevelBroadcastHasNoRootQuestion(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+
+	h.handleAppMention(mentionEvent("Ev1", "How do I connect my Coinbase wallet?", ""))
+
+	broadcast := receive(t, fakes.broadcasts, "broadcast")
+	if broadcast.RootQuestion != "" {
+		t.Errorf("RootQuestion = %q, want none for a question that starts a thread", broadcast.RootQuestion)
+	}
+}
+
+func TestStripBotMention(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		botID string
+		want  string
+	}{
+		{"leading", "<@UWAVIE> how do I export?", "UWAVIE", "how do I export?"},
+		{"middle", "hey <@UWAVIE> how do I export?", "UWAVIE", "hey how do I export?"},
+		{"trailing", "how do I export? <@UWAVIE>", "UWAVIE", "how do I export?"},
+		{"with display name", "<@UWAVIE|wavie> how do I export?", "UWAVIE", "how do I export?"},
+		{"other users kept", "<@UWAVIE> ask <@U999> about it", "UWAVIE", "ask <@U999> about it"},
+		{"angle brackets kept", "<@UWAVIE> is a<b and c>d?", "UWAVIE", "is a<b and c>d?"},
+		{"links kept", "<@UWAVIE> see <https://docs.example.com|the docs>", "UWAVIE", "see <https://docs.example.com|the docs>"},
+		{"unknown bot strips leading mention only", "<@U123> ask <@U999>", "", "ask <@U999>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripBotMention(tt.text, tt.botID); got != tt.want {
+				t.Errorf("stripBotMention(%q, %q) = %q, want %q", tt.text, tt.botID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutPostsTimeoutMessage(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.TimeoutMessage = "That took too long, try a simpler question."
+	})
+	fakes.failGPT(http.StatusGatewayTimeout)
+
+	h.handleAppMention(mentionEvent("Ev1", "Explain every report in detail", ""))
+
+	texts := fakes.slackTextsUntil(t, "That took too long")
+	for _, text := range texts {
+		if strings.Contains(text, genericErrorMessage) {
+			t.Errorf("posted the generic error %q for a timeout", text)
+		}
+	}
+	expectNone(t, fakes.broadcasts, "broadcast")
+}
+
+func TestFailurePostsGenericMessage(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.TimeoutMessage = "That took too long, try a simpler question."
+	})
+	fakes.failGPT(http.StatusInternalServerError)
+
+	h.handleAppMention(mentionEvent("Ev1", "How do I connect a wallet?", ""))
+
+	texts := fakes.slackTextsUntil(t, genericErrorMessage)
+	for _, text := range texts {
+		if strings.Contains(text, "That took too long") {
+			t.Errorf("posted the timeout message %q for a server error", text)
+		}
+	}
+}
+
+func TestClientDeadlineCountsAsTimeout(t *testing.T) {
+	if !isTimeoutError(fmt.Errorf("call GPT service: %w", context.DeadlineExceeded)) {
+		t.Error("context.DeadlineExceeded not treated as a timeout")
+	}
+	if isTimeoutError(errors.New("GPT service error: 500")) {
+		t.Error("a server error was treated as a timeout")
+	}
+}
+
+func TestDisabledEventTypesAreSkipped(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.EnabledEventTypes = []string{"reaction_added"}
+	})
+
+	rec := httptest.NewRecorder()
+	h.ProcessEvent(rec, signedEvent(t, mentionEvent("Ev1", "How do I connect a wallet?", ""), testSigningSecret))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want disabled events acknowledged with 200", rec.Code)
+	}
+	expectNone(t, fakes.gptRequests, "GPT request")
+	if !h.dedupStore.MarkIfNew("Ev1") {
+		t.Error("disabled event was recorded as processed")
+	}
+}
+
+func TestEnabledEventTypesAreProcessed(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.EnabledEventTypes = []string{" app_mention "}
+	})
+
+	rec := httptest.NewRecorder()
+	h.ProcessEvent(rec, signedEvent(t, mentionEvent("Ev1", "How do I connect a wallet?", ""), testSigningSecret))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", rec.Code)
+	}
+	if req := receive(t, fakes.gptRequests, "GPT request"); req.Message != "How do I connect a wallet?" {
+		t.Errorf("Message = %q, want the question", req.Message)
+	}
+}
+
+// slackMethods collects the methods of the next n Slack API calls
+func slackMethods(t *testing.T, calls <-chan slackCall, n int) []string {
+	t.Helper()
+
+	methods := make([]string, n)
+	for i := range methods {
+		methods[i] = receive(t, calls, "Slack API call").Method
+	}
+	return methods
+}
+
+func TestNotInChannelJoinsAndRetries(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.AutoJoinChannels = true
+	})
+	fakes.leaveChannel("C123", "")
+
+	ts, err := h.postAnswer(context.Background(), "UASKER", "C123", "Here's how.", testThreadTS, false)
+	if err != nil {
+		t.Fatalf("postAnswer: %v", err)
+	}
+	if ts == "" {
+		t.Error("answer was not posted in the channel")
+	}
+
+	got := slackMethods(t, fakes.slackCalls, 3)
+	want := []string{"chat.postMessage", "conversations.join", "chat.postMessage"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Slack calls = %v, want %v", got, want)
+	}
+	expectNone(t, fakes.slackCalls, "Slack API call")
+}
+
+func TestNotInChannelWithoutAutoJoinSendsDM(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+	fakes.leaveChannel("C123", "")
+
+	ts, err := h.postAnswer(context.Background(), "UASKER", "C123", "Here's how.", testThreadTS, false)
+	if err != nil {
+		t.Fatalf("postAnswer: %v", err)
+	}
+	if ts != "" {
+		t.Errorf("ts = %q, want empty for an answer delivered by DM", ts)
+	}
+
+	receive(t, fakes.slackCalls, "channel post")
+	dm := receive(t, fakes.slackCalls, "DM")
+	if dm.Method != "chat.postMessage" || !strings.Contains(dm.Body, `"channel":"UASKER"`) || !strings.Contains(dm.Body, "Here's how.") {
+		t.Errorf("got %s %s, want the answer sent to the user by DM", dm.Method, dm.Body)
+	}
+}
+
+func TestNotInPrivateChannelFallsBackToDM(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) {
+		cfg.AutoJoinChannels = true
+	})
+	fakes.leaveChannel("C123", "method_not_supported_for_channel_type")
+
+	if _, err := h.postAnswer(context.Background(), "UASKER", "C123", "Here's how.", testThreadTS, false); err != nil {
+		t.Fatalf("postAnswer: %v", err)
+	}
+
+	got := slackMethods(t, fakes.slackCalls, 3)
+	want := []string{"chat.postMessage", "conversations.join", "chat.postMessage"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Slack calls = %v, want %v", got, want)
+	}
+}
+
+func TestRedeliveryAfterRestartIsNotAnsweredTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed-events.log")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	event := mentionEvent("Ev1", "How do I connect a wallet?", "")
+
+	h, fakes, _ := newTestHandler(t, nil)
+	before, err := dedup.NewFileStore(path, time.Hour, logger)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	h.dedupStore = before
+
+	h.ProcessEvent(httptest.NewRecorder(), signedEvent(t, event, testSigningSecret))
+	receive(t, fakes.gptRequests, "GPT request")
+
+	// A new handler loading the same file stands in for the restarted service
+	restarted, fakes, _ := newTestHandler(t, nil)
+	after, err := dedup.NewFileStore(path, time.Hour, logger)
+	if err != nil {
+		t.Fatalf("NewFileStore after restart: %v", err)
+	}
+	restarted.dedupStore = after
+
+	req := signedEvent(t, event, testSigningSecret)
+	req.Header.Set("X-Slack-Retry-Num", "1")
+	req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+	rec := httptest.NewRecorder()
+	restarted.ProcessEvent(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want the redelivery acknowledged with 200", rec.Code)
+	}
+	expectNone(t, fakes.gptRequests, "GPT request for the redelivered event")
+}
+
+func TestSignedMentionIsDispatched(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+
+	rec := httptest.NewRecorder()
+	h.ProcessEvent(rec, signedEvent(t, mentionEvent("Ev1", "How do I connect a wallet?", ""), testSigningSecret))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", rec.Code)
+	}
+	req := receive(t, fakes.gptRequests, "GPT request")
+	if req.Message != "How do I connect a wallet?" || req.UserID != "UASKER" || req.ChannelID != "C123" {
+		t.Errorf("GPT request = %+v, want the parsed mention", req)
+	}
+}
+
+func TestBadSignatureIsRejected(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+
+	rec := httptest.NewRecorder()
+	h.ProcessEvent(rec, signedEvent(t, mentionEvent("Ev1", "How do I connect a wallet?", ""), "not-the-signing-secret"))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401", rec.Code)
+	}
+	expectNone(t, fakes.gptRequests, "GPT request")
+	if !h.dedupStore.MarkIfNew("Ev1") {
+		t.Error("rejected event was recorded as processed")
+	}
+}
+
+// fakeDedup is a dedup.Store recording the events marked through it
+type fakeDedup struct {
+	mutex  sync.Mutex
+	marked map[string]bool
+}
+
+func (d *fakeDedup) MarkIfNew(eventID string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.marked[eventID] {
+		return false
+	}
+	d.marked[eventID] = true
+	return true
+}
+
+func TestEventsAreDeduplicatedThroughTheStore(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+	store := &fakeDedup{marked: map[string]bool{"Ev1": true}}
+	h.dedupStore = store
+
+	h.ProcessEvent(httptest.NewRecorder(), signedEvent(t, mentionEvent("Ev1", "Already answered", ""), testSigningSecret))
+	expectNone(t, fakes.gptRequests, "GPT request for an event the store has seen")
+
+	h.ProcessEvent(httptest.NewRecorder(), signedEvent(t, mentionEvent("Ev2", "How do I connect a wallet?", ""), testSigningSecret))
+	receive(t, fakes.gptRequests, "GPT request for a new event")
+	if store.MarkIfNew("Ev2") {
+		t.Error("new event was not marked in the store")
+	}
+}
+
+func TestSlackRetriesAreAnsweredOnce(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, nil)
+	event := mentionEvent("Ev1", "How do I connect a wallet?", "")
+
+	for retry := 0; retry < 3; retry++ {
+		req := signedEvent(t, event, testSigningSecret)
+		if retry > 0 {
+			req.Header.Set("X-Slack-Retry-Num", strconv.Itoa(retry))
+			req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+		}
+		rec := httptest.NewRecorder()
+		h.ProcessEvent(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("delivery %d got %d, want 200", retry, rec.Code)
+		}
+	}
+
+	receive(t, fakes.gptRequests, "GPT request")
+	expectNone(t, fakes.gptRequests, "GPT request for a retried delivery")
+}
+
+func TestMentionsFromBotsAreIgnored(t *testing.T) {
+	tests := map[string]func(*slack.EventRequest){
+		"other bot":    func(e *slack.EventRequest) { e.Event.BotID = "BOTHER" },
+		"our own post": func(e *slack.EventRequest) { e.Event.User = testBotUserID },
+	}
+
+	for name, fromBot := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, fakes, _ := newTestHandler(t, nil)
+
+			event := mentionEvent("Ev1", "How do I connect a wallet?", "")
+			fromBot(&event)
+			rec := httptest.NewRecorder()
+			h.ProcessEvent(rec, signedEvent(t, event, testSigningSecret))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got %d, want the event acknowledged with 200", rec.Code)
+			}
+			expectNone(t, fakes.gptRequests, "GPT request for a bot's mention")
+			expectNone(t, fakes.slackCalls, "Slack call for a bot's mention")
+		})
+	}
+}
+
+func TestMentionsOverUserRateLimitSkipGPT(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, func(cfg *config.Config) { cfg.UserRateLimit = 2 })
+
+	for i := 1; i <= 3; i++ {
+		event := mentionEvent(fmt.Sprintf("Ev%d", i), "How do I connect a wallet?", "")
+		h.ProcessEvent(httptest.NewRecorder(), signedEvent(t, event, testSigningSecret))
+	}
+
+	receive(t, fakes.gptRequests, "first GPT request")
+	receive(t, fakes.gptRequests, "second GPT request")
+	fakes.slackTextsUntil(t, rateLimitedMessage)
+	expectNone(t, fakes.gptRequests, "GPT request over the rate limit")
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
+)
+
+// defaultHomeMarkdown is shown in the Home tab unless HOME_VIEW_PATH replaces it
+const defaultHomeMarkdown = `# 👋 Hi, I'm Wavie
+I answer questions about Bitwave using the Bitwave documentation.
+
+## How to ask
+- Mention *@Wavie* in a channel with your question, and I'll answer in a thread
+- Reply in that thread to ask follow-ups; no need to mention me again
+- Add *--broadcast* to a question to also send my answer to the channel
+
+## Example questions
+- How do I connect a wallet?
+- How do I export transactions for my accountant?
+- What does the inventory view show?
+
+## Feedback
+- React with 👍 or 👎 to tell us whether an answer helped
+- Reply in the thread starting with *** to leave detailed feedback`
+
+// SetHomeView replaces the default Home tab content with markdown
+func (h *Handler) SetHomeView(markdown string) {
+	h.homeView = slack.NewHomeView(markdown)
+}
+
+// handleAppHomeOpened publishes the Home tab when a user opens it, unless they already
+// have the current version
+func (h *Handler) handleAppHomeOpened(eventReq slack.EventRequest) {
+	if eventReq.Event.Tab != "home" {
+		return
+	}
+	if current := eventReq.Event.View; current != nil && current.PrivateMetadata == h.homeView.PrivateMetadata {
+		h.logger.Debug("Home view unchanged, not republishing", "user", eventReq.Event.User)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.slackClient.PublishHomeView(ctx, eventReq.Event.User, h.homeView); err != nil {
+		h.logger.Error("Failed to publish home view", "error", err, "user", eventReq.Event.User)
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// LimitBody caps request bodies at maxBytes so an oversized POST cannot exhaust memory.
+// Reading past the limit fails with an error that isBodyTooLarge recognizes.
+func LimitBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err came from reading past LimitBody's limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/idgen"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/conversation"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
+)
+
+// Quick actions that can be mapped to reaction emoji via REACTION_ACTIONS
+const (
+	actionRegenerate = "regenerate"
+	actionExpand     = "expand"
+	actionSave       = "save"
+)
+
+// expandPrompt is sent as the follow-up question for the expand action
+const expandPrompt = "Please expand on your previous answer with more detail and examples."
+
+// regenerateHint is added to a question re-asked after a 👎 on its answer
+const regenerateHint = "A previous answer to this question was marked unhelpful. Try again, more carefully: double-check it against the documentation and say clearly if you are unsure."
+
+// regenerateOnNegative re-asks the question behind an answer that got a 👎, with
+// regenerateHint, and posts the new answer in the thread. Each question is regenerated
+// at most once, so further 👎s on either answer don't keep regenerating it.
+func (h *Handler) regenerateOnNegative(eventReq slack.EventRequest) {
+	threadID, ok := h.conversationStore.GetAnswerThread(eventReq.Event.Item.TS)
+	if !ok {
+		return
+	}
+
+	history := h.conversationStore.GetMessages(threadID)
+	idx := lastMessageIndex(history, "user")
+	if idx < 0 {
+		h.logger.Info("No question found to regenerate", "thread_id", threadID)
+		return
+	}
+	question := history[idx].Content
+
+	// Kept in the dedup store so replicas agree and the marker expires with event IDs
+	sum := sha256.Sum256([]byte(threadID + "\x00" + question))
+	key := "regenerate:" + hex.EncodeToString(sum[:])
+	if !h.dedupStore.MarkIfNew(key) {
+		h.logger.Info("Answer already regenerated after negative feedback, skipping", "thread_id", threadID)
+		return
+	}
+
+	correlationID, err := idgen.GenerateId("wv", 16)
+	if err != nil {
+		h.logger.Error("Failed to generate correlation ID", "error", err)
+		return
+	}
+
+	h.logger.Info("Regenerating answer after negative feedback",
+		"correlation_id", correlationID,
+		"user", eventReq.Event.User,
+		"thread_id", threadID)
+
+	h.answerInThread(eventReq.Event.User, eventReq.Event.Item.Channel, threadID, question+"\n\n"+regenerateHint, history[:idx], false, correlationID)
+}
+
+// handleQuickAction runs the action mapped to a reaction on one of Wavie's answers
+func (h *Handler) handleQuickAction(eventReq slack.EventRequest, action string) {
+	channel := eventReq.Event.Item.Channel
+	threadID, ok := h.conversationStore.GetAnswerThread(eventReq.Event.Item.TS)
+	if !ok {
+		h.logger.Debug("Reaction is not on a tracked Wavie answer, ignoring",
+			"reaction", eventReq.Event.Reaction,
+			"message_ts", eventReq.Event.Item.TS)
+		return
+	}
+
+	history := h.conversationStore.GetMessages(threadID)
+
+	correlationID, err := idgen.GenerateId("wv", 16)
+	if err != nil {
+		h.logger.Error("Failed to generate correlation ID", "error", err)
+		return
+	}
+
+	h.logger.Info("Processing quick action",
+		"action", action,
+		"correlation_id", correlationID,
+		"user", eventReq.Event.User,
+		"thread_id", threadID)
+
+	switch action {
+	case actionRegenerate:
+		idx := lastMessageIndex(history, "user")
+		if idx < 0 {
+			h.logger.Info("No question found to regenerate", "thread_id", threadID)
+			return
+		}
+		h.answerInThread(eventReq.Event.User, channel, threadID, history[idx].Content, history[:idx], false, correlationID)
+
+	case actionExpand:
+		h.answerInThread(eventReq.Event.User, channel, threadID, expandPrompt, history, true, correlationID)
+
+	case actionSave:
+		idx := lastMessageIndex(history, "assistant")
+		if idx < 0 {
+			return
+		}
+		// Posting to the user ID delivers the saved answer to their DM with the app
+		text := "🔖 Saved answer from <#" + channel + ">:\n\n" + history[idx].Content
+		if _, err := h.slackClient.PostMessage(context.Background(), eventReq.Event.User, text); err != nil {
+			h.logger.Error("Failed to save answer for user", "error", err, "correlation_id", correlationID)
+		}
+
+	default:
+		h.logger.Warn("Unknown quick action configured", "action", action, "reaction", eventReq.Event.Reaction)
+	}
+}
+
+// answerInThread asks the GPT service the given question with prior history and posts
+// the answer in the thread. recordQuestion controls whether the question is stored as
+// a new user turn (false when re-asking a question that is already in the history).
+func (h *Handler) answerInThread(userID, channel, threadID, question string, prior []conversation.Message, recordQuestion bool, correlationID string) {
+	gptReq := slack.GPTRequest{
+		Message:             question,
+		UserID:              userID,
+		ChannelID:           channel,
+		ThreadTS:            threadID,
+		ConversationHistory: toConversationHistory(prior),
+		CorrelationID:       correlationID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+
+	placeholderTS := h.postPlaceholder(channel, threadID, correlationID)
+
+	gptResp, err := h.callGPTService(ctx, gptReq)
+	if err != nil {
+		h.logger.Error("Failed to run quick action", "error", err, "correlation_id", correlationID)
+		h.replyOrUpdate(channel, placeholderTS, h.errorMessageFor(err), threadID, correlationID)
+		return
+	}
+
+	if gptResp.Error != nil {
+		h.logger.Error("GPT service returned error", "code", gptResp.Error.Code, "error", gptResp.Error.Message, "correlation_id", correlationID)
+		h.replyOrUpdate(channel, placeholderTS, "Sorry, I couldn't do that right now.", threadID, correlationID)
+		return
+	}
+
+	if recordQuestion {
+		h.conversationStore.AddMessage(threadID, "user", question)
+	}
+	h.conversationStore.AddMessage(threadID, "assistant", gptResp.Response)
+
+	answerTS, err := h.deliverAnswer(context.Background(), userID, channel, placeholderTS, gptResp.Response, threadID, h.replyBroadcast, correlationID)
+	if err != nil {
+		h.logger.Error("Failed to post response to Slack", "error", err, "correlation_id", correlationID)
+		h.deadLetterQueue.Add(channel, gptResp.Response, threadID, correlationID)
+		return
+	}
+	if answerTS != "" {
+		h.conversationStore.RecordAnswer(threadID, answerTS, correlationID)
+	}
+
+	go h.callBroadcastService(slack.BroadcastRequest{
+		UserID:           userID,
+		ChannelID:        channel,
+		ThreadID:         threadID,
+		Question:         question,
+		Response:         gptResp.Response,
+		SourceDocs:       gptResp.SourceDocs,
+		Timestamp:        time.Now(),
+		CorrelationID:    correlationID,
+		PromptTokens:     gptResp.PromptTokens,
+		CompletionTokens: gptResp.CompletionTokens,
+		TotalTokens:      gptResp.TotalTokens,
+	})
+}
+
+// lastMessageIndex returns the index of the last message with the given role, or -1
+func lastMessageIndex(messages []conversation.Message, role string) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// toConversationHistory converts stored messages into the GPT request format
+func toConversationHistory(messages []conversation.Message) []slack.ConversationMessage {
+	history := make([]slack.ConversationMessage, 0, len(messages))
+	for _, msg := range messages {
+		history = append(history, slack.ConversationMessage{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	return history
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/config"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/conversation"
+	"github.com/orephillips/wavie-claude-bot/services/slack-events-listener-svc/internal/slack"
+)
+
+const testAnswerTS = "1700000000.000200"
+
+// reactionEvent is a reaction_added of reaction on the answer posted at testAnswerTS
+func reactionEvent(reaction string) slack.EventRequest {
+	return slack.EventRequest{
+		Type:    "event_callback",
+		EventID: "EvReaction",
+		Event: slack.Event{
+			Type:     "reaction_added",
+			User:     "UASKER",
+			Reaction: reaction,
+			Item:     slack.Item{Type: "message", Channel: "C123", TS: testAnswerTS},
+		},
+	}
+}
+
+// withReactionActions maps :repeat: to regenerate and :memo: to expand
+func withReactionActions(cfg *config.Config) {
+	cfg.ReactionActions = map[string]string{"repeat": actionRegenerate, "memo": actionExpand}
+}
+
+func TestRegenerateReactionReasksLastQuestion(t *testing.T) {
+	h, fakes, store := newTestHandler(t, withReactionActions)
+
+	store.AddMessage(testThreadTS, "user", "How do I connect my Coinbase wallet?")
+	store.AddMessage(testThreadTS, "assistant", "Go to Connections.")
+	store.RecordAnswer(testThreadTS, testAnswerTS, "corr_original")
+
+	h.handleReactionAdded(reactionEvent("repeat"))
+
+	req := receive(t, fakes.gptRequests, "GPT request")
+	if req.Message != "How do I connect my Coinbase wallet?" {
+		t.Errorf("Message = %q, want the last question re-asked", req.Message)
+	}
+	if len(req.ConversationHistory) != 0 {
+		t.Errorf("sent %d history messages, want only those before the question", len(req.ConversationHistory))
+	}
+	if req.ThreadTS != testThreadTS || req.CorrelationID == "corr_original" {
+		t.Errorf("got thread %q correlation %q, want the answer's thread and a new correlation ID", req.ThreadTS, req.CorrelationID)
+	}
+
+	receive(t, fakes.broadcasts, "broadcast")
+	messages := store.GetMessages(testThreadTS)
+	if users := countRole(messages, "user"); users != 1 {
+		t.Errorf("thread has %d user turns, want the re-asked question not stored again", users)
+	}
+	if last := messages[len(messages)-1]; last.Role != "assistant" || last.Content != "Here's how." {
+		t.Errorf("last turn = %+v, want the regenerated answer", last)
+	}
+}
+
+func TestExpandReactionSendsExpandPromptWithHistory(t *testing.T) {
+	h, fakes, store := newTestHandler(t, withReactionActions)
+
+	store.AddMessage(testThreadTS, "user", "How do I connect my Coinbase wallet?")
+	store.AddMessage(testThreadTS, "assistant", "Go to Connections.")
+	store.RecordAnswer(testThreadTS, testAnswerTS, "corr_original")
+
+	h.handleReactionAdded(reactionEvent("memo"))
+
+	req := receive(t, fakes.gptRequests, "GPT request")
+	if req.Message != expandPrompt {
+		t.Errorf("Message = %q, want the expand prompt", req.Message)
+	}
+	if len(req.ConversationHistory) != 2 {
+		t.Errorf("sent %d history messages, want the whole thread", len(req.ConversationHistory))
+	}
+}
+
+func TestReactionOnUntrackedMessageIsIgnored(t *testing.T) {
+	h, fakes, _ := newTestHandler(t, withReactionActions)
+
+	h.handleReactionAdded(reactionEvent("repeat"))
+
+	expectNone(t, fakes.gptRequests, "GPT request")
+	for len(fakes.slackCalls) > 0 {
+		if call := <-fakes.slackCalls; strings.HasPrefix(call.Method, "chat.") {
+			t.Errorf("unexpected Slack call %s", call.Method)
+		}
+	}
+}
+
+func countRole(messages []conversation.Message, role string) int {
+	n := 0
+	for _, msg := range messages {
+		if msg.Role == role {
+			n++
+		}
+	}
+	return n
+}
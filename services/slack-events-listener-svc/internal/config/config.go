@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Config struct {
 	LogLevel string `envconfig:"LOG_LEVEL" default:"info"`
 	Port     int    `envconfig:"PORT" default:"8080"`
@@ -9,4 +11,83 @@ type Config struct {
 
 	GPTProxyServiceURL  string `envconfig:"GPT_PROXY_SERVICE_URL" required:"true"`
 	BroadcastServiceURL string `envconfig:"BROADCAST_SERVICE_URL" required:"true"`
+
+	// UpstreamTimeout bounds each call to the GPT service and BroadcastTimeout each call
+	// to the broadcast service
+	UpstreamTimeout  time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"60s"`
+	BroadcastTimeout time.Duration `envconfig:"BROADCAST_TIMEOUT" default:"30s"`
+	// RequestTimeout bounds answering one question, from receiving the event to the GPT
+	// service replying; past it TimeoutMessage is posted instead
+	RequestTimeout time.Duration `envconfig:"REQUEST_TIMEOUT" default:"75s"`
+
+	// ServerReadTimeout and ServerWriteTimeout bound reading a request and writing its response
+	ServerReadTimeout  time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"120s"`
+	ServerWriteTimeout time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"120s"`
+
+	// MaxRequestBodyBytes is the largest request body accepted; larger ones get a 413
+	MaxRequestBodyBytes int64 `envconfig:"MAX_REQUEST_BODY_BYTES" default:"4194304"`
+
+	// DLQRetryDuration is how long failed answer posts keep being redelivered
+	DLQRetryDuration time.Duration `envconfig:"DLQ_RETRY_DURATION" default:"15m"`
+
+	// ReactionActions maps reaction names on Wavie answers to quick actions (regenerate, expand, save)
+	ReactionActions map[string]string `envconfig:"REACTION_ACTIONS" default:"repeat:regenerate,memo:expand,bookmark:save"`
+
+	// TimeoutMessage is posted when the model takes too long to answer
+	TimeoutMessage string `envconfig:"TIMEOUT_MESSAGE" default:"That took too long to answer. Please try again with a simpler or more specific question."`
+
+	// ThinkingMessage is posted right away and replaced by the answer; empty disables it
+	ThinkingMessage string `envconfig:"THINKING_MESSAGE" default:"_Wavie is thinking…_"`
+
+	// UserRateLimit is how many questions each user may ask per minute; 0 disables the limit
+	UserRateLimit int `envconfig:"USER_RATE_LIMIT" default:"5"`
+
+	// EnabledEventTypes lists the Slack event types that are processed; others are ignored
+	EnabledEventTypes []string `envconfig:"ENABLED_EVENT_TYPES" default:"app_mention,reaction_added,message,app_home_opened"`
+
+	// HomeViewPath is a Markdown file shown in the app's Home tab; empty uses the built-in
+	// help text
+	HomeViewPath string `envconfig:"HOME_VIEW_PATH"`
+
+	// BlockKitAnswers posts answers as Block Kit blocks so Markdown headers, tables and
+	// rules render properly instead of as raw text
+	BlockKitAnswers bool `envconfig:"BLOCK_KIT_ANSWERS" default:"false"`
+
+	// RegenerateOnNegative answers again, more carefully, when someone reacts 👎 to a Wavie
+	// answer. Each question is regenerated at most once.
+	RegenerateOnNegative bool `envconfig:"REGENERATE_ON_NEGATIVE" default:"false"`
+
+	// ReplyBroadcast also sends every threaded answer to the channel. Without it, users
+	// can ask for this per question by including --broadcast.
+	ReplyBroadcast bool `envconfig:"REPLY_BROADCAST" default:"false"`
+
+	// ReanswerEdits answers again when a user edits the latest question in a thread Wavie
+	// answered; otherwise the edit only corrects the question kept in the thread's history
+	ReanswerEdits bool `envconfig:"REANSWER_EDITS" default:"false"`
+
+	// AutoJoinChannels lets the bot join public channels it was mentioned in but isn't a member of
+	AutoJoinChannels bool `envconfig:"AUTO_JOIN_CHANNELS" default:"false"`
+
+	// DedupBackend selects where processed event IDs are kept: memory, file or redis
+	DedupBackend string `envconfig:"DEDUP_BACKEND" default:"memory"`
+	// DedupFilePath is the file used by the file backend
+	DedupFilePath string `envconfig:"DEDUP_FILE_PATH" default:"processed-events.log"`
+	// ConversationBackend selects where thread history is kept: memory, or redis to share
+	// it across replicas
+	ConversationBackend string `envconfig:"CONVERSATION_BACKEND" default:"memory"`
+	// ConversationMaxMessages caps the messages kept per thread, and ConversationMaxAge is
+	// how long a thread's history survives without activity
+	ConversationMaxMessages int           `envconfig:"CONVERSATION_MAX_MESSAGES" default:"20"`
+	ConversationMaxAge      time.Duration `envconfig:"CONVERSATION_MAX_AGE" default:"1h"`
+	// ConversationTokenBudget caps the estimated tokens of history kept per thread, so long
+	// threads don't overflow the model's context window; 0 disables it
+	ConversationTokenBudget int `envconfig:"CONVERSATION_TOKEN_BUDGET" default:"6000"`
+	// ConversationSummarize folds trimmed turns into a summary at the head of the history
+	// instead of dropping them; the summary uses part of the token budget
+	ConversationSummarize bool `envconfig:"CONVERSATION_SUMMARIZE" default:"false"`
+	// RedisAddr and RedisPassword configure the redis backends
+	RedisAddr     string `envconfig:"REDIS_ADDR" default:"localhost:6379"`
+	RedisPassword string `envconfig:"REDIS_PASSWORD"`
+	// DedupTTL is how long processed event IDs are remembered; Slack stops retrying within an hour
+	DedupTTL time.Duration `envconfig:"DEDUP_TTL" default:"2h"`
 }
@@ -0,0 +1,235 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisConversationPrefix = "conv:"
+	redisAnswerPrefix       = "conv:answer:"
+	redisTimeout            = 2 * time.Second
+)
+
+// RedisStore keeps conversations in Redis as JSON under conv:{threadID}, expiring after
+// maxAge without activity, so every replica sees the same thread history. Redis errors
+// are logged and treated as an empty conversation so an outage degrades to answering
+// without context rather than not answering.
+type RedisStore struct {
+	client      *redis.Client
+	maxMessages int
+	maxTokens   int
+	maxAge      time.Duration
+	summarizer  Summarizer
+	logger      *slog.Logger
+}
+
+// NewRedisStore connects to the Redis server at addr. Every command the store sends is
+// a GET or an unconditional SET, so the client's retries on connection errors are safe.
+func NewRedisStore(addr, password string, maxMessages, maxTokens int, maxAge time.Duration, logger *slog.Logger) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{
+		client:      client,
+		maxMessages: maxMessages,
+		maxTokens:   maxTokens,
+		maxAge:      maxAge,
+		logger:      logger,
+	}, nil
+}
+
+// GetOrCreate retrieves an existing conversation context or creates a new one. The
+// returned context is a copy; use AddMessage to change it.
+func (s *RedisStore) GetOrCreate(threadID string) *ConversationContext {
+	context, ok := s.load(threadID)
+	if !ok {
+		context = &ConversationContext{
+			ThreadID: threadID,
+			Messages: []Message{},
+		}
+	}
+
+	context.LastAccessed = time.Now()
+	s.save(context)
+	return context
+}
+
+// AddMessage adds a message to a conversation context, trimming it to maxMessages and
+// the token budget and summarizing what's dropped if enabled. Concurrent writes to the
+// same thread from different replicas are last-writer-wins, which is fine as Slack
+// delivers a thread's messages one at a time.
+func (s *RedisStore) AddMessage(threadID, role, content string) {
+	context, ok := s.load(threadID)
+	if !ok {
+		context = &ConversationContext{
+			ThreadID: threadID,
+			Messages: []Message{},
+		}
+	}
+
+	context.Messages = append(context.Messages, Message{
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now(),
+	})
+	messages, err := compactMessages(context.Messages, s.maxMessages, s.maxTokens, s.summarizer)
+	if err != nil {
+		s.logger.Error("Failed to summarize conversation", "thread_id", threadID, "error", err)
+	}
+	context.Messages = messages
+	context.LastAccessed = time.Now()
+
+	s.save(context)
+}
+
+// ReplaceMessage changes the content of the latest message with role and oldContent in
+// a thread that has not expired, reporting whether one was found
+func (s *RedisStore) ReplaceMessage(threadID, role, oldContent, newContent string) bool {
+	context, ok := s.load(threadID)
+	if !ok || !replaceMessage(context.Messages, role, oldContent, newContent) {
+		return false
+	}
+
+	s.save(context)
+	return true
+}
+
+// GetMessages returns all messages for a thread, or empty slice if not found or expired
+func (s *RedisStore) GetMessages(threadID string) []Message {
+	context, ok := s.load(threadID)
+	if !ok {
+		return []Message{}
+	}
+	return context.Messages
+}
+
+// GetRootMessage returns the first message with the given role in a thread
+func (s *RedisStore) GetRootMessage(threadID, role string) (Message, bool) {
+	return rootMessage(s.GetMessages(threadID), role)
+}
+
+// HasAnswered reports whether the bot has answered in the thread and the conversation
+// has not expired
+func (s *RedisStore) HasAnswered(threadID string) bool {
+	_, ok := s.GetRootMessage(threadID, "assistant")
+	return ok
+}
+
+// RecordAnswer remembers that the bot message with the given ts answered in threadID as
+// part of the interaction with correlationID
+func (s *RedisStore) RecordAnswer(threadID, messageTS, correlationID string) {
+	data, err := json.Marshal(Answer{ThreadID: threadID, CorrelationID: correlationID})
+	if err != nil {
+		s.logger.Error("Failed to encode answer", "thread_id", threadID, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, redisAnswerPrefix+messageTS, data, s.maxAge).Err(); err != nil {
+		s.logger.Error("Failed to record answer in redis", "thread_id", threadID, "message_ts", messageTS, "error", err)
+	}
+
+	if context, ok := s.load(threadID); ok {
+		context.LastCorrelationID = correlationID
+		s.save(context)
+	}
+}
+
+// GetAnswerThread returns the thread a bot answer belongs to, if it is still tracked
+func (s *RedisStore) GetAnswerThread(messageTS string) (string, bool) {
+	answer, ok := s.loadAnswer(messageTS)
+	return answer.ThreadID, ok
+}
+
+// GetAnswerCorrelationID returns the correlation ID of the interaction that produced a
+// bot answer, if it is still tracked
+func (s *RedisStore) GetAnswerCorrelationID(messageTS string) (string, bool) {
+	answer, ok := s.loadAnswer(messageTS)
+	return answer.CorrelationID, ok && answer.CorrelationID != ""
+}
+
+// GetLastCorrelationID returns the correlation ID of the bot's latest answer in a thread
+// that has not expired
+func (s *RedisStore) GetLastCorrelationID(threadID string) (string, bool) {
+	context, ok := s.load(threadID)
+	if !ok || context.LastCorrelationID == "" {
+		return "", false
+	}
+	return context.LastCorrelationID, true
+}
+
+// Stats only names the backend: Redis enforces maxAge itself by expiring keys, so
+// nothing is reset on access, and counting conversations would mean scanning every key
+func (s *RedisStore) Stats() Stats {
+	return Stats{Backend: "redis"}
+}
+
+func (s *RedisStore) loadAnswer(messageTS string) (Answer, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, redisAnswerPrefix+messageTS).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			s.logger.Error("Failed to look up answer in redis", "message_ts", messageTS, "error", err)
+		}
+		return Answer{}, false
+	}
+
+	var answer Answer
+	if err := json.Unmarshal(data, &answer); err != nil {
+		s.logger.Error("Failed to decode answer from redis", "message_ts", messageTS, "error", err)
+		return Answer{}, false
+	}
+	return answer, true
+}
+
+func (s *RedisStore) load(threadID string) (*ConversationContext, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, redisConversationPrefix+threadID).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			s.logger.Error("Failed to load conversation from redis", "thread_id", threadID, "error", err)
+		}
+		return nil, false
+	}
+
+	var conversation ConversationContext
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		s.logger.Error("Failed to decode conversation from redis", "thread_id", threadID, "error", err)
+		return nil, false
+	}
+	return &conversation, true
+}
+
+func (s *RedisStore) save(conversation *ConversationContext) {
+	data, err := json.Marshal(conversation)
+	if err != nil {
+		s.logger.Error("Failed to encode conversation", "thread_id", conversation.ThreadID, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, redisConversationPrefix+conversation.ThreadID, data, s.maxAge).Err(); err != nil {
+		s.logger.Error("Failed to save conversation to redis", "thread_id", conversation.ThreadID, "error", err)
+	}
+}
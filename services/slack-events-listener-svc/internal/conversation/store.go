@@ -1,8 +1,12 @@
 package conversation
 
 import (
+	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 // Message represents a single message in a conversation
@@ -10,6 +14,8 @@ type Message struct {
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	// Summary marks a message condensed from older turns by a Summarizer
+	Summary bool `json:"summary,omitempty"`
 }
 
 // ConversationContext holds the conversation history for a specific thread
@@ -17,21 +23,66 @@ type ConversationContext struct {
 	ThreadID     string    `json:"thread_id"`
 	Messages     []Message `json:"messages"`
 	LastAccessed time.Time `json:"last_accessed"`
+	// LastCorrelationID is the correlation ID of the bot's latest answer in the thread
+	LastCorrelationID string `json:"last_correlation_id,omitempty"`
 }
 
-// Store manages conversation contexts with thread-based storage
-type Store struct {
+// Answer records which thread and interaction a bot answer message belongs to
+type Answer struct {
+	ThreadID      string `json:"thread_id"`
+	CorrelationID string `json:"correlation_id"`
+}
+
+// Store keeps per-thread conversation history and which bot messages answered which
+// thread
+type Store interface {
+	GetOrCreate(threadID string) *ConversationContext
+	AddMessage(threadID, role, content string)
+	ReplaceMessage(threadID, role, oldContent, newContent string) bool
+	GetMessages(threadID string) []Message
+	GetRootMessage(threadID, role string) (Message, bool)
+	HasAnswered(threadID string) bool
+	RecordAnswer(threadID, messageTS, correlationID string)
+	GetAnswerThread(messageTS string) (string, bool)
+	GetAnswerCorrelationID(messageTS string) (string, bool)
+	GetLastCorrelationID(threadID string) (string, bool)
+	Stats() Stats
+}
+
+// Stats describes what a Store holds, for sizing maxMessages and maxAge
+type Stats struct {
+	Backend             string `json:"backend"`
+	ActiveConversations int    `json:"active_conversations"`
+	TotalMessages       int    `json:"total_messages"`
+	// OldestLastAccessed is when the least recently used conversation was last touched;
+	// one far older than maxAge means cleanup is falling behind
+	OldestLastAccessed *time.Time `json:"oldest_last_accessed,omitempty"`
+	// ExpiredResets counts conversations GetOrCreate found past maxAge and emptied
+	ExpiredResets int64 `json:"expired_resets"`
+}
+
+// MemoryStore keeps conversations in memory; they are lost on restart and not shared
+// between replicas
+type MemoryStore struct {
 	conversations map[string]*ConversationContext
+	answers       map[string]Answer // keyed by bot answer message ts
 	mutex         sync.RWMutex
 	maxMessages   int
+	maxTokens     int
 	maxAge        time.Duration
+	summarizer    Summarizer
+	logger        *slog.Logger
+	expiredResets atomic.Int64
 }
 
-// NewStore creates a new conversation store with specified limits
-func NewStore(maxMessages int, maxAge time.Duration) *Store {
-	store := &Store{
+// NewStore creates an in-memory conversation store with specified limits. A maxTokens
+// of zero or less disables the token budget.
+func NewStore(maxMessages, maxTokens int, maxAge time.Duration) *MemoryStore {
+	store := &MemoryStore{
 		conversations: make(map[string]*ConversationContext),
+		answers:       make(map[string]Answer),
 		maxMessages:   maxMessages,
+		maxTokens:     maxTokens,
 		maxAge:        maxAge,
 	}
 
@@ -42,7 +93,7 @@ func NewStore(maxMessages int, maxAge time.Duration) *Store {
 }
 
 // GetOrCreate retrieves an existing conversation context or creates a new one
-func (s *Store) GetOrCreate(threadID string) *ConversationContext {
+func (s *MemoryStore) GetOrCreate(threadID string) *ConversationContext {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -59,14 +110,35 @@ func (s *Store) GetOrCreate(threadID string) *ConversationContext {
 	// Check if context is too old
 	if time.Since(context.LastAccessed) > s.maxAge {
 		context.Messages = []Message{} // Reset if older than max age
+		s.expiredResets.Add(1)
 	}
 
 	context.LastAccessed = time.Now()
 	return context
 }
 
+// Stats counts the conversations held, including expired ones cleanup hasn't removed yet
+func (s *MemoryStore) Stats() Stats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := Stats{
+		Backend:             "memory",
+		ActiveConversations: len(s.conversations),
+		ExpiredResets:       s.expiredResets.Load(),
+	}
+	for _, context := range s.conversations {
+		stats.TotalMessages += len(context.Messages)
+		if stats.OldestLastAccessed == nil || context.LastAccessed.Before(*stats.OldestLastAccessed) {
+			lastAccessed := context.LastAccessed
+			stats.OldestLastAccessed = &lastAccessed
+		}
+	}
+	return stats
+}
+
 // AddMessage adds a message to a conversation context
-func (s *Store) AddMessage(threadID, role, content string) {
+func (s *MemoryStore) AddMessage(threadID, role, content string) {
 	context := s.GetOrCreate(threadID)
 
 	s.mutex.Lock()
@@ -79,14 +151,29 @@ func (s *Store) AddMessage(threadID, role, content string) {
 		Timestamp: time.Now(),
 	})
 
-	// Limit to max messages
-	if len(context.Messages) > s.maxMessages {
-		context.Messages = context.Messages[len(context.Messages)-s.maxMessages:]
+	// Limit to max messages and token budget, summarizing what's dropped if enabled
+	messages, err := compactMessages(context.Messages, s.maxMessages, s.maxTokens, s.summarizer)
+	if err != nil && s.logger != nil {
+		s.logger.Error("Failed to summarize conversation", "thread_id", threadID, "error", err)
+	}
+	context.Messages = messages
+}
+
+// ReplaceMessage changes the content of the latest message with role and oldContent in
+// a thread that has not expired, reporting whether one was found
+func (s *MemoryStore) ReplaceMessage(threadID, role, oldContent, newContent string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	context, exists := s.conversations[threadID]
+	if !exists || time.Since(context.LastAccessed) > s.maxAge {
+		return false
 	}
+	return replaceMessage(context.Messages, role, oldContent, newContent)
 }
 
 // GetMessages returns all messages for a thread, or empty slice if not found or expired
-func (s *Store) GetMessages(threadID string) []Message {
+func (s *MemoryStore) GetMessages(threadID string) []Message {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -103,8 +190,62 @@ func (s *Store) GetMessages(threadID string) []Message {
 	return context.Messages
 }
 
+// GetRootMessage returns the first message with the given role in a thread, which
+// for user messages is the question that started the conversation
+func (s *MemoryStore) GetRootMessage(threadID, role string) (Message, bool) {
+	return rootMessage(s.GetMessages(threadID), role)
+}
+
+// HasAnswered reports whether the bot has answered in the thread and the conversation
+// has not expired, meaning follow-ups there are addressed to the bot
+func (s *MemoryStore) HasAnswered(threadID string) bool {
+	_, ok := s.GetRootMessage(threadID, "assistant")
+	return ok
+}
+
+// RecordAnswer remembers that the bot message with the given ts answered in threadID as
+// part of the interaction with correlationID
+func (s *MemoryStore) RecordAnswer(threadID, messageTS, correlationID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.answers[messageTS] = Answer{ThreadID: threadID, CorrelationID: correlationID}
+	if context, exists := s.conversations[threadID]; exists {
+		context.LastCorrelationID = correlationID
+	}
+}
+
+// GetAnswerThread returns the thread a bot answer belongs to, if it is still tracked
+func (s *MemoryStore) GetAnswerThread(messageTS string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	answer, exists := s.answers[messageTS]
+	return answer.ThreadID, exists
+}
+
+// GetAnswerCorrelationID returns the correlation ID of the interaction that produced a
+// bot answer, if it is still tracked
+func (s *MemoryStore) GetAnswerCorrelationID(messageTS string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	answer, exists := s.answers[messageTS]
+	return answer.CorrelationID, exists && answer.CorrelationID != ""
+}
+
+// GetLastCorrelationID returns the correlation ID of the bot's latest answer in a thread
+// that has not expired
+func (s *MemoryStore) GetLastCorrelationID(threadID string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	context, exists := s.conversations[threadID]
+	if !exists || time.Since(context.LastAccessed) > s.maxAge || context.LastCorrelationID == "" {
+		return "", false
+	}
+	return context.LastCorrelationID, true
+}
+
 // cleanupRoutine periodically removes old conversations
-func (s *Store) cleanupRoutine() {
+func (s *MemoryStore) cleanupRoutine() {
 	ticker := time.NewTicker(15 * time.Minute)
 	defer ticker.Stop()
 
@@ -114,7 +255,7 @@ func (s *Store) cleanupRoutine() {
 }
 
 // cleanup removes conversations older than maxAge
-func (s *Store) cleanup() {
+func (s *MemoryStore) cleanup() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -123,4 +264,89 @@ func (s *Store) cleanup() {
 			delete(s.conversations, threadID)
 		}
 	}
+
+	for messageTS, answer := range s.answers {
+		if _, exists := s.conversations[answer.ThreadID]; !exists {
+			delete(s.answers, messageTS)
+		}
+	}
+}
+
+// replaceMessage changes the content of the latest message with role and oldContent
+func replaceMessage(messages []Message, role, oldContent, newContent string) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == role && messages[i].Content == oldContent {
+			messages[i].Content = newContent
+			return true
+		}
+	}
+	return false
+}
+
+// rootMessage returns the first message with the given role
+func rootMessage(messages []Message, role string) (Message, bool) {
+	for _, msg := range messages {
+		if msg.Role == role {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// trimMessages keeps only the newest maxMessages messages, then drops the oldest until
+// the estimated total fits within maxTokens. The newest message is always kept, even
+// if it alone is over budget.
+func trimMessages(messages []Message, maxMessages, maxTokens int) []Message {
+	if len(messages) > maxMessages {
+		messages = messages[len(messages)-maxMessages:]
+	}
+	if maxTokens <= 0 {
+		return messages
+	}
+
+	total := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += estimateTokens(messages[i].Content)
+		if total > maxTokens && i < len(messages)-1 {
+			return messages[i+1:]
+		}
+	}
+	return messages
+}
+
+// estimateTokens approximates a message's token count at four characters per token,
+// plus a few for the role and message framing GPT adds
+func estimateTokens(content string) int {
+	return (utf8.RuneCountInString(content)+3)/4 + 4
+}
+
+// Options configures the store created by New
+type Options struct {
+	Backend       string // memory or redis
+	RedisAddr     string
+	RedisPassword string
+	MaxMessages   int
+	MaxTokens     int
+	MaxAge        time.Duration
+	Summarizer    Summarizer // optional; trimmed turns are summarized instead of dropped
+}
+
+// New creates the store selected by opts.Backend
+func New(opts Options, logger *slog.Logger) (Store, error) {
+	switch opts.Backend {
+	case "", "memory":
+		store := NewStore(opts.MaxMessages, opts.MaxTokens, opts.MaxAge)
+		store.summarizer = opts.Summarizer
+		store.logger = logger
+		return store, nil
+	case "redis":
+		store, err := NewRedisStore(opts.RedisAddr, opts.RedisPassword, opts.MaxMessages, opts.MaxTokens, opts.MaxAge, logger)
+		if err != nil {
+			return nil, err
+		}
+		store.summarizer = opts.Summarizer
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown conversation backend %q", opts.Backend)
+	}
 }
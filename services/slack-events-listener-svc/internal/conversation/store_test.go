@@ -0,0 +1,73 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// totalTokens is the estimated token count of messages
+func totalTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content)
+	}
+	return total
+}
+
+func TestLongHistoryIsTrimmedToTokenBudget(t *testing.T) {
+	store := NewStore(20, 1000, time.Hour)
+
+	// Each turn is about 300 tokens, so 20 of them are far over the budget
+	for i := 1; i <= 20; i++ {
+		store.AddMessage("T1", "user", fmt.Sprintf("turn %d: %s", i, strings.Repeat("ledger ", 170)))
+	}
+
+	messages := store.GetMessages("T1")
+	if got := totalTokens(messages); got > 1000 {
+		t.Errorf("history is %d tokens, want at most the 1000 token budget", got)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("kept %d messages, want the 3 newest that fit", len(messages))
+	}
+	for i, msg := range messages {
+		if want := fmt.Sprintf("turn %d:", 18+i); !strings.HasPrefix(msg.Content, want) {
+			t.Errorf("message %d starts %.10q, want %q", i, msg.Content, want)
+		}
+	}
+}
+
+func TestOversizedNewestMessageIsKept(t *testing.T) {
+	store := NewStore(20, 100, time.Hour)
+	store.AddMessage("T1", "user", "How do I connect a wallet?")
+	store.AddMessage("T1", "assistant", strings.Repeat("Open Settings and choose Wallets. ", 50))
+
+	messages := store.GetMessages("T1")
+	if len(messages) != 1 || messages[0].Role != "assistant" {
+		t.Errorf("got %d messages, want only the newest, over-budget answer", len(messages))
+	}
+}
+
+func TestMessageCapAppliesWithinTokenBudget(t *testing.T) {
+	store := NewStore(4, 1000, time.Hour)
+	for i := 1; i <= 10; i++ {
+		store.AddMessage("T1", "user", fmt.Sprintf("question %d", i))
+	}
+
+	messages := store.GetMessages("T1")
+	if len(messages) != 4 || messages[0].Content != "question 7" {
+		t.Errorf("got %+v, want questions 7 to 10", messages)
+	}
+}
+
+func TestZeroTokenBudgetOnlyCapsMessages(t *testing.T) {
+	store := NewStore(20, 0, time.Hour)
+	for i := 1; i <= 5; i++ {
+		store.AddMessage("T1", "user", strings.Repeat("ledger ", 1000))
+	}
+
+	if got := len(store.GetMessages("T1")); got != 5 {
+		t.Errorf("kept %d messages, want all 5 with the token budget disabled", got)
+	}
+}
@@ -0,0 +1,112 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// summaryHeader starts every summary message so the model reads it as context rather
+// than something it said
+const summaryHeader = "Summary of earlier conversation:"
+
+// maxSummaryChars caps a summary message; older detail is dropped first, except for the
+// opening line, which usually states the original problem
+const maxSummaryChars = 2000
+
+// summaryLineChars caps how much of each message the extractive summary keeps
+const summaryLineChars = 200
+
+// Summarizer condenses conversation turns that are about to be trimmed. messages are
+// oldest first and may begin with the previous summary, so implementations can fold it
+// into the new one.
+type Summarizer interface {
+	Summarize(messages []Message) (string, error)
+}
+
+// ExtractiveSummarizer summarizes by keeping the first sentence of each message. It makes
+// no model call, so the only cost is the summary's tokens in later requests.
+type ExtractiveSummarizer struct{}
+
+// Summarize implements Summarizer
+func (ExtractiveSummarizer) Summarize(messages []Message) (string, error) {
+	lines := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Summary {
+			body := strings.TrimPrefix(msg.Content, summaryHeader)
+			for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					lines = append(lines, line)
+				}
+			}
+			continue
+		}
+
+		speaker := "User"
+		if msg.Role == "assistant" {
+			speaker = "Wavie"
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s", speaker, firstSentence(msg.Content, summaryLineChars)))
+	}
+
+	// Keep the opening line and the newest lines, dropping from the middle
+	for len(lines) > 2 && len(strings.Join(lines, "\n")) > maxSummaryChars {
+		lines = append(lines[:1], lines[2:]...)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// firstSentence returns text up to its first sentence end or line break, cut to at most
+// limit runes
+func firstSentence(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, "\n"); i >= 0 {
+		text = text[:i]
+	}
+	for _, end := range []string{". ", "? ", "! "} {
+		if i := strings.Index(text, end); i >= 0 {
+			text = text[:i+1]
+		}
+	}
+
+	if runes := []rune(text); len(runes) > limit {
+		text = strings.TrimSpace(string(runes[:limit])) + "…"
+	}
+	return text
+}
+
+// compactMessages trims messages to the limits. With a summarizer, the dropped messages
+// are folded into one summary message at the head, and the limits reserve room for it.
+// If summarizing fails, the messages are trimmed as usual and the error returned.
+func compactMessages(messages []Message, maxMessages, maxTokens int, summarizer Summarizer) ([]Message, error) {
+	if summarizer == nil || maxMessages < 2 {
+		return trimMessages(messages, maxMessages, maxTokens), nil
+	}
+
+	keptTokens := maxTokens
+	if maxTokens > 0 {
+		keptTokens = max(maxTokens-estimateTokens(summaryHeader)-maxSummaryChars/4, 1)
+	}
+	kept := trimMessages(messages, maxMessages-1, keptTokens)
+	if len(kept) == len(messages) {
+		return kept, nil
+	}
+
+	dropped := messages[:len(messages)-len(kept)]
+	summary, err := summarizer.Summarize(dropped)
+	if err != nil {
+		return trimMessages(messages, maxMessages, maxTokens), err
+	}
+	if runes := []rune(summary); len(runes) > maxSummaryChars {
+		summary = string(runes[:maxSummaryChars])
+	}
+
+	compacted := make([]Message, 0, len(kept)+1)
+	compacted = append(compacted, Message{
+		Role:      "assistant",
+		Content:   summaryHeader + "\n" + summary,
+		Timestamp: dropped[len(dropped)-1].Timestamp,
+		Summary:   true,
+	})
+	return append(compacted, kept...), nil
+}
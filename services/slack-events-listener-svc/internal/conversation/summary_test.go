@@ -0,0 +1,112 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubSummarizer records the messages it is asked to summarize and returns a fixed
+// summary, or err if set
+type stubSummarizer struct {
+	calls [][]Message
+	err   error
+}
+
+func (s *stubSummarizer) Summarize(messages []Message) (string, error) {
+	s.calls = append(s.calls, append([]Message(nil), messages...))
+	if s.err != nil {
+		return "", s.err
+	}
+	return fmt.Sprintf("summary of %d messages", len(messages)), nil
+}
+
+func newSummarizingStore(maxMessages int, summarizer Summarizer) *MemoryStore {
+	store := NewStore(maxMessages, 0, time.Hour)
+	store.summarizer = summarizer
+	return store
+}
+
+func TestTrimmedTurnsAreSummarizedAtHead(t *testing.T) {
+	summarizer := &stubSummarizer{}
+	store := newSummarizingStore(4, summarizer)
+	for i := 1; i <= 5; i++ {
+		store.AddMessage("T1", "user", fmt.Sprintf("question %d", i))
+	}
+
+	messages := store.GetMessages("T1")
+	if len(messages) != 4 {
+		t.Fatalf("kept %d messages, want 4 including the summary", len(messages))
+	}
+	head := messages[0]
+	if !head.Summary || head.Content != summaryHeader+"\nsummary of 2 messages" {
+		t.Errorf("head = %+v, want a summary of the 2 dropped questions", head)
+	}
+	if messages[1].Content != "question 3" || messages[3].Content != "question 5" {
+		t.Errorf("kept %+v, want questions 3 to 5 after the summary", messages[1:])
+	}
+
+	dropped := summarizer.calls[len(summarizer.calls)-1]
+	if dropped[len(dropped)-1].Content != "question 2" {
+		t.Errorf("summarized %+v, want it to end with question 2", dropped)
+	}
+}
+
+func TestPreviousSummaryIsFoldedIntoNext(t *testing.T) {
+	summarizer := &stubSummarizer{}
+	store := newSummarizingStore(4, summarizer)
+	for i := 1; i <= 6; i++ {
+		store.AddMessage("T1", "user", fmt.Sprintf("question %d", i))
+	}
+
+	last := summarizer.calls[len(summarizer.calls)-1]
+	if !last[0].Summary {
+		t.Errorf("summarized %+v, want the previous summary passed first", last)
+	}
+	if n := len(store.GetMessages("T1")); n != 4 {
+		t.Errorf("kept %d messages, want 4", n)
+	}
+}
+
+func TestFailedSummaryFallsBackToTrimming(t *testing.T) {
+	store := newSummarizingStore(4, &stubSummarizer{err: errors.New("model unavailable")})
+	for i := 1; i <= 5; i++ {
+		store.AddMessage("T1", "user", fmt.Sprintf("question %d", i))
+	}
+
+	messages := store.GetMessages("T1")
+	if len(messages) != 4 || messages[0].Summary || messages[0].Content != "question 2" {
+		t.Errorf("got %+v, want questions 2 to 5 without a summary", messages)
+	}
+}
+
+func TestExtractiveSummarizerKeepsFirstSentences(t *testing.T) {
+	summary, err := ExtractiveSummarizer{}.Summarize([]Message{
+		{Role: "assistant", Content: summaryHeader + "\n- User: My invoice sync fails.", Summary: true},
+		{Role: "user", Content: "It fails for Xero. The error says unauthorized."},
+		{Role: "assistant", Content: "Reconnect Xero from Settings.\nThen retry the sync."},
+	})
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+
+	want := "- User: My invoice sync fails.\n- User: It fails for Xero.\n- Wavie: Reconnect Xero from Settings."
+	if summary != want {
+		t.Errorf("summary =\n%s\nwant\n%s", summary, want)
+	}
+}
+
+func TestExtractiveSummaryKeepsOpeningLineWhenCapped(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "My invoice sync fails."}}
+	for i := 0; i < 30; i++ {
+		messages = append(messages, Message{Role: "assistant", Content: strings.Repeat("Try again later ", 20)})
+	}
+
+	summary, _ := ExtractiveSummarizer{}.Summarize(messages)
+	if len(summary) > maxSummaryChars || !strings.HasPrefix(summary, "- User: My invoice sync fails.") {
+		t.Errorf("summary is %d chars starting %.40q, want at most %d starting with the opening question",
+			len(summary), summary, maxSummaryChars)
+	}
+}
@@ -0,0 +1,141 @@
+package deadletter
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 2 * time.Minute
+	pollInterval   = time.Second
+)
+
+// Message is a Slack post that failed and is waiting to be redelivered
+type Message struct {
+	Channel       string
+	Text          string
+	ThreadTS      string
+	CorrelationID string
+	FirstFailed   time.Time
+	Attempts      int
+	NextAttempt   time.Time
+}
+
+// DeliverFunc attempts to post a message to Slack
+type DeliverFunc func(ctx context.Context, channel, text, threadTS string) error
+
+// Queue holds failed posts and redelivers them in the background with exponential
+// backoff until they succeed or have been failing for longer than maxRetryDuration
+type Queue struct {
+	messages         []*Message
+	mutex            sync.Mutex
+	deliver          DeliverFunc
+	maxRetryDuration time.Duration
+	logger           *slog.Logger
+}
+
+// NewQueue creates a dead-letter queue and starts its retry routine
+func NewQueue(deliver DeliverFunc, maxRetryDuration time.Duration, logger *slog.Logger) *Queue {
+	q := &Queue{
+		messages:         make([]*Message, 0),
+		deliver:          deliver,
+		maxRetryDuration: maxRetryDuration,
+		logger:           logger,
+	}
+
+	// Start retry routine
+	go q.retryRoutine()
+
+	return q
+}
+
+// Add queues a failed post for redelivery
+func (q *Queue) Add(channel, text, threadTS, correlationID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	q.messages = append(q.messages, &Message{
+		Channel:       channel,
+		Text:          text,
+		ThreadTS:      threadTS,
+		CorrelationID: correlationID,
+		FirstFailed:   now,
+		Attempts:      1,
+		NextAttempt:   now.Add(initialBackoff),
+	})
+
+	q.logger.Warn("Added message to dead-letter queue", "correlation_id", correlationID, "depth", len(q.messages))
+}
+
+// Depth returns the number of messages waiting for redelivery
+func (q *Queue) Depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.messages)
+}
+
+// retryRoutine periodically attempts redelivery of due messages
+func (q *Queue) retryRoutine() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		q.retryDue(time.Now())
+	}
+}
+
+// retryDue attempts every message whose backoff has elapsed, dropping the ones that
+// have exceeded the retry duration
+func (q *Queue) retryDue(now time.Time) {
+	q.mutex.Lock()
+	due := make([]*Message, 0)
+	remaining := make([]*Message, 0, len(q.messages))
+	for _, msg := range q.messages {
+		switch {
+		case now.Sub(msg.FirstFailed) > q.maxRetryDuration:
+			q.logger.Error("Giving up on dead-letter message",
+				"correlation_id", msg.CorrelationID,
+				"attempts", msg.Attempts)
+		case !msg.NextAttempt.After(now):
+			due = append(due, msg)
+		default:
+			remaining = append(remaining, msg)
+		}
+	}
+	q.messages = remaining
+	q.mutex.Unlock()
+
+	for _, msg := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := q.deliver(ctx, msg.Channel, msg.Text, msg.ThreadTS)
+		cancel()
+
+		if err == nil {
+			q.logger.Info("Redelivered dead-letter message",
+				"correlation_id", msg.CorrelationID,
+				"attempts", msg.Attempts+1)
+			continue
+		}
+
+		msg.Attempts++
+		backoff := initialBackoff << (msg.Attempts - 1)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		msg.NextAttempt = time.Now().Add(backoff)
+
+		q.logger.Warn("Dead-letter redelivery failed",
+			"correlation_id", msg.CorrelationID,
+			"attempts", msg.Attempts,
+			"next_attempt_in", backoff.String(),
+			"error", err)
+
+		q.mutex.Lock()
+		q.messages = append(q.messages, msg)
+		q.mutex.Unlock()
+	}
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDeliverer fails the first failures deliveries, then records the rest
+type fakeDeliverer struct {
+	mutex     sync.Mutex
+	failures  int
+	attempts  int
+	delivered []string
+}
+
+func (d *fakeDeliverer) deliver(ctx context.Context, channel, text, threadTS string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.attempts++
+	if d.attempts <= d.failures {
+		return errors.New("channel_not_found")
+	}
+	d.delivered = append(d.delivered, channel+":"+text+":"+threadTS)
+	return nil
+}
+
+func newTestQueue(d *fakeDeliverer, maxRetryDuration time.Duration) *Queue {
+	return NewQueue(d.deliver, maxRetryDuration, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestRedeliversOnceBackoffElapses(t *testing.T) {
+	d := &fakeDeliverer{}
+	q := newTestQueue(d, time.Hour)
+	q.Add("C123", "Here's how.", "1700000000.000100", "corr_1")
+
+	q.retryDue(time.Now())
+	if d.attempts != 0 {
+		t.Fatalf("redelivered before the initial backoff elapsed")
+	}
+
+	q.retryDue(time.Now().Add(initialBackoff))
+	if len(d.delivered) != 1 || d.delivered[0] != "C123:Here's how.:1700000000.000100" {
+		t.Fatalf("delivered %v, want the queued answer in its thread", d.delivered)
+	}
+	if q.Depth() != 0 {
+		t.Errorf("depth = %d after redelivery, want 0", q.Depth())
+	}
+}
+
+func TestFailedRedeliveryBacksOffExponentially(t *testing.T) {
+	d := &fakeDeliverer{failures: 2}
+	q := newTestQueue(d, time.Hour)
+	q.Add("C123", "Here's how.", "", "corr_1")
+
+	q.retryDue(time.Now().Add(initialBackoff))
+	if q.Depth() != 1 {
+		t.Fatalf("depth = %d after a failed redelivery, want it requeued", q.Depth())
+	}
+
+	msg := q.messages[0]
+	if msg.Attempts != 2 {
+		t.Errorf("attempts = %d, want 2", msg.Attempts)
+	}
+	if wait := time.Until(msg.NextAttempt); wait <= initialBackoff || wait > 2*initialBackoff {
+		t.Errorf("next attempt in %v, want about %v", wait, 2*initialBackoff)
+	}
+
+	q.retryDue(time.Now().Add(2 * initialBackoff))
+	q.retryDue(time.Now().Add(4 * initialBackoff))
+	if len(d.delivered) != 1 || q.Depth() != 0 {
+		t.Errorf("delivered %d with depth %d, want delivered on the third attempt", len(d.delivered), q.Depth())
+	}
+}
+
+func TestGivesUpAfterMaxRetryDuration(t *testing.T) {
+	d := &fakeDeliverer{}
+	q := newTestQueue(d, time.Minute)
+	q.Add("C123", "Here's how.", "", "corr_1")
+
+	q.retryDue(time.Now().Add(2 * time.Minute))
+
+	if d.attempts != 0 {
+		t.Errorf("attempted %d redeliveries past the retry duration, want none", d.attempts)
+	}
+	if q.Depth() != 0 {
+		t.Errorf("depth = %d, want the expired message dropped", q.Depth())
+	}
+}
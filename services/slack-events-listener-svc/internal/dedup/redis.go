@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "wavie:event:"
+	redisTimeout   = 2 * time.Second
+)
+
+// RedisStore keeps processed event IDs in Redis with a TTL, so dedup survives restarts
+// and is shared across replicas
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+	logger *slog.Logger
+}
+
+// NewRedisStore connects to the Redis server at addr. Commands are never retried: if a
+// SET NX reaches the server but its reply is lost, resending it would find the key and
+// drop the event as a duplicate.
+func NewRedisStore(addr, password string, ttl time.Duration, logger *slog.Logger) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:       addr,
+		Password:   password,
+		MaxRetries: -1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{
+		client: client,
+		ttl:    ttl,
+		logger: logger,
+	}, nil
+}
+
+// MarkIfNew sets the event's key until the TTL expires, only if it doesn't exist (SET NX).
+// Redis errors are logged and treated as new so an outage doesn't stop the bot from
+// answering.
+func (s *RedisStore) MarkIfNew(eventID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	set, err := s.client.SetNX(ctx, redisKeyPrefix+eventID, "1", s.ttl).Result()
+	if err != nil {
+		s.logger.Error("Failed to mark processed event in redis", "event_id", eventID, "error", err)
+		return true
+	}
+	return set
+}
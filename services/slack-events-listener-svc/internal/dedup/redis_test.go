@@ -0,0 +1,202 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis stand-in supporting the PING and SET commands the store uses.
+// Anything else, such as the client's HELLO handshake, gets an error reply.
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	expiries map[string]time.Time
+	conns    []net.Conn
+	sets     int
+	// dropSetReplies applies each SET but closes the connection instead of replying
+	dropSetReplies bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{listener: listener, expiries: make(map[string]time.Time)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mutex.Lock()
+			f.conns = append(f.conns, conn)
+			f.mutex.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.listener.Addr().String() }
+
+// stop shuts the server down and drops every client connection
+func (f *fakeRedis) stop() {
+	f.listener.Close()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// ttl returns how long key has left, or 0 if it doesn't exist
+func (f *fakeRedis) ttl(key string) time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return time.Until(f.expiries[key]).Round(time.Second)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		reply := f.reply(args)
+
+		f.mutex.Lock()
+		drop := f.dropSetReplies && strings.EqualFold(args[0], "SET")
+		f.mutex.Unlock()
+		if drop {
+			return
+		}
+		fmt.Fprint(conn, reply)
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SET":
+		// Only the SET key value EX seconds NX form is supported
+		f.sets++
+		if time.Now().Before(f.expiries[args[1]]) {
+			return "$-1\r\n"
+		}
+		seconds, _ := strconv.Atoi(args[4])
+		f.expiries[args[1]] = time.Now().Add(time.Duration(seconds) * time.Second)
+		return "+OK\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// readCommand reads one RESP array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func newTestRedisStore(t *testing.T, addr string) *RedisStore {
+	t.Helper()
+
+	s, err := NewRedisStore(addr, "", 2*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	return s
+}
+
+func TestRedisStoreMarksWithTTL(t *testing.T) {
+	redis := newFakeRedis(t)
+	s := newTestRedisStore(t, redis.addr())
+
+	if !s.MarkIfNew("Ev1") {
+		t.Fatal("first delivery is not new")
+	}
+	if s.MarkIfNew("Ev1") {
+		t.Error("second delivery is new")
+	}
+	if got := redis.ttl(redisKeyPrefix + "Ev1"); got != 2*time.Hour {
+		t.Errorf("key TTL = %v, want 2h", got)
+	}
+}
+
+func TestRedisStoreIsSharedAcrossReplicas(t *testing.T) {
+	redis := newFakeRedis(t)
+	first := newTestRedisStore(t, redis.addr())
+	second := newTestRedisStore(t, redis.addr())
+
+	first.MarkIfNew("Ev1")
+	if second.MarkIfNew("Ev1") {
+		t.Error("event marked by one replica is not seen by another")
+	}
+}
+
+func TestRedisStoreOutageTreatsEventsAsUnseen(t *testing.T) {
+	redis := newFakeRedis(t)
+	s := newTestRedisStore(t, redis.addr())
+	s.MarkIfNew("Ev1")
+
+	redis.stop()
+
+	if !s.MarkIfNew("Ev1") {
+		t.Error("event not new while redis is unreachable, want it answered rather than dropped")
+	}
+}
+
+func TestRedisStoreDoesNotResendALostSet(t *testing.T) {
+	redis := newFakeRedis(t)
+	s := newTestRedisStore(t, redis.addr())
+
+	redis.mutex.Lock()
+	redis.dropSetReplies = true
+	redis.mutex.Unlock()
+
+	if !s.MarkIfNew("Ev1") {
+		t.Error("event not new after its SET reply was lost, want it answered rather than dropped")
+	}
+
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	if redis.sets != 1 {
+		t.Errorf("server received %d SETs, want the lost one not resent", redis.sets)
+	}
+}
@@ -0,0 +1,236 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cleanupInterval = 5 * time.Minute
+
+// Store records which Slack event IDs have already been processed
+type Store interface {
+	// MarkIfNew records the event as processed, returning false if it already was. The
+	// check and the write are one step, so concurrent deliveries can't both see it as new.
+	MarkIfNew(eventID string) bool
+}
+
+// MemoryStore keeps processed event IDs in memory; they are lost on restart
+type MemoryStore struct {
+	events map[string]time.Time
+	ttl    time.Duration
+	mutex  sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory store whose entries expire after ttl
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		events: make(map[string]time.Time),
+		ttl:    ttl,
+	}
+
+	// Start cleanup routine
+	go s.cleanupRoutine()
+
+	return s
+}
+
+// MarkIfNew records the event as processed unless it was already marked within the TTL
+func (s *MemoryStore) MarkIfNew(eventID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.markIfNew(eventID, time.Now())
+	return ok
+}
+
+// markIfNew sets and returns the event's expiry, reporting false if the event was already
+// marked. Callers must hold the mutex.
+func (s *MemoryStore) markIfNew(eventID string, now time.Time) (time.Time, bool) {
+	if expiry, ok := s.events[eventID]; ok && now.Before(expiry) {
+		return expiry, false
+	}
+	expiry := now.Add(s.ttl)
+	s.events[eventID] = expiry
+	return expiry, true
+}
+
+func (s *MemoryStore) cleanupRoutine() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		now := time.Now()
+		for eventID, expiry := range s.events {
+			if now.After(expiry) {
+				delete(s.events, eventID)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// FileStore keeps processed event IDs in memory and appends them to a file so they
+// survive restarts. The file is local to one instance; use RedisStore to share
+// processed events across replicas.
+type FileStore struct {
+	*MemoryStore
+	path   string
+	file   *os.File
+	logger *slog.Logger
+}
+
+// NewFileStore loads unexpired event IDs from path and opens it for appending
+func NewFileStore(path string, ttl time.Duration, logger *slog.Logger) (*FileStore, error) {
+	memory := &MemoryStore{
+		events: make(map[string]time.Time),
+		ttl:    ttl,
+	}
+
+	if err := memory.load(path); err != nil {
+		return nil, fmt.Errorf("failed to load dedup file: %w", err)
+	}
+
+	s := &FileStore{
+		MemoryStore: memory,
+		path:        path,
+		logger:      logger,
+	}
+
+	// Rewrite the file without expired entries before appending to it
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("failed to compact dedup file: %w", err)
+	}
+
+	logger.Info("Loaded processed events from file", "path", path, "count", len(memory.events))
+
+	// Start cleanup routine
+	go s.cleanupRoutine()
+
+	return s, nil
+}
+
+// MarkIfNew records the event as processed and persists it, unless it was already marked
+func (s *FileStore) MarkIfNew(eventID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expiry, ok := s.markIfNew(eventID, time.Now())
+	if !ok {
+		return false
+	}
+
+	if _, err := fmt.Fprintf(s.file, "%s\t%d\n", eventID, expiry.Unix()); err != nil {
+		s.logger.Error("Failed to persist processed event", "event_id", eventID, "error", err)
+	}
+	return true
+}
+
+func (s *MemoryStore) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		eventID, expiryStr, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		unix, err := strconv.ParseInt(expiryStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		if expiry := time.Unix(unix, 0); expiry.After(now) {
+			s.events[eventID] = expiry
+		}
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the file with only the unexpired entries and reopens it for appending.
+// Callers must hold the mutex or be the only user of the store.
+func (s *FileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for eventID, expiry := range s.events {
+		fmt.Fprintf(writer, "%s\t%d\n", eventID, expiry.Unix())
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	return err
+}
+
+func (s *FileStore) cleanupRoutine() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		now := time.Now()
+		for eventID, expiry := range s.events {
+			if now.After(expiry) {
+				delete(s.events, eventID)
+			}
+		}
+		if err := s.compact(); err != nil {
+			s.logger.Error("Failed to compact dedup file", "path", s.path, "error", err)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Options configures the store created by New
+type Options struct {
+	Backend       string // memory, file or redis
+	FilePath      string
+	RedisAddr     string
+	RedisPassword string
+	TTL           time.Duration
+}
+
+// New creates the store selected by opts.Backend
+func New(opts Options, logger *slog.Logger) (Store, error) {
+	switch opts.Backend {
+	case "", "memory":
+		return NewMemoryStore(opts.TTL), nil
+	case "file":
+		return NewFileStore(opts.FilePath, opts.TTL, logger)
+	case "redis":
+		return NewRedisStore(opts.RedisAddr, opts.RedisPassword, opts.TTL, logger)
+	default:
+		return nil, fmt.Errorf("unknown dedup backend %q", opts.Backend)
+	}
+}
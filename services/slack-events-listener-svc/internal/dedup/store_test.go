@@ -0,0 +1,88 @@
+package dedup
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestFileStore(t *testing.T, path string, ttl time.Duration) *FileStore {
+	t.Helper()
+
+	s, err := NewFileStore(path, ttl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	t.Cleanup(func() { s.file.Close() })
+	return s
+}
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed-events.log")
+
+	before := newTestFileStore(t, path, time.Hour)
+	before.MarkIfNew("Ev1")
+
+	after := newTestFileStore(t, path, time.Hour)
+	if after.MarkIfNew("Ev1") {
+		t.Error("event marked before the restart is new after it")
+	}
+	if !after.MarkIfNew("Ev2") {
+		t.Error("unmarked event is not new")
+	}
+}
+
+func TestFileStoreDropsExpiredEventsOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "processed-events.log")
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	live := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	if err := os.WriteFile(path, []byte("Ev1\t"+expired+"\nEv2\t"+live+"\nmalformed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestFileStore(t, path, time.Hour)
+	if len(s.events) != 1 {
+		t.Errorf("loaded %d events, want 1", len(s.events))
+	}
+	if !s.MarkIfNew("Ev1") {
+		t.Error("expired event is not new")
+	}
+	if s.MarkIfNew("Ev2") {
+		t.Error("unexpired event is new")
+	}
+}
+
+func TestNewRejectsUnknownBackend(t *testing.T) {
+	if _, err := New(Options{Backend: "memcached"}, slog.Default()); err == nil {
+		t.Error("want an error for an unknown backend")
+	}
+}
+
+func TestMemoryStoreMarksConcurrentDeliveriesOnce(t *testing.T) {
+	s := NewMemoryStore(time.Hour)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	newCount := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.MarkIfNew("Ev1") {
+				mutex.Lock()
+				newCount++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if newCount != 1 {
+		t.Errorf("%d concurrent deliveries were new, want 1", newCount)
+	}
+}
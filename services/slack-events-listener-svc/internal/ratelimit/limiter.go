@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket holds the tokens left for one key and when they were last refilled
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// Limiter is an in-memory token bucket per key (a Slack user ID). Each key may burst up
+// to perMinute requests, refilling continuously at perMinute per minute.
+type Limiter struct {
+	buckets   map[string]*bucket
+	mutex     sync.Mutex
+	perMinute float64
+}
+
+// NewLimiter creates a limiter allowing perMinute requests per key. A perMinute of zero
+// or less disables limiting.
+func NewLimiter(perMinute int) *Limiter {
+	limiter := &Limiter{
+		buckets:   make(map[string]*bucket),
+		perMinute: float64(perMinute),
+	}
+
+	// Start cleanup routine
+	if perMinute > 0 {
+		go limiter.cleanupRoutine()
+	}
+
+	return limiter
+}
+
+// Allow takes a token for key if one is available
+func (l *Limiter) Allow(key string) bool {
+	return l.allow(key, time.Now())
+}
+
+func (l *Limiter) allow(key string, now time.Time) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: l.perMinute, lastRefill: now}
+		l.buckets[key] = b
+	}
+
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Minutes()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed * l.perMinute
+	if b.tokens > l.perMinute {
+		b.tokens = l.perMinute
+	}
+	b.lastRefill = now
+}
+
+// cleanupRoutine periodically removes buckets that have refilled completely
+func (l *Limiter) cleanupRoutine() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.cleanup(time.Now())
+	}
+}
+
+// cleanup drops full buckets, which behave the same as a key that was never seen
+func (l *Limiter) cleanup(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.perMinute {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowsBurstThenRefills(t *testing.T) {
+	l := NewLimiter(5)
+	start := time.Now()
+
+	for i := 1; i <= 5; i++ {
+		if !l.allow("U1", start) {
+			t.Fatalf("request %d denied, want the first 5 allowed", i)
+		}
+	}
+	if l.allow("U1", start) {
+		t.Fatal("request 6 allowed, want it over the limit")
+	}
+	if !l.allow("U2", start) {
+		t.Error("another user was limited by U1's requests")
+	}
+
+	// 5 per minute refills one token every 12 seconds
+	if l.allow("U1", start.Add(11*time.Second)) {
+		t.Error("allowed after 11s, want a token only after 12s")
+	}
+	if !l.allow("U1", start.Add(12500*time.Millisecond)) {
+		t.Error("denied after 12.5s, want one refilled token")
+	}
+	if l.allow("U1", start.Add(12500*time.Millisecond)) {
+		t.Error("allowed twice after 12.5s, want only one refilled token")
+	}
+}
+
+func TestLimiterZeroRateIsUnlimited(t *testing.T) {
+	l := NewLimiter(0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if !l.allow("U1", now) {
+			t.Fatalf("request %d denied with limiting disabled", i+1)
+		}
+	}
+}
+
+func TestCleanupDropsOnlyFullBuckets(t *testing.T) {
+	l := NewLimiter(5)
+	start := time.Now()
+	l.allow("U1", start)
+	l.allow("U2", start.Add(50*time.Second))
+
+	l.cleanup(start.Add(time.Minute))
+
+	if _, ok := l.buckets["U1"]; ok {
+		t.Error("U1's bucket refilled but was kept")
+	}
+	if _, ok := l.buckets["U2"]; !ok {
+		t.Error("U2's bucket is still refilling but was dropped")
+	}
+}
@@ -0,0 +1,228 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Slack rejects messages with more than maxBlocks blocks and section text longer than
+// maxBlockChars
+const (
+	maxBlocks     = 50
+	maxBlockChars = 3000
+)
+
+// Block is a Block Kit layout block. Only section and divider blocks are produced.
+type Block struct {
+	Type string      `json:"type"`
+	Text *TextObject `json:"text,omitempty"`
+}
+
+// TextObject is the text of a section block
+type TextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func sectionBlock(text string) Block {
+	return Block{Type: "section", Text: &TextObject{Type: "mrkdwn", Text: text}}
+}
+
+func dividerBlock() Block {
+	return Block{Type: "divider"}
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*$`)
+	bulletPattern    = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	boldPattern      = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	strikePattern    = regexp.MustCompile(`~~(.+?)~~`)
+	linkPattern      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	rulePattern      = regexp.MustCompile(`^\s*(-{3,}|\*{3,}|_{3,})\s*$`)
+	tableRulePattern = regexp.MustCompile(`^\s*\|?[\s:|-]*-[\s:|-]*\|?\s*$`)
+)
+
+// markdownToBlocks converts model output written in Markdown into Block Kit blocks: a
+// section per paragraph with the Markdown rewritten as Slack mrkdwn, fenced code blocks
+// kept whole, tables rendered as code so their columns line up, and a divider for each
+// horizontal rule. Sections longer than Slack allows are split. It returns nil when the
+// text has nothing to show.
+func markdownToBlocks(text string) []Block {
+	blocks := make([]Block, 0)
+	hasSection := false
+
+	addSection := func(text string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		for _, piece := range splitMessage(text, maxBlockChars) {
+			blocks = append(blocks, sectionBlock(piece))
+		}
+		hasSection = true
+	}
+
+	for _, paragraph := range splitBlocks(text) {
+		if strings.HasPrefix(strings.TrimSpace(paragraph), "```") {
+			addSection(stripFenceLanguage(paragraph))
+			continue
+		}
+		if isTable(paragraph) {
+			addSection(tableToCode(paragraph))
+			continue
+		}
+
+		// A rule can sit directly against text without blank lines around it
+		var current []string
+		for _, line := range strings.Split(paragraph, "\n") {
+			if rulePattern.MatchString(line) {
+				addSection(strings.Join(current, "\n"))
+				current = nil
+				blocks = append(blocks, dividerBlock())
+				continue
+			}
+			current = append(current, markdownToMrkdwn(line))
+		}
+		addSection(strings.Join(current, "\n"))
+	}
+
+	if !hasSection {
+		return nil
+	}
+	return blocks
+}
+
+// markdownToMrkdwn rewrites one line of Markdown in Slack's mrkdwn dialect
+func markdownToMrkdwn(line string) string {
+	if match := headingPattern.FindStringSubmatch(line); match != nil {
+		return "*" + strings.Trim(match[1], "*_") + "*"
+	}
+
+	line = bulletPattern.ReplaceAllString(line, "$1• ")
+	line = boldPattern.ReplaceAllString(line, "*$1$2*")
+	line = strikePattern.ReplaceAllString(line, "~$1~")
+	line = linkPattern.ReplaceAllString(line, "<$2|$1>")
+	return line
+}
+
+// stripFenceLanguage drops the language tag from a code block's opening fence, which
+// Slack would otherwise show as the first line of code
+func stripFenceLanguage(block string) string {
+	first, rest, _ := strings.Cut(block, "\n")
+	indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+	return indent + "```\n" + rest
+}
+
+// isTable reports whether every line of a paragraph is a Markdown table row
+func isTable(paragraph string) bool {
+	lines := strings.Split(paragraph, "\n")
+	if len(lines) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "|") {
+			return false
+		}
+	}
+	return true
+}
+
+// tableToCode renders a Markdown table as a code block, dropping the header separator row
+func tableToCode(paragraph string) string {
+	rows := make([]string, 0)
+	for _, line := range strings.Split(paragraph, "\n") {
+		if tableRulePattern.MatchString(line) {
+			continue
+		}
+		rows = append(rows, strings.TrimSpace(line))
+	}
+	return "```\n" + strings.Join(rows, "\n") + "\n```"
+}
+
+// batchBlocks splits blocks into messages of at most maxBlocks blocks
+func batchBlocks(blocks []Block) [][]Block {
+	batches := make([][]Block, 0, len(blocks)/maxBlocks+1)
+	for len(blocks) > maxBlocks {
+		batches = append(batches, blocks[:maxBlocks])
+		blocks = blocks[maxBlocks:]
+	}
+	if len(blocks) > 0 {
+		batches = append(batches, blocks)
+	}
+	return batches
+}
+
+// blocksText returns the plain text Slack shows in notifications for a message of blocks
+func blocksText(blocks []Block) string {
+	for _, block := range blocks {
+		if block.Text != nil {
+			return block.Text.Text
+		}
+	}
+	return ""
+}
+
+// isBlocksRejected reports whether Slack refused a message because of its blocks
+func isBlocksRejected(err error) bool {
+	return IsAPIError(err, "invalid_blocks") || IsAPIError(err, "invalid_blocks_format")
+}
+
+// PostBlocks posts Block Kit blocks to a channel, optionally as a reply in threadTS, and
+// returns the posted message's timestamp. Blocks beyond Slack's per-message limit are
+// posted as follow-up messages in the same thread.
+func (c *Client) PostBlocks(ctx context.Context, channel string, blocks []Block, threadTS string) (string, error) {
+	return c.postBlocks(ctx, channel, blocks, threadTS, false)
+}
+
+// postBlocks implements PostBlocks, broadcasting the first message to the channel if
+// broadcast is set
+func (c *Client) postBlocks(ctx context.Context, channel string, blocks []Block, threadTS string, broadcast bool) (string, error) {
+	if len(blocks) == 0 {
+		return "", fmt.Errorf("no blocks to post")
+	}
+
+	batches := batchBlocks(blocks)
+	firstTS, err := c.postBlockBatch(ctx, channel, batches[0], threadTS, broadcast)
+	if err != nil {
+		return "", err
+	}
+
+	// Follow-up messages of a top-level message go into its thread
+	if threadTS == "" {
+		threadTS = firstTS
+	}
+	if err := c.postBlockBatches(ctx, channel, batches[1:], threadTS, 1); err != nil {
+		return firstTS, err
+	}
+
+	c.logger.Info("Blocks posted to Slack", "channel", channel, "ts", firstTS, "blocks", len(blocks), "parts", len(batches))
+	return firstTS, nil
+}
+
+// postBlockBatches posts each batch as its own message in threadTS. skipped is how many
+// batches were already sent, so errors report the right part number.
+func (c *Client) postBlockBatches(ctx context.Context, channel string, batches [][]Block, threadTS string, skipped int) error {
+	for i, batch := range batches {
+		if _, err := c.postBlockBatch(ctx, channel, batch, threadTS, false); err != nil {
+			return fmt.Errorf("failed to post part %d of %d: %w", skipped+i+1, skipped+len(batches), err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) postBlockBatch(ctx context.Context, channel string, blocks []Block, threadTS string, broadcast bool) (string, error) {
+	payload := MessageResponse{
+		Channel:        channel,
+		Text:           blocksText(blocks),
+		ThreadTS:       threadTS,
+		Blocks:         blocks,
+		ReplyBroadcast: broadcast,
+	}
+
+	var postResp PostMessageResponse
+	if err := c.callAPI(ctx, "chat.postMessage", payload, &postResp); err != nil {
+		return "", err
+	}
+	return postResp.TS, nil
+}
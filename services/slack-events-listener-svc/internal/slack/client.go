@@ -8,60 +8,338 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackretry"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 )
 
+// defaultAPIURL is the base URL of the Slack Web API
+const defaultAPIURL = "https://slack.com/api/"
+
 type Client struct {
 	botToken string
+	apiURL   string
+	blockKit bool
 	logger   *slog.Logger
 	client   *http.Client
+	retry    slackretry.Policy
 }
 
 func NewClient(botToken string, logger *slog.Logger) *Client {
 	return &Client{
 		botToken: botToken,
+		apiURL:   defaultAPIURL,
 		logger:   logger,
+		retry:    slackretry.DefaultPolicy,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
 }
 
-func (c *Client) PostMessage(ctx context.Context, channel, text string, threadTS ...string) error {
-	payload := MessageResponse{
-		Channel: channel,
-		Text:    text,
+// SetAPIURL sends Web API calls to url (ending in a slash) instead of Slack, e.g. a
+// Slack-compatible proxy or a fake server in tests
+func (c *Client) SetAPIURL(url string) {
+	c.apiURL = url
+}
+
+// SetBlockKit makes PostMessage and UpdateMessage send Markdown text as Block Kit blocks
+// rather than plain text, so headers, tables and rules render properly
+func (c *Client) SetBlockKit(enabled bool) {
+	c.blockKit = enabled
+}
+
+// PostMessage posts text to a channel, optionally as a reply in threadTS, and returns
+// the posted message's timestamp. Text longer than Slack comfortably displays is split
+// into numbered parts posted in order in the same thread; the first part's timestamp is
+// returned.
+func (c *Client) PostMessage(ctx context.Context, channel, text string, threadTS ...string) (string, error) {
+	thread := ""
+	if len(threadTS) > 0 {
+		thread = threadTS[0]
 	}
-	
-	// Add thread_ts if provided
+	return c.postMessage(ctx, channel, text, thread, false)
+}
+
+// PostBroadcastReply posts text in threadTS like PostMessage and also shows it in the
+// channel, as Slack's "Also send to channel" does. Only the first part is broadcast; any
+// follow-up parts stay in the thread.
+func (c *Client) PostBroadcastReply(ctx context.Context, channel, text, threadTS string) (string, error) {
+	return c.postMessage(ctx, channel, text, threadTS, true)
+}
+
+func (c *Client) postMessage(ctx context.Context, channel, text, thread string, broadcast bool) (string, error) {
+	if c.blockKit {
+		if blocks := markdownToBlocks(text); len(blocks) > 0 {
+			// Only fall back when nothing was posted, or the answer would appear twice
+			ts, err := c.postBlocks(ctx, channel, blocks, thread, broadcast)
+			if ts != "" || !isBlocksRejected(err) {
+				return ts, err
+			}
+			c.logger.Warn("Slack rejected blocks, posting plain text", "channel", channel, "error", err)
+		}
+	}
+
+	segments := numberSegments(splitMessage(text, maxSegmentChars-segmentPrefixReserve))
+
+	firstTS := ""
+	for i, segment := range segments {
+		ts, err := c.postSegment(ctx, channel, segment, thread, broadcast && i == 0)
+		if err != nil {
+			if i == 0 {
+				return "", err
+			}
+			return firstTS, fmt.Errorf("failed to post part %d of %d: %w", i+1, len(segments), err)
+		}
+
+		if i == 0 {
+			firstTS = ts
+			// Follow-up parts of a top-level message go into its thread
+			if thread == "" {
+				thread = ts
+			}
+		}
+	}
+
+	c.logger.Info("Message posted to Slack", "channel", channel, "ts", firstTS, "parts", len(segments), "broadcast", broadcast)
+	return firstTS, nil
+}
+
+// UpdateMessage replaces the text of the message at ts, e.g. a placeholder posted while
+// an answer was being generated. Text too long for one message is split like
+// PostMessage: the first part replaces the message and the rest are posted in threadTS.
+func (c *Client) UpdateMessage(ctx context.Context, channel, ts, text string, threadTS ...string) error {
+	thread := ts
 	if len(threadTS) > 0 && threadTS[0] != "" {
-		payload.ThreadTS = threadTS[0]
+		thread = threadTS[0]
+	}
+
+	if c.blockKit {
+		if blocks := markdownToBlocks(text); len(blocks) > 0 {
+			updated, err := c.updateBlocks(ctx, channel, ts, blocks, thread)
+			if updated || !isBlocksRejected(err) {
+				return err
+			}
+			c.logger.Warn("Slack rejected blocks, updating with plain text", "channel", channel, "error", err)
+		}
+	}
+
+	segments := numberSegments(splitMessage(text, maxSegmentChars-segmentPrefixReserve))
+
+	payload := UpdateMessageRequest{
+		Channel: channel,
+		TS:      ts,
+		Text:    segments[0],
+	}
+	var updateResp APIResponse
+	if err := c.callAPI(ctx, "chat.update", payload, &updateResp); err != nil {
+		return err
+	}
+
+	for i, segment := range segments[1:] {
+		if _, err := c.postSegment(ctx, channel, segment, thread, false); err != nil {
+			return fmt.Errorf("failed to post part %d of %d: %w", i+2, len(segments), err)
+		}
+	}
+
+	c.logger.Info("Message updated in Slack", "channel", channel, "ts", ts, "parts", len(segments))
+	return nil
+}
+
+// updateBlocks replaces the message at ts with the first message's worth of blocks and
+// posts the rest in threadTS. It reports whether the message at ts was replaced.
+func (c *Client) updateBlocks(ctx context.Context, channel, ts string, blocks []Block, threadTS string) (bool, error) {
+	batches := batchBlocks(blocks)
+
+	payload := UpdateMessageRequest{
+		Channel: channel,
+		TS:      ts,
+		Text:    blocksText(batches[0]),
+		Blocks:  batches[0],
+	}
+	var updateResp APIResponse
+	if err := c.callAPI(ctx, "chat.update", payload, &updateResp); err != nil {
+		return false, err
+	}
+
+	if err := c.postBlockBatches(ctx, channel, batches[1:], threadTS, 1); err != nil {
+		return true, err
+	}
+
+	c.logger.Info("Message updated with blocks in Slack", "channel", channel, "ts", ts, "blocks", len(blocks), "parts", len(batches))
+	return true, nil
+}
+
+// IndicateThinking posts a short status message, such as "_working on it…_", in the
+// thread to show an answer is being generated. The returned ts can be passed to
+// UpdateMessage to replace it with the answer or to DeleteMessage to remove it.
+func (c *Client) IndicateThinking(ctx context.Context, channel, threadTS, text string) (string, error) {
+	return c.postSegment(ctx, channel, text, threadTS, false)
+}
+
+// DeleteMessage removes a message the bot posted
+func (c *Client) DeleteMessage(ctx context.Context, channel, ts string) error {
+	payload := DeleteMessageRequest{
+		Channel: channel,
+		TS:      ts,
 	}
 
+	var deleteResp APIResponse
+	if err := c.callAPI(ctx, "chat.delete", payload, &deleteResp); err != nil {
+		return err
+	}
+
+	c.logger.Info("Message deleted from Slack", "channel", channel, "ts", ts)
+	return nil
+}
+
+func (c *Client) postSegment(ctx context.Context, channel, text, threadTS string, broadcast bool) (string, error) {
+	payload := MessageResponse{
+		Channel:        channel,
+		Text:           text,
+		ThreadTS:       threadTS,
+		ReplyBroadcast: broadcast,
+	}
+
+	var postResp PostMessageResponse
+	if err := c.callAPI(ctx, "chat.postMessage", payload, &postResp); err != nil {
+		return "", err
+	}
+	return postResp.TS, nil
+}
+
+// AuthTest returns the user ID the bot token belongs to
+func (c *Client) AuthTest(ctx context.Context) (string, error) {
+	var authResp AuthTestResponse
+	if err := c.callAPI(ctx, "auth.test", struct{}{}, &authResp); err != nil {
+		return "", err
+	}
+	return authResp.UserID, nil
+}
+
+// JoinChannel joins a public channel so the bot can post in it
+func (c *Client) JoinChannel(ctx context.Context, channel string) error {
+	payload := map[string]string{"channel": channel}
+
+	var joinResp APIResponse
+	if err := c.callAPI(ctx, "conversations.join", payload, &joinResp); err != nil {
+		return err
+	}
+
+	c.logger.Info("Joined Slack channel", "channel", channel)
+	return nil
+}
+
+// GetMessage returns a single message by ts, whether it is top-level or a thread reply
+func (c *Client) GetMessage(ctx context.Context, channel, ts string) (*ThreadMessage, error) {
+	params := url.Values{
+		"channel":   {channel},
+		"ts":        {ts},
+		"limit":     {"1"},
+		"inclusive": {"true"},
+	}
+
+	var repliesResp RepliesResponse
+	if err := c.callAPIQuery(ctx, "conversations.replies", params, &repliesResp); err != nil {
+		return nil, err
+	}
+	if len(repliesResp.Messages) == 0 || repliesResp.Messages[0].TS != ts {
+		return nil, fmt.Errorf("message %s not found in %s", ts, channel)
+	}
+	return &repliesResp.Messages[0], nil
+}
+
+// GetThreadReplies returns the messages of the thread rooted at threadTS, oldest first
+// and starting with the root
+func (c *Client) GetThreadReplies(ctx context.Context, channel, threadTS string) ([]ThreadMessage, error) {
+	params := url.Values{
+		"channel": {channel},
+		"ts":      {threadTS},
+		"limit":   {"200"},
+	}
+
+	var repliesResp RepliesResponse
+	if err := c.callAPIQuery(ctx, "conversations.replies", params, &repliesResp); err != nil {
+		return nil, err
+	}
+	return repliesResp.Messages, nil
+}
+
+// callAPI posts a JSON payload to a Slack Web API method and decodes the response into
+// out, which must embed APIResponse so that ok:false replies are returned as *APIError
+func (c *Client) callAPI(ctx context.Context, method string, payload interface{}, out apiResult) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	return c.doAPI(ctx, "POST", c.apiURL+method, jsonData, method, out)
+}
+
+// callAPIQuery calls a read-only Slack Web API method, which take form arguments rather
+// than JSON, and decodes the response into out like callAPI
+func (c *Client) callAPIQuery(ctx context.Context, method string, params url.Values, out apiResult) error {
+	return c.doAPI(ctx, "GET", c.apiURL+method+"?"+params.Encode(), nil, method, out)
+}
+
+// doAPI sends a Slack Web API request, retrying when Slack rate limits it (HTTP 429 or
+// ok:false "ratelimited") or fails with a 5xx, and decodes the response into out
+func (c *Client) doAPI(ctx context.Context, httpMethod, url string, body []byte, method string, out apiResult) error {
+	for attempt := 0; ; attempt++ {
+		retry, requested, err := c.tryAPI(ctx, httpMethod, url, body, method, out)
+		if !retry || attempt >= c.retry.MaxRetries {
+			return err
+		}
+
+		delay := c.retry.Delay(attempt, requested)
+		c.logger.Warn("Slack call failed, retrying",
+			"method", method,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err)
+		if err := slackretry.Sleep(ctx, delay); err != nil {
+			return fmt.Errorf("gave up retrying %s: %w", method, err)
+		}
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// tryAPI makes a single attempt at a Slack call. It reports whether a failure is worth
+// retrying and any delay Slack asked for with Retry-After.
+func (c *Client) tryAPI(ctx context.Context, httpMethod, url string, body []byte, method string, out apiResult) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
 	req.Header.Set("Authorization", "Bearer "+c.botToken)
+	tracing.SetHeader(req)
 
 	resp, err := c.client.Do(req)
+	metrics.ObserveUpstream("slack", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		// Not retried: the message may have been posted before the connection failed
+		return false, 0, fmt.Errorf("failed to call %s: %w", method, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(respBody))
+		return slackretry.RetryableStatus(resp.StatusCode), slackretry.RetryAfter(resp), err
 	}
 
-	c.logger.Info("Message posted to Slack", "channel", channel)
-	return nil
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, 0, fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+
+	if result := out.result(); !result.OK {
+		return result.Error == "ratelimited", slackretry.RetryAfter(resp), &APIError{Method: method, Code: result.Error}
+	}
+
+	return false, 0, nil
 }
@@ -0,0 +1,107 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slackReply is one scripted response from the fake Slack API
+type slackReply struct {
+	status int
+	body   string
+}
+
+// newScriptedClient returns a client whose fake Slack API answers successive calls with
+// replies, repeating the last one, and the number of calls it received. Retries back
+// off by milliseconds rather than seconds.
+func newScriptedClient(t *testing.T, replies ...slackReply) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		reply := replies[min(n, len(replies))-1]
+		w.WriteHeader(reply.status)
+		fmt.Fprint(w, reply.body)
+	}))
+	t.Cleanup(api.Close)
+
+	c := NewClient("xoxb-test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.SetAPIURL(api.URL + "/")
+	c.retry.BaseDelay = time.Millisecond
+	return c, &calls
+}
+
+const postedReply = `{"ok":true,"channel":"C123","ts":"1700000000.000900"}`
+
+func TestRateLimitedPostIsRetried(t *testing.T) {
+	tests := map[string]slackReply{
+		"HTTP 429": {http.StatusTooManyRequests, ""},
+		"ok:false": {http.StatusOK, `{"ok":false,"error":"ratelimited"}`},
+		"HTTP 503": {http.StatusServiceUnavailable, "upstream unavailable"},
+	}
+
+	for name, limited := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, calls := newScriptedClient(t, limited, slackReply{http.StatusOK, postedReply})
+
+			ts, err := c.PostMessage(context.Background(), "C123", "Go to Connections.")
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if ts != "1700000000.000900" {
+				t.Errorf("ts = %q, want the retried post's", ts)
+			}
+			if n := calls.Load(); n != 2 {
+				t.Errorf("made %d calls, want 2", n)
+			}
+		})
+	}
+}
+
+func TestPostGivesUpAfterMaxRetries(t *testing.T) {
+	c, calls := newScriptedClient(t, slackReply{http.StatusTooManyRequests, ""})
+
+	if _, err := c.PostMessage(context.Background(), "C123", "Go to Connections."); err == nil {
+		t.Fatal("got nil error, want the rate limit reported")
+	}
+	if n, want := calls.Load(), int32(c.retry.MaxRetries+1); n != want {
+		t.Errorf("made %d calls, want %d", n, want)
+	}
+}
+
+func TestRetryStopsWhenContextEnds(t *testing.T) {
+	c, calls := newScriptedClient(t, slackReply{http.StatusTooManyRequests, ""})
+	c.retry.BaseDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.PostMessage(ctx, "C123", "Go to Connections."); err == nil {
+		t.Fatal("got nil error, want the retry abandoned")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d calls, want 1 before the context ended", n)
+	}
+}
+
+func TestOKFalseIsReturnedAsError(t *testing.T) {
+	c, calls := newScriptedClient(t, slackReply{http.StatusOK, `{"ok":false,"error":"channel_not_found"}`})
+
+	ts, err := c.PostMessage(context.Background(), "C123", "Go to Connections.")
+	if !IsAPIError(err, "channel_not_found") {
+		t.Fatalf("got %v, want a channel_not_found APIError", err)
+	}
+	if ts != "" {
+		t.Errorf("ts = %q, want none for a failed post", ts)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d calls, want 1 since channel_not_found is not retryable", n)
+	}
+}
@@ -0,0 +1,55 @@
+package slack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// maxViewBlocks is the most blocks Slack accepts in a Home tab view
+const maxViewBlocks = 100
+
+// View is a Block Kit surface published with views.publish
+type View struct {
+	Type   string  `json:"type"`
+	Blocks []Block `json:"blocks"`
+	// PrivateMetadata is returned with app_home_opened events; NewHomeView stores a hash
+	// of the content in it so unchanged views aren't republished
+	PrivateMetadata string `json:"private_metadata,omitempty"`
+}
+
+type PublishViewRequest struct {
+	UserID string `json:"user_id"`
+	View   View   `json:"view"`
+}
+
+// NewHomeView renders Markdown as a Home tab view, dropping blocks beyond Slack's limit
+func NewHomeView(markdown string) View {
+	blocks := markdownToBlocks(markdown)
+	if len(blocks) > maxViewBlocks {
+		blocks = blocks[:maxViewBlocks]
+	}
+
+	sum := sha256.Sum256([]byte(markdown))
+	return View{
+		Type:            "home",
+		Blocks:          blocks,
+		PrivateMetadata: "home:" + hex.EncodeToString(sum[:8]),
+	}
+}
+
+// PublishHomeView sets the Home tab the user sees for the app
+func (c *Client) PublishHomeView(ctx context.Context, userID string, view View) error {
+	payload := PublishViewRequest{
+		UserID: userID,
+		View:   view,
+	}
+
+	var publishResp APIResponse
+	if err := c.callAPI(ctx, "views.publish", payload, &publishResp); err != nil {
+		return err
+	}
+
+	c.logger.Info("Home view published", "user", userID)
+	return nil
+}
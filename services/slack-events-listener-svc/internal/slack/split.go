@@ -0,0 +1,204 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSegmentChars is the longest single message PostMessage sends; longer text is split
+// into numbered follow-ups in the same thread
+const maxSegmentChars = 3500
+
+// segmentPrefixReserve leaves room for the "(n/m) " prefix added to each part
+const segmentPrefixReserve = 10
+
+// splitMessage breaks text into segments of at most limit characters along paragraph
+// boundaries. Fenced code blocks are kept whole; one too large for a single segment is
+// split by line and its fence closed and reopened so every segment renders correctly.
+func splitMessage(text string, limit int) []string {
+	if len([]rune(text)) <= limit {
+		return []string{text}
+	}
+
+	segments := make([]string, 0)
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	for _, block := range splitBlocks(text) {
+		blockLen := len([]rune(block))
+		sepLen := 0
+		if current.Len() > 0 {
+			sepLen = 2
+		}
+
+		if len([]rune(current.String()))+sepLen+blockLen <= limit {
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(block)
+			continue
+		}
+
+		flush()
+		if blockLen <= limit {
+			current.WriteString(block)
+			continue
+		}
+
+		segments = append(segments, splitOversizedBlock(block, limit)...)
+	}
+	flush()
+
+	return segments
+}
+
+// splitBlocks splits text into paragraphs on blank lines, treating each fenced code
+// block (including any blank lines inside it) as a single paragraph
+func splitBlocks(text string) []string {
+	blocks := make([]string, 0)
+	var current []string
+	inFence := false
+
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !inFence {
+				flush()
+			}
+			current = append(current, line)
+			if inFence {
+				flush()
+			}
+			inFence = !inFence
+			continue
+		}
+
+		if !inFence && strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return blocks
+}
+
+// splitOversizedBlock splits a single paragraph or code block that exceeds limit by line,
+// and lines that are themselves too long by rune count
+func splitOversizedBlock(block string, limit int) []string {
+	lines := strings.Split(block, "\n")
+
+	// Code blocks re-open their fence (with its language tag) in every piece
+	opening, closing := "", ""
+	if strings.HasPrefix(strings.TrimSpace(lines[0]), "```") {
+		opening = lines[0]
+		lines = lines[1:]
+		if n := len(lines); n > 0 && strings.HasPrefix(strings.TrimSpace(lines[n-1]), "```") {
+			closing = lines[n-1]
+			lines = lines[:n-1]
+		} else {
+			closing = "```"
+		}
+	}
+
+	lineLimit := limit
+	if opening != "" {
+		lineLimit = limit - len([]rune(opening)) - len([]rune(closing)) - 2
+	}
+	// A fence line too long to repeat in every piece is split as plain text instead
+	if lineLimit < limit/2 {
+		opening, closing = "", ""
+		lines = strings.Split(block, "\n")
+		lineLimit = limit
+	}
+
+	pieces := make([]string, 0)
+	current := make([]string, 0)
+	currentLen := 0
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		body := strings.TrimRight(strings.Join(current, "\n"), " \n")
+		if opening != "" {
+			body = opening + "\n" + body + "\n" + closing
+		}
+		pieces = append(pieces, body)
+		current = current[:0]
+		currentLen = 0
+	}
+
+	for _, line := range lines {
+		for _, part := range splitRunes(line, lineLimit) {
+			partLen := len([]rune(part))
+			if currentLen > 0 && currentLen+1+partLen > lineLimit {
+				flush()
+			}
+			// Don't start a piece with a blank line
+			if currentLen == 0 && strings.TrimSpace(part) == "" {
+				continue
+			}
+			if currentLen > 0 {
+				currentLen++
+			}
+			current = append(current, part)
+			currentLen += partLen
+		}
+	}
+	flush()
+
+	return pieces
+}
+
+// splitRunes cuts s into pieces of at most n runes, preferring to break at spaces. An n
+// of 0 or less returns s whole.
+func splitRunes(s string, n int) []string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return []string{s}
+	}
+
+	parts := make([]string, 0, len(runes)/n+1)
+	for len(runes) > n {
+		cut := n
+		for i := n; i > n/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// numberSegments prefixes each segment with "(n/m)" when there is more than one
+func numberSegments(segments []string) []string {
+	if len(segments) < 2 {
+		return segments
+	}
+
+	numbered := make([]string, len(segments))
+	for i, segment := range segments {
+		numbered[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(segments), segment)
+	}
+	return numbered
+}
@@ -0,0 +1,70 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessageKeepsShortTextWhole(t *testing.T) {
+	segments := splitMessage("hello\n\nworld", 100)
+	if len(segments) != 1 || segments[0] != "hello\n\nworld" {
+		t.Errorf("got %q, want the text unchanged", segments)
+	}
+}
+
+func TestSplitMessageBreaksOnParagraphs(t *testing.T) {
+	first := strings.Repeat("a", 60)
+	second := strings.Repeat("b", 60)
+
+	segments := splitMessage(first+"\n\n"+second, 100)
+	if len(segments) != 2 || segments[0] != first || segments[1] != second {
+		t.Errorf("got %q, want one segment per paragraph", segments)
+	}
+}
+
+func TestSplitMessageReopensCodeFences(t *testing.T) {
+	lines := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		lines = append(lines, strings.Repeat("x", 10))
+	}
+	text := "```go\n" + strings.Join(lines, "\n") + "\n```"
+
+	segments := splitMessage(text, 100)
+	if len(segments) < 2 {
+		t.Fatalf("got %d segments, want the code block split", len(segments))
+	}
+	for i, segment := range segments {
+		if len([]rune(segment)) > 100 {
+			t.Errorf("segment %d has %d runes, want at most 100", i, len([]rune(segment)))
+		}
+		if !strings.HasPrefix(segment, "```go\n") || !strings.HasSuffix(segment, "\n```") {
+			t.Errorf("segment %d = %q, want it fenced", i, segment)
+		}
+	}
+}
+
+func TestSplitMessageHandlesOverlongFenceLine(t *testing.T) {
+	text := "```" + strings.Repeat("x", 3600) + "\nfoo\n```"
+
+	for _, limit := range []int{maxSegmentChars - segmentPrefixReserve, maxBlockChars} {
+		segments := splitMessage(text, limit)
+		if len(segments) < 2 {
+			t.Fatalf("limit %d: got %d segments, want the text split", limit, len(segments))
+		}
+		for i, segment := range segments {
+			if len([]rune(segment)) > limit {
+				t.Errorf("limit %d: segment %d has %d runes", limit, i, len([]rune(segment)))
+			}
+		}
+	}
+}
+
+func TestSplitRunesPrefersSpaces(t *testing.T) {
+	parts := splitRunes("aaaa bbbb cccc", 10)
+	if len(parts) != 2 || parts[0] != "aaaa bbbb" || parts[1] != "cccc" {
+		t.Errorf("got %q, want a break at the last space", parts)
+	}
+	if parts := splitRunes("abc", 0); len(parts) != 1 || parts[0] != "abc" {
+		t.Errorf("got %q for n = 0, want the string whole", parts)
+	}
+}
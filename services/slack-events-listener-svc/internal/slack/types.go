@@ -1,18 +1,22 @@
 package slack
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // EventRequest represents a Slack event request
 type EventRequest struct {
-	Token       string   `json:"token"`
-	Challenge   string   `json:"challenge"`
-	Type        string   `json:"type"`
-	TeamID      string   `json:"team_id"`
-	APIAppID    string   `json:"api_app_id"`
-	Event       Event    `json:"event"`
-	EventID     string   `json:"event_id"`
-	EventTime   int64    `json:"event_time"`
-	Auths       []Auth   `json:"authorizations"`
+	Token     string `json:"token"`
+	Challenge string `json:"challenge"`
+	Type      string `json:"type"`
+	TeamID    string `json:"team_id"`
+	APIAppID  string `json:"api_app_id"`
+	Event     Event  `json:"event"`
+	EventID   string `json:"event_id"`
+	EventTime int64  `json:"event_time"`
+	Auths     []Auth `json:"authorizations"`
 }
 
 type Event struct {
@@ -23,9 +27,19 @@ type Event struct {
 	TS       string `json:"ts"`
 	ThreadTS string `json:"thread_ts,omitempty"`
 	EventTS  string `json:"event_ts"`
+	Subtype  string `json:"subtype,omitempty"`
 	BotID    string `json:"bot_id,omitempty"`
-	Item     Item    `json:"item,omitempty"`
-	Reaction Reaction `json:"reaction,omitempty"`
+	Item     Item   `json:"item,omitempty"`
+	Reaction string `json:"reaction,omitempty"`
+	ItemUser string `json:"item_user,omitempty"`
+	// Message and PreviousMessage are the new and old versions of an edited message,
+	// sent with the message_changed subtype
+	Message         *Event `json:"message,omitempty"`
+	PreviousMessage *Event `json:"previous_message,omitempty"`
+	// Tab and View describe the tab opened in app_home_opened events; View is the
+	// currently published Home view, if any
+	Tab  string `json:"tab,omitempty"`
+	View *View  `json:"view,omitempty"`
 }
 
 type Item struct {
@@ -35,10 +49,10 @@ type Item struct {
 }
 
 type Reaction struct {
-	Type    string `json:"type"`
-	User    string `json:"user"`
+	Type     string `json:"type"`
+	User     string `json:"user"`
 	Reaction string `json:"reaction"`
-	Item    Item    `json:"item"`
+	Item     Item   `json:"item"`
 }
 
 type Auth struct {
@@ -50,8 +64,80 @@ type Auth struct {
 }
 
 type MessageResponse struct {
-	Channel  string `json:"channel"`
+	Channel  string  `json:"channel"`
+	Text     string  `json:"text"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+	Blocks   []Block `json:"blocks,omitempty"`
+	// ReplyBroadcast also shows a thread reply in the channel ("Also send to channel")
+	ReplyBroadcast bool `json:"reply_broadcast,omitempty"`
+}
+
+// APIResponse holds the fields common to every Slack Web API response
+type APIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func (r *APIResponse) result() *APIResponse { return r }
+
+// apiResult is implemented by response types that embed APIResponse
+type apiResult interface {
+	result() *APIResponse
+}
+
+// APIError is returned when Slack responds with ok:false
+type APIError struct {
+	Method string
+	Code   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack API error: %s returned %s", e.Method, e.Code)
+}
+
+// IsAPIError reports whether err is a Slack ok:false error with the given code
+func IsAPIError(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// PostMessageResponse is the body returned by chat.postMessage
+type UpdateMessageRequest struct {
+	Channel string  `json:"channel"`
+	TS      string  `json:"ts"`
+	Text    string  `json:"text"`
+	Blocks  []Block `json:"blocks,omitempty"`
+}
+
+type DeleteMessageRequest struct {
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+type PostMessageResponse struct {
+	APIResponse
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+type AuthTestResponse struct {
+	APIResponse
+	UserID string `json:"user_id"`
+	BotID  string `json:"bot_id"`
+}
+
+// RepliesResponse is the conversations.replies response
+type RepliesResponse struct {
+	APIResponse
+	Messages []ThreadMessage `json:"messages"`
+}
+
+// ThreadMessage is a message as returned by conversations.replies
+type ThreadMessage struct {
+	User     string `json:"user,omitempty"`
+	BotID    string `json:"bot_id,omitempty"`
 	Text     string `json:"text"`
+	TS       string `json:"ts"`
 	ThreadTS string `json:"thread_ts,omitempty"`
 }
 
@@ -63,29 +149,48 @@ type ConversationMessage struct {
 }
 
 type GPTRequest struct {
-	Message            string               `json:"message"`
-	UserID             string               `json:"user_id"`
-	ChannelID          string               `json:"channel_id"`
-	MessageTS          string               `json:"message_ts"`
-	ThreadTS           string               `json:"thread_ts,omitempty"`
+	Message             string                `json:"message"`
+	UserID              string                `json:"user_id"`
+	ChannelID           string                `json:"channel_id"`
+	MessageTS           string                `json:"message_ts"`
+	ThreadTS            string                `json:"thread_ts,omitempty"`
 	ConversationHistory []ConversationMessage `json:"conversation_history,omitempty"`
-	CorrelationID      string               `json:"correlation_id"`
+	CorrelationID       string                `json:"correlation_id"`
 }
 
 type GPTResponse struct {
-	Response      string `json:"response"`
-	CorrelationID string `json:"correlation_id"`
-	Error         string `json:"error,omitempty"`
+	Response      string        `json:"response"`
+	CorrelationID string        `json:"correlation_id"`
+	Error         *ServiceError `json:"error,omitempty"`
+	SourceDocs    []string      `json:"source_docs,omitempty"`
+	// Token usage reported by the model provider, if any
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+}
+
+// ServiceError is the error body returned by the GPT and broadcast services
+type ServiceError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type BroadcastRequest struct {
-	UserID        string    `json:"user_id"`
-	ChannelID     string    `json:"channel_id"`
-	ThreadID      string    `json:"thread_id,omitempty"`
-	Question      string    `json:"question"`
-	Response      string    `json:"response"`
-	Timestamp     time.Time `json:"timestamp"`
-	CorrelationID string    `json:"correlation_id"`
+	UserID       string `json:"user_id"`
+	ChannelID    string `json:"channel_id"`
+	ThreadID     string `json:"thread_id,omitempty"`
+	RootQuestion string `json:"root_question,omitempty"`
+	// ConversationHistory holds the thread's turns before this question, oldest first
+	ConversationHistory []ConversationMessage `json:"conversation_history,omitempty"`
+	Question            string                `json:"question"`
+	Response            string                `json:"response"`
+	SourceDocs          []string              `json:"source_docs,omitempty"`
+	Timestamp           time.Time             `json:"timestamp"`
+	CorrelationID       string                `json:"correlation_id"`
+	// Token usage of the answer, copied from the GPT response
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
 }
 
 // FeedbackRequest represents a request to broadcast user feedback
@@ -100,4 +205,6 @@ type FeedbackRequest struct {
 	FeedbackText  string    `json:"feedback_text,omitempty"`
 	Timestamp     time.Time `json:"timestamp"`
 	CorrelationID string    `json:"correlation_id"`
+	// OriginalCorrelationID is the correlation ID of the interaction being rated, if known
+	OriginalCorrelationID string `json:"original_correlation_id,omitempty"`
 }
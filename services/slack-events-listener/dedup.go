@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DedupStore records which Slack events have already been processed
+type DedupStore interface {
+	// MarkIfNew records the event as processed, returning false if it already was. The
+	// check and the write are one step, so concurrent deliveries can't both see it as new.
+	MarkIfNew(eventID string) bool
+}
+
+// NewDedupStore creates the store selected by DEDUP_BACKEND
+func NewDedupStore(config *Config) (DedupStore, error) {
+	switch config.DedupBackend {
+	case "", "memory":
+		return NewMemoryDedupStore(config.DedupTTL), nil
+	case "redis":
+		return NewRedisDedupStore(config.RedisAddr, config.RedisPassword, config.DedupTTL)
+	default:
+		return nil, fmt.Errorf("unknown dedup backend %q", config.DedupBackend)
+	}
+}
+
+// MemoryDedupStore keeps processed event IDs in memory; they are lost on restart
+type MemoryDedupStore struct {
+	events map[string]time.Time
+	ttl    time.Duration
+	mu     sync.Mutex
+}
+
+func NewMemoryDedupStore(ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		events: make(map[string]time.Time),
+		ttl:    ttl,
+	}
+}
+
+func (s *MemoryDedupStore) MarkIfNew(eventID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expiry, ok := s.events[eventID]; ok && now.Before(expiry) {
+		return false
+	}
+	s.events[eventID] = now.Add(s.ttl)
+
+	// Prune expired entries as the map grows
+	if len(s.events) > 1000 {
+		for id, expiry := range s.events {
+			if now.After(expiry) {
+				delete(s.events, id)
+			}
+		}
+	}
+	return true
+}
+
+const (
+	redisKeyPrefix = "wavie:event:"
+	redisTimeout   = 2 * time.Second
+)
+
+// RedisDedupStore keeps processed event IDs in Redis with a TTL, so dedup survives
+// restarts and is shared across instances
+type RedisDedupStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisDedupStore connects to the Redis server at addr. Commands are never retried: if
+// a SET NX reaches the server but its reply is lost, resending it would find the key and
+// drop the event as a duplicate.
+func NewRedisDedupStore(addr, password string, ttl time.Duration) (*RedisDedupStore, error) {
+	// Redis expiries are whole seconds here; a shorter TTL would store keys that never
+	// expire or fail every SET, either way leaving dedup broken
+	if ttl < time.Second {
+		return nil, fmt.Errorf("dedup TTL %v is under 1s", ttl)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:       addr,
+		Password:   password,
+		MaxRetries: -1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	return &RedisDedupStore{
+		client: client,
+		ttl:    ttl,
+	}, nil
+}
+
+// MarkIfNew sets the key only if it doesn't exist (SET NX). Redis errors count as new
+// so an outage doesn't stop the bot from answering.
+func (s *RedisDedupStore) MarkIfNew(eventID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	set, err := s.client.SetNX(ctx, redisKeyPrefix+eventID, "1", s.ttl.Truncate(time.Second)).Result()
+	if err != nil {
+		log.Printf("Failed to mark processed event %s in redis: %v", eventID, err)
+		return true
+	}
+	return set
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis stand-in supporting the PING and SET NX commands the store uses.
+// Anything else, such as the client's HELLO handshake, gets an error reply.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	keys     map[string]bool
+	sets     int
+	// dropSetReplies applies each SET but closes the connection instead of replying
+	dropSetReplies bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{listener: listener, keys: make(map[string]bool)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "SET":
+			f.sets++
+			if f.keys[args[1]] {
+				reply = "$-1\r\n"
+			} else {
+				f.keys[args[1]] = true
+				reply = "+OK\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		drop := f.dropSetReplies && strings.EqualFold(args[0], "SET")
+		f.mu.Unlock()
+
+		if drop {
+			return
+		}
+		fmt.Fprint(conn, reply)
+	}
+}
+
+// readRedisCommand reads one RESP array of bulk strings
+func readRedisCommand(reader *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisDedupStoreMarksOnce(t *testing.T) {
+	redis := newFakeRedis(t)
+	s, err := NewRedisDedupStore(redis.listener.Addr().String(), "", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisDedupStore: %v", err)
+	}
+
+	if !s.MarkIfNew("C123_1") {
+		t.Fatal("first delivery is not new")
+	}
+	if s.MarkIfNew("C123_1") {
+		t.Error("second delivery is new")
+	}
+}
+
+func TestRedisDedupStoreDoesNotResendALostSet(t *testing.T) {
+	redis := newFakeRedis(t)
+	s, err := NewRedisDedupStore(redis.listener.Addr().String(), "", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisDedupStore: %v", err)
+	}
+
+	redis.mu.Lock()
+	redis.dropSetReplies = true
+	redis.mu.Unlock()
+
+	if !s.MarkIfNew("C123_1") {
+		t.Error("event not new after its SET reply was lost, want it answered rather than dropped")
+	}
+
+	redis.mu.Lock()
+	defer redis.mu.Unlock()
+	if redis.sets != 1 {
+		t.Errorf("server received %d SETs, want the lost one not resent", redis.sets)
+	}
+}
+
+func TestRedisDedupStoreRejectsSubSecondTTL(t *testing.T) {
+	redis := newFakeRedis(t)
+	if _, err := NewRedisDedupStore(redis.listener.Addr().String(), "", 500*time.Millisecond); err == nil {
+		t.Error("NewRedisDedupStore accepted a 500ms TTL")
+	}
+}
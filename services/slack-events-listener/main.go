@@ -7,26 +7,40 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/metrics"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/slackcreds"
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	Port                string `envconfig:"PORT" default:"8080"`
-	SlackBotToken       string `envconfig:"WAVIE_SLACK_BOT_TOKEN" required:"true"`
-	SlackSigningSecret  string `envconfig:"WAVIE_SLACK_SIGNING_SECRET" required:"true"`
-	ClaudeProxyURL      string `envconfig:"CLAUDE_PROXY_URL" required:"true"`
-	BroadcastServiceURL string `envconfig:"BROADCAST_SERVICE_URL" required:"true"`
+	Port                string        `envconfig:"PORT" default:"8080"`
+	SlackBotToken       string        `envconfig:"WAVIE_SLACK_BOT_TOKEN" required:"true"`
+	SlackSigningSecret  string        `envconfig:"WAVIE_SLACK_SIGNING_SECRET" required:"true"`
+	SlackAPIURL         string        `envconfig:"SLACK_API_URL" default:"https://slack.com/api/"`
+	ClaudeProxyURL      string        `envconfig:"CLAUDE_PROXY_URL" required:"true"`
+	BroadcastServiceURL string        `envconfig:"BROADCAST_SERVICE_URL" required:"true"`
+	DedupBackend        string        `envconfig:"DEDUP_BACKEND" default:"memory"`
+	DedupTTL            time.Duration `envconfig:"DEDUP_TTL" default:"2h"`
+	RedisAddr           string        `envconfig:"REDIS_ADDR" default:"localhost:6379"`
+	RedisPassword       string        `envconfig:"REDIS_PASSWORD"`
+	UpstreamTimeout     time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"90s"`
+	ServerReadTimeout   time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"120s"`
+	ServerWriteTimeout  time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"120s"`
+	MaxRequestBodyBytes int64         `envconfig:"MAX_REQUEST_BODY_BYTES" default:"4194304"`
 }
 
 type SlackEvent struct {
@@ -49,34 +63,51 @@ type ClaudeRequest struct {
 }
 
 type ClaudeResponse struct {
-	Response      string `json:"response"`
-	CorrelationID string `json:"correlation_id"`
-	Error         string `json:"error,omitempty"`
+	Response      string    `json:"response"`
+	CorrelationID string    `json:"correlation_id"`
+	Error         *APIError `json:"error,omitempty"`
+	SourceDocs    []string  `json:"source_docs,omitempty"`
+	// UsedDocs is nil when the proxy predates reporting it
+	UsedDocs *bool `json:"used_docs,omitempty"`
+}
+
+// noDocsFootnote is appended to answers the proxy generated without documentation
+const noDocsFootnote = "\n\n_Answered without documentation._"
+
+// APIError is the error body returned by the Claude proxy
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type BroadcastRequest struct {
-	User          string `json:"user"`
-	Channel       string `json:"channel"`
-	Question      string `json:"question"`
-	Response      string `json:"response"`
-	Timestamp     string `json:"timestamp"`
-	CorrelationID string `json:"correlation_id"`
+	User          string   `json:"user"`
+	Channel       string   `json:"channel"`
+	Question      string   `json:"question"`
+	Response      string   `json:"response"`
+	SourceDocs    []string `json:"source_docs,omitempty"`
+	Timestamp     string   `json:"timestamp"`
+	CorrelationID string   `json:"correlation_id"`
 }
 
 type SlackEventsService struct {
-	config          *Config
-	httpClient      *http.Client
-	processedEvents map[string]bool
-	mu              sync.RWMutex
+	config     *Config
+	httpClient *http.Client
+	dedup      DedupStore
+	botUserID  string
 }
 
-func NewSlackEventsService(config *Config) *SlackEventsService {
+// leadingMentionPattern matches a user mention at the start of a message, used when the
+// bot's own user ID couldn't be resolved
+var leadingMentionPattern = regexp.MustCompile(`^\s*<@U[A-Z0-9]+>`)
+
+func NewSlackEventsService(config *Config, dedup DedupStore) *SlackEventsService {
 	return &SlackEventsService{
 		config: config,
 		httpClient: &http.Client{
-			Timeout: 90 * time.Second,
+			Timeout: config.UpstreamTimeout,
 		},
-		processedEvents: make(map[string]bool),
+		dedup: dedup,
 	}
 }
 
@@ -96,28 +127,44 @@ func (s *SlackEventsService) verifySlackRequest(r *http.Request, body []byte) bo
 	return hmac.Equal([]byte(signature), []byte(expectedSignature))
 }
 
-func (s *SlackEventsService) isEventProcessed(eventID string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.processedEvents[eventID]
+// resolveBotUserID asks Slack's auth.test endpoint which user the bot token belongs to
+func (s *SlackEventsService) resolveBotUserID() (string, error) {
+	req, err := http.NewRequest("POST", s.config.SlackAPIURL+"auth.test", nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.config.SlackBotToken)
+
+	resp, err := s.httpClient.Do(req)
+	metrics.ObserveUpstream("slack", err == nil && resp.StatusCode == http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var authResp struct {
+		OK     bool   `json:"ok"`
+		Error  string `json:"error"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return "", err
+	}
+
+	if !authResp.OK {
+		return "", fmt.Errorf("slack API error: %s", authResp.Error)
+	}
+
+	return authResp.UserID, nil
 }
 
-func (s *SlackEventsService) markEventProcessed(eventID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.processedEvents[eventID] = true
-	
-	if len(s.processedEvents) > 1000 {
-		newMap := make(map[string]bool)
-		count := 0
-		for k, v := range s.processedEvents {
-			if count < 500 {
-				newMap[k] = v
-				count++
-			}
-		}
-		s.processedEvents = newMap
+// stripBotMention removes the bot's mention from the message text
+func (s *SlackEventsService) stripBotMention(text string) string {
+	if s.botUserID != "" {
+		return strings.TrimSpace(strings.ReplaceAll(text, "<@"+s.botUserID+">", ""))
 	}
+	return strings.TrimSpace(leadingMentionPattern.ReplaceAllString(text, ""))
 }
 
 func (s *SlackEventsService) generateCorrelationID() string {
@@ -137,7 +184,15 @@ func (s *SlackEventsService) sendToClaudeProxy(message, user, channel, correlati
 		return nil, err
 	}
 
-	resp, err := s.httpClient.Post(s.config.ClaudeProxyURL+"/api/chat", "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", s.config.ClaudeProxyURL+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tracing.Header, correlationID)
+
+	resp, err := s.httpClient.Do(req)
+	metrics.ObserveUpstream("claude-proxy", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
@@ -151,23 +206,34 @@ func (s *SlackEventsService) sendToClaudeProxy(message, user, channel, correlati
 	return &claudeResp, nil
 }
 
-func (s *SlackEventsService) sendToBroadcastBot(user, channel, question, response, correlationID string) {
+func (s *SlackEventsService) sendToBroadcastBot(user, channel, question, response string, sourceDocs []string, correlationID string) {
 	broadcastReq := BroadcastRequest{
 		User:          user,
 		Channel:       channel,
 		Question:      question,
 		Response:      response,
+		SourceDocs:    sourceDocs,
 		Timestamp:     time.Now().Format(time.RFC3339),
 		CorrelationID: correlationID,
 	}
 
 	jsonData, _ := json.Marshal(broadcastReq)
-	
+
 	go func() {
-		_, err := s.httpClient.Post(s.config.BroadcastServiceURL+"/api/broadcast", "application/json", bytes.NewBuffer(jsonData))
+		req, err := http.NewRequest("POST", s.config.BroadcastServiceURL+"/api/broadcast", bytes.NewBuffer(jsonData))
+		if err != nil {
+			log.Printf("Failed to build broadcast request: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(tracing.Header, correlationID)
+
+		resp, err := s.httpClient.Do(req)
 		if err != nil {
 			log.Printf("Failed to send to broadcast bot: %v", err)
+			return
 		}
+		resp.Body.Close()
 	}()
 }
 
@@ -182,7 +248,7 @@ func (s *SlackEventsService) sendSlackMessage(channel, message string) error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", s.config.SlackAPIURL+"chat.postMessage", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
@@ -191,6 +257,7 @@ func (s *SlackEventsService) sendSlackMessage(channel, message string) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
+	metrics.ObserveUpstream("slack", err == nil && resp.StatusCode == http.StatusOK)
 	if err != nil {
 		return err
 	}
@@ -220,6 +287,10 @@ func (s *SlackEventsService) handleSlackEvents(w http.ResponseWriter, r *http.Re
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		if isBodyTooLarge(err) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -243,22 +314,20 @@ func (s *SlackEventsService) handleSlackEvents(w http.ResponseWriter, r *http.Re
 
 	if event.Type == "event_callback" && event.Event.Type == "app_mention" {
 		eventID := fmt.Sprintf("%s_%s", event.Event.Channel, event.Event.Ts)
-		
-		if s.isEventProcessed(eventID) {
+
+		if !s.dedup.MarkIfNew(eventID) {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		
-		s.markEventProcessed(eventID)
 
-		message := strings.TrimSpace(strings.ReplaceAll(event.Event.Text, "<@U08VAS7SKJ8>", ""))
+		message := s.stripBotMention(event.Event.Text)
 		if message == "" {
 			message = "Hello! How can I help you?"
 		}
 
 		correlationID := s.generateCorrelationID()
-		
-		log.Printf("Processing message from user %s in channel %s: %s (ID: %s)", 
+
+		log.Printf("Processing message from user %s in channel %s: %s (ID: %s)",
 			event.Event.User, event.Event.Channel, message, correlationID)
 
 		claudeResp, err := s.sendToClaudeProxy(message, event.Event.User, event.Event.Channel, correlationID)
@@ -269,18 +338,23 @@ func (s *SlackEventsService) handleSlackEvents(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		if claudeResp.Error != "" {
-			log.Printf("Claude proxy returned error: %s", claudeResp.Error)
+		if claudeResp.Error != nil {
+			log.Printf("Claude proxy returned error %s: %s", claudeResp.Error.Code, claudeResp.Error.Message)
 			s.sendSlackMessage(event.Event.Channel, "Sorry, I encountered an error while processing your request.")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		if err := s.sendSlackMessage(event.Event.Channel, claudeResp.Response); err != nil {
+		answer := claudeResp.Response
+		if claudeResp.UsedDocs != nil && !*claudeResp.UsedDocs {
+			answer += noDocsFootnote
+		}
+
+		if err := s.sendSlackMessage(event.Event.Channel, answer); err != nil {
 			log.Printf("Error sending message to Slack: %v", err)
 		}
 
-		s.sendToBroadcastBot(event.Event.User, event.Event.Channel, message, claudeResp.Response, correlationID)
+		s.sendToBroadcastBot(event.Event.User, event.Event.Channel, message, claudeResp.Response, claudeResp.SourceDocs, correlationID)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -296,23 +370,74 @@ func (s *SlackEventsService) healthCheck(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// limitBody caps request bodies at maxBytes so an oversized POST cannot exhaust memory.
+// Reading past the limit fails with an error that isBodyTooLarge recognizes.
+func limitBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err came from reading past limitBody's limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 func main() {
 	var config Config
 	if err := envconfig.Process("", &config); err != nil {
 		log.Fatalf("Failed to process environment variables: %v", err)
 	}
 
-	service := NewSlackEventsService(&config)
+	if err := slackcreds.ValidateBotToken(config.SlackBotToken); err != nil {
+		log.Fatalf("Invalid WAVIE_SLACK_BOT_TOKEN: %v", err)
+	}
+	if err := slackcreds.ValidateSigningSecret(config.SlackSigningSecret); err != nil {
+		log.Fatalf("Invalid WAVIE_SLACK_SIGNING_SECRET: %v", err)
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"UPSTREAM_TIMEOUT":     config.UpstreamTimeout,
+		"SERVER_READ_TIMEOUT":  config.ServerReadTimeout,
+		"SERVER_WRITE_TIMEOUT": config.ServerWriteTimeout,
+	} {
+		if timeout <= 0 {
+			log.Fatalf("%s must be a positive duration, got %v", name, timeout)
+		}
+	}
+	if config.MaxRequestBodyBytes <= 0 {
+		log.Fatalf("MAX_REQUEST_BODY_BYTES must be positive, got %d", config.MaxRequestBodyBytes)
+	}
+
+	dedup, err := NewDedupStore(&config)
+	if err != nil {
+		log.Fatalf("Failed to create dedup store: %v", err)
+	}
+
+	service := NewSlackEventsService(&config, dedup)
+
+	botUserID, err := service.resolveBotUserID()
+	if err != nil {
+		log.Printf("Warning: Failed to resolve bot user ID, stripping any leading mention instead: %v", err)
+	} else {
+		service.botUserID = botUserID
+		log.Printf("Resolved bot user ID: %s", botUserID)
+	}
+
+	metrics.SetService("slack-events-listener")
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", service.healthCheck)
-	mux.HandleFunc("/slack/events", service.handleSlackEvents)
+	mux.Handle("/health", metrics.Instrument("/health", http.HandlerFunc(service.healthCheck)))
+	mux.Handle("/slack/events", metrics.Instrument("/slack/events", http.HandlerFunc(service.handleSlackEvents)))
+	mux.Handle("/metrics", metrics.Handler())
 
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
-		ReadTimeout:  120 * time.Second,
-		WriteTimeout: 120 * time.Second,
+		Handler:      tracing.Middleware(limitBody(mux, config.MaxRequestBodyBytes), slog.Default()),
+		ReadTimeout:  config.ServerReadTimeout,
+		WriteTimeout: config.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -330,4 +455,4 @@ func main() {
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BitwaveCorp/shared-svcs/shared/utils/tracing"
+)
+
+// newTestService returns a service whose Slack calls go to a fake answering auth.test
+// with authResponse
+func newTestService(t *testing.T, authResponse string) *SlackEventsService {
+	t.Helper()
+
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth.test" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, authResponse)
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	config := &Config{
+		SlackBotToken:   "xoxb-test",
+		SlackAPIURL:     slackAPI.URL + "/",
+		UpstreamTimeout: 5 * time.Second,
+	}
+	return NewSlackEventsService(config, NewMemoryDedupStore(time.Hour))
+}
+
+func TestResolvedBotUserIDIsStripped(t *testing.T) {
+	s := newTestService(t, `{"ok":true,"user_id":"U0RANDOM42"}`)
+
+	botUserID, err := s.resolveBotUserID()
+	if err != nil {
+		t.Fatalf("resolveBotUserID: %v", err)
+	}
+	if botUserID != "U0RANDOM42" {
+		t.Fatalf("resolveBotUserID() = %q, want U0RANDOM42", botUserID)
+	}
+	s.botUserID = botUserID
+
+	got := s.stripBotMention("<@U0RANDOM42> how do I ask <@UOTHER1> for access?")
+	if want := "how do I ask <@UOTHER1> for access?"; got != want {
+		t.Errorf("stripBotMention() = %q, want %q", got, want)
+	}
+}
+
+func TestUnresolvedBotUserIDStripsLeadingMention(t *testing.T) {
+	s := newTestService(t, `{"ok":false,"error":"invalid_auth"}`)
+
+	if _, err := s.resolveBotUserID(); err == nil {
+		t.Fatal("resolveBotUserID() succeeded, want the invalid_auth error")
+	}
+
+	got := s.stripBotMention("  <@UANYBOT7> how do I ask <@UOTHER1> for access?")
+	if want := "how do I ask <@UOTHER1> for access?"; got != want {
+		t.Errorf("stripBotMention() = %q, want %q", got, want)
+	}
+}
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// fakeDedupStore is a DedupStore recording the events marked through it
+type fakeDedupStore struct {
+	mutex  sync.Mutex
+	marked map[string]bool
+}
+
+func (d *fakeDedupStore) MarkIfNew(eventID string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.marked[eventID] {
+		return false
+	}
+	d.marked[eventID] = true
+	return true
+}
+
+// newEventService returns a service using dedup whose Claude proxy, Slack and broadcast
+// calls go to fakes, and a count of the questions sent to the Claude proxy
+func newEventService(t *testing.T, dedup DedupStore) (*SlackEventsService, *atomic.Int32) {
+	t.Helper()
+
+	questions := &atomic.Int32{}
+	upstreams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/chat" {
+			questions.Add(1)
+			fmt.Fprint(w, `{"response":"Go to Connections.","correlation_id":"corr_1"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	t.Cleanup(upstreams.Close)
+
+	config := &Config{
+		SlackBotToken:       "xoxb-test",
+		SlackSigningSecret:  testSigningSecret,
+		SlackAPIURL:         upstreams.URL + "/",
+		ClaudeProxyURL:      upstreams.URL,
+		BroadcastServiceURL: upstreams.URL,
+		UpstreamTimeout:     5 * time.Second,
+	}
+	return NewSlackEventsService(config, dedup), questions
+}
+
+// signedMention builds a signed app_mention event posted at ts in channel C123
+func signedMention(t *testing.T, ts string) *http.Request {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"type":"event_callback","event":{"type":"app_mention","user":"UASKER","text":"<@UWAVIE> How do I connect a wallet?","channel":"C123","ts":%q}}`, ts)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	req := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestEventsAreDeduplicatedThroughTheStore(t *testing.T) {
+	store := &fakeDedupStore{marked: map[string]bool{"C123_1700000000.000100": true}}
+	s, questions := newEventService(t, store)
+
+	s.handleSlackEvents(httptest.NewRecorder(), signedMention(t, "1700000000.000100"))
+	if got := questions.Load(); got != 0 {
+		t.Fatalf("sent %d questions for an event the store has seen, want 0", got)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleSlackEvents(rec, signedMention(t, "1700000000.000200"))
+	if rec.Code != http.StatusOK || questions.Load() != 1 {
+		t.Errorf("got %d after %d questions, want a new event answered once", rec.Code, questions.Load())
+	}
+	if store.MarkIfNew("C123_1700000000.000200") {
+		t.Error("new event was not marked in the store")
+	}
+}
+
+func TestSlackRetriesAreAnsweredOnce(t *testing.T) {
+	s, questions := newEventService(t, NewMemoryDedupStore(time.Hour))
+
+	for retry := 0; retry < 3; retry++ {
+		req := signedMention(t, "1700000000.000100")
+		if retry > 0 {
+			req.Header.Set("X-Slack-Retry-Num", strconv.Itoa(retry))
+			req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+		}
+		rec := httptest.NewRecorder()
+		s.handleSlackEvents(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("delivery %d got %d, want 200", retry, rec.Code)
+		}
+	}
+
+	if got := questions.Load(); got != 1 {
+		t.Errorf("sent %d questions for one event delivered three times, want 1", got)
+	}
+}
+
+func TestCorrelationIDHeaderReachesClaudeProxyAndBroadcastBot(t *testing.T) {
+	type call struct{ header, body string }
+	calls := make(chan call, 2)
+	upstreams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			CorrelationID string `json:"correlation_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/api/chat":
+			calls <- call{r.Header.Get(tracing.Header), body.CorrelationID}
+			fmt.Fprint(w, `{"response":"Go to Connections."}`)
+		case "/api/broadcast":
+			calls <- call{r.Header.Get(tracing.Header), body.CorrelationID}
+			fmt.Fprint(w, `{"status":"success"}`)
+		default:
+			fmt.Fprint(w, `{"ok":true}`)
+		}
+	}))
+	t.Cleanup(upstreams.Close)
+
+	s := NewSlackEventsService(&Config{
+		SlackBotToken:       "xoxb-test",
+		SlackSigningSecret:  testSigningSecret,
+		SlackAPIURL:         upstreams.URL + "/",
+		ClaudeProxyURL:      upstreams.URL,
+		BroadcastServiceURL: upstreams.URL,
+		UpstreamTimeout:     5 * time.Second,
+	}, NewMemoryDedupStore(time.Hour))
+
+	s.handleSlackEvents(httptest.NewRecorder(), signedMention(t, "1700000000.000100"))
+
+	for _, hop := range []string{"Claude proxy", "broadcast bot"} {
+		select {
+		case got := <-calls:
+			if got.header == "" || got.header != got.body {
+				t.Errorf("%s got %s %q for correlation_id %q, want them equal", hop, tracing.Header, got.header, got.body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was never called", hop)
+		}
+	}
+}
+
+func TestOversizedEventIsRejected(t *testing.T) {
+	s, questions := newEventService(t, NewMemoryDedupStore(time.Hour))
+	handler := limitBody(http.HandlerFunc(s.handleSlackEvents), 64)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedMention(t, "1700000000.000100"))
+	if rec.Code != http.StatusRequestEntityTooLarge || questions.Load() != 0 {
+		t.Errorf("got %d after %d questions for an event over a 64 byte limit, want 413 and none", rec.Code, questions.Load())
+	}
+}
+
+func TestRejectedEventCarriesRequestID(t *testing.T) {
+	s, _ := newEventService(t, NewMemoryDedupStore(time.Hour))
+	handler := tracing.Middleware(limitBody(http.HandlerFunc(s.handleSlackEvents), 64), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedMention(t, "1700000000.000100"))
+	if rec.Code != http.StatusRequestEntityTooLarge || rec.Header().Get(tracing.RequestIDHeader) == "" {
+		t.Errorf("got %d with %s %q, want a 413 still carrying a request ID", rec.Code, tracing.RequestIDHeader, rec.Header().Get(tracing.RequestIDHeader))
+	}
+}
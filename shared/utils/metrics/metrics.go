@@ -0,0 +1,105 @@
+// Package metrics exposes request latency and upstream call counts for Prometheus, with
+// every series labelled by the service that recorded it so one dashboard covers them all.
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcome labels
+const (
+	OutcomeSuccess     = "success"
+	OutcomeError       = "error"
+	OutcomeClientError = "client_error"
+	OutcomeServerError = "server_error"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds; LLM calls can take a minute
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	// registry holds only this package's metrics, so /metrics exposes nothing else
+	registry = prometheus.NewRegistry()
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wavie_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests.",
+		Buckets: latencyBuckets,
+	}, []string{"service", "handler", "outcome"})
+
+	upstream = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wavie_upstream_requests_total",
+		Help: "Calls to upstream APIs by outcome.",
+	}, []string{"service", "upstream", "outcome"})
+
+	service atomic.Pointer[string]
+)
+
+func init() {
+	registry.MustRegister(latency, upstream)
+	SetService("unknown")
+}
+
+// SetService sets the service label attached to every metric; call it once from main
+// before serving
+func SetService(name string) {
+	service.Store(&name)
+}
+
+// Instrument records the latency and outcome of every request served by next under the
+// given handler label
+func Instrument(handler string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		observeRequest(handler, recorder.status, time.Since(start))
+	})
+}
+
+// ObserveUpstream counts one call to an upstream API such as "slack" or "openai"
+func ObserveUpstream(name string, success bool) {
+	outcome := OutcomeSuccess
+	if !success {
+		outcome = OutcomeError
+	}
+	upstream.WithLabelValues(*service.Load(), name, outcome).Inc()
+}
+
+func observeRequest(handler string, status int, elapsed time.Duration) {
+	outcome := OutcomeSuccess
+	switch {
+	case status >= 500:
+		outcome = OutcomeServerError
+	case status >= 400:
+		outcome = OutcomeClientError
+	}
+	latency.WithLabelValues(*service.Load(), handler, outcome).Observe(elapsed.Seconds())
+}
+
+// Handler serves the current metrics for Prometheus to scrape
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// statusRecorder captures the response status, passing flushes through for streaming
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsCarryTheServiceLabel(t *testing.T) {
+	SetService("test-svc")
+	t.Cleanup(func() { SetService("unknown") })
+
+	handler := Instrument("/api/chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/chat", nil))
+	ObserveUpstream("slack", false)
+
+	body := scrape(t)
+	for _, want := range []string{
+		`wavie_http_request_duration_seconds_count{handler="/api/chat",outcome="server_error",service="test-svc"} 1`,
+		`wavie_upstream_requests_total{outcome="error",service="test-svc",upstream="slack"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape is missing %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestInstrumentPassesFlushesThrough(t *testing.T) {
+	flushed := false
+	handler := Instrument("/api/chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flushed = w.(http.Flusher)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/chat", nil))
+
+	if !flushed {
+		t.Error("instrumented handler can't flush, which would break streamed answers")
+	}
+}
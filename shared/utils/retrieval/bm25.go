@@ -0,0 +1,27 @@
+package retrieval
+
+import "math"
+
+// BM25 parameters: k1 controls how quickly repeated terms stop adding to a chunk's
+// score, b how strongly scores are normalized by chunk length
+const (
+	bm25K1 = 1.5
+	bm25B  = 0.75
+)
+
+// IDF is the inverse document frequency of a term found in docFreq of chunkCount chunks
+func IDF(chunkCount, docFreq int) float64 {
+	n, df := float64(chunkCount), float64(docFreq)
+	return math.Log((n-df+0.5)/(df+0.5) + 1)
+}
+
+// BM25 scores a term occurring termFreq times in a chunk of chunkLength keywords, where
+// chunks average avgChunkLength keywords and the term's inverse document frequency is idf
+func BM25(termFreq, chunkLength int, avgChunkLength, idf float64) float64 {
+	tf := float64(termFreq)
+	lengthRatio := 1.0
+	if avgChunkLength > 0 {
+		lengthRatio = float64(chunkLength) / avgChunkLength
+	}
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*lengthRatio))
+}
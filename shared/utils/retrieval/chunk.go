@@ -0,0 +1,125 @@
+// Package retrieval holds the document chunking and BM25 scoring shared by the OpenAI
+// and Claude proxies, which build their own indexes on top of it.
+package retrieval
+
+import "strings"
+
+// SplitSections starts a new section at each Markdown heading. Lines inside fenced code
+// blocks never start a section, so "# comment" lines in shell examples stay put.
+func SplitSections(content string) []string {
+	sections := make([]string, 0)
+	var current strings.Builder
+	inFence := false
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		} else if !inFence && strings.HasPrefix(trimmed, "#") && current.Len() > 0 {
+			sections = append(sections, current.String())
+			current.Reset()
+		}
+		current.WriteString(line + "\n")
+	}
+
+	if current.Len() > 0 {
+		sections = append(sections, current.String())
+	}
+
+	return sections
+}
+
+// SplitCodeFences breaks text into words, except that each fenced code block (opening
+// fence through closing fence, or the end of the text if unclosed) is a single unit
+func SplitCodeFences(text string) []string {
+	units := make([]string, 0)
+	var fence []string
+
+	for _, line := range strings.Split(text, "\n") {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		if fence != nil {
+			fence = append(fence, line)
+			if isFence {
+				units = append(units, strings.Join(fence, "\n"))
+				fence = nil
+			}
+			continue
+		}
+		if isFence {
+			fence = []string{line}
+			continue
+		}
+		units = append(units, strings.Fields(line)...)
+	}
+	if fence != nil {
+		units = append(units, strings.Join(fence, "\n"))
+	}
+
+	return units
+}
+
+// PackUnits packs units, such as those from SplitCodeFences, into chunks of roughly
+// chunkSize characters. A unit is never split, so a code block larger than chunkSize
+// gets a chunk of its own. Each chunk after the first starts with up to overlap
+// characters of whole units from the end of the previous one, so sentences at a
+// boundary keep their context.
+func PackUnits(units []string, chunkSize, overlap int) []string {
+	chunks := make([]string, 0)
+	current := make([]string, 0)
+	currentLen := 0
+
+	for _, unit := range units {
+		if currentLen+len(unit)+1 > chunkSize && len(current) > 0 {
+			chunks = append(chunks, JoinUnits(current))
+			current = overlapTail(current, len(unit), chunkSize, overlap)
+			currentLen = len(JoinUnits(current))
+		}
+		if len(current) > 0 {
+			currentLen++
+		}
+		current = append(current, unit)
+		currentLen += len(unit)
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, JoinUnits(current))
+	}
+
+	return chunks
+}
+
+// overlapTail returns the trailing units that fit in overlap characters, stopping at a
+// code block. It returns nothing if carrying them over would leave no room for the next
+// unit.
+func overlapTail(units []string, nextLen, chunkSize, overlap int) []string {
+	start := len(units)
+	length := 0
+	for i := len(units) - 1; i >= 0; i-- {
+		if strings.HasPrefix(units[i], "```") || length+len(units[i])+1 > overlap {
+			break
+		}
+		length += len(units[i]) + 1
+		start = i
+	}
+
+	if start == len(units) || length+nextLen > chunkSize {
+		return make([]string, 0)
+	}
+	return append([]string(nil), units[start:]...)
+}
+
+// JoinUnits joins words with spaces and puts code blocks on their own lines
+func JoinUnits(units []string) string {
+	var chunk strings.Builder
+	for i, unit := range units {
+		if i > 0 {
+			if strings.HasPrefix(unit, "```") || strings.HasPrefix(units[i-1], "```") {
+				chunk.WriteString("\n")
+			} else {
+				chunk.WriteString(" ")
+			}
+		}
+		chunk.WriteString(unit)
+	}
+	return chunk.String()
+}
@@ -0,0 +1,67 @@
+package retrieval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSectionsIgnoresHeadingsInCodeFences(t *testing.T) {
+	content := "# Install\nRun this:\n```sh\n# not a heading\nmake\n```\n## Usage\nCall it."
+
+	sections := SplitSections(content)
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2: %q", len(sections), sections)
+	}
+	if !strings.Contains(sections[0], "# not a heading") {
+		t.Errorf("first section %q lost the fenced comment", sections[0])
+	}
+}
+
+func TestSplitCodeFencesKeepsBlocksWhole(t *testing.T) {
+	units := SplitCodeFences("run this\n```go\nfmt.Println(1)\n```\nthen stop")
+
+	want := []string{"run", "this", "```go\nfmt.Println(1)\n```", "then", "stop"}
+	if strings.Join(units, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", units, want)
+	}
+}
+
+func TestPackUnitsOverlapsChunks(t *testing.T) {
+	units := strings.Fields(strings.Repeat("word ", 40))
+
+	chunks := PackUnits(units, 50, 10)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > 50 {
+			t.Errorf("chunk %d is %d characters, want at most 50", i, len(chunk))
+		}
+		if i > 0 && !strings.HasPrefix(chunk, "word word ") {
+			t.Errorf("chunk %d = %q, want it to repeat the end of the previous one", i, chunk)
+		}
+	}
+}
+
+func TestPackUnitsDoesNotOverlapCodeBlocks(t *testing.T) {
+	block := "```\n" + strings.Repeat("x", 30) + "\n```"
+
+	chunks := PackUnits([]string{"intro", block, "outro"}, 40, 50)
+	want := []string{"intro", block, "outro"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want the code block in a chunk of its own and not repeated", chunks)
+	}
+}
+
+func TestBM25FavorsFrequentTermsInShortChunks(t *testing.T) {
+	idf := IDF(10, 2)
+	if idf <= 0 {
+		t.Fatalf("IDF(10, 2) = %v, want it positive", idf)
+	}
+	if BM25(3, 10, 10, idf) <= BM25(1, 10, 10, idf) {
+		t.Error("more occurrences did not score higher")
+	}
+	if BM25(1, 5, 10, idf) <= BM25(1, 20, 10, idf) {
+		t.Error("a shorter chunk did not score higher for the same count")
+	}
+}
@@ -0,0 +1,58 @@
+package retrieval
+
+import "strings"
+
+// stemSuffixes are derivational endings removed by Stem, longest first. A replacement
+// keeps the stem aligned with the base word, e.g. "creation" -> "create" -> "creat".
+var stemSuffixes = []struct {
+	suffix      string
+	replacement string
+}{
+	{"ization", "ize"},
+	{"isation", "ise"},
+	{"iation", ""},
+	{"ation", "ate"},
+	{"ition", ""},
+	{"ness", ""},
+	{"ing", ""},
+	{"ion", ""},
+	{"ed", ""},
+}
+
+// Stem reduces a lower-case word to an index key so morphological variants match, e.g.
+// "reconcile", "reconciling", "reconciled" and "reconciliation" all become "reconcil".
+// It is a lightweight Porter-style stemmer: plurals first, then one derivational
+// suffix, then doubled consonants and a silent trailing "e". Stems are only keys and
+// are never shown to users.
+func Stem(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "s") && len(word) > 3 &&
+		!strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = strings.TrimSuffix(word, "s")
+	}
+
+	for _, s := range stemSuffixes {
+		if !strings.HasSuffix(word, s.suffix) {
+			continue
+		}
+		// Only strip when a real stem is left, so "bring" and "need" stay intact
+		base := strings.TrimSuffix(word, s.suffix)
+		if len(base) >= 3 && strings.ContainsAny(base, "aeiouy") {
+			word = base + s.replacement
+		}
+		break
+	}
+
+	if n := len(word); n > 3 && word[n-1] == word[n-2] && !strings.ContainsRune("aeioulsz", rune(word[n-1])) {
+		word = word[:n-1]
+	}
+	if len(word) > 3 && strings.HasSuffix(word, "e") {
+		word = strings.TrimSuffix(word, "e")
+	}
+
+	return word
+}
@@ -0,0 +1,32 @@
+package retrieval
+
+import "testing"
+
+func TestStemCollapsesVariants(t *testing.T) {
+	groups := [][]string{
+		{"invoice", "invoices", "invoiced", "invoicing"},
+		{"reconcile", "reconciles", "reconciled", "reconciling", "reconciliation"},
+		{"account", "accounts", "accounted", "accounting"},
+		{"policy", "policies"},
+		{"process", "processes", "processed", "processing"},
+		{"create", "creates", "created", "creating", "creation"},
+		{"stop", "stops", "stopped", "stopping"},
+		{"organize", "organized", "organization"},
+	}
+	for _, group := range groups {
+		want := Stem(group[0])
+		for _, word := range group[1:] {
+			if got := Stem(word); got != want {
+				t.Errorf("Stem(%q) = %q, want %q like Stem(%q)", word, got, want, group[0])
+			}
+		}
+	}
+}
+
+func TestStemLeavesShortAndIrregularWordsIntact(t *testing.T) {
+	for _, word := range []string{"bring", "need", "status", "analysis", "class"} {
+		if got := Stem(word); got != word {
+			t.Errorf("Stem(%q) = %q, want it unchanged", word, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package slackcreds sanity-checks Slack credentials and IDs from configuration, so every
+// service rejects a missing or mistyped value at startup the same way.
+package slackcreds
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minSigningSecretLength is the length of the signing secrets Slack issues
+const minSigningSecretLength = 32
+
+// ValidateBotToken checks that token looks like a Slack bot token, so a missing or
+// mistyped credential fails at startup instead of on the first API call
+func ValidateBotToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("bot token is empty")
+	}
+	if !strings.HasPrefix(token, "xoxb-") {
+		return fmt.Errorf("bot token must start with \"xoxb-\"")
+	}
+	return nil
+}
+
+// ValidateChannelID checks that id looks like a public channel (C), private channel (G)
+// or direct message (D) ID
+func ValidateChannelID(id string) error {
+	if id == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+	if !strings.ContainsAny(id[:1], "CGD") {
+		return fmt.Errorf("channel ID %q must start with C, G or D", id)
+	}
+	return nil
+}
+
+// ValidateSigningSecret checks that secret is set and long enough to be a Slack signing
+// secret rather than a placeholder
+func ValidateSigningSecret(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("signing secret is empty")
+	}
+	if len(secret) < minSigningSecretLength {
+		return fmt.Errorf("signing secret is %d characters, expected at least %d", len(secret), minSigningSecretLength)
+	}
+	return nil
+}
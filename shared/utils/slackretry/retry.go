@@ -0,0 +1,66 @@
+// Package slackretry decides when and how long to wait before retrying a Slack Web API
+// call, so every service backs off from Slack the same way.
+package slackretry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy says how often a Slack call is retried and how long to wait between attempts.
+// Waits follow Slack's Retry-After header when it sends one and otherwise back off
+// exponentially from BaseDelay up to MaxDelay.
+type Policy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultPolicy retries a rate limited or 5xx call up to 3 times
+var DefaultPolicy = Policy{
+	MaxRetries: 3,
+	BaseDelay:  1 * time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// Delay returns how long to wait before retry number attempt (from 0), given the delay
+// Slack requested, if any
+func (p Policy) Delay(attempt int, requested time.Duration) time.Duration {
+	if requested > 0 {
+		return requested
+	}
+	delay := p.BaseDelay << attempt
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// RetryableStatus reports whether an HTTP status is worth retrying
+func RetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// RetryAfter parses a Retry-After header given in seconds, returning 0 if absent
+func RetryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Sleep waits for d, returning early with the context's error if it is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
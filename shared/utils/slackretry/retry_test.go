@@ -0,0 +1,72 @@
+package slackretry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		attempt   int
+		requested time.Duration
+		want      time.Duration
+	}{
+		{0, 0, 1 * time.Second},
+		{1, 0, 2 * time.Second},
+		{3, 0, 8 * time.Second},
+		{10, 0, 30 * time.Second},             // capped
+		{0, 5 * time.Second, 5 * time.Second}, // Retry-After wins
+	}
+
+	for _, tt := range tests {
+		if got := DefaultPolicy.Delay(tt.attempt, tt.requested); got != tt.want {
+			t.Errorf("Delay(%d, %v) = %v, want %v", tt.attempt, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusBadRequest:          false,
+		http.StatusForbidden:           false,
+	} {
+		if got := RetryableStatus(status); got != want {
+			t.Errorf("RetryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":      0,
+		"7":     7 * time.Second,
+		"-1":    0,
+		"later": 0,
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if header != "" {
+			resp.Header.Set("Retry-After", header)
+		}
+		if got := RetryAfter(resp); got != want {
+			t.Errorf("RetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestSleepStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := Sleep(ctx, time.Minute); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slept %v after the context ended", elapsed)
+	}
+}
@@ -0,0 +1,101 @@
+// Package tokenlimit keeps requests to chat models within their context windows. It
+// knows nothing about providers, so the OpenAI and Claude proxies share it.
+package tokenlimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultContextWindow is used for models that have no configured window
+const DefaultContextWindow = 8192
+
+// defaultContextWindows holds the known context windows (in tokens) per model. Names
+// match as prefixes, so "claude" covers Claude models not listed individually.
+var defaultContextWindows = map[string]int{
+	"gpt-4":             8192,
+	"gpt-4-32k":         32768,
+	"gpt-4-turbo":       128000,
+	"gpt-4o":            128000,
+	"gpt-4o-mini":       128000,
+	"gpt-3.5-turbo":     16385,
+	"claude-3-haiku":    200000,
+	"claude-3-sonnet":   200000,
+	"claude-3-opus":     200000,
+	"claude-3-5-sonnet": 200000,
+	"claude":            200000,
+}
+
+// Guard keeps model input plus requested output within the model's context window
+type Guard struct {
+	windows map[string]int
+}
+
+// NewGuard creates a guard using the built-in windows, with overrides taking precedence
+func NewGuard(overrides map[string]int) *Guard {
+	windows := make(map[string]int, len(defaultContextWindows)+len(overrides))
+	for model, window := range defaultContextWindows {
+		windows[model] = window
+	}
+	for model, window := range overrides {
+		windows[model] = window
+	}
+	return &Guard{windows: windows}
+}
+
+// ParseWindows parses a "model:tokens,model:tokens" list into a window map
+func ParseWindows(spec string) (map[string]int, error) {
+	windows := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		idx := strings.LastIndex(entry, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid context window entry %q, expected model:tokens", entry)
+		}
+
+		tokens, err := strconv.Atoi(strings.TrimSpace(entry[idx+1:]))
+		if err != nil || tokens <= 0 {
+			return nil, fmt.Errorf("invalid token count in context window entry %q", entry)
+		}
+		windows[strings.TrimSpace(entry[:idx])] = tokens
+	}
+	return windows, nil
+}
+
+// ContextWindow returns the context window for a model. Dated model names such as
+// "gpt-4-0613" resolve to the longest configured prefix.
+func (g *Guard) ContextWindow(model string) int {
+	if window, ok := g.windows[model]; ok {
+		return window
+	}
+
+	best, window := "", DefaultContextWindow
+	for name, w := range g.windows {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best, window = name, w
+		}
+	}
+	return window
+}
+
+// InputBudget returns how many tokens of input fit alongside maxOutput tokens of output
+func (g *Guard) InputBudget(model string, maxOutput int) int {
+	return g.ContextWindow(model) - maxOutput
+}
+
+// EstimateTokens approximates the token count of text using the ~4 characters per
+// token rule of thumb. It deliberately errs on the high side.
+func EstimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// EstimateMessageTokens approximates the tokens used by a chat message, including
+// the per-message overhead that providers add for role and framing
+func EstimateMessageTokens(role, content string) int {
+	return EstimateTokens(role) + EstimateTokens(content) + 4
+}
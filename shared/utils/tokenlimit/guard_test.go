@@ -0,0 +1,48 @@
+package tokenlimit
+
+import "testing"
+
+func TestContextWindow(t *testing.T) {
+	guard := NewGuard(map[string]int{"gpt-4": 16000, "my-model": 32000})
+
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4", 16000},                     // overridden
+		{"gpt-4-0613", 16000},                // dated name resolves to its family
+		{"gpt-4-turbo-2024-04-09", 128000},   // longest prefix wins
+		{"claude-3-haiku-20240307", 200000},  // built-in
+		{"claude-sonnet-4-20250514", 200000}, // unlisted Claude model
+		{"my-model", 32000},                  // added by override
+		{"unknown-model", DefaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := guard.ContextWindow(tt.model); got != tt.want {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestInputBudget(t *testing.T) {
+	guard := NewGuard(nil)
+	if got := guard.InputBudget("gpt-4", 1000); got != 8192-1000 {
+		t.Errorf("InputBudget(gpt-4, 1000) = %d, want %d", got, 8192-1000)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	windows, err := ParseWindows(" gpt-4:8192, ft:gpt-4o:org:custom:64000 ,")
+	if err != nil {
+		t.Fatalf("ParseWindows: %v", err)
+	}
+	if windows["gpt-4"] != 8192 || windows["ft:gpt-4o:org:custom"] != 64000 || len(windows) != 2 {
+		t.Errorf("ParseWindows = %v", windows)
+	}
+
+	for _, spec := range []string{"gpt-4", ":8192", "gpt-4:lots", "gpt-4:0"} {
+		if _, err := ParseWindows(spec); err == nil {
+			t.Errorf("ParseWindows(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package tracing propagates a correlation ID across services in the X-Correlation-ID
+// header so one request can be followed from the listener through the proxy to the
+// broadcaster in aggregated logs, and so callers can quote it when reporting a problem.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Header carries the correlation ID between services
+const Header = "X-Correlation-ID"
+
+// RequestIDHeader returns the same ID to callers that predate X-Correlation-ID, and is
+// accepted in its place when a caller sends only that
+const RequestIDHeader = "X-Request-ID"
+
+type correlationIDKey struct{}
+
+// NewContext returns a copy of ctx carrying correlationID
+func NewContext(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// FromContext returns the correlation ID stored in ctx, if any
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// Middleware reads the caller's X-Correlation-ID (or X-Request-ID), generating one if
+// absent, stores it in the request context, echoes it on the response in both headers
+// and logs each request with it
+func Middleware(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(Header)
+		if correlationID == "" {
+			correlationID = r.Header.Get(RequestIDHeader)
+		}
+		if correlationID == "" {
+			correlationID = generateCorrelationID()
+		}
+
+		w.Header().Set(Header, correlationID)
+		w.Header().Set(RequestIDHeader, correlationID)
+		ctx := NewContext(r.Context(), correlationID)
+
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		logger.InfoContext(ctx, "Handled request",
+			"correlation_id", correlationID,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+// SetHeader copies the correlation ID in req's context, if any, onto its headers
+func SetHeader(req *http.Request) {
+	if id := FromContext(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// NewLogHandler wraps next so records logged with a context carrying a correlation ID
+// get a correlation_id attribute, unless the call already set one
+func NewLogHandler(next slog.Handler) slog.Handler {
+	return logHandler{next}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (h logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := FromContext(ctx); id != "" && !hasAttr(record, "correlation_id") {
+		record.AddAttrs(slog.String("correlation_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{h.Handler.WithGroup(name)}
+}
+
+func hasAttr(record slog.Record, key string) bool {
+	found := false
+	record.Attrs(func(attr slog.Attr) bool {
+		found = attr.Key == key
+		return !found
+	})
+	return found
+}
+
+func generateCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "corr_" + time.Now().Format("20060102150405.000000000")
+	}
+	return "corr_" + hex.EncodeToString(b)
+}
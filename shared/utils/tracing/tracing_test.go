@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(req *http.Request) (*httptest.ResponseRecorder, string) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestMiddlewareGeneratesID(t *testing.T) {
+	rec, seen := serve(httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	got := rec.Header().Get(Header)
+	if !strings.HasPrefix(got, "corr_") {
+		t.Fatalf("%s = %q, want a generated corr_ ID", Header, got)
+	}
+	if seen != got {
+		t.Errorf("handler saw correlation ID %q, response carries %q", seen, got)
+	}
+	if requestID := rec.Header().Get(RequestIDHeader); requestID != got {
+		t.Errorf("%s = %q, want the correlation ID %q", RequestIDHeader, requestID, got)
+	}
+}
+
+func TestMiddlewarePropagatesCallerID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	req.Header.Set(Header, "wavie_from_caller")
+
+	rec, seen := serve(req)
+
+	if got := rec.Header().Get(Header); got != "wavie_from_caller" {
+		t.Errorf("%s = %q, want the caller's ID echoed", Header, got)
+	}
+	if seen != "wavie_from_caller" {
+		t.Errorf("handler saw correlation ID %q, want the caller's", seen)
+	}
+}
+
+func TestMiddlewareAcceptsCallerRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	req.Header.Set(RequestIDHeader, "req_from_caller")
+
+	rec, seen := serve(req)
+
+	if seen != "req_from_caller" {
+		t.Errorf("handler saw correlation ID %q, want the caller's request ID", seen)
+	}
+	for _, header := range []string{Header, RequestIDHeader} {
+		if got := rec.Header().Get(header); got != "req_from_caller" {
+			t.Errorf("%s = %q, want the caller's request ID echoed", header, got)
+		}
+	}
+}
+
+func TestMiddlewarePrefersCorrelationIDOverRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	req.Header.Set(Header, "wavie_1")
+	req.Header.Set(RequestIDHeader, "req_1")
+
+	rec, seen := serve(req)
+
+	if seen != "wavie_1" || rec.Header().Get(RequestIDHeader) != "wavie_1" {
+		t.Errorf("handler saw %q and %s = %q, want wavie_1 for both", seen, RequestIDHeader, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestMiddlewareSetsHeaderOnErrors(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for _, header := range []string{Header, RequestIDHeader} {
+		if rec.Code != http.StatusInternalServerError || rec.Header().Get(header) == "" {
+			t.Errorf("got %d with %s %q, want a 500 still carrying an ID", rec.Code, header, rec.Header().Get(header))
+		}
+	}
+}
+
+func TestSetHeaderCopiesIDFromContext(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/broadcast", nil)
+	SetHeader(req)
+	if got := req.Header.Get(Header); got != "" {
+		t.Errorf("%s = %q without a correlation ID in context, want it unset", Header, got)
+	}
+
+	req = req.WithContext(NewContext(req.Context(), "wavie_1"))
+	SetHeader(req)
+	if got := req.Header.Get(Header); got != "wavie_1" {
+		t.Errorf("%s = %q, want the ID from the context", Header, got)
+	}
+}
+
+func TestLogHandlerAddsCorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	logger.InfoContext(NewContext(context.Background(), "wavie_1"), "traced")
+	logger.InfoContext(NewContext(context.Background(), "wavie_1"), "explicit", "correlation_id", "wavie_2")
+	logger.Info("untraced")
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if got := records[0]["correlation_id"]; got != "wavie_1" {
+		t.Errorf("traced record correlation_id = %v, want wavie_1", got)
+	}
+	if got := records[1]["correlation_id"]; got != "wavie_2" || strings.Count(buf.String(), "wavie_2") != 1 {
+		t.Errorf("explicit record correlation_id = %v, want the caller's wavie_2 only", got)
+	}
+	if _, ok := records[2]["correlation_id"]; ok {
+		t.Errorf("untraced record carries a correlation_id: %v", records[2])
+	}
+}